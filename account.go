@@ -0,0 +1,54 @@
+package app
+
+import "time"
+
+// What happens to a user's articles when their account is deleted.
+const (
+	ArticlesDelete    = "delete"
+	ArticlesAnonymise = "anonymise" // kept without an author
+	ArticlesTransfer  = "transfer"  // given to another user
+)
+
+// AccountDeletion is a pending account deletion. Until DeleteAfter passes
+// the user can still cancel it.
+type AccountDeletion struct {
+	UserId      uint32    `json:"-"`
+	Articles    string    `json:"articles"`
+	TransferTo  string    `json:"transfer_to,omitempty"` // username, with ArticlesTransfer
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// Data export states.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background.
+type DataExport struct {
+	ID          uint32     `json:"id"`
+	UserId      uint32     `json:"-"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+type AccountService interface {
+	// ScheduleDeletion deletes the account once the grace period is over.
+	// Accounts without a password, e.g. signed up through OIDC, ignore it.
+	ScheduleDeletion(d *AccountDeletion, password string) error
+	CancelDeletion(userId uint32) error
+	// PurgeDeleted deletes accounts whose grace period is over, and expired
+	// exports, returning how many accounts were deleted.
+	PurgeDeleted() (int, error)
+
+	RequestExport(userId uint32) (*DataExport, error)
+	GetExport(userId uint32, exportId uint32) (*DataExport, error)
+	// ProcessExports builds the archives of pending exports.
+	ProcessExports() (int, error)
+	// ExportArchive returns the ZIP archive of a ready export.
+	ExportArchive(exportId uint32) ([]byte, error)
+}
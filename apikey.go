@@ -0,0 +1,33 @@
+package app
+
+import "time"
+
+// APIKey is a long-lived credential for machine clients. Only a hash of the
+// key is stored; the prefix identifies it to its owner.
+type APIKey struct {
+	ID         uint32     `json:"id"`
+	UserId     uint32     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// API key scopes. A key without scopes may do anything its owner can.
+const (
+	ScopeArticlesWrite = "articles:write"
+	ScopeAccount       = "account"
+)
+
+// Scopes lists the scopes an API key can be restricted to.
+var Scopes = []string{ScopeArticlesWrite, ScopeAccount}
+
+type APIKeyService interface {
+	Create(k *APIKey) (string, error)
+	List(userId uint32) ([]*APIKey, error)
+	Revoke(userId uint32, id uint32) error
+	Authenticate(key string, ip string) (*APIKey, error)
+}
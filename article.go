@@ -3,13 +3,15 @@ package app
 import "time"
 
 type Article struct {
-	ID        uint32    `json:"id"`
-	Slug      string    `json:"slug"`
-	Title     string    `json:"title"`
-	Body      string    `json:"body"`
-	UserId    uint32    `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          uint32     `json:"id"`
+	Slug        string     `json:"slug"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	UserId      uint32     `json:"user_id"` // 0 if the author deleted their account anonymously
+	WorkspaceId uint32     `json:"workspace_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // set on articles in the trash
 }
 
 type ArticleService interface {
@@ -19,3 +21,23 @@ type ArticleService interface {
 	Update(a *Article) error
 	Delete(slug string) error
 }
+
+// PrimaryArticles is implemented by article services that may read from
+// replicas lagging behind the primary.
+type PrimaryArticles interface {
+	// FromPrimary returns the service reading from the primary, e.g. for a
+	// user who just wrote and has to read their writes.
+	FromPrimary() ArticleService
+}
+
+// ArticleTrashService manages deleted articles. Their authors can restore
+// them until the retention period is over, after which they are purged.
+type ArticleTrashService interface {
+	// Trash returns the deleted articles of a user, last deleted first.
+	Trash(userId uint32) ([]*Article, error)
+	// Restore undeletes an article of the user.
+	Restore(userId uint32, slug string) (*Article, error)
+	// PurgeTrash deletes articles whose retention period is over, returning
+	// how many were deleted.
+	PurgeTrash() (int, error)
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditSignup           = "user.signup"
+	AuditPasswordChange   = "user.password_change"
+	AuditEmailChange      = "user.email_change"
+	AuditTwoFactorEnroll  = "user.two_factor_enroll"
+	AuditTwoFactorEnable  = "user.two_factor_enable"
+	AuditTwoFactorDisable = "user.two_factor_disable"
+	AuditAPIKeyCreate     = "api_key.create"
+	AuditLoginSucceeded   = "auth.login_succeeded"
+	AuditLoginFailed      = "auth.login_failed"
+	AuditPermissionDenied = "auth.permission_denied"
+	AuditArticleCreate    = "article.create"
+	AuditArticleUpdate    = "article.update"
+	AuditArticleDelete    = "article.delete"
+	AuditArticleRestore   = "article.restore"
+)
+
+// AuditEvent records who did what, from where. Before and After hold the
+// fields an action changed.
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	ActorId   uint32          `json:"actor_id,omitempty"` // 0 for anonymous requests
+	Target    string          `json:"target,omitempty"`   // e.g. "article:my-slug"
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	RequestId string          `json:"request_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Hash      string          `json:"hash"` // of the event and the hash of the previous one
+}
+
+// AuditFilter selects audit events, zero fields match any.
+type AuditFilter struct {
+	ActorId  uint32
+	Action   string
+	Target   string
+	Since    time.Time
+	Until    time.Time
+	BeforeId int64 // pages through older events
+	Limit    int
+}
+
+// AuditLog is an append-only log whose events are hash-chained, so changing
+// or removing one breaks the chain from there on.
+type AuditLog interface {
+	// Record appends e, setting its ID, time and hash.
+	Record(e *AuditEvent) error
+	// Query returns the matching events, newest first.
+	Query(f AuditFilter) ([]*AuditEvent, error)
+	// Verify recomputes the chain, returning ErrAuditChainBroken and the ID
+	// of the first event that doesn't match.
+	Verify() (int64, error)
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"log"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.ArticleService = &ArticleService{}
+
+// Default TTLs of cached lookups.
+const (
+	DefaultArticleTTL  = time.Minute
+	DefaultNotFoundTTL = 10 * time.Second
+)
+
+// notFound is cached for slugs without an article.
+var notFound = []byte("-")
+
+// ArticleService serves GetBySlug from a store, looking up the wrapped
+// service on misses. Writes through it invalidate what they change; writes
+// made elsewhere, e.g. by other instances with an in-process store, show
+// after the TTL, as may a lookup racing a write. Failing stores are logged
+// and bypassed.
+type ArticleService struct {
+	next  app.ArticleService
+	store Store
+	group *group // shared with the services of other workspaces
+
+	TTL         time.Duration // of found articles
+	NotFoundTTL time.Duration // of slugs without an article, 0 doesn't cache them
+	Prefix      string        // of the keys, "article:" by default
+}
+
+// NewArticleService returns an ArticleService caching lookups of next in
+// store with the default TTLs.
+func NewArticleService(next app.ArticleService, store Store) *ArticleService {
+	return &ArticleService{
+		next:        next,
+		store:       store,
+		group:       &group{},
+		TTL:         DefaultArticleTTL,
+		NotFoundTTL: DefaultNotFoundTTL,
+		Prefix:      "article:",
+	}
+}
+
+// InWorkspace returns the service caching the articles of a workspace, if
+// the wrapped service supports workspaces. It shares the store, with keys
+// prefixed by the workspace.
+func (s *ArticleService) InWorkspace(workspaceId uint32) app.ArticleService {
+	workspaces, ok := s.next.(app.WorkspaceArticles)
+	if !ok {
+		return s
+	}
+
+	scoped := *s
+	scoped.next = workspaces.InWorkspace(workspaceId)
+	scoped.Prefix = fmt.Sprintf("%sw%d:", s.Prefix, workspaceId)
+	return &scoped
+}
+
+// GetAll isn't cached, as every write would invalidate it.
+func (s *ArticleService) GetAll() ([]*app.Article, error) {
+	return s.next.GetAll()
+}
+
+func (s *ArticleService) GetBySlug(slug string) (*app.Article, error) {
+	key := s.Prefix + slug
+
+	if b, ok, err := s.store.Get(key); err != nil {
+		log.Printf("cannot read article %s from cache: %s", slug, err)
+	} else if ok {
+		a, err := decodeArticle(b)
+		switch err {
+		case nil:
+			return a, nil
+		case app.ErrArticleNotFound:
+			return &app.Article{}, err
+		default:
+			log.Printf("cannot decode cached article %s: %s", slug, err)
+		}
+	}
+
+	// concurrent misses share one lookup
+	v, err := s.group.do(key, func() (interface{}, error) {
+		a, err := s.next.GetBySlug(slug)
+		switch err {
+		case nil:
+			s.set(key, a, s.TTL)
+		case app.ErrArticleNotFound:
+			if s.NotFoundTTL > 0 {
+				s.setBytes(key, notFound, s.NotFoundTTL)
+			}
+		}
+		return a, err
+	})
+	if err != nil {
+		return &app.Article{}, err
+	}
+
+	// callers may modify their article, so each gets its own
+	a := *v.(*app.Article)
+	return &a, nil
+}
+
+// Save invalidates the slug, which may be cached as not found.
+func (s *ArticleService) Save(a *app.Article) error {
+	if err := s.next.Save(a); err != nil {
+		return err
+	}
+	s.invalidate(a.Slug)
+	return nil
+}
+
+// Update invalidates the previous slug and the new one.
+func (s *ArticleService) Update(a *app.Article) error {
+	oldSlug := a.Slug
+	err := s.next.Update(a)
+	// invalidate even on errors, the update may have gone through
+	s.invalidate(oldSlug, a.Slug)
+	return err
+}
+
+func (s *ArticleService) Delete(slug string) error {
+	err := s.next.Delete(slug)
+	s.invalidate(slug)
+	return err
+}
+
+func (s *ArticleService) invalidate(slugs ...string) {
+	keys := make([]string, len(slugs))
+	for i, slug := range slugs {
+		keys[i] = s.Prefix + slug
+	}
+	if err := s.store.Delete(keys...); err != nil {
+		log.Printf("cannot invalidate cached articles %v: %s", slugs, err)
+	}
+}
+
+func (s *ArticleService) set(key string, a *app.Article, ttl time.Duration) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("cannot encode article %s for cache: %s", a.Slug, err)
+		return
+	}
+	s.setBytes(key, b, ttl)
+}
+
+func (s *ArticleService) setBytes(key string, b []byte, ttl time.Duration) {
+	if err := s.store.Set(key, b, ttl); err != nil {
+		log.Printf("cannot cache %s: %s", key, err)
+	}
+}
+
+func decodeArticle(b []byte) (*app.Article, error) {
+	if string(b) == string(notFound) {
+		return nil, app.ErrArticleNotFound
+	}
+	var a app.Article
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// WrapTrash returns ts invalidating the slugs it restores, which may be
+// cached as not found.
+func (s *ArticleService) WrapTrash(ts app.ArticleTrashService) app.ArticleTrashService {
+	return &trashService{ArticleTrashService: ts, articles: s}
+}
+
+type trashService struct {
+	app.ArticleTrashService
+	articles *ArticleService
+}
+
+// InWorkspace returns the trash of a workspace, invalidating the articles
+// cached for it, if the wrapped service supports workspaces.
+func (s *trashService) InWorkspace(workspaceId uint32) app.ArticleTrashService {
+	workspaces, ok := s.ArticleTrashService.(app.WorkspaceTrash)
+	if !ok {
+		return s
+	}
+
+	return &trashService{
+		ArticleTrashService: workspaces.InWorkspace(workspaceId),
+		articles:            s.articles.InWorkspace(workspaceId).(*ArticleService),
+	}
+}
+
+func (s *trashService) Restore(userId uint32, slug string) (*app.Article, error) {
+	a, err := s.ArticleTrashService.Restore(userId, slug)
+	if err == nil {
+		s.articles.invalidate(slug)
+	}
+	return a, err
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/cache/redistest"
+	"github.com/leartgjoni/go-rest-template/inmem"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/password"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingArticles counts the lookups reaching the wrapped service.
+type countingArticles struct {
+	app.ArticleService
+	lookups int32
+	delay   time.Duration
+}
+
+func (s *countingArticles) GetBySlug(slug string) (*app.Article, error) {
+	atomic.AddInt32(&s.lookups, 1)
+	time.Sleep(s.delay)
+	return s.ArticleService.GetBySlug(slug)
+}
+
+func (s *countingArticles) count() int32 { return atomic.LoadInt32(&s.lookups) }
+
+// stores runs a test against each store.
+func stores(t *testing.T, test func(t *testing.T, store Store)) {
+	t.Run("lru", func(t *testing.T) {
+		test(t, NewLRU(100))
+	})
+	t.Run("redis", func(t *testing.T) {
+		srv := redistest.NewServer("")
+		defer srv.Close()
+		s := NewRedis(srv.Addr)
+		defer s.Close()
+		test(t, s)
+	})
+}
+
+func newTestArticles(t *testing.T) (*countingArticles, *app.Article) {
+	db := inmem.NewDB()
+	user := &app.User{Username: "test", Email: "test@test.com", Password: "password"}
+	us := inmem.NewUserService(db, nil)
+	us.Passwords = password.NewHasher(password.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err := us.Save(user); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+
+	backend := &countingArticles{ArticleService: inmem.NewArticleService(db)}
+	article := &app.Article{Title: "title", Body: "body", UserId: user.ID}
+	if err := backend.Save(article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	return backend, article
+}
+
+func TestArticleService_GetBySlug(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, article := newTestArticles(t)
+		s := NewArticleService(backend, store)
+
+		for i := 0; i < 3; i++ {
+			a, err := s.GetBySlug(article.Slug)
+			if err != nil {
+				t.Fatalf("wrong error. expected %v but got %s", nil, err)
+			}
+			if a.ID != article.ID || a.Title != article.Title {
+				t.Fatalf("wrong article %+v", a)
+			}
+			// callers get their own copy
+			a.Title = "changed"
+		}
+
+		if backend.count() != 1 {
+			t.Fatalf("wrong number of lookups. expected %d but got %d", 1, backend.count())
+		}
+	})
+}
+
+func TestArticleService_NotFound(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, _ := newTestArticles(t)
+		s := NewArticleService(backend, store)
+
+		for i := 0; i < 3; i++ {
+			if _, err := s.GetBySlug("unknown"); err != app.ErrArticleNotFound {
+				t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+			}
+		}
+		if backend.count() != 1 {
+			t.Fatalf("wrong number of lookups. expected %d but got %d", 1, backend.count())
+		}
+
+		// without a not found TTL every lookup reaches the backend
+		s.NotFoundTTL = 0
+		_, _ = s.GetBySlug("other")
+		_, _ = s.GetBySlug("other")
+		if backend.count() != 3 {
+			t.Fatalf("wrong number of lookups. expected %d but got %d", 3, backend.count())
+		}
+	})
+}
+
+func TestArticleService_Invalidation(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, article := newTestArticles(t)
+		s := NewArticleService(backend, store)
+
+		oldSlug := article.Slug
+		if _, err := s.GetBySlug(oldSlug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+
+		// update gives the article a new slug
+		update := &app.Article{Slug: oldSlug, Title: "new title", Body: "new body"}
+		if err := s.Update(update); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+		if _, err := s.GetBySlug(oldSlug); err != app.ErrArticleNotFound {
+			t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+		}
+		a, err := s.GetBySlug(update.Slug)
+		if err != nil || a.Title != "new title" {
+			t.Fatalf("expected the updated article but got %+v, %v", a, err)
+		}
+
+		if err := s.Delete(update.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+		if _, err := s.GetBySlug(update.Slug); err != app.ErrArticleNotFound {
+			t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+		}
+	})
+}
+
+func TestArticleService_WrapTrash(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, article := newTestArticles(t)
+		s := NewArticleService(backend, store)
+
+		if err := s.Delete(article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+		if _, err := s.GetBySlug(article.Slug); err != app.ErrArticleNotFound {
+			t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+		}
+
+		// restoring brings the article back, without waiting for the not found TTL
+		trash := s.WrapTrash(&mock.ArticleTrashService{
+			RestoreFn: func(userId uint32, slug string) (*app.Article, error) {
+				return article, backend.Save(article)
+			},
+		})
+		if _, err := trash.Restore(article.UserId, article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+		if _, err := s.GetBySlug(article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+	})
+}
+
+func TestArticleService_Stampede(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, article := newTestArticles(t)
+		backend.delay = 50 * time.Millisecond
+		s := NewArticleService(backend, store)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.GetBySlug(article.Slug); err != nil {
+					t.Errorf("wrong error. expected %v but got %s", nil, err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if backend.count() != 1 {
+			t.Fatalf("wrong number of lookups. expected %d but got %d", 1, backend.count())
+		}
+	})
+}
+
+func TestArticleService_StoreDown(t *testing.T) {
+	backend, article := newTestArticles(t)
+
+	srv := redistest.NewServer("")
+	store := NewRedis(srv.Addr)
+	srv.Close()
+	s := NewArticleService(backend, store)
+
+	// lookups still work, straight from the backend
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetBySlug(article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+	}
+	if backend.count() != 2 {
+		t.Fatalf("wrong number of lookups. expected %d but got %d", 2, backend.count())
+	}
+}
+
+// workspaceArticles keeps the articles of other workspaces empty.
+type workspaceArticles struct {
+	*countingArticles
+}
+
+func (s workspaceArticles) InWorkspace(workspaceId uint32) app.ArticleService {
+	return &countingArticles{ArticleService: inmem.NewArticleService(inmem.NewDB())}
+}
+
+func TestArticleService_InWorkspace(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		backend, article := newTestArticles(t)
+		s := NewArticleService(workspaceArticles{backend}, store)
+
+		if _, err := s.GetBySlug(article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+
+		// the article cached for the default workspace isn't another's
+		scoped := s.InWorkspace(2)
+		if _, err := scoped.GetBySlug(article.Slug); err != app.ErrArticleNotFound {
+			t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+		}
+		if _, err := s.GetBySlug(article.Slug); err != nil {
+			t.Fatalf("wrong error. expected %v but got %s", nil, err)
+		}
+		if backend.count() != 1 {
+			t.Fatalf("wrong number of lookups. expected %d but got %d", 1, backend.count())
+		}
+	})
+
+	// without workspaces in the wrapped service the cache has none either
+	backend, _ := newTestArticles(t)
+	s := NewArticleService(backend, NewLRU(100))
+	if s.InWorkspace(2) != s {
+		t.Fatal("expected the same service")
+	}
+}
@@ -0,0 +1,20 @@
+// Package cache wraps services to serve lookups from a cache, either in
+// process or shared in Redis.
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// Store keeps values for a while. Stores may drop values before their TTL,
+// e.g. to stay within a size.
+type Store interface {
+	// Get returns the value of a key, and false if there is none.
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// ErrClosed is returned by stores used after Close.
+var ErrClosed = errors.New("cache: store closed")
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	c := NewLRU(2)
+
+	_ = c.Set("a", []byte("1"), time.Minute)
+	_ = c.Set("b", []byte("2"), time.Minute)
+
+	// a becomes the most recently used, so adding c drops b
+	if v, ok, _ := c.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("wrong value. expected %s but got %s", "1", v)
+	}
+	_ = c.Set("c", []byte("3"), time.Minute)
+
+	if _, ok, _ := c.Get("b"); ok {
+		t.Fatal("expected b to be dropped")
+	}
+	if _, ok, _ := c.Get("a"); !ok {
+		t.Fatal("expected a to be kept")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("wrong length. expected %d but got %d", 2, c.Len())
+	}
+
+	_ = c.Delete("a", "unknown")
+	if _, ok, _ := c.Get("a"); ok {
+		t.Fatal("expected a to be deleted")
+	}
+}
+
+func TestLRU_TTL(t *testing.T) {
+	c := NewLRU(10)
+
+	_ = c.Set("a", []byte("1"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok, _ := c.Get("a"); ok {
+		t.Fatal("expected a to expire")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("wrong length. expected %d but got %d", 0, c.Len())
+	}
+}
+
+func TestLRU_CopiesValues(t *testing.T) {
+	c := NewLRU(10)
+
+	value := []byte("1")
+	_ = c.Set("a", value, time.Minute)
+	value[0] = '2'
+
+	if v, _, _ := c.Get("a"); string(v) != "1" {
+		t.Fatalf("wrong value. expected %s but got %s", "1", v)
+	}
+}
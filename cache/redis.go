@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ensure store implements interface.
+var _ Store = &Redis{}
+
+// Redis is a store shared by all instances, kept in a server speaking the
+// Redis protocol, e.g. Redis, Valkey or KeyDB. Connections are reused.
+type Redis struct {
+	Addr     string // host:port
+	Password string // optional, sent with AUTH
+	DB       int    // selected after connecting
+	Prefix   string // prepended to keys, so apps can share a server
+
+	DialTimeout time.Duration
+	IOTimeout   time.Duration // per command
+	MaxIdle     int           // connections kept open between commands
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+// NewRedis returns a Redis store for a server.
+func NewRedis(addr string) *Redis {
+	return &Redis{
+		Addr:        addr,
+		DialTimeout: 2 * time.Second,
+		IOTimeout:   time.Second,
+		MaxIdle:     8,
+	}
+}
+
+// redisError is an error reply, after which the connection is still usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (s *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := s.do("GET", s.Prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+func (s *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err := s.do("SET", s.Prefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+func (s *Redis) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, key := range keys {
+		args = append(args, s.Prefix+key)
+	}
+	_, err := s.do(args...)
+	return err
+}
+
+// Ping checks the server can be reached.
+func (s *Redis) Ping() error {
+	_, err := s.do("PING")
+	return err
+}
+
+// Close closes the idle connections. Commands in flight close theirs when
+// done.
+func (s *Redis) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, c := range s.idle {
+		_ = c.Close()
+	}
+	s.idle = nil
+	return nil
+}
+
+// do runs a command and returns its reply: nil, a string, an int64, []byte
+// or []interface{}.
+func (s *Redis) do(args ...string) (interface{}, error) {
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(s.IOTimeout, args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the connection is in an unknown state
+		_ = c.Close()
+		return nil, err
+	}
+	s.release(c)
+	return reply, err
+}
+
+func (s *Redis) conn() (*redisConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	netConn, err := net.DialTimeout("tcp", s.Addr, s.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	if s.Password != "" {
+		if _, err := c.do(s.IOTimeout, "AUTH", s.Password); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	if s.DB != 0 {
+		if _, err := c.do(s.IOTimeout, "SELECT", strconv.Itoa(s.DB)); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (s *Redis) release(c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || len(s.idle) >= s.MaxIdle {
+		_ = c.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if timeout > 0 {
+		if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	// commands are sent as arrays of bulk strings
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.r)
+}
+
+// readReply reads a reply of the Redis protocol (RESP2).
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			replies[i], err = readReply(r)
+			if e, ok := err.(redisError); ok {
+				// keep reading, so the connection stays usable
+				replies[i] = e
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"github.com/leartgjoni/go-rest-template/cache/redistest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedis(t *testing.T) {
+	srv := redistest.NewServer("")
+	defer srv.Close()
+
+	s := NewRedis(srv.Addr)
+	s.Prefix = "app:"
+	defer s.Close()
+
+	if _, ok, err := s.Get("a"); ok || err != nil {
+		t.Fatalf("expected a miss but got %v, %v", ok, err)
+	}
+
+	if err := s.Set("a", []byte("hello\r\nworld"), time.Minute); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if err := s.Set("b", []byte("2"), 10*time.Millisecond); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	if v, ok, err := s.Get("a"); !ok || err != nil || string(v) != "hello\r\nworld" {
+		t.Fatalf("wrong value. expected %q but got %q, %v", "hello\r\nworld", v, err)
+	}
+
+	keys := srv.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "app:a,app:b" {
+		t.Fatalf("wrong keys %v", keys)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := s.Get("b"); ok {
+		t.Fatal("expected b to expire")
+	}
+
+	if err := s.Delete("a", "b"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if _, ok, _ := s.Get("a"); ok {
+		t.Fatal("expected a to be deleted")
+	}
+}
+
+func TestRedis_Auth(t *testing.T) {
+	srv := redistest.NewServer("secret")
+	defer srv.Close()
+
+	tests := []struct {
+		password string
+		expected string // part of the error
+	}{
+		{"", "NOAUTH"},
+		{"wrong", "WRONGPASS"},
+		{"secret", ""},
+	}
+
+	for _, test := range tests {
+		s := NewRedis(srv.Addr)
+		s.Password = test.password
+		err := s.Ping()
+		_ = s.Close()
+
+		if (err == nil) != (test.expected == "") || (err != nil && !strings.Contains(err.Error(), test.expected)) {
+			t.Fatalf("wrong error. expected %s but got %v", test.expected, err)
+		}
+	}
+}
+
+func TestRedis_ReusesConnections(t *testing.T) {
+	srv := redistest.NewServer("")
+	defer srv.Close()
+
+	s := NewRedis(srv.Addr)
+	defer s.Close()
+
+	// error replies leave the connection usable
+	if _, err := s.do("UNKNOWN"); err == nil {
+		t.Fatal("expected an error reply")
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Ping(); err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+	}
+	if len(s.idle) != 1 {
+		t.Fatalf("wrong number of idle connections. expected %d but got %d", 1, len(s.idle))
+	}
+}
+
+func TestRedis_Closed(t *testing.T) {
+	srv := redistest.NewServer("")
+	defer srv.Close()
+
+	s := NewRedis(srv.Addr)
+	_ = s.Close()
+	if err := s.Ping(); err != ErrClosed {
+		t.Fatalf("wrong error. expected %s but got %v", ErrClosed, err)
+	}
+}
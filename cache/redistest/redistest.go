@@ -0,0 +1,201 @@
+// Package redistest provides a stub Redis server for tests, understanding
+// the few commands the cache package sends.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a local server keeping values in memory.
+type Server struct {
+	Addr string
+
+	password string
+	ln       net.Listener
+
+	mu     sync.Mutex
+	values map[string]value
+	conns  map[net.Conn]bool
+}
+
+type value struct {
+	data    []byte
+	expires time.Time // zero if it doesn't expire
+}
+
+// NewServer starts a server on a random local port, requiring AUTH with the
+// password before other commands unless it's empty. Callers must Close it.
+func NewServer(password string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		Addr:     ln.Addr().String(),
+		password: password,
+		ln:       ln,
+		values:   map[string]value{},
+		conns:    map[net.Conn]bool{},
+	}
+	go s.serve()
+	return s
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+	_ = s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+}
+
+// Keys returns the keys currently set.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for k, v := range s.values {
+		if v.expires.IsZero() || time.Now().Before(v.expires) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer func() {
+		_ = c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		if strings.ToUpper(args[0]) == "AUTH" {
+			if len(args) == 2 && args[1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		} else if !authenticated {
+			reply = "-NOAUTH Authentication required.\r\n"
+		} else {
+			reply = s.run(args)
+		}
+
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) run(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+
+	switch {
+	case name == "PING":
+		return "+PONG\r\n"
+	case name == "SELECT" && len(args) == 2:
+		return "+OK\r\n"
+	case name == "GET" && len(args) == 2:
+		v, ok := s.values[args[1]]
+		if !ok || (!v.expires.IsZero() && time.Now().After(v.expires)) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v.data), v.data)
+	case name == "SET" && (len(args) == 3 || len(args) == 5):
+		v := value{data: []byte(args[2])}
+		if len(args) == 5 {
+			ms, err := strconv.Atoi(args[4])
+			if err != nil || strings.ToUpper(args[3]) != "PX" {
+				return "-ERR syntax error\r\n"
+			}
+			v.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		s.values[args[1]] = v
+		return "+OK\r\n"
+	case name == "DEL" && len(args) >= 2:
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := s.values[k]; ok {
+				delete(s.values, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func readLength(r *bufio.Reader, kind byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 4 || line[0] != kind {
+		return 0, fmt.Errorf("unexpected line %q", line)
+	}
+	return strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+}
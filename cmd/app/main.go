@@ -1,13 +1,34 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/cache"
 	"github.com/leartgjoni/go-rest-template/http"
+	"github.com/leartgjoni/go-rest-template/inmem"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mail"
+	"github.com/leartgjoni/go-rest-template/oidc"
+	"github.com/leartgjoni/go-rest-template/password"
 	"github.com/leartgjoni/go-rest-template/postgres"
+	"github.com/leartgjoni/go-rest-template/sqlite"
+	"github.com/leartgjoni/go-rest-template/stream"
+	"github.com/leartgjoni/go-rest-template/webhook"
 	"github.com/spf13/viper"
 	"io"
+	"net"
+	nethttp "net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -19,6 +40,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run a one-off command, e.g. `keys rotate`, instead of the server.
+	if len(os.Args) > 1 {
+		if err := m.RunCommand(os.Args[1:]); err != nil {
+			_, _ = fmt.Fprintln(m.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Execute program.
 	if err := m.Run(); err != nil {
 		_, _ = fmt.Fprintln(m.Stderr, err)
@@ -83,29 +113,328 @@ func (m *Main) LoadConfig() error {
 		DbHost:     viper.GetString("DB_HOST"),
 		DbName:     viper.GetString("DB_NAME"),
 		ApiSecret:  viper.GetString("API_SECRET"),
+
+		DatabaseUrl:        viper.GetString("DATABASE_URL"),
+		DbSslMode:          viper.GetString("DB_SSLMODE"),
+		DbSslRootCert:      viper.GetString("DB_SSLROOTCERT"),
+		DbMaxOpenConns:     viper.GetInt("DB_MAX_OPEN_CONNS"),
+		DbMaxIdleConns:     viper.GetInt("DB_MAX_IDLE_CONNS"),
+		DbConnMaxLifetime:  viper.GetDuration("DB_CONN_MAX_LIFETIME"),
+		DbConnMaxIdleTime:  viper.GetDuration("DB_CONN_MAX_IDLE_TIME"),
+		DbStatementTimeout: viper.GetDuration("DB_STATEMENT_TIMEOUT"),
+		DbApplicationName:  viper.GetString("DB_APPLICATION_NAME"),
+		DbConnectAttempts:  viper.GetInt("DB_CONNECT_ATTEMPTS"),
+
+		DbReadYourWritesWindow:  viper.GetDuration("DB_READ_YOUR_WRITES_WINDOW"),
+		DbReplicaHealthInterval: viper.GetDuration("DB_REPLICA_HEALTH_INTERVAL"),
+		DbLogQueries:            viper.GetBool("DB_LOG_QUERIES"),
+		DbRowLevelSecurity:      viper.GetBool("DB_ROW_LEVEL_SECURITY"),
+		MetricsAddr:             viper.GetString("METRICS_ADDR"),
+
+		ArticleCache:            viper.GetString("ARTICLE_CACHE"),
+		ArticleCacheSize:        viper.GetInt("ARTICLE_CACHE_SIZE"),
+		ArticleCacheTTL:         viper.GetDuration("ARTICLE_CACHE_TTL"),
+		ArticleCacheNotFoundTTL: viper.GetDuration("ARTICLE_CACHE_NOT_FOUND_TTL"),
+		RedisAddr:               viper.GetString("REDIS_ADDR"),
+		RedisPassword:           viper.GetString("REDIS_PASSWORD"),
+		RedisDB:                 viper.GetInt("REDIS_DB"),
+
+		Storage:           viper.GetString("STORAGE"),
+		MemorySnapshot:    viper.GetString("MEMORY_SNAPSHOT_FILE"),
+		SqlitePath:        viper.GetString("SQLITE_PATH"),
+		SqliteMigrations:  viper.GetString("SQLITE_MIGRATIONS_DIR"),
+		SqliteBusyTimeout: viper.GetDuration("SQLITE_BUSY_TIMEOUT"),
+
+		CompressionMinSize: viper.GetInt("COMPRESSION_MIN_SIZE"),
+
+		TotpEncryptionKey: viper.GetString("TOTP_ENCRYPTION_KEY"),
+		TotpIssuer:        viper.GetString("TOTP_ISSUER"),
+
+		JwtAlgorithm:            viper.GetString("JWT_ALGORITHM"),
+		SigningKeyEncryptionKey: viper.GetString("SIGNING_KEY_ENCRYPTION_KEY"),
+
+		LoginFreeAttempts: viper.GetInt("LOGIN_FREE_ATTEMPTS"),
+		LoginLockAfter:    viper.GetInt("LOGIN_LOCK_AFTER"),
+		LoginLockDuration: viper.GetDuration("LOGIN_LOCK_DURATION"),
+		LoginIPLockAfter:  viper.GetInt("LOGIN_IP_LOCK_AFTER"),
+		SmtpAddr:          viper.GetString("SMTP_ADDR"),
+		SmtpFrom:          viper.GetString("SMTP_FROM"),
+		SmtpUsername:      viper.GetString("SMTP_USERNAME"),
+		SmtpPassword:      viper.GetString("SMTP_PASSWORD"),
+
+		ConfirmEmailUrl: viper.GetString("CONFIRM_EMAIL_URL"),
+
+		DeletionGracePeriod: viper.GetDuration("DELETION_GRACE_PERIOD"),
+		TrashRetention:      viper.GetDuration("ARTICLE_TRASH_RETENTION"),
+
+		WorkspaceDomain: viper.GetString("WORKSPACE_DOMAIN"),
+
+		WebhookRetention:   viper.GetDuration("WEBHOOK_RETENTION"),
+		WebhookMaxAttempts: viper.GetInt("WEBHOOK_MAX_ATTEMPTS"),
+
+		StreamBufferSize: viper.GetInt("STREAM_BUFFER_SIZE"),
+
+		SessionCacheTTL: viper.GetDuration("SESSION_CACHE_TTL"),
+
+		CookieSessions: viper.GetBool("COOKIE_SESSIONS"),
+		CookieName:     viper.GetString("COOKIE_NAME"),
+		CookieDomain:   viper.GetString("COOKIE_DOMAIN"),
+		CookieInsecure: viper.GetBool("COOKIE_INSECURE"),
+		CookieSameSite: viper.GetString("COOKIE_SAMESITE"),
+		CsrfMode:       viper.GetString("CSRF_MODE"),
+
+		PasswordMinLength:     viper.GetInt("PASSWORD_MIN_LENGTH"),
+		PasswordMaxLength:     viper.GetInt("PASSWORD_MAX_LENGTH"),
+		BreachedPasswordsFile: viper.GetString("BREACHED_PASSWORDS_FILE"),
+		Argon2Memory:          viper.GetUint32("ARGON2_MEMORY"),
+		Argon2Iterations:      viper.GetUint32("ARGON2_ITERATIONS"),
+		Argon2Parallelism:     uint8(viper.GetUint("ARGON2_PARALLELISM")),
+	}
+
+	if m.Config.Storage == "" {
+		m.Config.Storage = StoragePostgres
+	}
+	switch m.Config.Storage {
+	case StoragePostgres, StorageMemory:
+	case StorageSqlite:
+		if m.Config.SqlitePath == "" {
+			m.Config.SqlitePath = "app.db"
+		}
+		if m.Config.SqliteMigrations == "" {
+			m.Config.SqliteMigrations = "sqlite/migrations"
+		}
+		if m.Config.SqliteBusyTimeout <= 0 {
+			m.Config.SqliteBusyTimeout = sqlite.DefaultBusyTimeout
+		}
+	default:
+		return fmt.Errorf("unknown STORAGE %q, expected %s, %s or %s", m.Config.Storage, StoragePostgres, StorageSqlite, StorageMemory)
+	}
+
+	for _, u := range strings.Split(viper.GetString("DB_REPLICA_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			m.Config.DbReplicaUrls = append(m.Config.DbReplicaUrls, u)
+		}
+	}
+
+	for _, o := range strings.Split(viper.GetString("WEBSOCKET_ORIGINS"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			m.Config.WebSocketOrigins = append(m.Config.WebSocketOrigins, o)
+		}
+	}
+
+	switch m.Config.ArticleCache {
+	case "", CacheMemory:
+	case CacheRedis:
+		if m.Config.RedisAddr == "" {
+			return errors.New("ARTICLE_CACHE=redis needs REDIS_ADDR")
+		}
+	default:
+		return fmt.Errorf("unknown ARTICLE_CACHE %q, expected %s or %s", m.Config.ArticleCache, CacheMemory, CacheRedis)
+	}
+	if m.Config.ArticleCacheTTL <= 0 {
+		m.Config.ArticleCacheTTL = cache.DefaultArticleTTL
+	}
+	if m.Config.ArticleCacheNotFoundTTL <= 0 {
+		m.Config.ArticleCacheNotFoundTTL = cache.DefaultNotFoundTTL
+	}
+
+	if m.Config.DbSslMode == "" {
+		m.Config.DbSslMode = "disable"
+	}
+	if m.Config.DbApplicationName == "" {
+		m.Config.DbApplicationName = "go-rest-template"
+	}
+	if m.Config.DbConnectAttempts <= 0 {
+		m.Config.DbConnectAttempts = postgres.DefaultPoolOptions.PingAttempts
+	}
+
+	if m.Config.TotpIssuer == "" {
+		m.Config.TotpIssuer = "go-rest-template"
+	}
+
+	if m.Config.DeletionGracePeriod <= 0 {
+		m.Config.DeletionGracePeriod = postgres.DefaultDeletionGracePeriod
+	}
+	if m.Config.TrashRetention <= 0 {
+		m.Config.TrashRetention = postgres.DefaultTrashRetention
+	}
+	if m.Config.WebhookRetention <= 0 {
+		m.Config.WebhookRetention = postgres.DefaultWebhookRetention
+	}
+	if m.Config.WebhookMaxAttempts <= 0 {
+		m.Config.WebhookMaxAttempts = webhook.DefaultMaxAttempts
+	}
+	if m.Config.StreamBufferSize <= 0 {
+		m.Config.StreamBufferSize = stream.DefaultBufferSize
+	}
+
+	if m.Config.SessionCacheTTL <= 0 {
+		m.Config.SessionCacheTTL = postgres.DefaultSessionCacheTTL
+	}
+
+	if m.Config.PasswordMinLength <= 0 {
+		m.Config.PasswordMinLength = 8
+	}
+
+	if m.Config.PasswordMaxLength <= 0 {
+		m.Config.PasswordMaxLength = 1024
+	}
+
+	if m.Config.JwtAlgorithm == "" {
+		m.Config.JwtAlgorithm = app.AlgorithmRS256
+	}
+
+	// OIDC_PROVIDERS=google,gitlab reads OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, ...
+	m.Config.OidcProviders = map[string]oidc.Config{}
+	for _, name := range strings.Split(viper.GetString("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		m.Config.OidcProviders[strings.ToLower(name)] = oidc.Config{
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+			RedirectURL:  viper.GetString(prefix + "REDIRECT_URL"),
+		}
 	}
 
 	return nil
 }
 
 func (m *Main) Run() error {
-	dbUrl := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", m.Config.DbHost, m.Config.DbPort, m.Config.DbUser, m.Config.DbName, m.Config.DbPassword)
-	db, err := postgres.Open(dbUrl)
+	switch m.Config.Storage {
+	case StorageMemory:
+		return m.runInMemory()
+	case StorageSqlite:
+		return m.runSqlite()
+	}
+
+	db, err := m.openDb()
 	if err != nil {
-		fmt.Println(m.Stderr, err)
-		os.Exit(1)
+		return err
 	}
 
+	// JWTs are signed with the active signing key. The first start creates
+	// one; later ones are made with `keys rotate`.
+	signingKeyService, err := m.signingKeyService(db)
+	if err != nil {
+		return err
+	}
+	if err := signingKeyService.EncryptKeys(); err != nil {
+		return err
+	}
+	if err := ensureSigningKey(signingKeyService, m.Config.JwtAlgorithm); err != nil {
+		return err
+	}
+	tokens := keyring.New(signingKeyService)
+
 	// Initialize postgres services.
-	userService := postgres.NewUserService(db, m.Config.ApiSecret)
+	userService := postgres.NewUserService(db, tokens)
+	userService.Passwords = password.NewHasher(m.passwordParams())
+	policy, err := m.passwordPolicy()
+	if err != nil {
+		return err
+	}
+	userService.Policy = policy
 	articleService := postgres.NewArticleService(db)
+	articleService.RowLevelSecurity = m.Config.DbRowLevelSecurity
+	apiKeyService := postgres.NewAPIKeyService(db)
+	sessionService := postgres.NewSessionService(db, m.Config.SessionCacheTTL)
+	userService.Sessions = sessionService
+	accountService := postgres.NewAccountService(db, m.Config.DeletionGracePeriod)
+	trashService := postgres.NewArticleTrashService(db, m.Config.TrashRetention)
+	webhookQueue := postgres.NewWebhookQueue(db, m.Config.WebhookRetention)
 
-	// Initialize Http server.
-	httpServer := http.NewServer()
-	httpServer.Addr = ":8080"
+	// Changes to articles are streamed to clients of every instance, as
+	// they're notified by the database.
+	broker := stream.NewBroker(m.Config.StreamBufferSize)
+	dsn, err := m.dataSourceName()
+	if err != nil {
+		return err
+	}
+	eventListener, err := postgres.ListenEvents(db, dsn, broker.Publish)
+	if err != nil {
+		return err
+	}
+
+	// Two-factor authentication is only offered with an encryption key for the secrets.
+	var twoFactorService *postgres.TwoFactorService
+	if m.Config.TotpEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(m.Config.TotpEncryptionKey)
+		if err != nil || len(key) != 32 {
+			return errors.New("TOTP_ENCRYPTION_KEY must be 32 base64 encoded bytes")
+		}
+		twoFactorService = postgres.NewTwoFactorService(db, tokens, key, m.Config.TotpIssuer)
+	}
+
+	mailer := m.mailer()
+	userService.Mailer = mailer
+	userService.ConfirmEmailURL = m.Config.ConfirmEmailUrl
+
+	loginThrottle := postgres.NewLoginThrottleService(db, m.loginThrottlePolicy())
+	loginThrottle.Mailer = mailer
 
+	// Initialize Http server.
+	httpServer := m.newHttpServer()
 	httpServer.UserService = userService
-	httpServer.ArticleService = articleService
+	httpServer.PasswordPolicy = policy
+	httpServer.ReadYourWritesWindow = m.readYourWritesWindow()
+	cachedArticles, closeCache := m.cachedArticles(articleService)
+	httpServer.ArticleService = cachedArticles
+	httpServer.ArticleTrashService = trashService
+	httpServer.WorkspaceTrash = trashService
+	if c, ok := cachedArticles.(*cache.ArticleService); ok {
+		httpServer.ArticleTrashService = c.WrapTrash(trashService)
+		httpServer.WorkspaceTrash = httpServer.ArticleTrashService.(app.WorkspaceTrash)
+	}
+	httpServer.APIKeyService = apiKeyService
+	httpServer.SigningKeys = tokens
+	httpServer.LoginThrottle = loginThrottle
+	httpServer.SessionService = sessionService
+	httpServer.AuditLog = postgres.NewAuditLog(db)
+	httpServer.UnitOfWork = postgres.NewUnitOfWork(db, userService)
+	httpServer.WorkspaceService = postgres.NewWorkspaceService(db)
+	httpServer.WorkspaceArticles = articleService
+	if c, ok := cachedArticles.(*cache.ArticleService); ok {
+		httpServer.WorkspaceArticles = c
+	}
+	httpServer.WorkspaceDomain = m.Config.WorkspaceDomain
+	httpServer.WebhookService = postgres.NewWebhookService(db)
+	httpServer.EventBroker = broker
+	httpServer.WebSocketOrigins = m.Config.WebSocketOrigins
+	if twoFactorService != nil {
+		httpServer.TwoFactorService = twoFactorService
+	}
+
+	// Export download URLs are signed, so exports need API_SECRET.
+	if m.Config.ApiSecret != "" {
+		httpServer.AccountService = accountService
+		httpServer.ExportURLSecret = m.secret(secretExportURL)
+	}
+
+	if m.Config.CookieSessions {
+		cookies, err := m.sessionCookies()
+		if err != nil {
+			return err
+		}
+		httpServer.SessionCookies = cookies
+	}
+
+	// Provider metadata is discovered on first use, so a provider being down
+	// doesn't prevent startup.
+	if len(m.Config.OidcProviders) > 0 {
+		if m.Config.ApiSecret == "" {
+			return errors.New("API_SECRET is required to sign OIDC login state")
+		}
+		httpServer.IdentityService = postgres.NewIdentityService(db)
+		httpServer.OIDCProviders = map[string]*oidc.Client{}
+		for name, config := range m.Config.OidcProviders {
+			httpServer.OIDCProviders[name] = oidc.NewClient(config, nil)
+		}
+		httpServer.OIDCStateSecret = m.secret(secretOIDCState)
+	}
 
 	// Start HTTP server.
 	if err := httpServer.Start(); err != nil {
@@ -113,9 +442,28 @@ func (m *Main) Run() error {
 	}
 	_, _ = fmt.Fprintf(m.Stdout, "Listening on port: %s\n", httpServer.Addr)
 
+	closeMetrics, err := m.serveMetrics()
+	if err != nil {
+		_ = httpServer.Close()
+		return err
+	}
+
+	stopJobs := m.runJobs(accountService, trashService, webhookQueue, jobInterval)
+
+	dispatcher := webhook.NewDispatcher(webhookQueue)
+	dispatcher.MaxAttempts = m.Config.WebhookMaxAttempts
+	dispatcher.Start()
+
 	// Assign close function.
 	m.closeFn = func() error {
+		stopJobs()
+		dispatcher.Close()
+		closeMetrics()
 		_ = httpServer.Close()
+		loginThrottle.Wait()
+		_ = eventListener.Close()
+		broker.Close()
+		closeCache()
 		_ = db.Close()
 		return nil
 	}
@@ -123,11 +471,659 @@ func (m *Main) Run() error {
 	return nil
 }
 
+// runInMemory serves users and articles kept in memory, e.g. for demos.
+// They are written to MEMORY_SNAPSHOT_FILE on shutdown and loaded from it on
+// the next start. Other features need Postgres.
+func (m *Main) runInMemory() error {
+	key, err := m.signingKeyEncryptionKey()
+	if err != nil {
+		return err
+	}
+	db, err := inmem.Open(m.Config.MemorySnapshot, key)
+	if err != nil {
+		return err
+	}
+
+	signingKeyService := inmem.NewSigningKeyService(db)
+	if err := ensureSigningKey(signingKeyService, m.Config.JwtAlgorithm); err != nil {
+		return err
+	}
+
+	tokens := keyring.New(signingKeyService)
+	userService := inmem.NewUserService(db, tokens)
+	userService.Passwords = password.NewHasher(m.passwordParams())
+	if userService.Policy, err = m.passwordPolicy(); err != nil {
+		return err
+	}
+	userService.Mailer = m.mailer()
+	userService.ConfirmEmailURL = m.Config.ConfirmEmailUrl
+
+	return m.serveStandalone(userService, userService.Policy, inmem.NewArticleService(db), tokens, db.Close)
+}
+
+// runSqlite serves users and articles stored in a SQLite file, for small
+// deployments. Other features need Postgres.
+func (m *Main) runSqlite() error {
+	key, err := m.signingKeyEncryptionKey()
+	if err != nil {
+		return err
+	}
+	db, err := sqlite.Open(m.Config.SqlitePath, m.Config.SqliteBusyTimeout)
+	if err != nil {
+		return err
+	}
+	if err := db.Migrate(m.Config.SqliteMigrations); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	signingKeyService := sqlite.NewSigningKeyService(db, key)
+	if err := signingKeyService.EncryptKeys(); err != nil {
+		return err
+	}
+	if err := ensureSigningKey(signingKeyService, m.Config.JwtAlgorithm); err != nil {
+		return err
+	}
+
+	tokens := keyring.New(signingKeyService)
+	userService := sqlite.NewUserService(db, tokens)
+	userService.Passwords = password.NewHasher(m.passwordParams())
+	if userService.Policy, err = m.passwordPolicy(); err != nil {
+		return err
+	}
+	userService.Mailer = m.mailer()
+	userService.ConfirmEmailURL = m.Config.ConfirmEmailUrl
+
+	return m.serveStandalone(userService, userService.Policy, sqlite.NewArticleService(db), tokens, db.Close)
+}
+
+// serveStandalone starts the server of a storage backend other than
+// Postgres, calling closeDb on shutdown.
+func (m *Main) serveStandalone(us app.UserService, policy app.PasswordPolicy, as app.ArticleService, tokens *keyring.Ring, closeDb func() error) error {
+	httpServer := m.newHttpServer()
+	httpServer.UserService = us
+	httpServer.PasswordPolicy = policy
+	cachedArticles, closeCache := m.cachedArticles(as)
+	httpServer.ArticleService = cachedArticles
+	httpServer.SigningKeys = tokens
+
+	if m.Config.CookieSessions {
+		cookies, err := m.sessionCookies()
+		if err != nil {
+			return err
+		}
+		httpServer.SessionCookies = cookies
+	}
+
+	if err := httpServer.Start(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(m.Stdout, "Listening on port: %s (%s storage)\n", httpServer.Addr, m.Config.Storage)
+
+	m.closeFn = func() error {
+		_ = httpServer.Close()
+		closeCache()
+		return closeDb()
+	}
+
+	return nil
+}
+
+// newHttpServer returns a server configured with everything but services.
+func (m *Main) newHttpServer() *http.Server {
+	httpServer := http.NewServer()
+	httpServer.Addr = ":8080"
+	if m.Config.CompressionMinSize > 0 {
+		httpServer.CompressionMinSize = m.Config.CompressionMinSize
+	}
+	return httpServer
+}
+
+// mailer returns the SMTP mailer, or without SMTP settings one writing
+// emails to stdout.
+func (m *Main) mailer() app.Mailer {
+	if m.Config.SmtpAddr == "" {
+		return &mail.LogMailer{W: m.Stdout}
+	}
+	return mail.NewSMTPMailer(m.Config.SmtpAddr, m.Config.SmtpFrom, m.Config.SmtpUsername, m.Config.SmtpPassword)
+}
+
+// passwordPolicy returns the policy new passwords are checked against.
+func (m *Main) passwordPolicy() (*password.Policy, error) {
+	policy := password.NewPolicy(m.Config.PasswordMinLength, m.Config.PasswordMaxLength)
+	if m.Config.BreachedPasswordsFile != "" {
+		if err := policy.LoadBreachedFile(m.Config.BreachedPasswordsFile); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// jobInterval is how often background jobs run.
+const jobInterval = 30 * time.Second
+
+// runJobs builds pending data exports, deletes accounts whose grace period
+// is over and empties the article trash and the outbox of what's past
+// retention, every interval until the returned function is called.
+func (m *Main) runJobs(as app.AccountService, ts app.ArticleTrashService, wq app.WebhookQueue, interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := as.ProcessExports(); err != nil {
+				_, _ = fmt.Fprintln(m.Stderr, "cannot process data exports:", err)
+			}
+			if _, err := as.PurgeDeleted(); err != nil {
+				_, _ = fmt.Fprintln(m.Stderr, "cannot purge deleted accounts:", err)
+			}
+			if _, err := ts.PurgeTrash(); err != nil {
+				_, _ = fmt.Fprintln(m.Stderr, "cannot purge trashed articles:", err)
+			}
+			if _, err := wq.Purge(); err != nil {
+				_, _ = fmt.Fprintln(m.Stderr, "cannot purge delivered events:", err)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// RunCommand executes a one-off administrative command.
+func (m *Main) RunCommand(args []string) error {
+	switch {
+	case len(args) >= 2 && args[0] == "keys" && args[1] == "rotate":
+		return m.rotateKeys(args[2:])
+	default:
+		return fmt.Errorf("unknown command %q, expected: keys rotate [-alg RS256|EdDSA]", strings.Join(args, " "))
+	}
+}
+
+// rotateKeys makes a new signing key the active one. Running servers pick it
+// up within keyring.RefreshInterval and sign with it after
+// keyring.PublishDelay.
+func (m *Main) rotateKeys(args []string) error {
+	flags := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	flags.SetOutput(m.Stderr)
+	algorithm := flags.String("alg", m.Config.JwtAlgorithm, "signing algorithm, RS256 or EdDSA")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if m.Config.Storage == StorageSqlite {
+		return m.rotateSqliteKeys(*algorithm)
+	}
+	// a running server would overwrite the key in its snapshot on shutdown
+	if m.Config.Storage == StorageMemory {
+		return errors.New("keys rotate needs STORAGE=postgres or sqlite")
+	}
+
+	db, err := m.openDb()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	signingKeyService, err := m.signingKeyService(db)
+	if err != nil {
+		return err
+	}
+	k, err := signingKeyService.Rotate(*algorithm)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(m.Stdout, "Active signing key: %s (%s), signing from %s\n", k.ID, k.Algorithm, k.ActivatesAt.Format(time.RFC3339))
+	return nil
+}
+
+// signingKeyService returns the postgres signing keys, encrypted with
+// SIGNING_KEY_ENCRYPTION_KEY.
+func (m *Main) signingKeyService(db *postgres.DB) (*postgres.SigningKeyService, error) {
+	key, err := m.signingKeyEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return postgres.NewSigningKeyService(db, key), nil
+}
+
+// signingKeyEncryptionKey returns the key encrypting the stored signing
+// keys, whatever the storage.
+func (m *Main) signingKeyEncryptionKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(m.Config.SigningKeyEncryptionKey)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("SIGNING_KEY_ENCRYPTION_KEY must be 32 base64 encoded bytes")
+	}
+	return key, nil
+}
+
+// rotateSqliteKeys makes a new signing key the active one in the SQLite
+// database. Running servers pick it up within keyring.RefreshInterval and
+// sign with it after keyring.PublishDelay.
+func (m *Main) rotateSqliteKeys(algorithm string) error {
+	db, err := sqlite.Open(m.Config.SqlitePath, m.Config.SqliteBusyTimeout)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Migrate(m.Config.SqliteMigrations); err != nil {
+		return err
+	}
+
+	key, err := m.signingKeyEncryptionKey()
+	if err != nil {
+		return err
+	}
+	k, err := sqlite.NewSigningKeyService(db, key).Rotate(algorithm)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(m.Stdout, "Active signing key: %s (%s), signing from %s\n", k.ID, k.Algorithm, k.ActivatesAt.Format(time.RFC3339))
+	return nil
+}
+
+// loginThrottlePolicy returns the default policy with configured overrides.
+func (m *Main) loginThrottlePolicy() postgres.LoginThrottlePolicy {
+	policy := postgres.DefaultLoginThrottlePolicy
+	if m.Config.LoginFreeAttempts > 0 {
+		policy.FreeAttempts = m.Config.LoginFreeAttempts
+	}
+	if m.Config.LoginLockAfter > 0 {
+		policy.LockAfter = m.Config.LoginLockAfter
+	}
+	if m.Config.LoginLockDuration > 0 {
+		policy.LockDuration = m.Config.LoginLockDuration
+	}
+	if m.Config.LoginIPLockAfter > 0 {
+		policy.IPLockAfter = m.Config.LoginIPLockAfter
+	}
+	return policy
+}
+
+// passwordParams returns the default Argon2id parameters with configured
+// overrides. Existing hashes are upgraded as users log in.
+func (m *Main) passwordParams() password.Params {
+	params := password.DefaultParams
+	if m.Config.Argon2Memory > 0 {
+		params.Memory = m.Config.Argon2Memory
+	}
+	if m.Config.Argon2Iterations > 0 {
+		params.Iterations = m.Config.Argon2Iterations
+	}
+	if m.Config.Argon2Parallelism > 0 {
+		params.Parallelism = m.Config.Argon2Parallelism
+	}
+	return params
+}
+
+// sessionCookies returns the cookie session settings of browser clients.
+func (m *Main) sessionCookies() (*http.SessionCookies, error) {
+	cookies := http.NewSessionCookies()
+	if m.Config.CookieName != "" {
+		cookies.Name = m.Config.CookieName
+	}
+	cookies.Domain = m.Config.CookieDomain
+	cookies.Secure = !m.Config.CookieInsecure
+
+	switch strings.ToLower(m.Config.CookieSameSite) {
+	case "", "lax":
+		cookies.SameSite = nethttp.SameSiteLaxMode
+	case "strict":
+		cookies.SameSite = nethttp.SameSiteStrictMode
+	case "none":
+		if !cookies.Secure {
+			return nil, errors.New("COOKIE_SAMESITE=none requires secure cookies")
+		}
+		cookies.SameSite = nethttp.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown COOKIE_SAMESITE %q", m.Config.CookieSameSite)
+	}
+
+	switch m.Config.CsrfMode {
+	case "", http.CSRFDoubleSubmit:
+		cookies.CSRF = http.CSRFDoubleSubmit
+	case http.CSRFSynchronizer:
+		if m.Config.ApiSecret == "" {
+			return nil, errors.New("API_SECRET is required to sign CSRF tokens")
+		}
+		cookies.CSRF = http.CSRFSynchronizer
+		cookies.CSRFSecret = m.secret(secretCSRF)
+	default:
+		return nil, fmt.Errorf("unknown CSRF_MODE %q", m.Config.CsrfMode)
+	}
+
+	return cookies, nil
+}
+
+func (m *Main) openDb() (*postgres.DB, error) {
+	dsn, err := m.dataSourceName()
+	if err != nil {
+		return nil, err
+	}
+	db, err := postgres.Open(dsn, m.poolOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	// replicas that can't be reached yet are used once they can
+	var replicas []*postgres.DB
+	for i, replicaUrl := range m.Config.DbReplicaUrls {
+		dsn, err := m.urlDataSourceName("DB_REPLICA_URLS", replicaUrl)
+		if err == nil {
+			var replica *postgres.DB
+			if replica, err = postgres.OpenReplica(dsn, m.poolOptions()); err == nil {
+				replicas = append(replicas, replica)
+				continue
+			}
+		}
+		for _, r := range replicas {
+			_ = r.Close()
+		}
+		_ = db.Close()
+		return nil, fmt.Errorf("replica %d: %s", i+1, err)
+	}
+	if len(replicas) > 0 {
+		db.UseReplicas(m.replicaOptions(), replicas...)
+	}
+	return db, nil
+}
+
+func (m *Main) replicaOptions() postgres.ReplicaOptions {
+	opts := postgres.DefaultReplicaOptions
+	if m.Config.DbReplicaHealthInterval > 0 {
+		opts.HealthCheckInterval = m.Config.DbReplicaHealthInterval
+	}
+	opts.LogQueries = m.Config.DbLogQueries
+	return opts
+}
+
+// defaultReadYourWritesWindow covers the replication lag of a replica nearby.
+const defaultReadYourWritesWindow = 5 * time.Second
+
+// readYourWritesWindow returns how long clients read from the primary after
+// writing, if there are replicas.
+func (m *Main) readYourWritesWindow() time.Duration {
+	if len(m.Config.DbReplicaUrls) == 0 {
+		return 0
+	}
+	if m.Config.DbReadYourWritesWindow > 0 {
+		return m.Config.DbReadYourWritesWindow
+	}
+	return defaultReadYourWritesWindow
+}
+
+// dataSourceName returns DATABASE_URL, or the connection string of the
+// discrete DB_* fields. Application name and statement timeout are added to
+// the URL unless it sets them itself.
+func (m *Main) dataSourceName() (string, error) {
+	c := m.Config
+	if c.DatabaseUrl != "" {
+		return m.urlDataSourceName("DATABASE_URL", c.DatabaseUrl)
+	}
+
+	statementTimeout := ""
+	if c.DbStatementTimeout > 0 {
+		statementTimeout = fmt.Sprint(c.DbStatementTimeout.Milliseconds())
+	}
+
+	params := [][2]string{
+		{"host", c.DbHost},
+		{"port", c.DbPort},
+		{"user", c.DbUser},
+		{"dbname", c.DbName},
+		{"password", c.DbPassword},
+		{"sslmode", c.DbSslMode},
+		{"sslrootcert", c.DbSslRootCert},
+		{"application_name", c.DbApplicationName},
+		{"statement_timeout", statementTimeout},
+	}
+	var parts []string
+	for _, p := range params {
+		if p[1] != "" {
+			parts = append(parts, p[0]+"="+quoteParam(p[1]))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// urlDataSourceName adds application name and statement timeout to a
+// postgres:// URL, unless it sets them itself.
+func (m *Main) urlDataSourceName(name string, rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %s", name, err)
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return "", fmt.Errorf("invalid %s: unknown scheme %q", name, u.Scheme)
+	}
+
+	q := u.Query()
+	if q.Get("application_name") == "" && m.Config.DbApplicationName != "" {
+		q.Set("application_name", m.Config.DbApplicationName)
+	}
+	if q.Get("statement_timeout") == "" && m.Config.DbStatementTimeout > 0 {
+		q.Set("statement_timeout", fmt.Sprint(m.Config.DbStatementTimeout.Milliseconds()))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// quoteParam quotes a value of a key=value connection string, so passwords
+// may contain spaces and quotes.
+func quoteParam(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+	return "'" + v + "'"
+}
+
+func (m *Main) poolOptions() postgres.PoolOptions {
+	return postgres.PoolOptions{
+		MaxOpenConns:    m.Config.DbMaxOpenConns,
+		MaxIdleConns:    m.Config.DbMaxIdleConns,
+		ConnMaxLifetime: m.Config.DbConnMaxLifetime,
+		ConnMaxIdleTime: m.Config.DbConnMaxIdleTime,
+		PingAttempts:    m.Config.DbConnectAttempts,
+		PingBackoff:     postgres.DefaultPoolOptions.PingBackoff,
+	}
+}
+
+// cachedArticles wraps an article service with the ARTICLE_CACHE, returning
+// a function closing the cache.
+func (m *Main) cachedArticles(as app.ArticleService) (app.ArticleService, func()) {
+	var store cache.Store
+	closeStore := func() {}
+	switch m.Config.ArticleCache {
+	case "":
+		return as, closeStore
+	case CacheMemory:
+		store = cache.NewLRU(m.Config.ArticleCacheSize)
+	case CacheRedis:
+		redis := cache.NewRedis(m.Config.RedisAddr)
+		redis.Password = m.Config.RedisPassword
+		redis.DB = m.Config.RedisDB
+		redis.Prefix = "go-rest-template:"
+		// a cache that's down is bypassed, so it doesn't prevent startup
+		if err := redis.Ping(); err != nil {
+			_, _ = fmt.Fprintf(m.Stderr, "cannot reach redis, articles are looked up without cache until it's back: %s\n", err)
+		}
+		store = redis
+		closeStore = func() { _ = redis.Close() }
+	}
+
+	cached := cache.NewArticleService(as, store)
+	cached.TTL = m.Config.ArticleCacheTTL
+	cached.NotFoundTTL = m.Config.ArticleCacheNotFoundTTL
+	return cached, closeStore
+}
+
+// serveMetrics serves the expvar variables, like the queries each database
+// pool served, on METRICS_ADDR. It is kept off the API address, as the
+// variables include the command line.
+func (m *Main) serveMetrics() (func(), error) {
+	if m.Config.MetricsAddr == "" {
+		return func() {}, nil
+	}
+
+	ln, err := net.Listen("tcp", m.Config.MetricsAddr)
+	if err != nil {
+		return nil, err
+	}
+	mux := nethttp.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	go func() { _ = nethttp.Serve(ln, mux) }()
+
+	_, _ = fmt.Fprintf(m.Stdout, "Serving metrics on: %s\n", ln.Addr())
+	return func() { _ = ln.Close() }, nil
+}
+
+// Purposes of the keys derived from API_SECRET.
+const (
+	secretCSRF      = "csrf"
+	secretExportURL = "export-url"
+	secretOIDCState = "oidc-state"
+)
+
+// secret returns the key of one purpose, derived from API_SECRET so a key
+// leaking or misused in one place doesn't sign for another. It's the HKDF
+// expand step (RFC 5869) for a single block, with purpose as the info.
+func (m *Main) secret(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(m.Config.ApiSecret))
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
+
+// ensureSigningKey creates the first signing key if there is no active one.
+func ensureSigningKey(ks app.SigningKeyService, algorithm string) error {
+	keys, err := ks.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k.Active {
+			return nil
+		}
+	}
+
+	_, err = ks.Rotate(algorithm)
+	return err
+}
+
+// Stores of the ARTICLE_CACHE config.
+const (
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+// Storage backends of the STORAGE config.
+const (
+	StoragePostgres = "postgres"
+	StorageSqlite   = "sqlite"
+	StorageMemory   = "memory"
+)
+
 type Config struct {
+	Storage           string        // postgres (default), sqlite or memory
+	MemorySnapshot    string        // JSON file users and articles are kept in with STORAGE=memory
+	SqlitePath        string        // database file with STORAGE=sqlite, app.db by default
+	SqliteMigrations  string        // sqlite/migrations by default
+	SqliteBusyTimeout time.Duration // how long writes wait for each other
+
 	DbUser     string
 	DbPassword string
 	DbPort     string
 	DbHost     string
 	DbName     string
-	ApiSecret  string
+	ApiSecret  string // keys of CSRF tokens, export URLs and OIDC login state are derived from it
+
+	DatabaseUrl        string        // postgres://..., replaces the DB_* fields above
+	DbSslMode          string        // disable (default), require, verify-ca or verify-full
+	DbSslRootCert      string        // CA certificate file for verify-ca and verify-full
+	DbMaxOpenConns     int           // 0 is unlimited
+	DbMaxIdleConns     int           // 0 keeps the database/sql default of 2
+	DbConnMaxLifetime  time.Duration // 0 keeps connections forever
+	DbConnMaxIdleTime  time.Duration
+	DbStatementTimeout time.Duration // queries running longer are cancelled by the server
+	DbApplicationName  string        // shown in pg_stat_activity, go-rest-template by default
+	DbConnectAttempts  int           // pings at startup before giving up, 5 by default
+
+	DbReplicaUrls           []string      // postgres:// URLs of read replicas, comma separated
+	DbReadYourWritesWindow  time.Duration // how long clients read from the primary after writing, 5s by default
+	DbReplicaHealthInterval time.Duration // 5s by default
+	DbLogQueries            bool          // logs the pool serving each query
+	DbRowLevelSecurity      bool          // also scopes articles to workspaces with the row-level security policy
+
+	MetricsAddr string // optional, serves /debug/vars on a separate address, e.g. localhost:9090
+
+	ArticleCache            string        // memory or redis, articles aren't cached when empty
+	ArticleCacheSize        int           // articles kept in memory, 10000 by default
+	ArticleCacheTTL         time.Duration // 1m by default
+	ArticleCacheNotFoundTTL time.Duration // of slugs without article, 10s by default
+	RedisAddr               string        // host:port
+	RedisPassword           string
+	RedisDB                 int
+
+	CompressionMinSize int
+
+	TotpEncryptionKey string // base64, 32 bytes
+	TotpIssuer        string
+
+	JwtAlgorithm            string // algorithm of new signing keys, RS256 or EdDSA
+	SigningKeyEncryptionKey string // base64, 32 bytes, encrypts the stored signing keys
+
+	OidcProviders map[string]oidc.Config // by name, as used in /auth/oidc/{provider}
+
+	LoginFreeAttempts int           // failed logins before delays start
+	LoginLockAfter    int           // failed logins before the account gets locked
+	LoginLockDuration time.Duration // e.g. 15m
+	LoginIPLockAfter  int           // failed logins from one IP before it gets locked
+
+	SmtpAddr     string // host:port, emails are logged when empty
+	SmtpFrom     string
+	SmtpUsername string
+	SmtpPassword string
+
+	ConfirmEmailUrl string // page of the web app that confirms email changes
+
+	DeletionGracePeriod time.Duration // until a deleted account is gone for good
+	TrashRetention      time.Duration // until a deleted article is gone for good
+
+	WorkspaceDomain string // e.g. example.com, to resolve workspaces from subdomains
+
+	WebhookRetention   time.Duration // how long delivered events are kept, 7 days by default
+	WebhookMaxAttempts int           // before a delivery is dead-lettered, 10 by default
+
+	StreamBufferSize int      // latest events streaming clients can resume from
+	WebSocketOrigins []string // e.g. https://editor.example.com, besides our own
+
+	SessionCacheTTL time.Duration // how long revoked sessions may still work on other instances
+
+	CookieSessions bool   // set tokens in cookies for browser clients
+	CookieName     string // "session" by default
+	CookieDomain   string
+	CookieInsecure bool   // allows cookies over plain HTTP, for development
+	CookieSameSite string // lax (default), strict or none
+	CsrfMode       string // double-submit (default) or synchronizer
+
+	PasswordMinLength     int    // in characters, 8 by default
+	PasswordMaxLength     int    // in bytes, 1024 by default
+	BreachedPasswordsFile string // one password or SHA-1 hex digest per line
+	Argon2Memory          uint32 // in KiB
+	Argon2Iterations      uint32
+	Argon2Parallelism     uint8
 }
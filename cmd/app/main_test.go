@@ -1,10 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/cache"
+	"github.com/leartgjoni/go-rest-template/cache/redistest"
+	apphttp "github.com/leartgjoni/go-rest-template/http"
+	"github.com/leartgjoni/go-rest-template/inmem"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/password"
+	"github.com/leartgjoni/go-rest-template/postgres"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMainIntegration(t *testing.T) {
@@ -46,3 +59,382 @@ func TestMainIntegration(t *testing.T) {
 		t.Fatalf("Expected 'healthy' but got %s", string(body))
 	}
 }
+
+// testEncryptionKey encrypts the signing keys stored by tests.
+const testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestMain_RunInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inmem")
+	if err != nil {
+		t.Fatal("cannot create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewMain()
+	m.Stdout = ioutil.Discard
+	m.Config = Config{
+		Storage:                 StorageMemory,
+		SigningKeyEncryptionKey: testEncryptionKey,
+		MemorySnapshot:          filepath.Join(dir, "snapshot.json"),
+		JwtAlgorithm:            app.AlgorithmEdDSA,
+		PasswordMinLength:       8,
+		PasswordMaxLength:       1024,
+	}
+	if err := m.Run(); err != nil {
+		t.Fatal("cannot run main", err)
+	}
+
+	signup(t)
+
+	// the user is kept in the snapshot
+	if err := m.Close(); err != nil {
+		t.Fatal("cannot close main", err)
+	}
+
+	key, _ := base64.StdEncoding.DecodeString(testEncryptionKey)
+	db, err := inmem.Open(m.Config.MemorySnapshot, key)
+	if err != nil {
+		t.Fatal("cannot open snapshot", err)
+	}
+	if _, err := inmem.NewUserService(db, nil).GetByUsername("test"); err != nil {
+		t.Fatal("cannot get user from snapshot", err)
+	}
+}
+
+func TestMain_RunSqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal("cannot create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewMain()
+	m.Stdout = ioutil.Discard
+	m.Config = Config{
+		Storage:                 StorageSqlite,
+		SigningKeyEncryptionKey: testEncryptionKey,
+		SqlitePath:              filepath.Join(dir, "app.db"),
+		SqliteMigrations:        "../../sqlite/migrations",
+		SqliteBusyTimeout:       time.Second,
+		JwtAlgorithm:            app.AlgorithmEdDSA,
+		PasswordMinLength:       8,
+		PasswordMaxLength:       1024,
+	}
+	if err := m.Run(); err != nil {
+		t.Fatal("cannot run main", err)
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			t.Fatal("cannot close main", err)
+		}
+	}()
+
+	signup(t)
+
+	if err := m.RunCommand([]string{"keys", "rotate"}); err != nil {
+		t.Fatal("cannot rotate keys", err)
+	}
+}
+
+// signup signs up a user with the server listening on :8080.
+func signup(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost:8080/auth/signup", strings.NewReader(`{"username":"test","email":"test@test.com","password":"random-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	// the connection mustn't be reused with the server of another test
+	req.Close = true
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("http post failed", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("cannot sign up, got status %d", resp.StatusCode)
+	}
+}
+
+func TestMain_RunCommand(t *testing.T) {
+	m := NewMain()
+	m.Stderr = ioutil.Discard
+
+	if err := m.RunCommand([]string{"keys"}); err == nil || !strings.HasPrefix(err.Error(), "unknown command") {
+		t.Fatalf("expected unknown command error but got %v", err)
+	}
+
+	if err := m.RunCommand([]string{"keys", "rotate", "-random"}); err == nil {
+		t.Fatal("expected unknown flag to be rejected")
+	}
+}
+
+func TestEnsureSigningKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          []*app.SigningKey
+		rotateInvoked bool
+	}{
+		{
+			name:          "first start",
+			keys:          []*app.SigningKey{},
+			rotateInvoked: true,
+		},
+		{
+			name:          "active key",
+			keys:          []*app.SigningKey{{ID: "kid", Active: true}},
+			rotateInvoked: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ks := &mock.SigningKeyService{
+				KeysFn: func() ([]*app.SigningKey, error) { return test.keys, nil },
+				RotateFn: func(algorithm string) (*app.SigningKey, error) {
+					return &app.SigningKey{ID: "kid", Algorithm: algorithm, Active: true}, nil
+				},
+			}
+
+			if err := ensureSigningKey(ks, app.AlgorithmEdDSA); err != nil {
+				t.Fatal("cannot ensure signing key", err)
+			}
+
+			if ks.RotateInvoked != test.rotateInvoked {
+				t.Fatalf("expected RotateInvoked to be %v", test.rotateInvoked)
+			}
+		})
+	}
+}
+
+func TestMain_LoginThrottlePolicy(t *testing.T) {
+	m := NewMain()
+	if policy := m.loginThrottlePolicy(); policy != postgres.DefaultLoginThrottlePolicy {
+		t.Fatalf("expected default policy but got %+v", policy)
+	}
+
+	m.Config.LoginLockAfter = 5
+	m.Config.LoginLockDuration = time.Hour
+	policy := m.loginThrottlePolicy()
+	if policy.LockAfter != 5 || policy.LockDuration != time.Hour || policy.FreeAttempts != postgres.DefaultLoginThrottlePolicy.FreeAttempts {
+		t.Fatalf("wrong policy %+v", policy)
+	}
+}
+
+func TestMain_PasswordParams(t *testing.T) {
+	m := NewMain()
+	if params := m.passwordParams(); params != password.DefaultParams {
+		t.Fatalf("expected default params but got %+v", params)
+	}
+
+	m.Config.Argon2Memory = 19 * 1024
+	m.Config.Argon2Iterations = 2
+	params := m.passwordParams()
+	if params.Memory != 19*1024 || params.Iterations != 2 || params.Parallelism != password.DefaultParams.Parallelism {
+		t.Fatalf("wrong params %+v", params)
+	}
+}
+
+func TestMain_DataSourceName(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		dsn    string
+		err    bool
+	}{
+		{
+			"discrete fields",
+			Config{DbHost: "localhost", DbPort: "5432", DbUser: "app", DbName: "app", DbPassword: `it's a \secret`, DbSslMode: "verify-full", DbSslRootCert: "/etc/ca.pem", DbApplicationName: "api", DbStatementTimeout: 30 * time.Second},
+			`host='localhost' port='5432' user='app' dbname='app' password='it\'s a \\secret' sslmode='verify-full' sslrootcert='/etc/ca.pem' application_name='api' statement_timeout='30000'`,
+			false,
+		},
+		{
+			"url",
+			Config{DatabaseUrl: "postgres://app:secret@db:5432/app?sslmode=require", DbHost: "ignored", DbApplicationName: "api", DbStatementTimeout: time.Second},
+			"postgres://app:secret@db:5432/app?application_name=api&sslmode=require&statement_timeout=1000",
+			false,
+		},
+		{
+			"url with own parameters",
+			Config{DatabaseUrl: "postgresql://db/app?application_name=worker&statement_timeout=5", DbApplicationName: "api", DbStatementTimeout: time.Second},
+			"postgresql://db/app?application_name=worker&statement_timeout=5",
+			false,
+		},
+		{
+			"not a postgres url",
+			Config{DatabaseUrl: "mysql://db/app"},
+			"",
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMain()
+			m.Config = tt.config
+			dsn, err := m.dataSourceName()
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if dsn != tt.dsn {
+				t.Fatalf("wrong data source name. expected %s but got %s", tt.dsn, dsn)
+			}
+		})
+	}
+}
+
+func TestMain_PoolOptions(t *testing.T) {
+	m := NewMain()
+	m.Config.DbMaxOpenConns = 20
+	m.Config.DbConnMaxLifetime = time.Hour
+	m.Config.DbConnectAttempts = 3
+
+	opts := m.poolOptions()
+	if opts.MaxOpenConns != 20 || opts.MaxIdleConns != 0 || opts.ConnMaxLifetime != time.Hour || opts.PingAttempts != 3 || opts.PingBackoff != postgres.DefaultPoolOptions.PingBackoff {
+		t.Fatalf("wrong options %+v", opts)
+	}
+}
+
+func TestMain_ReplicaOptions(t *testing.T) {
+	m := NewMain()
+	if opts := m.replicaOptions(); opts != postgres.DefaultReplicaOptions {
+		t.Fatalf("expected default options but got %+v", opts)
+	}
+
+	m.Config.DbLogQueries = true
+	opts := m.replicaOptions()
+	if !opts.LogQueries || opts.HealthCheckInterval != postgres.DefaultReplicaOptions.HealthCheckInterval {
+		t.Fatalf("wrong options %+v", opts)
+	}
+}
+
+func TestMain_ReadYourWritesWindow(t *testing.T) {
+	m := NewMain()
+	if window := m.readYourWritesWindow(); window != 0 {
+		t.Fatalf("expected no window without replicas but got %s", window)
+	}
+
+	m.Config.DbReplicaUrls = []string{"postgres://replica"}
+	if window := m.readYourWritesWindow(); window != defaultReadYourWritesWindow {
+		t.Fatalf("expected the default window but got %s", window)
+	}
+
+	m.Config.DbReadYourWritesWindow = time.Minute
+	if window := m.readYourWritesWindow(); window != time.Minute {
+		t.Fatalf("expected a window of %s but got %s", time.Minute, window)
+	}
+}
+
+func TestMain_CachedArticles(t *testing.T) {
+	as := &mock.ArticleService{}
+
+	m := NewMain()
+	if cached, _ := m.cachedArticles(as); cached != as {
+		t.Fatal("expected articles not to be cached by default")
+	}
+
+	m.Config.ArticleCache = CacheMemory
+	m.Config.ArticleCacheTTL = time.Hour
+	cached, closeCache := m.cachedArticles(as)
+	defer closeCache()
+	if c, ok := cached.(*cache.ArticleService); !ok || c.TTL != time.Hour {
+		t.Fatalf("wrong article service %+v", cached)
+	}
+
+	srv := redistest.NewServer("secret")
+	defer srv.Close()
+	m.Config.ArticleCache = CacheRedis
+	m.Config.RedisAddr = srv.Addr
+	m.Config.RedisPassword = "secret"
+	m.Stderr = &strings.Builder{}
+	_, closeCache = m.cachedArticles(as)
+	defer closeCache()
+	if m.Stderr.(*strings.Builder).Len() != 0 {
+		t.Fatalf("expected redis to be reachable but got %s", m.Stderr)
+	}
+}
+
+func TestMain_SessionCookies(t *testing.T) {
+	m := NewMain()
+	cookies, err := m.sessionCookies()
+	if err != nil {
+		t.Fatal("cannot configure cookies", err)
+	}
+	if cookies.Name != "session" || !cookies.Secure || cookies.SameSite != http.SameSiteLaxMode || cookies.CSRF != apphttp.CSRFDoubleSubmit {
+		t.Fatalf("wrong cookies %+v", cookies)
+	}
+
+	m.Config.CsrfMode = apphttp.CSRFSynchronizer
+	if _, err := m.sessionCookies(); err == nil {
+		t.Fatal("expected synchronizer tokens to need a secret")
+	}
+
+	m.Config.ApiSecret = "random-secret"
+	m.Config.CookieInsecure = true
+	m.Config.CookieSameSite = "none"
+	if _, err := m.sessionCookies(); err == nil {
+		t.Fatal("expected SameSite=None to need secure cookies")
+	}
+
+	m.Config.CookieSameSite = "strict"
+	cookies, err = m.sessionCookies()
+	if err != nil {
+		t.Fatal("cannot configure cookies", err)
+	}
+	if cookies.Secure || cookies.SameSite != http.SameSiteStrictMode || cookies.CSRF != apphttp.CSRFSynchronizer || !bytes.Equal(cookies.CSRFSecret, m.secret(secretCSRF)) {
+		t.Fatalf("wrong cookies %+v", cookies)
+	}
+}
+
+func TestMain_Secret(t *testing.T) {
+	m := NewMain()
+	m.Config.ApiSecret = "random-secret"
+
+	csrf := m.secret(secretCSRF)
+	if len(csrf) != 32 || bytes.Equal(csrf, []byte(m.Config.ApiSecret)) {
+		t.Fatalf("expected a derived key but got %x", csrf)
+	}
+	if !bytes.Equal(csrf, m.secret(secretCSRF)) {
+		t.Fatal("expected the same key for the same purpose")
+	}
+	if bytes.Equal(csrf, m.secret(secretExportURL)) || bytes.Equal(csrf, m.secret(secretOIDCState)) || bytes.Equal(m.secret(secretExportURL), m.secret(secretOIDCState)) {
+		t.Fatal("expected a different key for each purpose")
+	}
+}
+
+func TestMain_RunJobs(t *testing.T) {
+	m := NewMain()
+	m.Stderr = ioutil.Discard
+
+	runs := make(chan struct{}, 10)
+	as := &mock.AccountService{
+		ProcessExportsFn: func() (int, error) { return 0, nil },
+		PurgeDeletedFn: func() (int, error) {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+			return 0, nil
+		},
+	}
+
+	ts := &mock.ArticleTrashService{
+		PurgeTrashFn: func() (int, error) { return 0, nil },
+	}
+
+	wq := &mock.WebhookQueue{
+		PurgeFn: func() (int, error) { return 0, nil },
+	}
+
+	stop := m.runJobs(as, ts, wq, time.Millisecond)
+	<-runs
+	<-runs
+	stop()
+
+	if !as.ProcessExportsInvoked {
+		t.Fatal("expected exports to be processed")
+	}
+	if !ts.PurgeTrashInvoked {
+		t.Fatal("expected the trash to be purged")
+	}
+	if !wq.PurgeInvoked {
+		t.Fatal("expected the outbox to be purged")
+	}
+}
@@ -0,0 +1,391 @@
+// Package collab lets the users working on an article see each other: who
+// is viewing or editing it, where their cursors are, and when it changes.
+//
+// Every article has a room of the WebSockets open on it. Clients send JSON
+// messages, {"type":"mode","mode":"editing"} to say what they're doing and
+// {"type":"cursor","cursor":...} with their cursor, in whatever shape the
+// editor uses. The room sends presence messages listing its clients when
+// they come, go or change mode, the cursors of the others, and changed
+// messages with the article when it's updated or deleted.
+//
+// Rooms are per instance: clients see the others connected to the same
+// instance, while changes reach them from any instance.
+package collab
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	app "github.com/leartgjoni/go-rest-template"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message types.
+const (
+	MessageWelcome  = "welcome"  // to a client joining, with its id
+	MessagePresence = "presence" // the clients in the room
+	MessageMode     = "mode"     // from a client, changing its mode
+	MessageCursor   = "cursor"   // the cursor of a client
+	MessageChanged  = "changed"  // the article was updated or deleted
+)
+
+// Modes of clients.
+const (
+	ModeViewing = "viewing"
+	ModeEditing = "editing"
+)
+
+// DefaultPingInterval is how often clients are pinged. Those not answering
+// within twice the interval are disconnected.
+const DefaultPingInterval = 30 * time.Second
+
+const (
+	// writeWait is how long a client may take to accept a message.
+	writeWait = 10 * time.Second
+
+	// maxMessageSize bounds the messages of clients, in bytes.
+	maxMessageSize = 4096
+
+	// sendBuffer is how many messages a client may fall behind by before
+	// it's disconnected.
+	sendBuffer = 64
+)
+
+// Message is exchanged with clients as JSON.
+type Message struct {
+	Type     string          `json:"type"`
+	ClientId uint64          `json:"client_id,omitempty"`
+	UserId   uint32          `json:"user_id,omitempty"`
+	Mode     string          `json:"mode,omitempty"`
+	Cursor   json.RawMessage `json:"cursor,omitempty"`
+	Clients  []*Presence     `json:"clients,omitempty"`
+	Event    string          `json:"event,omitempty"`   // of changed messages, e.g. article.updated
+	Article  json.RawMessage `json:"article,omitempty"` // of changed messages
+}
+
+// Presence is a client in a room.
+type Presence struct {
+	ClientId uint64 `json:"client_id"`
+	UserId   uint32 `json:"user_id"`
+	Username string `json:"username"`
+	Mode     string `json:"mode"`
+}
+
+// Hub keeps the rooms of the articles being worked on.
+type Hub struct {
+	PingInterval time.Duration
+
+	mu      sync.Mutex
+	rooms   map[uint32]map[*client]bool // clients by article id
+	lastId  uint64                      // of clients
+	closed  bool
+	clients sync.WaitGroup
+
+	sub     app.EventSubscription // of Follow
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewHub returns a new instance of Hub.
+func NewHub() *Hub {
+	return &Hub{
+		PingInterval: DefaultPingInterval,
+		rooms:        map[uint32]map[*client]bool{},
+		done:         make(chan struct{}),
+	}
+}
+
+type client struct {
+	Presence
+	articleId uint32
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{} // closed when the client left
+	kicked    bool          // the closing handshake started
+}
+
+// Serve runs the WebSocket of a user in the room of an article, until it's
+// closed by either side.
+func (h *Hub) Serve(conn *websocket.Conn, articleId uint32, user *app.User) {
+	c := &client{
+		Presence:  Presence{UserId: user.ID, Username: user.Username, Mode: ModeViewing},
+		articleId: articleId,
+		conn:      conn,
+		send:      make(chan []byte, sendBuffer),
+		done:      make(chan struct{}),
+	}
+	if !h.join(c) {
+		_ = writeClose(conn, websocket.CloseGoingAway, "shutting down")
+		_ = conn.Close()
+		return
+	}
+	defer h.clients.Done()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		h.write(c)
+	}()
+
+	h.read(c)
+
+	h.leave(c)
+	<-stopped
+	_ = conn.Close()
+}
+
+// join adds c to its room, unless the hub is closed.
+func (h *Hub) join(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.clients.Add(1)
+
+	h.lastId++
+	c.ClientId = h.lastId
+	room := h.rooms[c.articleId]
+	if room == nil {
+		room = map[*client]bool{}
+		h.rooms[c.articleId] = room
+	}
+	room[c] = true
+
+	h.sendTo(c, &Message{Type: MessageWelcome, ClientId: c.ClientId})
+	h.broadcastPresence(c.articleId)
+	return true
+}
+
+// leave removes c from its room.
+func (h *Hub) leave(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room := h.rooms[c.articleId]
+	if !room[c] {
+		return
+	}
+	delete(room, c)
+	close(c.done)
+	if len(room) == 0 {
+		delete(h.rooms, c.articleId)
+		return
+	}
+	h.broadcastPresence(c.articleId)
+}
+
+// read handles the messages of c until its connection is closed.
+func (h *Hub) read(c *client) {
+	pongWait := 2 * h.PingInterval
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			_ = writeClose(c.conn, websocket.CloseInvalidFramePayloadData, "invalid message")
+			return
+		}
+
+		switch m.Type {
+		case MessageMode:
+			if m.Mode != ModeViewing && m.Mode != ModeEditing {
+				continue
+			}
+			h.mu.Lock()
+			if c.Mode != m.Mode {
+				c.Mode = m.Mode
+				h.broadcastPresence(c.articleId)
+			}
+			h.mu.Unlock()
+		case MessageCursor:
+			h.mu.Lock()
+			h.broadcast(c.articleId, c, &Message{Type: MessageCursor, ClientId: c.ClientId, UserId: c.UserId, Cursor: m.Cursor})
+			h.mu.Unlock()
+		}
+	}
+}
+
+// write sends the messages of c and pings it, until it leaves. It's the
+// only writer of messages, while control messages may be written by any
+// goroutine and have deadlines of their own.
+func (h *Hub) write(c *client) {
+	ticker := time.NewTicker(h.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err = c.conn.WriteMessage(websocket.TextMessage, msg)
+		case <-ticker.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		}
+		if err != nil {
+			h.mu.Lock()
+			kicked := c.kicked
+			h.mu.Unlock()
+			// unless we're waiting for the client to answer our close, the
+			// connection is broken
+			if !kicked {
+				_ = c.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// kick starts closing the connection of c. It's closed when the client
+// answers, or after writeWait.
+func (h *Hub) kick(c *client, code int, reason string) {
+	h.mu.Lock()
+	c.kicked = true
+	h.mu.Unlock()
+
+	_ = writeClose(c.conn, code, reason)
+	_ = c.conn.SetReadDeadline(time.Now().Add(writeWait))
+}
+
+// writeClose starts the closing handshake of conn.
+func writeClose(conn *websocket.Conn, code int, reason string) error {
+	return conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+}
+
+// broadcastPresence sends the clients of a room to all of them. h.mu must
+// be held.
+func (h *Hub) broadcastPresence(articleId uint32) {
+	m := &Message{Type: MessagePresence, Clients: []*Presence{}}
+	for c := range h.rooms[articleId] {
+		p := c.Presence
+		m.Clients = append(m.Clients, &p)
+	}
+	sort.Slice(m.Clients, func(i, j int) bool { return m.Clients[i].ClientId < m.Clients[j].ClientId })
+	h.broadcast(articleId, nil, m)
+}
+
+// broadcast sends m to the clients of a room but except. h.mu must be held.
+func (h *Hub) broadcast(articleId uint32, except *client, m *Message) {
+	for c := range h.rooms[articleId] {
+		if c != except {
+			h.sendTo(c, m)
+		}
+	}
+}
+
+// sendTo queues m for c, disconnecting it if it fell behind. h.mu must be
+// held.
+func (h *Hub) sendTo(c *client, m *Message) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("collab: cannot encode %s message: %s", m.Type, err)
+		return
+	}
+
+	select {
+	case c.send <- b:
+	default:
+		if !c.kicked {
+			c.kicked = true
+			go func() {
+				_ = writeClose(c.conn, websocket.ClosePolicyViolation, "too slow")
+				_ = c.conn.SetReadDeadline(time.Now().Add(writeWait))
+			}()
+		}
+	}
+}
+
+// Follow sends the changes to articles published by b to their rooms,
+// until the hub is closed.
+func (h *Hub) Follow(b app.EventBroker) {
+	h.stopped = make(chan struct{})
+	go func() {
+		defer close(h.stopped)
+
+		var lastId int64
+		for {
+			sub, _ := b.Subscribe(lastId)
+			h.mu.Lock()
+			if h.closed {
+				h.mu.Unlock()
+				sub.Close()
+				return
+			}
+			h.sub = sub
+			h.mu.Unlock()
+
+			for e := range sub.Events() {
+				lastId = e.ID
+				h.changed(e)
+			}
+
+			// we fell behind, or the broker is closing
+			select {
+			case <-h.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+}
+
+// changed notifies the room of an article of a change to it.
+func (h *Hub) changed(e *app.Event) {
+	if e.Type != app.EventArticleUpdated && e.Type != app.EventArticleDeleted {
+		return
+	}
+	var article struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.Unmarshal(e.Data, &article); err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(article.ID, nil, &Message{Type: MessageChanged, Event: e.Type, Article: e.Data})
+}
+
+// Close closes the WebSockets of the rooms, telling clients we're going
+// away, and waits for them to be closed.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.done)
+	if h.sub != nil {
+		h.sub.Close()
+	}
+	var clients []*client
+	for _, room := range h.rooms {
+		for c := range room {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		h.kick(c, websocket.CloseGoingAway, "shutting down")
+	}
+	h.clients.Wait()
+	if h.stopped != nil {
+		<-h.stopped
+	}
+}
@@ -0,0 +1,173 @@
+package collab
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hubServer serves the room of article 1 with h, as the user named by the
+// username query parameter.
+func hubServer(h *Hub) (*httptest.Server, string) {
+	var lastUserId uint32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		lastUserId++
+		h.Serve(conn, 1, &app.User{ID: lastUserId, Username: r.URL.Query().Get("username")})
+	}))
+	return ts, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c
+}
+
+func readMessage(t *testing.T, c *websocket.Conn) string {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	return string(data)
+}
+
+func writeMessage(t *testing.T, c *websocket.Conn, m string) {
+	if err := c.WriteMessage(websocket.TextMessage, []byte(m)); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+}
+
+func expectMessage(t *testing.T, c *websocket.Conn, expected string) {
+	if received := readMessage(t, c); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
+
+func TestHub_Serve(t *testing.T) {
+	h := NewHub()
+	ts, url := hubServer(h)
+	defer ts.Close()
+	defer h.Close()
+
+	alice := dial(t, url+"?username=alice")
+	defer alice.Close()
+	expectMessage(t, alice, `{"type":"welcome","client_id":1}`)
+	expectMessage(t, alice, `{"type":"presence","clients":[{"client_id":1,"user_id":1,"username":"alice","mode":"viewing"}]}`)
+
+	bob := dial(t, url+"?username=bob")
+	defer bob.Close()
+	expectMessage(t, bob, `{"type":"welcome","client_id":2}`)
+	presence := `{"type":"presence","clients":[{"client_id":1,"user_id":1,"username":"alice","mode":"viewing"},{"client_id":2,"user_id":2,"username":"bob","mode":"viewing"}]}`
+	expectMessage(t, bob, presence)
+	expectMessage(t, alice, presence)
+
+	// modes are shared with everyone
+	writeMessage(t, bob, `{"type":"mode","mode":"editing"}`)
+	presence = `{"type":"presence","clients":[{"client_id":1,"user_id":1,"username":"alice","mode":"viewing"},{"client_id":2,"user_id":2,"username":"bob","mode":"editing"}]}`
+	expectMessage(t, alice, presence)
+	expectMessage(t, bob, presence)
+
+	// cursors with the others
+	writeMessage(t, bob, `{"type":"cursor","cursor":{"offset":12}}`)
+	expectMessage(t, alice, `{"type":"cursor","client_id":2,"user_id":2,"cursor":{"offset":12}}`)
+
+	// leaving is shared too
+	_ = bob.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	expectMessage(t, alice, `{"type":"presence","clients":[{"client_id":1,"user_id":1,"username":"alice","mode":"viewing"}]}`)
+}
+
+func TestHub_Follow(t *testing.T) {
+	b := stream.NewBroker(10)
+	h := NewHub()
+	h.Follow(b)
+	ts, url := hubServer(h)
+	defer ts.Close()
+	defer h.Close()
+
+	alice := dial(t, url+"?username=alice")
+	defer alice.Close()
+	readMessage(t, alice) // welcome
+	readMessage(t, alice) // presence
+
+	// wait for the hub to subscribe
+	for subscribed := false; !subscribed; {
+		h.mu.Lock()
+		subscribed = h.sub != nil
+		h.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	b.Publish(&app.Event{ID: 1, Type: app.EventArticleUpdated, Data: json.RawMessage(`{"id":2,"slug":"other"}`)})
+	b.Publish(&app.Event{ID: 2, Type: app.EventArticleUpdated, Data: json.RawMessage(`{"id":1,"slug":"hello"}`)})
+	expectMessage(t, alice, `{"type":"changed","event":"article.updated","article":{"id":1,"slug":"hello"}}`)
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub()
+	ts, url := hubServer(h)
+	defer ts.Close()
+
+	alice := dial(t, url+"?username=alice")
+	defer alice.Close()
+	readMessage(t, alice) // welcome
+	readMessage(t, alice) // presence
+
+	closed := make(chan struct{})
+	go func() {
+		// answering the close lets the hub finish
+		_, _, err := alice.ReadMessage()
+		if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.CloseGoingAway {
+			t.Errorf("wrong error %v", err)
+		}
+		close(closed)
+	}()
+
+	h.Close()
+	<-closed
+
+	// nobody joins afterwards
+	bob := dial(t, url+"?username=bob")
+	defer bob.Close()
+	if _, _, err := bob.ReadMessage(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestHub_PingTimeout(t *testing.T) {
+	h := NewHub()
+	h.PingInterval = 10 * time.Millisecond
+	ts, url := hubServer(h)
+	defer ts.Close()
+	defer h.Close()
+
+	// a client not reading doesn't answer pings either
+	alice := dial(t, url+"?username=alice")
+	defer alice.Close()
+	readMessage(t, alice) // welcome
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		h.mu.Lock()
+		rooms := len(h.rooms)
+		h.mu.Unlock()
+		if rooms == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client to be disconnected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
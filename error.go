@@ -12,9 +12,111 @@ const (
 	ErrWrongPasswordFormat = Error("wrong password format")
 	ErrUserNotFound        = Error("not found")
 	ErrWrongCredentials    = Error("wrong credentials")
+	ErrAccountLocked       = Error("account locked")
+	ErrUsernameAlreadyUsed = Error("username already in use")
+	ErrInvalidEmailChange  = Error("invalid or expired email confirmation")
+)
+
+// password policy errors
+const (
+	ErrPasswordTooShort = Error("password too short")
+	ErrPasswordTooLong  = Error("password too long")
+	ErrPasswordBreached = Error("password appears in a data breach")
+)
+
+// login throttling errors
+const (
+	ErrTooManyLoginAttempts = Error("too many login attempts")
+)
+
+// two-factor errors
+const (
+	ErrTwoFactorRequired       = Error("two-factor authentication required")
+	ErrTwoFactorAlreadyEnabled = Error("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled    = Error("two-factor authentication not enrolled")
+	ErrWrongTwoFactorCode      = Error("wrong two-factor code")
+	ErrInvalidChallenge        = Error("invalid or expired challenge")
+)
+
+// api key errors
+const (
+	ErrAPIKeyNotFound = Error("not found")
+	ErrInvalidAPIKey  = Error("invalid api key")
+)
+
+// session errors
+const (
+	ErrSessionNotFound = Error("not found")
+)
+
+// identity errors
+const (
+	ErrUnknownProvider   = Error("unknown identity provider")
+	ErrEmailNotVerified  = Error("email not verified by identity provider")
+	ErrInvalidLoginState = Error("invalid or expired login state")
+)
+
+// account errors
+const (
+	ErrInvalidArticleStrategy = Error("invalid article strategy")
+	ErrInvalidTransferTarget  = Error("invalid user to transfer articles to")
+	ErrDeletionNotScheduled   = Error("account deletion not scheduled")
+	ErrExportNotFound         = Error("not found")
 )
 
 // article errors
 const (
 	ErrArticleNotFound = Error("not found")
 )
+
+// signing key errors
+const (
+	ErrNoActiveSigningKey   = Error("no active signing key")
+	ErrUnsupportedAlgorithm = Error("unsupported signing algorithm")
+)
+
+// workspace errors
+const (
+	ErrWorkspaceNotFound  = Error("not found")
+	ErrWorkspaceSlugUsed  = Error("workspace slug already in use")
+	ErrMembershipNotFound = Error("not a member of the workspace")
+	ErrInvalidRole        = Error("invalid role")
+	ErrLastOwner          = Error("a workspace needs an owner")
+)
+
+// audit errors
+const (
+	ErrAuditChainBroken = Error("audit log hash chain broken")
+)
+
+// webhook errors
+const (
+	ErrWebhookNotFound = Error("not found")
+)
+
+// constraint errors, wrapped in a ConstraintError
+const (
+	ErrUniqueViolation     = Error("unique violation")
+	ErrForeignKeyViolation = Error("foreign key violation")
+	ErrNotNullViolation    = Error("not null violation")
+	ErrCheckViolation      = Error("check violation")
+)
+
+// ConstraintError is returned by storage when a write violates a
+// constraint. Err is one of the constraint errors, so callers can match it
+// with errors.Is and use Constraint to tell which column conflicted.
+type ConstraintError struct {
+	Err        error
+	Constraint string
+}
+
+// Error returns the error message. Fulfills the error interface
+func (e *ConstraintError) Error() string {
+	if e.Constraint == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + " of " + e.Constraint
+}
+
+// Unwrap returns the constraint error.
+func (e *ConstraintError) Unwrap() error { return e.Err }
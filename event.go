@@ -0,0 +1,44 @@
+package app
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain events, as delivered to webhooks and streamed to clients.
+const (
+	EventArticleCreated  = "article.created"
+	EventArticleUpdated  = "article.updated"
+	EventArticleDeleted  = "article.deleted"  // moved to the trash, or deleted with its author
+	EventArticleRestored = "article.restored" // from the trash
+	EventArticlePurged   = "article.purged"   // deleted for good from the trash
+)
+
+// EventTypes are the events webhooks can subscribe to.
+var EventTypes = []string{EventArticleCreated, EventArticleUpdated, EventArticleDeleted, EventArticleRestored, EventArticlePurged}
+
+// Event is a change written to the outbox with the write causing it, and
+// delivered to webhooks and subscribers from there.
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	WorkspaceId uint32          `json:"workspace_id"`
+	Data        json.RawMessage `json:"data"` // e.g. the article created
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// EventSubscription receives events until it's closed, by the subscriber or
+// by the broker, e.g. when the subscriber falls behind.
+type EventSubscription interface {
+	// Events is closed with the subscription.
+	Events() <-chan *Event
+	Close()
+}
+
+// EventBroker fans events out to subscribers as they're committed.
+type EventBroker interface {
+	// Subscribe replays the buffered events published after the one with
+	// lastId, then sends new ones. Zero lastId only sends new ones. Missed
+	// reports that lastId isn't buffered anymore, so events were missed.
+	Subscribe(lastId int64) (sub EventSubscription, missed bool)
+}
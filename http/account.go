@@ -0,0 +1,176 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportURLTTL is how long a signed export download URL works.
+const exportURLTTL = 15 * time.Minute
+
+// AccountHandler represents an HTTP handler for deleting and exporting accounts.
+type AccountHandler interface {
+	HandleDelete(w http.ResponseWriter, r *http.Request)
+	HandleRestore(w http.ResponseWriter, r *http.Request)
+	HandleExport(w http.ResponseWriter, r *http.Request)
+	HandleGetExport(w http.ResponseWriter, r *http.Request)
+	HandleDownloadExport(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type accountHandler struct {
+	// Services
+	AccountService app.AccountService
+
+	// Signs export download URLs.
+	URLSecret []byte
+}
+
+func NewAccountHandler(as app.AccountService, urlSecret []byte) *accountHandler {
+	return &accountHandler{AccountService: as, URLSecret: urlSecret}
+}
+
+// HandleDelete schedules the deletion of the user's account. It can be
+// cancelled at POST /users/me/restore until the grace period is over.
+func (h *accountHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.AccountDeletionRequest{}
+	if r.ContentLength == 0 {
+		// render.Bind doesn't accept an empty body
+		if err := data.Bind(r); err != nil {
+			utils.Render(w, r, payloads.ErrInvalidRequest(err))
+			return
+		}
+	} else if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	if err := h.AccountService.ScheduleDeletion(data.AccountDeletion, data.Password); err != nil {
+		utils.Render(w, r, accountHttpError(err))
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	utils.Render(w, r, payloads.NewAccountDeletionResponse(data.AccountDeletion))
+}
+
+func (h *accountHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.AccountService.CancelDeletion(userId); err != nil {
+		utils.Render(w, r, accountHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleExport starts building an archive of the user's data. Its status,
+// and the download URL once ready, is at GET /users/me/export/{exportId}.
+func (h *accountHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	e, err := h.AccountService.RequestExport(userId)
+	if err != nil {
+		utils.Render(w, r, accountHttpError(err))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/users/me/export/%d", e.ID))
+	render.Status(r, http.StatusAccepted)
+	utils.Render(w, r, payloads.NewDataExportResponse(e, ""))
+}
+
+func (h *accountHandler) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+	exportId, err := strconv.ParseUint(chi.URLParam(r, "exportId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid export id")))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	e, err := h.AccountService.GetExport(userId, uint32(exportId))
+	if err != nil {
+		utils.Render(w, r, accountHttpError(err))
+		return
+	}
+
+	downloadURL := ""
+	if e.Status == app.ExportReady {
+		downloadURL = h.signExportURL(e.ID, time.Now().Add(exportURLTTL))
+	}
+
+	utils.Render(w, r, payloads.NewDataExportResponse(e, downloadURL))
+}
+
+// HandleDownloadExport serves an export archive to whoever has a valid
+// signed URL, so it can be downloaded without the API token, e.g. by a browser.
+func (h *accountHandler) HandleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	exportId, err := strconv.ParseUint(chi.URLParam(r, "exportId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrNotFound)
+		return
+	}
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		utils.Render(w, r, payloads.ErrForbidden)
+		return
+	}
+
+	signature, err := hex.DecodeString(r.URL.Query().Get("signature"))
+	if err != nil || !hmac.Equal(signature, h.exportMAC(uint32(exportId), expires)) {
+		utils.Render(w, r, payloads.ErrForbidden)
+		return
+	}
+
+	archive, err := h.AccountService.ExportArchive(uint32(exportId))
+	if err != nil {
+		utils.Render(w, r, accountHttpError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, exportId))
+	w.Header().Set("Cache-Control", "private, no-store")
+	_, _ = w.Write(archive)
+}
+
+func (h *accountHandler) signExportURL(exportId uint32, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	return fmt.Sprintf("/exports/%d?expires=%d&signature=%s", exportId, expires, hex.EncodeToString(h.exportMAC(exportId, expires)))
+}
+
+func (h *accountHandler) exportMAC(exportId uint32, expires int64) []byte {
+	mac := hmac.New(sha256.New, h.URLSecret)
+	_, _ = fmt.Fprintf(mac, "export:%d:%d", exportId, expires)
+	return mac.Sum(nil)
+}
+
+// app error to http error
+func accountHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrInvalidArticleStrategy,
+		app.ErrInvalidTransferTarget,
+		app.ErrDeletionNotScheduled:
+		return payloads.ErrInvalidRequest(err)
+	case app.ErrWrongCredentials:
+		return payloads.ErrUnauthorized
+	case app.ErrExportNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountHandler_HandleDelete(t *testing.T) {
+	var tests = []struct {
+		name                    string
+		body                    string
+		ScheduleDeletionFn      func(d *app.AccountDeletion, password string) error
+		ScheduleDeletionInvoked bool
+		expectedStatus          int
+	}{
+		{
+			name: "defaults to anonymise",
+			body: "",
+			ScheduleDeletionFn: func(d *app.AccountDeletion, password string) error {
+				if d.UserId != 1 || d.Articles != app.ArticlesAnonymise {
+					t.Fatalf("wrong deletion %v", d)
+				}
+				return nil
+			},
+			ScheduleDeletionInvoked: true,
+			expectedStatus:          http.StatusAccepted,
+		},
+		{
+			name: "transfer",
+			body: `{"articles":"transfer","transfer_to":"other","password":"password"}`,
+			ScheduleDeletionFn: func(d *app.AccountDeletion, password string) error {
+				if d.Articles != app.ArticlesTransfer || d.TransferTo != "other" || password != "password" {
+					t.Fatalf("wrong deletion %v", d)
+				}
+				return nil
+			},
+			ScheduleDeletionInvoked: true,
+			expectedStatus:          http.StatusAccepted,
+		},
+		{
+			name:                    "transfer without user",
+			body:                    `{"articles":"transfer"}`,
+			ScheduleDeletionInvoked: false,
+			expectedStatus:          http.StatusBadRequest,
+		},
+		{
+			name: "wrong password",
+			body: `{"articles":"delete","password":"wrong"}`,
+			ScheduleDeletionFn: func(d *app.AccountDeletion, password string) error {
+				return app.ErrWrongCredentials
+			},
+			ScheduleDeletionInvoked: true,
+			expectedStatus:          http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var as mock.AccountService
+			h := NewAccountHandler(&as, []byte("secret"))
+
+			// Mock our ScheduleDeletion() call.
+			as.ScheduleDeletionFn = test.ScheduleDeletionFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("DELETE", "/users/me", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleDelete)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if as.ScheduleDeletionInvoked != test.ScheduleDeletionInvoked {
+				t.Fatalf("expected ScheduleDeletionInvoked to be %v", test.ScheduleDeletionInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAccountHandler_HandleRestore(t *testing.T) {
+	var as mock.AccountService
+	h := NewAccountHandler(&as, []byte("secret"))
+
+	for _, err := range []error{nil, app.ErrDeletionNotScheduled} {
+		as.CancelDeletionFn = func(userId uint32) error { return err }
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/users/me/restore", nil)
+		ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+		httpHandler := http.HandlerFunc(h.HandleRestore)
+		httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+		expectedStatus := http.StatusNoContent
+		if err != nil {
+			expectedStatus = http.StatusBadRequest
+		}
+		if w.Code != expectedStatus {
+			t.Fatalf("wrong status. expected %v but got %v", expectedStatus, w.Code)
+		}
+	}
+}
+
+func TestAccountHandler_Export(t *testing.T) {
+	// Inject our mock into our handler.
+	var as mock.AccountService
+	h := NewAccountHandler(&as, []byte("secret"))
+
+	as.RequestExportFn = func(userId uint32) (*app.DataExport, error) {
+		return &app.DataExport{ID: 5, UserId: userId, Status: app.ExportPending}, nil
+	}
+	as.GetExportFn = func(userId uint32, exportId uint32) (*app.DataExport, error) {
+		if userId != 1 || exportId != 5 {
+			return nil, app.ErrExportNotFound
+		}
+		return &app.DataExport{ID: 5, UserId: userId, Status: app.ExportReady}, nil
+	}
+	as.ExportArchiveFn = func(exportId uint32) ([]byte, error) {
+		return []byte("zip"), nil
+	}
+
+	// Request the export.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/users/me/export", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+	http.HandlerFunc(h.HandleExport).ServeHTTP(w, r.WithContext(ctx))
+
+	if w.Code != http.StatusAccepted || w.Header().Get("Location") != "/users/me/export/5" {
+		t.Fatalf("wrong response %v %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// Get its download URL.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/users/me/export/5", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("exportId", "5")
+	ctx = context.WithValue(context.WithValue(r.Context(), "userId", uint32(1)), chi.RouteCtxKey, rctx)
+	http.HandlerFunc(h.HandleGetExport).ServeHTTP(w, r.WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusOK, w.Code)
+	}
+
+	download := func(rawURL string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", rawURL, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("exportId", strings.TrimPrefix(r.URL.Path, "/exports/"))
+		http.HandlerFunc(h.HandleDownloadExport).ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+		return w
+	}
+
+	var res struct {
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.DownloadURL == "" {
+		t.Fatalf("expected a download url but got %s", w.Body.String())
+	}
+	downloadURL := res.DownloadURL
+
+	t.Run("signed", func(t *testing.T) {
+		w := download(downloadURL)
+		if w.Code != http.StatusOK || w.Body.String() != "zip" || w.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("wrong download %v %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("other export", func(t *testing.T) {
+		if w := download(strings.Replace(downloadURL, "/exports/5", "/exports/6", 1)); w.Code != http.StatusForbidden {
+			t.Fatalf("wrong status. expected %v but got %v", http.StatusForbidden, w.Code)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		u, _ := url.Parse(h.signExportURL(5, time.Now().Add(-time.Second)))
+		if w := download(u.String()); w.Code != http.StatusForbidden {
+			t.Fatalf("wrong status. expected %v but got %v", http.StatusForbidden, w.Code)
+		}
+	})
+}
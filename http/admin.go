@@ -0,0 +1,53 @@
+package http
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"strconv"
+)
+
+// AdminHandler represents an HTTP handler for administrative actions.
+type AdminHandler interface {
+	HandleUnlockUser(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type adminHandler struct {
+	// Services
+	LoginThrottle app.LoginThrottle
+}
+
+func NewAdminHandler(lt app.LoginThrottle) *adminHandler {
+	return &adminHandler{LoginThrottle: lt}
+}
+
+// HandleUnlockUser lifts a lockout caused by failed logins.
+func (h *adminHandler) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "userId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid user id")))
+		return
+	}
+
+	if err := h.LoginThrottle.Unlock(uint32(id)); err != nil {
+		utils.Render(w, r, adminHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// app error to http error
+func adminHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrUserNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler_HandleUnlockUser(t *testing.T) {
+	var tests = []struct {
+		name           string
+		id             string
+		UnlockFn       func(userId uint32) error
+		UnlockInvoked  bool
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			id:   "2",
+			UnlockFn: func(userId uint32) error {
+				if userId != 2 {
+					return errors.New("wrong id")
+				}
+				return nil
+			},
+			UnlockInvoked:  true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "not found",
+			id:   "2",
+			UnlockFn: func(userId uint32) error {
+				return app.ErrUserNotFound
+			},
+			UnlockInvoked:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			UnlockFn:       nil,
+			UnlockInvoked:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var lt mock.LoginThrottle
+			h := NewAdminHandler(&lt)
+
+			// Mock our Unlock() call.
+			lt.UnlockFn = test.UnlockFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/admin/users/"+test.id+"/unlock", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("userId", test.id)
+
+			httpHandler := http.HandlerFunc(h.HandleUnlockUser)
+			httpHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+
+			// Validate mock.
+			if lt.UnlockInvoked != test.UnlockInvoked {
+				t.Fatalf("expected UnlockInvoked to be %v", test.UnlockInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
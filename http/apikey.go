@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"strconv"
+)
+
+// APIKeyHandler represents an HTTP handler for managing personal API keys.
+type APIKeyHandler interface {
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleRevoke(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type apiKeyHandler struct {
+	// Services
+	APIKeyService app.APIKeyService
+	AuditLog      app.AuditLog // optional, records created keys
+}
+
+func NewAPIKeyHandler(ks app.APIKeyService) *apiKeyHandler {
+	return &apiKeyHandler{APIKeyService: ks}
+}
+
+func (h *apiKeyHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.APIKeyRequest{Action: "create"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	k := data.APIKey
+
+	// keys can't create keys allowed more than themselves
+	if scopes, ok := r.Context().Value("apiKeyScopes").([]string); ok && !withinScopes(k.Scopes, scopes) {
+		utils.Render(w, r, payloads.ErrForbidden)
+		return
+	}
+
+	key, err := h.APIKeyService.Create(k)
+	if err != nil {
+		utils.Render(w, r, apiKeyHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{
+		Action: app.AuditAPIKeyCreate,
+		Target: "api_key:" + strconv.FormatUint(uint64(k.ID), 10),
+		After:  auditJSON(map[string]interface{}{"name": k.Name, "prefix": k.Prefix, "scopes": k.Scopes, "expires_at": k.ExpiresAt}),
+	})
+
+	render.Status(r, http.StatusCreated)
+	utils.Render(w, r, payloads.NewAPIKeyResponse(k, key))
+}
+
+func (h *apiKeyHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	keys, err := h.APIKeyService.List(userId)
+	if err != nil {
+		utils.Render(w, r, apiKeyHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewAPIKeyListResponse(keys))
+}
+
+func (h *apiKeyHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "apiKeyId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid api key id")))
+		return
+	}
+
+	if err := h.APIKeyService.Revoke(userId, uint32(id)); err != nil {
+		utils.Render(w, r, apiKeyHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withinScopes reports whether a key with the requested scopes may do no
+// more than one with held. No scopes means all of them.
+func withinScopes(requested []string, held []string) bool {
+	if len(held) == 0 {
+		return true
+	}
+	if len(requested) == 0 {
+		return false
+	}
+	for _, r := range requested {
+		found := false
+		for _, h := range held {
+			if r == h {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// app error to http error
+func apiKeyHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrAPIKeyNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
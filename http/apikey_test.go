@@ -0,0 +1,232 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyHandler_HandleCreate(t *testing.T) {
+	var tests = []struct {
+		name             string
+		CreateFn         func(k *app.APIKey) (string, error)
+		CreateInvoked    bool
+		scopes           []string // of the key making the request
+		body             []byte
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			CreateFn: func(k *app.APIKey) (string, error) {
+				k.ID = 1
+				k.Prefix = "grt_aaaaaaaa"
+				k.CreatedAt = time.Unix(0, 0).UTC()
+				return "grt_aaaaaaaa_secret", nil
+			},
+			CreateInvoked:    true,
+			body:             []byte(`{"name":"ci","scopes":["articles:write"]}`),
+			expectedStatus:   http.StatusCreated,
+			expectedResponse: fmt.Sprintf(`{"id":1,"user_id":1,"name":"ci","prefix":"grt_aaaaaaaa","scopes":["articles:write"],"expires_at":null,"last_used_at":null,"last_used_ip":"","created_at":"%s","key":"grt_aaaaaaaa_secret"}`, time.Unix(0, 0).UTC().Format(time.RFC3339)),
+		},
+		{
+			name:             "unknown scope",
+			CreateFn:         nil,
+			CreateInvoked:    false,
+			body:             []byte(`{"name":"ci","scopes":["admin"]}`),
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"unknown scope \"admin\""}`,
+		},
+		{
+			name:             "scope the key doesn't hold",
+			CreateFn:         nil,
+			CreateInvoked:    false,
+			scopes:           []string{app.ScopeAccount},
+			body:             []byte(`{"name":"ci","scopes":["articles:write"]}`),
+			expectedStatus:   http.StatusForbidden,
+			expectedResponse: `{"message":"Forbidden"}`,
+		},
+		{
+			name:             "scoped key creating an unscoped one",
+			CreateFn:         nil,
+			CreateInvoked:    false,
+			scopes:           []string{app.ScopeAccount},
+			body:             []byte(`{"name":"ci"}`),
+			expectedStatus:   http.StatusForbidden,
+			expectedResponse: `{"message":"Forbidden"}`,
+		},
+		{
+			name: "scope the key holds",
+			CreateFn: func(k *app.APIKey) (string, error) {
+				k.ID = 1
+				k.Prefix = "grt_aaaaaaaa"
+				k.CreatedAt = time.Unix(0, 0).UTC()
+				return "grt_aaaaaaaa_secret", nil
+			},
+			CreateInvoked:    true,
+			scopes:           []string{app.ScopeAccount, app.ScopeArticlesWrite},
+			body:             []byte(`{"name":"ci","scopes":["articles:write"]}`),
+			expectedStatus:   http.StatusCreated,
+			expectedResponse: fmt.Sprintf(`{"id":1,"user_id":1,"name":"ci","prefix":"grt_aaaaaaaa","scopes":["articles:write"],"expires_at":null,"last_used_at":null,"last_used_ip":"","created_at":"%s","key":"grt_aaaaaaaa_secret"}`, time.Unix(0, 0).UTC().Format(time.RFC3339)),
+		},
+		{
+			name: "Create() error",
+			CreateFn: func(k *app.APIKey) (string, error) {
+				return "", errors.New("create fn error")
+			},
+			CreateInvoked:    true,
+			body:             []byte(`{"name":"ci"}`),
+			expectedStatus:   http.StatusInternalServerError,
+			expectedResponse: `{"message":"Server Error","error":"create fn error"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var ks mock.APIKeyService
+			h := NewAPIKeyHandler(&ks)
+
+			// Mock our Create() call.
+			ks.CreateFn = test.CreateFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/api-keys", bytes.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+			if test.scopes != nil {
+				ctx = context.WithValue(ctx, "apiKeyScopes", test.scopes)
+			}
+
+			httpHandler := http.HandlerFunc(h.HandleCreate)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if ks.CreateInvoked != test.CreateInvoked {
+				t.Fatalf("expected CreateInvoked to be %v", test.CreateInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandler_HandleList(t *testing.T) {
+	// Inject our mock into our handler.
+	var ks mock.APIKeyService
+	h := NewAPIKeyHandler(&ks)
+
+	// Mock our List() call.
+	ks.ListFn = func(userId uint32) ([]*app.APIKey, error) {
+		if userId != 1 {
+			t.Fatalf("unexpected id: %d", userId)
+		}
+		return []*app.APIKey{}, nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/auth/api-keys", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+	httpHandler := http.HandlerFunc(h.HandleList)
+	httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+	// Validate mock.
+	if !ks.ListInvoked {
+		t.Fatal("expected ListInvoked to be true")
+	}
+
+	if received := strings.TrimSpace(w.Body.String()); received != `[]` {
+		t.Fatalf("expected [] but received %s", received)
+	}
+}
+
+func TestAPIKeyHandler_HandleRevoke(t *testing.T) {
+	var tests = []struct {
+		name           string
+		id             string
+		RevokeFn       func(userId uint32, id uint32) error
+		RevokeInvoked  bool
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			id:   "3",
+			RevokeFn: func(userId uint32, id uint32) error {
+				if userId != 1 || id != 3 {
+					return errors.New("wrong ids")
+				}
+				return nil
+			},
+			RevokeInvoked:  true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "not found",
+			id:   "3",
+			RevokeFn: func(userId uint32, id uint32) error {
+				return app.ErrAPIKeyNotFound
+			},
+			RevokeInvoked:  true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid id",
+			id:             "abc",
+			RevokeFn:       nil,
+			RevokeInvoked:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var ks mock.APIKeyService
+			h := NewAPIKeyHandler(&ks)
+
+			// Mock our Revoke() call.
+			ks.RevokeFn = test.RevokeFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("DELETE", "/auth/api-keys/"+test.id, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("apiKeyId", test.id)
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			ctx = context.WithValue(ctx, "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleRevoke)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if ks.RevokeInvoked != test.RevokeInvoked {
+				t.Fatalf("expected RevokeInvoked to be %v", test.RevokeInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
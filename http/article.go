@@ -28,6 +28,8 @@ type articleHandler struct {
 
 	// Services
 	ArticleService app.ArticleService
+	Workspaces     app.WorkspaceArticles // optional, scopes articles to the request's workspace
+	AuditLog       app.AuditLog          // optional, records changes
 }
 
 func NewArticleHandler(as app.ArticleService) *articleHandler {
@@ -43,18 +45,20 @@ func (h *articleHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 
 	article := data.Article
 
-	err := h.ArticleService.Save(article)
+	err := h.articles(r).Save(article)
 	if err != nil {
 		utils.Render(w, r, articleHttpError(err))
 		return
 	}
 
+	h.recordChange(r, app.AuditArticleCreate, article.Slug, nil, article)
+
 	render.Status(r, http.StatusCreated)
 	utils.Render(w, r, payloads.NewArticleResponse(article))
 }
 
 func (h *articleHandler) HandleList(w http.ResponseWriter, r *http.Request) {
-	articles, err := h.ArticleService.GetAll()
+	articles, err := h.articles(r).GetAll()
 	if err != nil {
 		utils.Render(w, r, articleHttpError(err))
 		return
@@ -77,32 +81,64 @@ func (h *articleHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	article := data.Article
+	before := r.Context().Value("article").(*app.Article)
 
-	err := h.ArticleService.Update(article)
+	err := h.articles(r).Update(article)
 	if err != nil {
 		utils.Render(w, r, articleHttpError(err))
 		return
 	}
 
+	h.recordChange(r, app.AuditArticleUpdate, before.Slug, before, article)
+
 	utils.Render(w, r, payloads.NewArticleResponse(article))
 }
 
 func (h *articleHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	article := r.Context().Value("article").(*app.Article)
 
-	err := h.ArticleService.Delete(article.Slug)
+	err := h.articles(r).Delete(article.Slug)
 
 	if err != nil {
 		utils.Render(w, r, articleHttpError(err))
 		return
 	}
+
+	h.recordChange(r, app.AuditArticleDelete, article.Slug, article, nil)
+}
+
+// articles returns the article service of the request's workspace.
+func (h *articleHandler) articles(r *http.Request) app.ArticleService {
+	workspace, ok := r.Context().Value("workspace").(*app.Workspace)
+	if !ok || workspace.ID == app.DefaultWorkspaceId || h.Workspaces == nil {
+		return primaryArticles(r, h.ArticleService)
+	}
+	return primaryArticles(r, h.Workspaces.InWorkspace(workspace.ID))
+}
+
+// recordChange records the fields of an article an action changed.
+func (h *articleHandler) recordChange(r *http.Request, action string, slug string, before, after *app.Article) {
+	if h.AuditLog == nil {
+		return
+	}
+
+	var b, a interface{}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	e := &app.AuditEvent{Action: action, Target: "article:" + slug}
+	e.Before, e.After = auditDiff(b, a)
+	recordAudit(h.AuditLog, r, e)
 }
 
 // middlewares
 func (h *articleHandler) ArticleCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		articleSlug := chi.URLParam(r, "articleSlug")
-		article, err := h.ArticleService.GetBySlug(articleSlug)
+		article, err := h.articles(r).GetBySlug(articleSlug)
 		if err != nil {
 			utils.Render(w, r, articleHttpError(err))
 			return
@@ -120,6 +156,7 @@ func (h *articleHandler) ArticleOwner(next http.Handler) http.Handler {
 		userId := r.Context().Value("userId").(uint32)
 
 		if article.UserId != userId {
+			recordDenied(h.AuditLog, r, "article owner")
 			utils.Render(w, r, payloads.ErrUnauthorized)
 			return
 		}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/middleware"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultAuditQueryLimit is how many events GET /admin/audit returns
+// without a limit.
+const DefaultAuditQueryLimit = 50
+
+// AuditHandler represents an HTTP handler for querying the audit log.
+type AuditHandler interface {
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleVerify(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type auditHandler struct {
+	// Services
+	AuditLog app.AuditLog
+}
+
+func NewAuditHandler(al app.AuditLog) *auditHandler {
+	return &auditHandler{AuditLog: al}
+}
+
+// HandleList lists audit events, newest first. They can be filtered with
+// the actor_id, action, target, since and until (RFC 3339) query parameters,
+// and paged through with before_id and limit.
+func (h *auditHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	f, err := auditFilter(r)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	events, err := h.AuditLog.Query(f)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewAuditEventListResponse(events))
+}
+
+// HandleVerify checks the hash chain of the whole log.
+func (h *auditHandler) HandleVerify(w http.ResponseWriter, r *http.Request) {
+	brokenAt, err := h.AuditLog.Verify()
+	if err != nil && err != app.ErrAuditChainBroken {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewAuditVerificationResponse(brokenAt))
+}
+
+func auditFilter(r *http.Request) (app.AuditFilter, error) {
+	q := r.URL.Query()
+	f := app.AuditFilter{
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Limit:  DefaultAuditQueryLimit,
+	}
+
+	if v := q.Get("actor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return f, errors.New("invalid actor_id")
+		}
+		f.ActorId = uint32(id)
+	}
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return f, errors.New("invalid before_id")
+		}
+		f.BeforeId = id
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return f, errors.New("invalid limit")
+		}
+		f.Limit = limit
+	}
+
+	var err error
+	if f.Since, err = parseAuditTime(q.Get("since")); err != nil {
+		return f, errors.New("invalid since, expected RFC 3339")
+	}
+	if f.Until, err = parseAuditTime(q.Get("until")); err != nil {
+		return f, errors.New("invalid until, expected RFC 3339")
+	}
+	return f, nil
+}
+
+func parseAuditTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// recordAudit records e with the client and request of r, and the
+// authenticated user as actor unless e has one. The action already
+// happened, so a failing log doesn't fail the request, it's only logged.
+func recordAudit(al app.AuditLog, r *http.Request, e *app.AuditEvent) {
+	if al == nil {
+		return
+	}
+
+	if err := al.Record(auditEvent(r, e)); err != nil {
+		log.Printf("cannot record audit event %s: %s", e.Action, err)
+	}
+}
+
+// auditEvent returns e with the client and request of r, and the
+// authenticated user as actor unless e has one.
+func auditEvent(r *http.Request, e *app.AuditEvent) *app.AuditEvent {
+	if e.ActorId == 0 {
+		e.ActorId, _ = r.Context().Value("userId").(uint32)
+	}
+	e.IP = utils.ClientIP(r)
+	e.UserAgent = r.UserAgent()
+	e.RequestId = middleware.GetReqID(r.Context())
+	return e
+}
+
+// recordDenied records that the request lacked the permission required.
+func recordDenied(al app.AuditLog, r *http.Request, required string) {
+	recordAudit(al, r, &app.AuditEvent{
+		Action: app.AuditPermissionDenied,
+		Target: r.Method + " " + r.URL.Path,
+		After:  auditJSON(map[string]string{"required": required}),
+	})
+}
+
+// auditDiff returns the fields of before and after, both encoded as JSON
+// objects, that differ. Either may be nil, e.g. for a created article.
+func auditDiff(before, after interface{}) (json.RawMessage, json.RawMessage) {
+	b, a := auditFields(before), auditFields(after)
+	for k, v := range b {
+		if w, ok := a[k]; ok && string(v) == string(w) {
+			delete(a, k)
+			delete(b, k)
+		}
+	}
+	return auditJSON(b), auditJSON(a)
+}
+
+func auditFields(v interface{}) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if v == nil {
+		return fields
+	}
+	if b, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(b, &fields)
+	}
+	return fields
+}
+
+// auditJSON encodes v, leaving out empty maps.
+func auditJSON(v interface{}) json.RawMessage {
+	if m, ok := v.(map[string]json.RawMessage); ok && len(m) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,376 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditHandler_HandleList(t *testing.T) {
+	epoch := time.Unix(0, 0).UTC()
+
+	var tests = []struct {
+		name             string
+		query            string
+		expectedFilter   app.AuditFilter
+		QueryInvoked     bool
+		expectedResponse string
+	}{
+		{
+			name:             "success",
+			query:            "?actor_id=1&action=article.delete&since=1970-01-01T00:00:00Z&before_id=10&limit=5",
+			expectedFilter:   app.AuditFilter{ActorId: 1, Action: "article.delete", Since: epoch, BeforeId: 10, Limit: 5},
+			QueryInvoked:     true,
+			expectedResponse: `[{"id":1,"action":"article.delete","actor_id":1,"target":"article:hello","ip":"1.2.3.4","user_agent":"test","request_id":"req-1","before":{"title":"Hello"},"created_at":"1970-01-01T00:00:00Z","hash":"abc"}]`,
+		},
+		{
+			name:             "default limit",
+			query:            "",
+			expectedFilter:   app.AuditFilter{Limit: DefaultAuditQueryLimit},
+			QueryInvoked:     true,
+			expectedResponse: `[{"id":1,"action":"article.delete","actor_id":1,"target":"article:hello","ip":"1.2.3.4","user_agent":"test","request_id":"req-1","before":{"title":"Hello"},"created_at":"1970-01-01T00:00:00Z","hash":"abc"}]`,
+		},
+		{
+			name:             "invalid actor id",
+			query:            "?actor_id=me",
+			QueryInvoked:     false,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid actor_id"}`,
+		},
+		{
+			name:             "invalid since",
+			query:            "?since=yesterday",
+			QueryInvoked:     false,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid since, expected RFC 3339"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var al mock.AuditLog
+			h := NewAuditHandler(&al)
+
+			// Mock our Query() call.
+			al.QueryFn = func(f app.AuditFilter) ([]*app.AuditEvent, error) {
+				if f != test.expectedFilter {
+					t.Fatalf("wrong filter. expected %+v but got %+v", test.expectedFilter, f)
+				}
+				return []*app.AuditEvent{{ID: 1, Action: app.AuditArticleDelete, ActorId: 1, Target: "article:hello", IP: "1.2.3.4", UserAgent: "test", RequestId: "req-1", Before: []byte(`{"title":"Hello"}`), CreatedAt: epoch, Hash: "abc"}}, nil
+			}
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/admin/audit"+test.query, nil)
+			httpHandler := http.HandlerFunc(h.HandleList)
+			httpHandler.ServeHTTP(w, r)
+
+			// Validate mock.
+			if al.QueryInvoked != test.QueryInvoked {
+				t.Fatalf("expected QueryInvoked to be %v", test.QueryInvoked)
+			}
+
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
+
+func TestAuditHandler_HandleVerify(t *testing.T) {
+	var tests = []struct {
+		name             string
+		VerifyFn         func() (int64, error)
+		expectedResponse string
+	}{
+		{
+			name:             "valid",
+			VerifyFn:         func() (int64, error) { return 0, nil },
+			expectedResponse: `{"valid":true}`,
+		},
+		{
+			name:             "broken",
+			VerifyFn:         func() (int64, error) { return 42, app.ErrAuditChainBroken },
+			expectedResponse: `{"valid":false,"broken_at":42}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var al mock.AuditLog
+			al.VerifyFn = test.VerifyFn
+			h := NewAuditHandler(&al)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/admin/audit/verify", nil)
+			http.HandlerFunc(h.HandleVerify).ServeHTTP(w, r)
+
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_HandleLogin_Audit(t *testing.T) {
+	var us mock.UserService
+	us.LoginFn = func(u *app.User) (string, error) {
+		return "", app.ErrWrongCredentials
+	}
+
+	var recorded []*app.AuditEvent
+	al := &mock.AuditLog{RecordFn: func(e *app.AuditEvent) error {
+		recorded = append(recorded, e)
+		return nil
+	}}
+
+	h := NewAuthHandler(&us)
+	h.AuditLog = al
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(`{"email":"test@test.com","password":"random"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("User-Agent", "test-agent")
+	r.RemoteAddr = "1.2.3.4:1234"
+	ctx := context.WithValue(r.Context(), middleware.RequestIDKey, "req-1")
+
+	http.HandlerFunc(h.HandleLogin).ServeHTTP(w, r.WithContext(ctx))
+
+	if len(recorded) != 1 {
+		t.Fatalf("wrong number of events. expected %d but got %d", 1, len(recorded))
+	}
+	e := recorded[0]
+	if e.Action != app.AuditLoginFailed || e.ActorId != 0 || e.Target != "email:test@test.com" {
+		t.Fatalf("wrong event %+v", e)
+	}
+	if e.IP != "1.2.3.4" || e.UserAgent != "test-agent" || e.RequestId != "req-1" {
+		t.Fatalf("wrong request details %+v", e)
+	}
+	if string(e.After) != `{"reason":"wrong credentials"}` {
+		t.Fatalf("wrong after %s", e.After)
+	}
+}
+
+func TestArticleHandler_HandleUpdate_Audit(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	var as mock.ArticleService
+	as.UpdateFn = func(a *app.Article) error {
+		a.UpdatedAt = now
+		return nil
+	}
+
+	var recorded []*app.AuditEvent
+	al := &mock.AuditLog{RecordFn: func(e *app.AuditEvent) error {
+		recorded = append(recorded, e)
+		return nil
+	}}
+
+	h := NewArticleHandler(&as)
+	h.AuditLog = al
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PATCH", "/articles/hello", bytes.NewBufferString(`{"title":"Hello","body":"new body"}`))
+	r.Header.Set("Content-Type", "application/json")
+	ctx := context.WithValue(r.Context(), "article", &app.Article{ID: 1, Slug: "hello", Title: "Hello", Body: "old body", UserId: 1, CreatedAt: now, UpdatedAt: now})
+	ctx = context.WithValue(ctx, "userId", uint32(1))
+
+	http.HandlerFunc(h.HandleUpdate).ServeHTTP(w, r.WithContext(ctx))
+
+	if len(recorded) != 1 {
+		t.Fatalf("wrong number of events. expected %d but got %d", 1, len(recorded))
+	}
+	e := recorded[0]
+	if e.Action != app.AuditArticleUpdate || e.ActorId != 1 || e.Target != "article:hello" {
+		t.Fatalf("wrong event %+v", e)
+	}
+	// only the changed fields
+	if string(e.Before) != `{"body":"old body"}` || string(e.After) != `{"body":"new body"}` {
+		t.Fatalf("wrong diff %s, %s", e.Before, e.After)
+	}
+}
+
+func TestArticleHandler_ArticleOwner_Audit(t *testing.T) {
+	var recorded []*app.AuditEvent
+	al := &mock.AuditLog{RecordFn: func(e *app.AuditEvent) error {
+		recorded = append(recorded, e)
+		return nil
+	}}
+
+	h := NewArticleHandler(&mock.ArticleService{})
+	h.AuditLog = al
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/articles/hello", nil)
+	ctx := context.WithValue(r.Context(), "article", &app.Article{Slug: "hello", UserId: 2})
+	ctx = context.WithValue(ctx, "userId", uint32(1))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("expected the request to be denied")
+	})
+	h.ArticleOwner(next).ServeHTTP(w, r.WithContext(ctx))
+
+	if len(recorded) != 1 || recorded[0].Action != app.AuditPermissionDenied || recorded[0].ActorId != 1 || recorded[0].Target != "DELETE /articles/hello" {
+		t.Fatalf("wrong events %+v", recorded)
+	}
+}
+
+func TestHandlers_Audit(t *testing.T) {
+	emails := []string{"old@test.com", "new@test.com"}
+	us := &mock.UserService{
+		GetByIdFn: func(userId uint32) (*app.User, error) {
+			email := emails[0]
+			emails = emails[1:]
+			return &app.User{ID: userId, Email: email}, nil
+		},
+		ConfirmEmailChangeFn: func(userId uint32, token string) error { return nil },
+	}
+	tfs := &mock.TwoFactorService{
+		EnrollFn:  func(userId uint32) (*app.TOTPEnrollment, error) { return &app.TOTPEnrollment{}, nil },
+		ConfirmFn: func(userId uint32, code string) ([]string, error) { return []string{}, nil },
+		DisableFn: func(userId uint32, password string, code string) error { return nil },
+	}
+	ks := &mock.APIKeyService{
+		CreateFn: func(k *app.APIKey) (string, error) {
+			k.ID = 7
+			k.Prefix = "abc"
+			return "grt_abc_secret", nil
+		},
+		AuthenticateFn: func(key string, ip string) (*app.APIKey, error) { return nil, app.ErrInvalidAPIKey },
+	}
+	ts := &mock.ArticleTrashService{
+		RestoreFn: func(userId uint32, slug string) (*app.Article, error) { return &app.Article{Slug: "hello"}, nil },
+	}
+
+	var tests = []struct {
+		name           string
+		handler        func(al app.AuditLog) http.Handler
+		header         string
+		body           string
+		expectedAction string
+		expectedTarget string
+		expectedBefore string
+		expectedAfter  string
+	}{
+		{
+			name: "two-factor enroll",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewTwoFactorHandler(tfs, us)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleEnroll)
+			},
+			expectedAction: app.AuditTwoFactorEnroll,
+			expectedTarget: "user:1",
+		},
+		{
+			name: "two-factor confirm",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewTwoFactorHandler(tfs, us)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleConfirm)
+			},
+			body:           `{"code":"123456"}`,
+			expectedAction: app.AuditTwoFactorEnable,
+			expectedTarget: "user:1",
+		},
+		{
+			name: "two-factor disable",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewTwoFactorHandler(tfs, us)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleDisable)
+			},
+			body:           `{"password":"random","code":"123456"}`,
+			expectedAction: app.AuditTwoFactorDisable,
+			expectedTarget: "user:1",
+		},
+		{
+			name: "api key create",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewAPIKeyHandler(ks)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleCreate)
+			},
+			body:           `{"name":"ci","scopes":["articles:write"]}`,
+			expectedAction: app.AuditAPIKeyCreate,
+			expectedTarget: "api_key:7",
+			expectedAfter:  `{"expires_at":null,"name":"ci","prefix":"abc","scopes":["articles:write"]}`,
+		},
+		{
+			name: "api key authentication failure",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewAuthHandler(us)
+				h.APIKeyService = ks
+				h.AuditLog = al
+				return h.Authentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			},
+			header:         "grt_abc_wrong",
+			expectedAction: app.AuditLoginFailed,
+			expectedAfter:  `{"method":"api_key","reason":"invalid api key"}`,
+		},
+		{
+			name: "email change",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewUserHandler(us)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleConfirmEmail)
+			},
+			body:           `{"token":"random-token"}`,
+			expectedAction: app.AuditEmailChange,
+			expectedTarget: "user:1",
+			expectedBefore: `{"email":"old@test.com"}`,
+			expectedAfter:  `{"email":"new@test.com"}`,
+		},
+		{
+			name: "article restore",
+			handler: func(al app.AuditLog) http.Handler {
+				h := NewTrashHandler(ts)
+				h.AuditLog = al
+				return http.HandlerFunc(h.HandleRestore)
+			},
+			expectedAction: app.AuditArticleRestore,
+			expectedTarget: "article:hello",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var recorded []*app.AuditEvent
+			al := &mock.AuditLog{RecordFn: func(e *app.AuditEvent) error {
+				recorded = append(recorded, e)
+				return nil
+			}}
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			if test.header != "" {
+				r.Header.Set(APIKeyHeader, test.header)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("articleSlug", "hello")
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			ctx = context.WithValue(ctx, "userId", uint32(1))
+
+			test.handler(al).ServeHTTP(w, r.WithContext(ctx))
+
+			if len(recorded) != 1 {
+				t.Fatalf("wrong number of events. expected %d but got %d: %s", 1, len(recorded), w.Body.String())
+			}
+			e := recorded[0]
+			if e.Action != test.expectedAction || e.Target != test.expectedTarget {
+				t.Fatalf("wrong event %+v", e)
+			}
+			if string(e.Before) != test.expectedBefore || string(e.After) != test.expectedAfter {
+				t.Fatalf("wrong before and after %s, %s", e.Before, e.After)
+			}
+		})
+	}
+}
@@ -6,8 +6,11 @@ import (
 	app "github.com/leartgjoni/go-rest-template"
 	"github.com/leartgjoni/go-rest-template/http/payloads"
 	"github.com/leartgjoni/go-rest-template/http/utils"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 )
 
 // AuthHandler represents an HTTP handler for managing authentication.
@@ -15,16 +18,30 @@ type AuthHandler interface {
 	HandleSignup(w http.ResponseWriter, r *http.Request)
 	HandleLogin(w http.ResponseWriter, r *http.Request)
 	HandleMe(w http.ResponseWriter, r *http.Request)
+	HandleLogout(w http.ResponseWriter, r *http.Request)
 	Authentication(next http.Handler) http.Handler
+	RequireScope(scope string) func(next http.Handler) http.Handler
+	RequireAdmin(next http.Handler) http.Handler
 }
 
+// APIKeyHeader carries personal API keys for machine clients.
+const APIKeyHeader = "X-API-Key"
+
 // struct that implements interface
 type authHandler struct {
 	// The server's base URL.
 	baseUrl url.URL
 
 	// Services
-	UserService app.UserService
+	UserService      app.UserService
+	TwoFactorService app.TwoFactorService // optional, enables two-step login
+	APIKeyService    app.APIKeyService    // optional, enables API key authentication
+	LoginThrottle    app.LoginThrottle    // optional, slows down password guessing
+	SessionService   app.SessionService   // optional, enables revoking sessions
+	AuditLog         app.AuditLog         // optional, records logins and denials
+	PasswordPolicy   app.PasswordPolicy   // optional, rejects overlong passwords before they're hashed
+
+	Cookies *SessionCookies // optional, enables cookie sessions
 }
 
 func NewAuthHandler(us app.UserService) *authHandler {
@@ -46,12 +63,24 @@ func (h *authHandler) HandleSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recordAudit(h.AuditLog, r, &app.AuditEvent{
+		Action:  app.AuditSignup,
+		ActorId: user.ID,
+		Target:  userTarget(user.ID),
+		After:   auditJSON(map[string]string{"username": user.Username, "email": user.Email}),
+	})
+
 	jwtToken, err := h.UserService.CreateToken(user.ID)
 	if err != nil {
 		utils.Render(w, r, authHttpError(err))
 		return
 	}
 
+	if jwtToken, err = issueToken(w, r, h.Cookies, jwtToken); err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
 	render.Status(r, http.StatusCreated)
 	utils.Render(w, r, payloads.NewUserResponse(user, jwtToken))
 }
@@ -64,20 +93,91 @@ func (h *authHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user := data.User
+	email := user.Email
+	ip := utils.ClientIP(r)
+
+	if h.PasswordPolicy != nil && h.PasswordPolicy.TooLong(user.Password) {
+		utils.Render(w, r, payloads.ErrInvalidRequest(app.ErrPasswordTooLong))
+		return
+	}
+
+	if h.LoginThrottle != nil {
+		if wait, err := h.LoginThrottle.Check(email, ip); err != nil {
+			handleThrottled(w, r, wait, err)
+			return
+		}
+	}
 
 	jwtToken, err := h.UserService.Login(user)
+	switch err {
+	case nil:
+		recordAudit(h.AuditLog, r, &app.AuditEvent{Action: app.AuditLoginSucceeded, ActorId: user.ID, Target: userTarget(user.ID)})
+	case app.ErrWrongCredentials, app.ErrAccountLocked:
+		recordAudit(h.AuditLog, r, &app.AuditEvent{
+			Action: app.AuditLoginFailed,
+			Target: "email:" + email,
+			After:  auditJSON(map[string]string{"reason": err.Error()}),
+		})
+	}
+	if h.LoginThrottle != nil {
+		var tErr error
+		switch err {
+		case app.ErrWrongCredentials:
+			tErr = h.LoginThrottle.Failed(email, ip)
+		case nil:
+			// with two-factor, once the code is verified too
+			tErr = h.LoginThrottle.Succeeded(email, ip)
+		}
+		if tErr != nil {
+			utils.Render(w, r, authHttpError(tErr))
+			return
+		}
+	}
+	if err == app.ErrTwoFactorRequired && h.TwoFactorService != nil {
+		h.handleTwoFactorChallenge(w, r, user)
+		return
+	}
 	if err != nil {
 		utils.Render(w, r, authHttpError(err))
 		return
 	}
 
+	if jwtToken, err = issueToken(w, r, h.Cookies, jwtToken); err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
 	utils.Render(w, r, payloads.NewUserResponse(user, jwtToken))
 }
 
+// handleTwoFactorChallenge answers a correct password for a user with
+// two-factor enabled: the client gets a short-lived challenge token to
+// exchange, together with a code, at POST /auth/login/2fa.
+func (h *authHandler) handleTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user *app.User) {
+	challenge, err := h.TwoFactorService.CreateChallenge(user.ID)
+	if err != nil {
+		utils.Render(w, r, authHttpError(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewTwoFactorChallengeResponse(challenge))
+}
+
+// handleThrottled answers a login that has to wait, telling the client for how long.
+func handleThrottled(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) {
+	if err != app.ErrTooManyLoginAttempts {
+		utils.Render(w, r, authHttpError(err))
+		return
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.Render(w, r, payloads.ErrTooManyRequests)
+}
+
 func (h *authHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
 	userId := r.Context().Value("userId").(uint32)
 
-	user, err := h.UserService.GetById(userId)
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
 
 	if err != nil {
 		utils.Render(w, r, authHttpError(err))
@@ -87,27 +187,142 @@ func (h *authHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
 	utils.Render(w, r, payloads.NewUserResponse(user, ""))
 }
 
+// HandleLogout ends the current session, which is the only way to get rid
+// of an HttpOnly session cookie.
+func (h *authHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	if sessionId, _ := r.Context().Value("sessionId").(string); sessionId != "" && h.SessionService != nil {
+		if err := h.SessionService.Revoke(userId, sessionId); err != nil && err != app.ErrSessionNotFound {
+			utils.Render(w, r, authHttpError(err))
+			return
+		}
+	}
+
+	if h.Cookies != nil {
+		h.Cookies.clear(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Authentication accepts either a `Bearer <jwt>` Authorization header, an
+// API key in the X-API-Key header or, with cookie sessions, the session cookie.
 func (h *authHandler) Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userId, err := h.UserService.ExtractAuthenticationToken(r)
+		if h.Cookies != nil {
+			r = h.Cookies.withToken(r)
+		}
+
+		if key := r.Header.Get(APIKeyHeader); key != "" && h.APIKeyService != nil {
+			k, err := h.APIKeyService.Authenticate(key, utils.ClientIP(r))
+			if err == app.ErrInvalidAPIKey {
+				recordAudit(h.AuditLog, r, &app.AuditEvent{
+					Action: app.AuditLoginFailed,
+					After:  auditJSON(map[string]string{"method": "api_key", "reason": err.Error()}),
+				})
+			}
+			if err != nil {
+				utils.Render(w, r, authHttpError(err))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "userId", k.UserId)
+			ctx = context.WithValue(ctx, "apiKeyScopes", k.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		session, err := h.UserService.ExtractAuthenticationToken(r)
 		if err != nil {
 			utils.Render(w, r, authHttpError(err))
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userId", userId)
+		if h.SessionService != nil {
+			session.UserAgent = r.UserAgent()
+			session.IP = utils.ClientIP(r)
+			if err := h.SessionService.Touch(session); err != nil {
+				utils.Render(w, r, authHttpError(err))
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "userId", session.UserId)
+		ctx = context.WithValue(ctx, "sessionId", session.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequireScope restricts a route to API keys granted scope. Requests
+// authenticated with a JWT, or with an unscoped key, always pass.
+func (h *authHandler) RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := r.Context().Value("apiKeyScopes").([]string)
+			if !ok || len(scopes) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, s := range scopes {
+				if s == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			recordDenied(h.AuditLog, r, "scope "+scope)
+			utils.Render(w, r, payloads.ErrForbidden)
+		})
+	}
+}
+
+// RequireAdmin restricts a route to administrators. It must come after Authentication.
+func (h *authHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("userId").(uint32)
+
+		user, err := primaryUsers(r, h.UserService).GetById(userId)
+		if err == app.ErrUserNotFound {
+			utils.Render(w, r, payloads.ErrUnauthorized)
+			return
+		}
+		if err != nil {
+			utils.Render(w, r, authHttpError(err))
+			return
+		}
+
+		if !user.IsAdmin {
+			recordDenied(h.AuditLog, r, "admin")
+			utils.Render(w, r, payloads.ErrForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// userTarget is how audit events refer to a user.
+func userTarget(userId uint32) string {
+	return "user:" + strconv.FormatUint(uint64(userId), 10)
+}
+
 // app error to http error
 func authHttpError(err error) render.Renderer {
 	switch err {
 	case app.ErrEmailAlreadyUsed,
-		app.ErrWrongPasswordFormat:
+		app.ErrWrongPasswordFormat,
+		app.ErrPasswordTooShort,
+		app.ErrPasswordTooLong,
+		app.ErrPasswordBreached:
 		return payloads.ErrInvalidRequest(err)
-	case app.ErrWrongCredentials:
+	case app.ErrWrongCredentials,
+		app.ErrTwoFactorRequired,
+		app.ErrInvalidAPIKey:
 		return payloads.ErrUnauthorized
+	case app.ErrAccountLocked:
+		return payloads.ErrTooManyRequests
 	case app.ErrUserNotFound:
 		return payloads.ErrNotFound
 	default:
@@ -10,6 +10,7 @@ import (
 
 	app "github.com/leartgjoni/go-rest-template"
 	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/password"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -44,7 +45,7 @@ func TestAuthHandler_HandleSignup(t *testing.T) {
 			},
 			CreateTokenInvoked: true,
 			body:               []byte(`{"username":"test","email":"test@test.com","password":"random"}`),
-			expectedResponse:   fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","created_at":"%s","updated_at":"%s","token":"random-token"}`, nowString, nowString),
+			expectedResponse:   fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"%s","updated_at":"%s","token":"random-token"}`, nowString, nowString),
 		},
 		{
 			name: "Save() error",
@@ -57,6 +58,17 @@ func TestAuthHandler_HandleSignup(t *testing.T) {
 			body:               []byte(`{"username":"test","email":"test@test.com","password":"random"}`),
 			expectedResponse:   `{"message":"Server Error","error":"save fn error"}`,
 		},
+		{
+			name: "Breached password",
+			SaveFn: func(user *app.User) error {
+				return app.ErrPasswordBreached
+			},
+			SaveInvoked:        true,
+			CreateTokenFn:      nil,
+			CreateTokenInvoked: false,
+			body:               []byte(`{"username":"test","email":"test@test.com","password":"random"}`),
+			expectedResponse:   `{"message":"Invalid request.","error":"password appears in a data breach"}`,
+		},
 		{
 			name: "CreateToken() error",
 			SaveFn: func(user *app.User) error {
@@ -146,7 +158,7 @@ func TestAuthHandler_HandleLogin(t *testing.T) {
 			},
 			LoginInvoked:     true,
 			body:             []byte(`{"email":"test@test.com","password":"random"}`),
-			expectedResponse: fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","created_at":"%s","updated_at":"%s","token":"random-token"}`, nowString, nowString),
+			expectedResponse: fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"%s","updated_at":"%s","token":"random-token"}`, nowString, nowString),
 		},
 		{
 			name: "wrong credentials",
@@ -202,6 +214,208 @@ func TestAuthHandler_HandleLogin(t *testing.T) {
 	}
 }
 
+func TestAuthHandler_HandleLogin_TwoFactor(t *testing.T) {
+	var tests = []struct {
+		name                   string
+		CreateChallengeFn      func(userId uint32) (string, error)
+		CreateChallengeInvoked bool
+		expectedResponse       string
+	}{
+		{
+			name: "challenge issued",
+			CreateChallengeFn: func(userId uint32) (string, error) {
+				return "random-challenge", nil
+			},
+			CreateChallengeInvoked: true,
+			expectedResponse:       `{"mfa_required":true,"mfa_token":"random-challenge"}`,
+		},
+		{
+			name: "CreateChallenge() error",
+			CreateChallengeFn: func(userId uint32) (string, error) {
+				return "", errors.New("create challenge fn error")
+			},
+			CreateChallengeInvoked: true,
+			expectedResponse:       `{"message":"Server Error","error":"create challenge fn error"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var us mock.UserService
+			var tfs mock.TwoFactorService
+			h := NewAuthHandler(&us)
+			h.TwoFactorService = &tfs
+
+			// Mock our Login() call.
+			us.LoginFn = func(u *app.User) (string, error) {
+				u.ID = 1
+				return "", app.ErrTwoFactorRequired
+			}
+
+			// Mock our CreateChallenge() call.
+			tfs.CreateChallengeFn = test.CreateChallengeFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/login", bytes.NewBuffer([]byte(`{"email":"test@test.com","password":"random"}`)))
+			r.Header.Set("Content-Type", "application/json")
+			httpHandler := http.HandlerFunc(h.HandleLogin)
+			httpHandler.ServeHTTP(w, r)
+
+			// Validate mock.
+			if tfs.CreateChallengeInvoked != test.CreateChallengeInvoked {
+				t.Fatalf("expected CreateChallengeInvoked to be %v", test.CreateChallengeInvoked)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_HandleLogin_Throttle(t *testing.T) {
+	var tests = []struct {
+		name             string
+		CheckFn          func(email string, ip string) (time.Duration, error)
+		LoginFn          func(u *app.User) (string, error)
+		LoginInvoked     bool
+		FailedInvoked    bool
+		SucceededInvoked bool
+		expectedStatus   int
+		expectedRetry    string
+	}{
+		{
+			name: "allowed",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				if email != "test@test.com" || ip != "10.0.0.1" {
+					t.Fatalf("wrong email %s or ip %s", email, ip)
+				}
+				return 0, nil
+			},
+			LoginFn: func(u *app.User) (string, error) {
+				return "random-token", nil
+			},
+			LoginInvoked:     true,
+			SucceededInvoked: true,
+			expectedStatus:   http.StatusOK,
+		},
+		{
+			name: "wrong password",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return 0, nil
+			},
+			LoginFn: func(u *app.User) (string, error) {
+				return "", app.ErrWrongCredentials
+			},
+			LoginInvoked:   true,
+			FailedInvoked:  true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "two-factor required",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return 0, nil
+			},
+			LoginFn: func(u *app.User) (string, error) {
+				return "", app.ErrTwoFactorRequired
+			},
+			// the attempt succeeds with the code
+			LoginInvoked:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "throttled",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return 1500 * time.Millisecond, app.ErrTooManyLoginAttempts
+			},
+			expectedStatus: http.StatusTooManyRequests,
+			expectedRetry:  "2",
+		},
+		{
+			name: "locked account",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return 0, nil
+			},
+			LoginFn: func(u *app.User) (string, error) {
+				return "", app.ErrAccountLocked
+			},
+			LoginInvoked:   true,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var us mock.UserService
+			var lt mock.LoginThrottle
+			var tfs mock.TwoFactorService
+			h := NewAuthHandler(&us)
+			h.LoginThrottle = &lt
+			h.TwoFactorService = &tfs
+
+			us.LoginFn = test.LoginFn
+			lt.CheckFn = test.CheckFn
+			lt.FailedFn = func(email string, ip string) error { return nil }
+			lt.SucceededFn = func(email string, ip string) error { return nil }
+			tfs.CreateChallengeFn = func(userId uint32) (string, error) { return "random-challenge", nil }
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/login", bytes.NewBuffer([]byte(`{"email":"test@test.com","password":"random"}`)))
+			r.Header.Set("Content-Type", "application/json")
+			r.RemoteAddr = "10.0.0.1:1234"
+			httpHandler := http.HandlerFunc(h.HandleLogin)
+			httpHandler.ServeHTTP(w, r)
+
+			// Validate mocks.
+			if us.LoginInvoked != test.LoginInvoked {
+				t.Fatalf("expected LoginInvoked to be %v", test.LoginInvoked)
+			}
+			if lt.FailedInvoked != test.FailedInvoked {
+				t.Fatalf("expected FailedInvoked to be %v", test.FailedInvoked)
+			}
+			if lt.SucceededInvoked != test.SucceededInvoked {
+				t.Fatalf("expected SucceededInvoked to be %v", test.SucceededInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+			if retry := w.Header().Get("Retry-After"); retry != test.expectedRetry {
+				t.Fatalf("wrong Retry-After. expected %q but got %q", test.expectedRetry, retry)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_HandleLogin_TooLong(t *testing.T) {
+	var us mock.UserService
+	h := NewAuthHandler(&us)
+	h.PasswordPolicy = password.NewPolicy(8, 64)
+
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"email":"test@test.com","password":"%s"}`, strings.Repeat("a", 65))
+	r, _ := http.NewRequest("POST", "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	http.HandlerFunc(h.HandleLogin).ServeHTTP(w, r)
+
+	// it isn't hashed
+	if us.LoginInvoked {
+		t.Fatal("expected LoginInvoked to be false")
+	}
+
+	expected := `{"message":"Invalid request.","error":"password too long"}`
+	if received := strings.TrimSpace(w.Body.String()); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
+
 func TestAuthHandler_HandleMe(t *testing.T) {
 	// mock time
 	now := time.Unix(0, 0)
@@ -226,7 +440,7 @@ func TestAuthHandler_HandleMe(t *testing.T) {
 				}, nil
 			},
 			GetByIdInvoked:   true,
-			expectedResponse: fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","created_at":"%s","updated_at":"%s"}`, nowString, nowString),
+			expectedResponse: fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"%s","updated_at":"%s"}`, nowString, nowString),
 		},
 		{
 			name: "wrong token",
@@ -274,44 +488,73 @@ func TestAuthHandler_HandleMe(t *testing.T) {
 func TestAuthHandler_Authentication(t *testing.T) {
 	var tests = []struct {
 		name                              string
-		ExtractAuthenticationTokenFn      func(r *http.Request) (uint32, error)
+		ExtractAuthenticationTokenFn      func(r *http.Request) (*app.Session, error)
 		ExtractAuthenticationTokenInvoked bool
+		TouchFn                           func(s *app.Session) error
+		TouchInvoked                      bool
 		expectedId                        uint32
 		expectedErr                       string
 	}{
 		{
 			name: "authenticated",
-			ExtractAuthenticationTokenFn: func(r *http.Request) (uint32, error) {
-				return 1, nil
+			ExtractAuthenticationTokenFn: func(r *http.Request) (*app.Session, error) {
+				return &app.Session{ID: "abc", UserId: 1}, nil
 			},
 			ExtractAuthenticationTokenInvoked: true,
-			expectedId:                        1,
-			expectedErr:                       "",
+			TouchFn: func(s *app.Session) error {
+				if s.ID != "abc" || s.UserAgent != "test-agent" || s.IP == "" {
+					return errors.New("wrong session")
+				}
+				return nil
+			},
+			TouchInvoked: true,
+			expectedId:   1,
+			expectedErr:  "",
 		},
 		{
 			name: "wrong token",
-			ExtractAuthenticationTokenFn: func(r *http.Request) (uint32, error) {
-				return 1, errors.New("random internal error")
+			ExtractAuthenticationTokenFn: func(r *http.Request) (*app.Session, error) {
+				return nil, errors.New("random internal error")
 			},
 			ExtractAuthenticationTokenInvoked: true,
+			TouchFn:                           nil,
+			TouchInvoked:                      false,
 			expectedId:                        0,
 			expectedErr:                       `{"message":"Server Error","error":"random internal error"}`,
 		},
+		{
+			name: "revoked session",
+			ExtractAuthenticationTokenFn: func(r *http.Request) (*app.Session, error) {
+				return &app.Session{ID: "abc", UserId: 1}, nil
+			},
+			ExtractAuthenticationTokenInvoked: true,
+			TouchFn: func(s *app.Session) error {
+				return app.ErrWrongCredentials
+			},
+			TouchInvoked: true,
+			expectedId:   0,
+			expectedErr:  `{"message":"Unauthorized"}`,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			// Inject our mock into our handler.
 			var us mock.UserService
+			var ss mock.SessionService
 			h := NewAuthHandler(&us)
+			h.SessionService = &ss
 
-			// Mock our Login() call.
+			// Mock our ExtractAuthenticationToken() and Touch() calls.
 			us.ExtractAuthenticationTokenFn = test.ExtractAuthenticationTokenFn
+			ss.TouchFn = test.TouchFn
 
 			// Invoke the handler.
 			w := httptest.NewRecorder()
 			r, _ := http.NewRequest("GET", "/test", nil)
 			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("User-Agent", "test-agent")
+			r.RemoteAddr = "127.0.0.1:1234"
 
 			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				userId := r.Context().Value("userId").(uint32)
@@ -319,12 +562,19 @@ func TestAuthHandler_Authentication(t *testing.T) {
 				if userId != test.expectedId {
 					t.Fatalf("expected %v but received %v", test.expectedId, userId)
 				}
+				if sessionId := r.Context().Value("sessionId").(string); sessionId != "abc" {
+					t.Fatalf("expected abc but received %v", sessionId)
+				}
 			})
 			h.Authentication(nextHandler).ServeHTTP(w, r)
 
 			// Validate mock.
 			if us.ExtractAuthenticationTokenInvoked != test.ExtractAuthenticationTokenInvoked {
-				t.Fatalf("expected GetByIdInvoked to be %v", test.ExtractAuthenticationTokenInvoked)
+				t.Fatalf("expected ExtractAuthenticationTokenInvoked to be %v", test.ExtractAuthenticationTokenInvoked)
+			}
+
+			if ss.TouchInvoked != test.TouchInvoked {
+				t.Fatalf("expected TouchInvoked to be %v", test.TouchInvoked)
 			}
 
 			// check for error
@@ -334,3 +584,243 @@ func TestAuthHandler_Authentication(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthHandler_Authentication_APIKey(t *testing.T) {
+	var tests = []struct {
+		name             string
+		AuthenticateFn   func(key string, ip string) (*app.APIKey, error)
+		expectedId       uint32
+		expectedResponse string
+	}{
+		{
+			name: "authenticated",
+			AuthenticateFn: func(key string, ip string) (*app.APIKey, error) {
+				return &app.APIKey{ID: 1, UserId: 2, Scopes: []string{app.ScopeArticlesWrite}}, nil
+			},
+			expectedId: 2,
+		},
+		{
+			name: "invalid key",
+			AuthenticateFn: func(key string, ip string) (*app.APIKey, error) {
+				return nil, app.ErrInvalidAPIKey
+			},
+			expectedId:       0,
+			expectedResponse: `{"message":"Unauthorized"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var us mock.UserService
+			var ks mock.APIKeyService
+			h := NewAuthHandler(&us)
+			h.APIKeyService = &ks
+
+			// Mock our Authenticate() call.
+			ks.AuthenticateFn = test.AuthenticateFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/test", nil)
+			r.Header.Set(APIKeyHeader, "grt_aaaaaaaa_secret")
+			r.RemoteAddr = "10.0.0.1:1234"
+
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userId := r.Context().Value("userId").(uint32)
+
+				if userId != test.expectedId {
+					t.Fatalf("expected %v but received %v", test.expectedId, userId)
+				}
+			})
+			h.Authentication(nextHandler).ServeHTTP(w, r)
+
+			// Validate mocks.
+			if !ks.AuthenticateInvoked {
+				t.Fatal("expected AuthenticateInvoked to be true")
+			}
+			if us.ExtractAuthenticationTokenInvoked {
+				t.Fatal("expected ExtractAuthenticationTokenInvoked to be false")
+			}
+
+			if test.expectedId == 0 && strings.TrimSpace(w.Body.String()) != test.expectedResponse {
+				t.Fatalf("wrong error. expected %v but received %v", test.expectedResponse, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Authentication_Cookie(t *testing.T) {
+	// Inject our mock into our handler.
+	var us mock.UserService
+	h := NewAuthHandler(&us)
+	h.Cookies = NewSessionCookies()
+
+	// Mock our ExtractAuthenticationToken() call.
+	us.ExtractAuthenticationTokenFn = func(r *http.Request) (*app.Session, error) {
+		if r.Header.Get("Authorization") != "Bearer cookie-token" {
+			return nil, app.ErrWrongCredentials
+		}
+		return &app.Session{ID: "abc", UserId: 1}, nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "cookie-token"})
+
+	invoked := false
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		invoked = true
+		if userId := r.Context().Value("userId").(uint32); userId != 1 {
+			t.Fatalf("expected 1 but received %v", userId)
+		}
+	})
+	h.Authentication(nextHandler).ServeHTTP(w, r)
+
+	if !invoked {
+		t.Fatalf("expected the request to be authenticated but received %s", w.Body.String())
+	}
+}
+
+func TestAuthHandler_HandleLogout(t *testing.T) {
+	// Inject our mocks into our handler.
+	var us mock.UserService
+	var ss mock.SessionService
+	h := NewAuthHandler(&us)
+	h.SessionService = &ss
+	h.Cookies = NewSessionCookies()
+
+	// Mock our Revoke() call.
+	ss.RevokeFn = func(userId uint32, id string) error {
+		if userId != 1 || id != "abc" {
+			return errors.New("wrong ids")
+		}
+		return nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/auth/logout", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+	ctx = context.WithValue(ctx, "sessionId", "abc")
+
+	httpHandler := http.HandlerFunc(h.HandleLogout)
+	httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+	// Validate mock.
+	if !ss.RevokeInvoked {
+		t.Fatal("expected RevokeInvoked to be true")
+	}
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusNoContent, w.Code)
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Fatalf("expected cookie %s to be removed", cookie.Name)
+		}
+	}
+	if len(w.Result().Cookies()) != 2 {
+		t.Fatalf("expected 2 cookies to be removed but got %d", len(w.Result().Cookies()))
+	}
+}
+
+func TestAuthHandler_RequireScope(t *testing.T) {
+	var tests = []struct {
+		name           string
+		scopes         interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "jwt",
+			scopes:         nil,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unscoped key",
+			scopes:         []string{},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "granted scope",
+			scopes:         []string{app.ScopeAccount, app.ScopeArticlesWrite},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing scope",
+			scopes:         []string{app.ScopeAccount},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewAuthHandler(&mock.UserService{})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/articles", nil)
+			ctx := r.Context()
+			if test.scopes != nil {
+				ctx = context.WithValue(ctx, "apiKeyScopes", test.scopes)
+			}
+
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			h.RequireScope(app.ScopeArticlesWrite)(nextHandler).ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_RequireAdmin(t *testing.T) {
+	var tests = []struct {
+		name           string
+		GetByIdFn      func(userId uint32) (*app.User, error)
+		expectedStatus int
+	}{
+		{
+			name: "admin",
+			GetByIdFn: func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, IsAdmin: true}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "not admin",
+			GetByIdFn: func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId}, nil
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "deleted user",
+			GetByIdFn: func(userId uint32) (*app.User, error) {
+				return &app.User{}, app.ErrUserNotFound
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var us mock.UserService
+			us.GetByIdFn = test.GetByIdFn
+			h := NewAuthHandler(&us)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/admin/users/2/unlock", nil)
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			h.RequireAdmin(nextHandler).ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
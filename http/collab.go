@@ -0,0 +1,118 @@
+package http
+
+import (
+	"github.com/gorilla/websocket"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/collab"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// bearerProtocol is the WebSocket subprotocol browsers, which can't set
+// headers on WebSockets, pass their token with: the protocols they ask for
+// are "bearer" and the token.
+const bearerProtocol = "bearer"
+
+// CollabHandler represents an HTTP handler for working on articles together.
+type CollabHandler interface {
+	HandleConnect(w http.ResponseWriter, r *http.Request)
+	WebSocketToken(next http.Handler) http.Handler
+}
+
+// struct that implements interface
+type collabHandler struct {
+	Hub     *collab.Hub
+	Origins []string // optional, of browsers allowed to connect besides our own
+
+	// Services
+	UserService app.UserService
+}
+
+func NewCollabHandler(hub *collab.Hub, us app.UserService) *collabHandler {
+	return &collabHandler{Hub: hub, UserService: us}
+}
+
+// HandleConnect opens a WebSocket to the room of the article, see package
+// collab for its messages.
+func (h *collabHandler) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	article := r.Context().Value("article").(*app.Article)
+	userId := r.Context().Value("userId").(uint32)
+
+	// cookies are sent with WebSockets opened by any site
+	if !h.allowedOrigin(r) {
+		utils.Render(w, r, payloads.ErrForbidden)
+		return
+	}
+
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	header := http.Header{}
+	if protocols := websocketProtocols(r); len(protocols) > 0 && protocols[0] == bearerProtocol {
+		header.Set("Sec-WebSocket-Protocol", bearerProtocol)
+	}
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		// answered already
+		return
+	}
+
+	h.Hub.Serve(conn, article.ID, user)
+}
+
+// upgrader leaves origins to allowedOrigin, which answers before the user is
+// looked up.
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+func (h *collabHandler) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range h.Origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// middlewares
+
+// WebSocketToken authenticates WebSockets with the token of the bearer
+// subprotocol, by making them look like requests with an Authorization
+// header. It must come before Authentication.
+func (h *collabHandler) WebSocketToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocols := websocketProtocols(r)
+		if r.Header.Get("Authorization") == "" && len(protocols) == 2 && protocols[0] == bearerProtocol {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+protocols[1])
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// websocketProtocols returns the subprotocols a WebSocket asks for.
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, v := range r.Header["Sec-Websocket-Protocol"] {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	return protocols
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/collab"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollabHandler_HandleConnect(t *testing.T) {
+	var us mock.UserService
+	us.GetByIdFn = func(userId uint32) (*app.User, error) {
+		return &app.User{ID: userId, Username: "alice"}, nil
+	}
+	hub := collab.NewHub()
+	defer hub.Close()
+	h := NewCollabHandler(hub, &us)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "article", &app.Article{ID: 1, Slug: "hello"})
+		ctx = context.WithValue(ctx, "userId", uint32(2))
+		h.HandleConnect(w, r.WithContext(ctx))
+	}))
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	// other sites may not connect
+	if _, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}}); err == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the connection to be forbidden, got %v", err)
+	}
+
+	// the bearer subprotocol is selected for browsers asking for it
+	c, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {ts.URL}, "Sec-WebSocket-Protocol": {"bearer, token"}})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	defer c.Close()
+	if p := res.Header.Get("Sec-WebSocket-Protocol"); p != bearerProtocol {
+		t.Fatalf("wrong subprotocol %q", p)
+	}
+
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, _ = c.ReadMessage() // welcome
+	_, data, err := c.ReadMessage()
+	expected := `{"type":"presence","clients":[{"client_id":1,"user_id":2,"username":"alice","mode":"viewing"}]}`
+	if err != nil || string(data) != expected {
+		t.Fatalf("expected %s but received %s (%v)", expected, data, err)
+	}
+}
+
+func TestCollabHandler_WebSocketToken(t *testing.T) {
+	var tests = []struct {
+		name          string
+		header        http.Header
+		authorization string
+	}{
+		{
+			name:          "bearer subprotocol",
+			header:        http.Header{"Sec-Websocket-Protocol": {"bearer, abc.def.ghi"}},
+			authorization: "Bearer abc.def.ghi",
+		},
+		{
+			name:          "authorization header",
+			header:        http.Header{"Sec-Websocket-Protocol": {"bearer, abc.def.ghi"}, "Authorization": {"Bearer xyz"}},
+			authorization: "Bearer xyz",
+		},
+		{
+			name:          "other subprotocol",
+			header:        http.Header{"Sec-Websocket-Protocol": {"chat"}},
+			authorization: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewCollabHandler(collab.NewHub(), &mock.UserService{})
+
+			var authorization string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+			})
+
+			r, _ := http.NewRequest("GET", "/articles/hello/live", nil)
+			r.Header = test.header
+			h.WebSocketToken(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			if authorization != test.authorization {
+				t.Fatalf("expected %q but got %q", test.authorization, authorization)
+			}
+		})
+	}
+}
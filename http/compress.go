@@ -0,0 +1,234 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultCompressionMinSize is the smallest response body, in bytes, that
+// gets compressed. Below it the encoding overhead is not worth paying.
+const DefaultCompressionMinSize = 1024
+
+// encoder is a streaming content-coding writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// encoders maps content-codings to their writer constructors.
+var encoders = map[string]func(w io.Writer) encoder{
+	"br": func(w io.Writer) encoder {
+		return brotli.NewWriter(w)
+	},
+	"gzip": func(w io.Writer) encoder {
+		return gzip.NewWriter(w)
+	},
+	"deflate": func(w io.Writer) encoder {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	},
+}
+
+// encodingOffers lists the content-codings in server preference, used to
+// break ties between equally weighted codings. Identity comes last.
+var encodingOffers = []string{"br", "gzip", "deflate", "identity"}
+
+// compressibleTypes lists the media types (or type prefixes) worth compressing.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/msgpack",
+	"application/x-msgpack",
+	"application/cbor",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// Compress is a middleware that compresses response bodies of at least
+// minSize bytes with the best content-coding the client accepts.
+func Compress(minSize int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the response depends on Accept-Encoding whether we compress or not
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the accepted content-coding to use, or an empty
+// string for identity.
+func negotiateEncoding(header string) string {
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+
+	encoding, ok := utils.Negotiate(header, encodingOffers)
+	if !ok || encoding == "identity" {
+		return ""
+	}
+	return encoding
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body reaches the size threshold, then either compresses or passes through.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	minSize  int
+
+	buf     []byte
+	status  int
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		if !cw.compressible() {
+			if err := cw.decide(false); err != nil {
+				return 0, err
+			}
+		} else {
+			cw.buf = append(cw.buf, p...)
+			if len(cw.buf) < cw.minSize {
+				return len(p), nil
+			}
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends whatever has been buffered so far. An undecided response is
+// settled on the current buffer size.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(cw.compressible() && len(cw.buf) >= cw.minSize); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is not available on writer")
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to set
+// write deadlines.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close completes the response, sending small bodies uncompressed.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(cw.compressible() && len(cw.buf) >= cw.minSize); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
+
+// compressible reports whether the response, as described by its headers so
+// far, may be compressed.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		// handlers that write without a content type get it sniffed
+		return true
+	}
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide sends the header, wiring up the encoder when compressing, and
+// flushes any buffered bytes.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		cw.enc = encoders[cw.encoding](cw.ResponseWriter)
+	}
+
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"title":"random title","body":"random body"}`, 50)
+	small := `{"title":"random title"}`
+
+	var tests = []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		body             string
+		expectedEncoding string
+	}{
+		{
+			name:             "gzip",
+			acceptEncoding:   "gzip",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "brotli preferred on equal weight",
+			acceptEncoding:   "gzip, deflate, br",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "br",
+		},
+		{
+			name:             "quality values",
+			acceptEncoding:   "br;q=0.2, deflate;q=0.8, gzip;q=0.5",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "deflate",
+		},
+		{
+			name:             "excluded coding",
+			acceptEncoding:   "br;q=0, gzip",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "identity preferred",
+			acceptEncoding:   "identity, gzip;q=0.5",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "",
+		},
+		{
+			name:             "below threshold",
+			acceptEncoding:   "gzip",
+			contentType:      "application/json",
+			body:             small,
+			expectedEncoding: "",
+		},
+		{
+			name:             "no accept encoding",
+			acceptEncoding:   "",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: "",
+		},
+		{
+			name:             "not compressible",
+			acceptEncoding:   "gzip",
+			contentType:      "image/png",
+			body:             large,
+			expectedEncoding: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Compress(256)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(http.StatusCreated)
+				// write in chunks to cross the threshold mid-stream
+				for i := 0; i < len(test.body); i += 100 {
+					end := i + 100
+					if end > len(test.body) {
+						end = len(test.body)
+					}
+					_, _ = w.Write([]byte(test.body[i:end]))
+				}
+			}))
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/articles", nil)
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("wrong status. expected %v but got %v", http.StatusCreated, w.Code)
+			}
+
+			if w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("expected Vary: Accept-Encoding but got %q", w.Header().Get("Vary"))
+			}
+
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding != test.expectedEncoding {
+				t.Fatalf("wrong encoding. expected %q but got %q", test.expectedEncoding, encoding)
+			}
+
+			body := decode(t, encoding, w.Body)
+			if body != test.body {
+				t.Fatalf("wrong body. expected %s but got %s", test.body, body)
+			}
+		})
+	}
+}
+
+func TestCompress_EmptyResponse(t *testing.T) {
+	handler := Compress(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/articles/slug", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusNoContent, w.Code)
+	}
+
+	if w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Fatalf("expected empty identity body but got %q (%s)", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+}
+
+func decode(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatal("cannot read gzip body", err)
+		}
+		r = gr
+	case "deflate":
+		r = flate.NewReader(body)
+	case "br":
+		r = brotli.NewReader(body)
+	default:
+		r = body
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("cannot decode body", err)
+	}
+	return string(bytes.TrimSpace(b))
+}
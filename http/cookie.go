@@ -0,0 +1,195 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/go-chi/render"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"time"
+)
+
+// CSRF protection modes of cookie sessions.
+const (
+	// CSRFDoubleSubmit sets the CSRF token in a cookie scripts can read,
+	// which they send back in the X-CSRF-Token header.
+	CSRFDoubleSubmit = "double-submit"
+	// CSRFSynchronizer derives the CSRF token from the session, so scripts
+	// get it from the login response or GET /auth/csrf.
+	CSRFSynchronizer = "synchronizer"
+)
+
+// CSRFHeader carries the CSRF token of requests authenticated with a cookie.
+const CSRFHeader = "X-CSRF-Token"
+
+// SessionCookies configures cookie sessions for browser clients: tokens are
+// set in an HttpOnly cookie instead of being returned in the response, and
+// state-changing requests made with the cookie need a CSRF token.
+type SessionCookies struct {
+	Name     string // of the session cookie, the CSRF cookie is Name + "_csrf"
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	MaxAge   time.Duration // should match how long tokens are valid
+
+	CSRF       string // CSRFDoubleSubmit or CSRFSynchronizer
+	CSRFSecret []byte // signs synchronizer tokens
+}
+
+// NewSessionCookies returns secure defaults for cookie sessions.
+func NewSessionCookies() *SessionCookies {
+	return &SessionCookies{
+		Name:     "session",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   24 * time.Hour,
+		CSRF:     CSRFDoubleSubmit,
+	}
+}
+
+// issueToken hands a new token to the client. With cookie sessions it is set
+// in a cookie and the returned token, to render in the response, is empty.
+// Clients sending credentials in headers keep getting tokens in responses.
+func issueToken(w http.ResponseWriter, r *http.Request, c *SessionCookies, token string) (string, error) {
+	if c == nil || r.Header.Get("Authorization") != "" || r.Header.Get(APIKeyHeader) != "" {
+		return token, nil
+	}
+
+	if err := c.set(w, token); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+func (c *SessionCookies) set(w http.ResponseWriter, token string) error {
+	http.SetCookie(w, c.cookie(c.Name, token, true))
+
+	csrfToken := c.synchronizerToken(token)
+	if c.CSRF != CSRFSynchronizer {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		csrfToken = hex.EncodeToString(b)
+		http.SetCookie(w, c.cookie(c.csrfCookieName(), csrfToken, false))
+	}
+
+	w.Header().Set(CSRFHeader, csrfToken)
+	return nil
+}
+
+// clear removes the cookies, e.g. on logout.
+func (c *SessionCookies) clear(w http.ResponseWriter) {
+	for _, name := range []string{c.Name, c.csrfCookieName()} {
+		cookie := c.cookie(name, "", true)
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+func (c *SessionCookies) cookie(name string, value string, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   c.Domain,
+		MaxAge:   int(c.MaxAge.Seconds()),
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+func (c *SessionCookies) csrfCookieName() string {
+	return c.Name + "_csrf"
+}
+
+// token returns the token of a request authenticated with the session
+// cookie. Requests with credentials in headers aren't, even if they carry
+// the cookie too.
+func (c *SessionCookies) token(r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") != "" || r.Header.Get(APIKeyHeader) != "" {
+		return "", false
+	}
+
+	cookie, err := r.Cookie(c.Name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// withToken makes a request authenticated with the session cookie look like
+// one with an Authorization header.
+func (c *SessionCookies) withToken(r *http.Request) *http.Request {
+	token, ok := c.token(r)
+	if !ok {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// csrfToken returns the CSRF token expected with a session token.
+func (c *SessionCookies) csrfToken(r *http.Request, token string) string {
+	if c.CSRF == CSRFSynchronizer {
+		return c.synchronizerToken(token)
+	}
+
+	cookie, err := r.Cookie(c.csrfCookieName())
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (c *SessionCookies) synchronizerToken(token string) string {
+	mac := hmac.New(sha256.New, c.CSRFSecret)
+	mac.Write([]byte("csrf:" + token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Protect rejects state-changing requests authenticated with the session
+// cookie that lack a valid CSRF token.
+func (c *SessionCookies) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := c.token(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := c.csrfToken(r, token)
+		received := r.Header.Get(CSRFHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(received)) != 1 {
+			utils.Render(w, r, payloads.ErrInvalidCSRFToken)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleCSRFToken returns the CSRF token of the current cookie session, for
+// scripts that lost it, e.g. after a page reload.
+func (c *SessionCookies) HandleCSRFToken(w http.ResponseWriter, r *http.Request) {
+	token, ok := c.token(r)
+	if !ok {
+		utils.Render(w, r, payloads.ErrUnauthorized)
+		return
+	}
+
+	render.JSON(w, r, map[string]string{"csrf_token": c.csrfToken(r, token)})
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionCookies_IssueToken(t *testing.T) {
+	c := NewSessionCookies()
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/auth/login", nil)
+
+	token, err := issueToken(w, r, c, "jwt")
+	if err != nil {
+		t.Fatal("cannot issue token", err)
+	}
+	if token != "" {
+		t.Fatalf("expected the token not to be rendered but got %s", token)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	session := cookies["session"]
+	if session == nil || session.Value != "jwt" || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("wrong session cookie %v", session)
+	}
+
+	csrf := cookies["session_csrf"]
+	if csrf == nil || csrf.Value == "" || csrf.HttpOnly || csrf.Value != w.Header().Get(CSRFHeader) {
+		t.Fatalf("wrong csrf cookie %v", csrf)
+	}
+
+	// clients sending credentials in headers don't use cookies
+	w = httptest.NewRecorder()
+	r.Header.Set("Authorization", "Bearer old")
+	if token, err := issueToken(w, r, c, "jwt"); err != nil || token != "jwt" {
+		t.Fatalf("expected jwt but got %s, %v", token, err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("expected no cookies to be set")
+	}
+}
+
+func TestSessionCookies_Protect(t *testing.T) {
+	doubleSubmit := NewSessionCookies()
+
+	synchronizer := NewSessionCookies()
+	synchronizer.CSRF = CSRFSynchronizer
+	synchronizer.CSRFSecret = []byte("random-secret")
+
+	var tests = []struct {
+		name           string
+		cookies        *SessionCookies
+		method         string
+		header         http.Header
+		cookieValues   map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "safe method",
+			cookies:        doubleSubmit,
+			method:         "GET",
+			cookieValues:   map[string]string{"session": "jwt"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "without session cookie",
+			cookies:        doubleSubmit,
+			method:         "POST",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "authorization header",
+			cookies:        doubleSubmit,
+			method:         "POST",
+			header:         http.Header{"Authorization": {"Bearer jwt"}},
+			cookieValues:   map[string]string{"session": "jwt"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "double-submit token",
+			cookies:        doubleSubmit,
+			method:         "POST",
+			header:         http.Header{CSRFHeader: {"csrf"}},
+			cookieValues:   map[string]string{"session": "jwt", "session_csrf": "csrf"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong double-submit token",
+			cookies:        doubleSubmit,
+			method:         "DELETE",
+			header:         http.Header{CSRFHeader: {"other"}},
+			cookieValues:   map[string]string{"session": "jwt", "session_csrf": "csrf"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing csrf cookie",
+			cookies:        doubleSubmit,
+			method:         "POST",
+			header:         http.Header{CSRFHeader: {""}},
+			cookieValues:   map[string]string{"session": "jwt"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "synchronizer token",
+			cookies:        synchronizer,
+			method:         "PATCH",
+			header:         http.Header{CSRFHeader: {synchronizer.synchronizerToken("jwt")}},
+			cookieValues:   map[string]string{"session": "jwt"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "synchronizer token of another session",
+			cookies:        synchronizer,
+			method:         "PATCH",
+			header:         http.Header{CSRFHeader: {synchronizer.synchronizerToken("other")}},
+			cookieValues:   map[string]string{"session": "jwt"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(test.method, "/articles", nil)
+			for name := range test.header {
+				r.Header.Set(name, test.header[name][0])
+			}
+			for name, value := range test.cookieValues {
+				r.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			test.cookies.Protect(next).ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestSessionCookies_HandleCSRFToken(t *testing.T) {
+	c := NewSessionCookies()
+	c.CSRF = CSRFSynchronizer
+	c.CSRFSecret = []byte("random-secret")
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/auth/csrf", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "jwt"})
+
+	c.HandleCSRFToken(w, r)
+
+	expected := `{"csrf_token":"` + c.synchronizerToken("jwt") + `"}` + "\n"
+	if w.Body.String() != expected {
+		t.Fatalf("expected %s but received %s", expected, w.Body.String())
+	}
+}
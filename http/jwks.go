@@ -0,0 +1,43 @@
+package http
+
+import (
+	"github.com/go-chi/render"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"net/http"
+	"strconv"
+)
+
+// jwksMaxAge lets verifiers cache the key set for as long as rotated keys
+// are published before they sign.
+var jwksMaxAge = "max-age=" + strconv.Itoa(int(keyring.PublishDelay.Seconds()))
+
+// JWKSHandler serves the public signing keys so other services can verify our tokens.
+type JWKSHandler interface {
+	HandleJWKS(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type jwksHandler struct {
+	// Services
+	Keys *keyring.Ring
+}
+
+func NewJWKSHandler(keys *keyring.Ring) *jwksHandler {
+	return &jwksHandler{Keys: keys}
+}
+
+// HandleJWKS serves the keys the ring loaded last, so anonymous requests
+// don't reach the database.
+func (h *jwksHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.Keys.PublicJWKSet()
+	if err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	// verifiers expect JSON whatever the negotiated format
+	w.Header().Set("Cache-Control", "public, "+jwksMaxAge)
+	render.JSON(w, r, set)
+}
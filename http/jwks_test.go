@@ -0,0 +1,74 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJWKSHandler_HandleJWKS(t *testing.T) {
+	k, err := keyring.Generate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot generate signing key", err)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		var loads int
+		h := NewJWKSHandler(keyring.New(&mock.SigningKeyService{
+			KeysFn: func() ([]*app.SigningKey, error) {
+				loads++
+				return []*app.SigningKey{k}, nil
+			},
+		}))
+
+		var w *httptest.ResponseRecorder
+		for i := 0; i < 2; i++ {
+			w = httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+			r.Header.Set("Accept", "application/msgpack")
+			http.HandlerFunc(h.HandleJWKS).ServeHTTP(w, r)
+		}
+
+		// the keys are served as loaded by the ring
+		if loads != 1 {
+			t.Fatalf("expected the keys to be loaded once but they were %d times", loads)
+		}
+
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Fatalf("expected a json response but got %v %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		// as long as rotated keys are published before they sign
+		if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=300" {
+			t.Fatalf("wrong Cache-Control. expected %s but got %s", "public, max-age=300", cc)
+		}
+
+		var set keyring.JWKSet
+		if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+			t.Fatal("cannot decode jwks", err)
+		}
+		if len(set.Keys) != 1 || set.Keys[0].Kid != k.ID || set.Keys[0].Kty != "OKP" || strings.Contains(w.Body.String(), `"d"`) {
+			t.Fatalf("wrong jwks %s", w.Body.String())
+		}
+	})
+
+	t.Run("Keys() error", func(t *testing.T) {
+		h := NewJWKSHandler(keyring.New(&mock.SigningKeyService{
+			KeysFn: func() ([]*app.SigningKey, error) { return nil, errors.New("keys fn error") },
+		}))
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		http.HandlerFunc(h.HandleJWKS).ServeHTTP(w, r)
+
+		expected := `{"message":"Server Error","error":"keys fn error"}`
+		if received := strings.TrimSpace(w.Body.String()); received != expected {
+			t.Fatalf("expected %s but received %s", expected, received)
+		}
+	})
+}
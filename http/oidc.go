@@ -0,0 +1,235 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"github.com/leartgjoni/go-rest-template/oidc"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// oidcFlowCookie keeps the state, nonce and PKCE verifier of a login in
+	// progress, signed so it can't be forged.
+	oidcFlowCookie = "oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+// OIDCHandler represents an HTTP handler for signing in with external identity providers.
+type OIDCHandler interface {
+	HandleStart(w http.ResponseWriter, r *http.Request)
+	HandleCallback(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type oidcHandler struct {
+	// Services
+	IdentityService  app.IdentityService
+	UserService      app.UserService
+	TwoFactorService app.TwoFactorService // optional
+	AuditLog         app.AuditLog         // optional, records logins
+
+	Providers   map[string]*oidc.Client
+	StateSecret []byte          // signs the flow cookie
+	Cookies     *SessionCookies // optional, enables cookie sessions
+}
+
+func NewOIDCHandler(is app.IdentityService, us app.UserService, providers map[string]*oidc.Client, stateSecret []byte) *oidcHandler {
+	return &oidcHandler{
+		IdentityService: is,
+		UserService:     us,
+		Providers:       providers,
+		StateSecret:     stateSecret,
+	}
+}
+
+// HandleStart redirects the user to the provider's login page.
+func (h *oidcHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	client, ok := h.Providers[provider]
+	if !ok {
+		utils.Render(w, r, oidcHttpError(app.ErrUnknownProvider))
+		return
+	}
+
+	flow, err := oidc.NewFlow()
+	if err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	authURL, err := client.AuthCodeURL(flow)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    h.sealFlow(provider, flow, time.Now().Add(oidcFlowTTL)),
+		Path:     "/auth/oidc/" + provider,
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode, // sent on the top-level redirect back from the provider
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleCallback completes the login and answers like POST /auth/login.
+func (h *oidcHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	client, ok := h.Providers[provider]
+	if !ok {
+		utils.Render(w, r, oidcHttpError(app.ErrUnknownProvider))
+		return
+	}
+
+	// the flow is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/auth/oidc/" + provider, MaxAge: -1, HttpOnly: true, Secure: isHTTPS(r)})
+
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		utils.Render(w, r, oidcHttpError(app.ErrInvalidLoginState))
+		return
+	}
+	flow, ok := h.openFlow(cookie.Value, provider)
+	if !ok || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("state")), []byte(flow.State)) != 1 {
+		utils.Render(w, r, oidcHttpError(app.ErrInvalidLoginState))
+		return
+	}
+
+	// the user denied access or the provider failed
+	code := r.URL.Query().Get("code")
+	if r.URL.Query().Get("error") != "" || code == "" {
+		utils.Render(w, r, payloads.ErrUnauthorized)
+		return
+	}
+
+	claims, err := client.Exchange(code, flow)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrUnauthorized)
+		return
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+	user, err := h.IdentityService.Login(&app.ExternalUser{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      username,
+	})
+	if err == app.ErrTwoFactorRequired && h.TwoFactorService != nil {
+		challenge, err := h.TwoFactorService.CreateChallenge(user.ID)
+		if err != nil {
+			utils.Render(w, r, oidcHttpError(err))
+			return
+		}
+		utils.Render(w, r, payloads.NewTwoFactorChallengeResponse(challenge))
+		return
+	}
+	if err != nil {
+		utils.Render(w, r, oidcHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{
+		Action:  app.AuditLoginSucceeded,
+		ActorId: user.ID,
+		Target:  userTarget(user.ID),
+		After:   auditJSON(map[string]string{"method": "oidc", "provider": provider}),
+	})
+
+	jwtToken, err := h.UserService.CreateToken(user.ID)
+	if err != nil {
+		utils.Render(w, r, oidcHttpError(err))
+		return
+	}
+
+	if jwtToken, err = issueToken(w, r, h.Cookies, jwtToken); err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewUserResponse(user, jwtToken))
+}
+
+type sealedFlow struct {
+	Provider  string `json:"p"`
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// sealFlow encodes a flow as base64(json).base64(hmac).
+func (h *oidcHandler) sealFlow(provider string, flow *oidc.Flow, expiresAt time.Time) string {
+	// marshalling plain strings can't fail
+	b, _ := json.Marshal(sealedFlow{provider, flow.State, flow.Nonce, flow.Verifier, expiresAt.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(h.flowMAC(payload))
+}
+
+func (h *oidcHandler) openFlow(value string, provider string) (*oidc.Flow, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, h.flowMAC(parts[0])) {
+		return nil, false
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	var f sealedFlow
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, false
+	}
+	if f.Provider != provider || time.Now().Unix() > f.ExpiresAt {
+		return nil, false
+	}
+
+	return &oidc.Flow{State: f.State, Nonce: f.Nonce, Verifier: f.Verifier}, true
+}
+
+func (h *oidcHandler) flowMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, h.StateSecret)
+	mac.Write([]byte(oidcFlowCookie + ":" + payload))
+	return mac.Sum(nil)
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// app error to http error
+func oidcHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrUnknownProvider:
+		return payloads.ErrNotFound
+	case app.ErrTwoFactorRequired:
+		return payloads.ErrUnauthorized
+	case app.ErrInvalidLoginState,
+		app.ErrEmailNotVerified:
+		return payloads.ErrInvalidRequest(err)
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/oidc"
+	"github.com/leartgjoni/go-rest-template/oidc/oidctest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// oidcRequest builds a request routed to provider.
+func oidcRequest(target string, provider string) *http.Request {
+	r, _ := http.NewRequest("GET", target, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("provider", provider)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// startOIDCLogin runs HandleStart and lets the stub provider approve the
+// login, returning the flow cookie and the callback URL.
+func startOIDCLogin(t *testing.T, h *oidcHandler, provider *oidctest.Provider) (*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	http.HandlerFunc(h.HandleStart).ServeHTTP(w, oidcRequest("/auth/oidc/stub", "stub"))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusFound, w.Code)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("wrong flow cookie %v", cookies)
+	}
+
+	callback, err := provider.Authorize(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal("cannot authorize", err)
+	}
+
+	return cookies[0], callback
+}
+
+func TestOIDCHandler_Flow(t *testing.T) {
+	provider := oidctest.NewProvider("client-id", "client-secret")
+	defer provider.Close()
+
+	providers := map[string]*oidc.Client{
+		"stub": oidc.NewClient(provider.Config("http://localhost/auth/oidc/stub/callback"), nil),
+	}
+
+	var tests = []struct {
+		name             string
+		LoginFn          func(u *app.ExternalUser) (*app.User, error)
+		twoFactor        bool
+		tamper           func(cookie *http.Cookie, callback string) (*http.Cookie, string)
+		expectedStatus   int
+		expectedResponse string
+		expectedAudit    string
+	}{
+		{
+			name: "success",
+			LoginFn: func(u *app.ExternalUser) (*app.User, error) {
+				if u.Provider != "stub" || u.Subject != "stub-subject" || !u.EmailVerified || u.Username != "Test User" {
+					t.Fatalf("wrong external user %v", u)
+				}
+				return &app.User{ID: 1, Username: "test", Email: u.Email}, nil
+			},
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `"token":"random-token"`,
+			expectedAudit:    app.AuditLoginSucceeded,
+		},
+		{
+			name: "two-factor",
+			LoginFn: func(u *app.ExternalUser) (*app.User, error) {
+				return &app.User{ID: 1}, app.ErrTwoFactorRequired
+			},
+			twoFactor:        true,
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"mfa_required":true,"mfa_token":"random-challenge"}`,
+		},
+		{
+			name: "two-factor without the service",
+			LoginFn: func(u *app.ExternalUser) (*app.User, error) {
+				return &app.User{ID: 1}, app.ErrTwoFactorRequired
+			},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: `{"message":"Unauthorized"}`,
+		},
+		{
+			name: "email not verified",
+			LoginFn: func(u *app.ExternalUser) (*app.User, error) {
+				return nil, app.ErrEmailNotVerified
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"email not verified by identity provider"}`,
+		},
+		{
+			name: "state mismatch",
+			tamper: func(cookie *http.Cookie, callback string) (*http.Cookie, string) {
+				u, _ := url.Parse(callback)
+				q := u.Query()
+				q.Set("state", "forged")
+				u.RawQuery = q.Encode()
+				return cookie, u.String()
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid or expired login state"}`,
+		},
+		{
+			name: "forged cookie",
+			tamper: func(cookie *http.Cookie, callback string) (*http.Cookie, string) {
+				cookie.Value = strings.Replace(cookie.Value, ".", "x.", 1)
+				return cookie, callback
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid or expired login state"}`,
+		},
+		{
+			name: "missing cookie",
+			tamper: func(cookie *http.Cookie, callback string) (*http.Cookie, string) {
+				return nil, callback
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid or expired login state"}`,
+		},
+		{
+			name: "access denied",
+			tamper: func(cookie *http.Cookie, callback string) (*http.Cookie, string) {
+				u, _ := url.Parse(callback)
+				q := u.Query()
+				q.Del("code")
+				q.Set("error", "access_denied")
+				u.RawQuery = q.Encode()
+				return cookie, u.String()
+			},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: `{"message":"Unauthorized"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var is mock.IdentityService
+			var us mock.UserService
+			var tfs mock.TwoFactorService
+			var recorded []*app.AuditEvent
+			h := NewOIDCHandler(&is, &us, providers, []byte("random-secret"))
+			h.AuditLog = &mock.AuditLog{RecordFn: func(e *app.AuditEvent) error {
+				recorded = append(recorded, e)
+				return nil
+			}}
+			if test.twoFactor {
+				h.TwoFactorService = &tfs
+			}
+
+			is.LoginFn = test.LoginFn
+			us.CreateTokenFn = func(userId uint32) (string, error) { return "random-token", nil }
+			tfs.CreateChallengeFn = func(userId uint32) (string, error) { return "random-challenge", nil }
+
+			cookie, callback := startOIDCLogin(t, h, provider)
+			if test.tamper != nil {
+				cookie, callback = test.tamper(cookie, callback)
+			}
+
+			w := httptest.NewRecorder()
+			r := oidcRequest(callback, "stub")
+			if cookie != nil {
+				r.AddCookie(cookie)
+			}
+			http.HandlerFunc(h.HandleCallback).ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v: %s", test.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if received := strings.TrimSpace(w.Body.String()); !strings.Contains(received, test.expectedResponse) {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+
+			if is.LoginInvoked != (test.LoginFn != nil) {
+				t.Fatalf("expected LoginInvoked to be %v", test.LoginFn != nil)
+			}
+
+			if test.expectedAudit == "" && len(recorded) > 0 {
+				t.Fatalf("expected no audit event but got %+v", recorded[0])
+			}
+			if test.expectedAudit != "" && (len(recorded) != 1 || recorded[0].Action != test.expectedAudit || recorded[0].ActorId != 1 || string(recorded[0].After) != `{"method":"oidc","provider":"stub"}`) {
+				t.Fatalf("expected a %s event but got %+v", test.expectedAudit, recorded)
+			}
+		})
+	}
+}
+
+func TestOIDCHandler_UnknownProvider(t *testing.T) {
+	h := NewOIDCHandler(&mock.IdentityService{}, &mock.UserService{}, map[string]*oidc.Client{}, []byte("random-secret"))
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(h.HandleStart).ServeHTTP(w, oidcRequest("/auth/oidc/other", "other"))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusNotFound, w.Code)
+	}
+}
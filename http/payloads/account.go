@@ -0,0 +1,68 @@
+package payloads
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"strings"
+)
+
+type AccountDeletionRequest struct {
+	*app.AccountDeletion
+
+	Password string `json:"password"`
+}
+
+func (d *AccountDeletionRequest) Bind(r *http.Request) error {
+	// no body asks for the defaults
+	if d.AccountDeletion == nil {
+		d.AccountDeletion = &app.AccountDeletion{}
+	}
+
+	//post-process after a decode
+	d.Articles = strings.ToLower(strings.TrimSpace(d.Articles))
+	if d.Articles == "" {
+		d.Articles = app.ArticlesAnonymise
+	}
+	d.TransferTo = strings.TrimSpace(d.TransferTo)
+	d.UserId = r.Context().Value("userId").(uint32)
+
+	switch d.Articles {
+	case app.ArticlesDelete, app.ArticlesAnonymise:
+		return nil
+	case app.ArticlesTransfer:
+		if d.TransferTo == "" {
+			return errors.New("required transfer_to")
+		}
+		return nil
+	default:
+		return errors.New("articles must be one of delete, anonymise, transfer")
+	}
+}
+
+// response
+type AccountDeletionResponse struct {
+	*app.AccountDeletion
+}
+
+func NewAccountDeletionResponse(d *app.AccountDeletion) *AccountDeletionResponse {
+	return &AccountDeletionResponse{AccountDeletion: d}
+}
+
+func (rd *AccountDeletionResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+type DataExportResponse struct {
+	*app.DataExport
+
+	DownloadURL string `json:"download_url,omitempty"` // signed, once the export is ready
+}
+
+func NewDataExportResponse(e *app.DataExport, downloadURL string) *DataExportResponse {
+	return &DataExportResponse{DataExport: e, DownloadURL: downloadURL}
+}
+
+func (rd *DataExportResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package payloads
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type APIKeyRequest struct {
+	*app.APIKey
+
+	Action string `json:"-"` // application-level action, helps in controlling logic flow
+}
+
+func (k *APIKeyRequest) Bind(r *http.Request) error {
+	// k.APIKey is nil if no APIKey fields are sent in the request. Return an
+	// error to avoid a nil pointer dereference.
+	if k.APIKey == nil {
+		return errors.New("missing required APIKey fields")
+	}
+
+	//post-process after a decode
+	if k.Action == "create" {
+		k.prepare()
+	}
+	k.UserId = r.Context().Value("userId").(uint32)
+	return k.validate(k.Action)
+}
+
+func (k *APIKeyRequest) prepare() {
+	// everything but name, scopes and expiry is set by the server
+	*k.APIKey = app.APIKey{
+		Name:      strings.TrimSpace(k.Name),
+		Scopes:    k.Scopes,
+		ExpiresAt: k.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (k *APIKeyRequest) validate(action string) error {
+	switch strings.ToLower(action) {
+	case "create":
+		if k.Name == "" {
+			return errors.New("required name")
+		}
+		if len(k.Name) > 100 {
+			return errors.New("name too long")
+		}
+		for _, scope := range k.Scopes {
+			if !validScope(scope) {
+				return fmt.Errorf("unknown scope %q", scope)
+			}
+		}
+		if k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now()) {
+			return errors.New("expires_at must be in the future")
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func validScope(scope string) bool {
+	for _, s := range app.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// response
+type APIKeyResponse struct {
+	*app.APIKey
+
+	Key string `json:"key,omitempty"` // plain text key, only returned on creation
+}
+
+func (rd *APIKeyResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewAPIKeyResponse(k *app.APIKey, key string) *APIKeyResponse {
+	return &APIKeyResponse{APIKey: k, Key: key}
+}
+
+func NewAPIKeyListResponse(keys []*app.APIKey) []render.Renderer {
+	list := []render.Renderer{}
+	for _, k := range keys {
+		list = append(list, NewAPIKeyResponse(k, ""))
+	}
+	return list
+}
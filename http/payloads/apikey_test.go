@@ -0,0 +1,71 @@
+package payloads
+
+import (
+	"context"
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyRequest_Bind(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		apiKey      *app.APIKey
+		expectedErr error
+	}{
+		{
+			name:        "missing fields",
+			apiKey:      nil,
+			expectedErr: errors.New("missing required APIKey fields"),
+		},
+		{
+			name:        "without name",
+			apiKey:      &app.APIKey{Name: "  "},
+			expectedErr: errors.New("required name"),
+		},
+		{
+			name:        "unknown scope",
+			apiKey:      &app.APIKey{Name: "ci", Scopes: []string{"admin"}},
+			expectedErr: errors.New(`unknown scope "admin"`),
+		},
+		{
+			name:        "expired",
+			apiKey:      &app.APIKey{Name: "ci", ExpiresAt: &past},
+			expectedErr: errors.New("expires_at must be in the future"),
+		},
+		{
+			name:        "valid",
+			apiKey:      &app.APIKey{Name: "ci", Scopes: []string{app.ScopeArticlesWrite}, ExpiresAt: &future, Prefix: "grt_injected"},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := APIKeyRequest{APIKey: test.apiKey, Action: "create"}
+			r, _ := http.NewRequest("POST", "/auth/api-keys", nil)
+			r = r.WithContext(context.WithValue(r.Context(), "userId", uint32(1)))
+
+			err := request.Bind(r)
+
+			if test.expectedErr != nil {
+				if err == nil || err.Error() != test.expectedErr.Error() {
+					t.Fatalf("wrong error. expected %s but got %v", test.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if request.UserId != 1 || request.Prefix != "" {
+				t.Fatalf("server-set fields not reset: %v", request.APIKey)
+			}
+		})
+	}
+}
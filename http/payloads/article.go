@@ -40,6 +40,7 @@ func (a *ArticleRequest) prepare() {
 	//a.ID = 0
 	a.CreatedAt = time.Now()
 	a.UpdatedAt = time.Now()
+	a.DeletedAt = nil
 }
 
 func (a *ArticleRequest) validate(action string) error {
@@ -0,0 +1,37 @@
+package payloads
+
+import (
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+)
+
+// response
+type AuditEventResponse struct {
+	*app.AuditEvent
+}
+
+func (rd *AuditEventResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewAuditEventListResponse(events []*app.AuditEvent) []render.Renderer {
+	list := []render.Renderer{}
+	for _, e := range events {
+		list = append(list, &AuditEventResponse{AuditEvent: e})
+	}
+	return list
+}
+
+type AuditVerificationResponse struct {
+	Valid    bool  `json:"valid"`
+	BrokenAt int64 `json:"broken_at,omitempty"` // the first event not matching its hash
+}
+
+func (rd *AuditVerificationResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewAuditVerificationResponse(brokenAt int64) *AuditVerificationResponse {
+	return &AuditVerificationResponse{Valid: brokenAt == 0, BrokenAt: brokenAt}
+}
@@ -47,4 +47,8 @@ func ErrServer(err error) render.Renderer {
 }
 
 var ErrUnauthorized = &ErrResponse{HTTPStatusCode: 401, Message: "Unauthorized"}
+var ErrForbidden = &ErrResponse{HTTPStatusCode: 403, Message: "Forbidden"}
+var ErrInvalidCSRFToken = &ErrResponse{HTTPStatusCode: 403, Message: "Invalid CSRF token."}
 var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, Message: "Resource not found."}
+var ErrNotAcceptable = &ErrResponse{HTTPStatusCode: 406, Message: "Not acceptable."}
+var ErrTooManyRequests = &ErrResponse{HTTPStatusCode: 429, Message: "Too many requests."}
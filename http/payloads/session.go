@@ -0,0 +1,30 @@
+package payloads
+
+import (
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+)
+
+// response
+type SessionResponse struct {
+	*app.Session
+
+	Current bool `json:"current"` // whether the request was made with this session
+}
+
+func (rd *SessionResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewSessionResponse(s *app.Session, currentId string) *SessionResponse {
+	return &SessionResponse{Session: s, Current: s.ID == currentId}
+}
+
+func NewSessionListResponse(sessions []*app.Session, currentId string) []render.Renderer {
+	list := []render.Renderer{}
+	for _, s := range sessions {
+		list = append(list, NewSessionResponse(s, currentId))
+	}
+	return list
+}
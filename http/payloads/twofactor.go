@@ -0,0 +1,88 @@
+package payloads
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"strings"
+)
+
+type TwoFactorRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+	Token    string `json:"mfa_token"`
+
+	Action string `json:"-"` // application-level action, helps in controlling logic flow
+}
+
+func (t *TwoFactorRequest) Bind(*http.Request) error {
+	t.Code = strings.TrimSpace(t.Code)
+	return t.validate(t.Action)
+}
+
+func (t *TwoFactorRequest) validate(action string) error {
+	switch strings.ToLower(action) {
+	case "confirm":
+		if t.Code == "" {
+			return errors.New("required code")
+		}
+		return nil
+	case "disable":
+		if t.Password == "" {
+			return errors.New("required password")
+		}
+		if t.Code == "" {
+			return errors.New("required code")
+		}
+		return nil
+	case "login":
+		if t.Token == "" {
+			return errors.New("required mfa_token")
+		}
+		if t.Code == "" {
+			return errors.New("required code")
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// response
+type TwoFactorEnrollmentResponse struct {
+	*app.TOTPEnrollment
+}
+
+func NewTwoFactorEnrollmentResponse(enrollment *app.TOTPEnrollment) *TwoFactorEnrollmentResponse {
+	return &TwoFactorEnrollmentResponse{TOTPEnrollment: enrollment}
+}
+
+func (rd *TwoFactorEnrollmentResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewRecoveryCodesResponse(codes []string) *RecoveryCodesResponse {
+	return &RecoveryCodesResponse{RecoveryCodes: codes}
+}
+
+func (rd *RecoveryCodesResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+// TwoFactorChallengeResponse is returned by login when a code is still needed.
+type TwoFactorChallengeResponse struct {
+	Required bool   `json:"mfa_required"`
+	Token    string `json:"mfa_token"`
+}
+
+func NewTwoFactorChallengeResponse(token string) *TwoFactorChallengeResponse {
+	return &TwoFactorChallengeResponse{Required: true, Token: token}
+}
+
+func (rd *TwoFactorChallengeResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
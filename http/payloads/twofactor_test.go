@@ -0,0 +1,71 @@
+package payloads
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTwoFactorRequest_Bind(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     TwoFactorRequest
+		expectedErr error
+	}{
+		{
+			name:        "confirm without code",
+			request:     TwoFactorRequest{Action: "confirm", Code: "  "},
+			expectedErr: errors.New("required code"),
+		},
+		{
+			name:        "confirm",
+			request:     TwoFactorRequest{Action: "confirm", Code: "123456"},
+			expectedErr: nil,
+		},
+		{
+			name:        "disable without password",
+			request:     TwoFactorRequest{Action: "disable", Code: "123456"},
+			expectedErr: errors.New("required password"),
+		},
+		{
+			name:        "disable without code",
+			request:     TwoFactorRequest{Action: "disable", Password: "random-password"},
+			expectedErr: errors.New("required code"),
+		},
+		{
+			name:        "disable",
+			request:     TwoFactorRequest{Action: "disable", Password: "random-password", Code: "123456"},
+			expectedErr: nil,
+		},
+		{
+			name:        "login without token",
+			request:     TwoFactorRequest{Action: "login", Code: "123456"},
+			expectedErr: errors.New("required mfa_token"),
+		},
+		{
+			name:        "login without code",
+			request:     TwoFactorRequest{Action: "login", Token: "random-token"},
+			expectedErr: errors.New("required code"),
+		},
+		{
+			name:        "login",
+			request:     TwoFactorRequest{Action: "login", Token: "random-token", Code: "123456"},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.request.Bind(nil)
+
+			if test.expectedErr != nil {
+				if err == nil || err.Error() != test.expectedErr.Error() {
+					t.Fatalf("wrong error. expected %s but got %s", test.expectedErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("wrong error. expected %s but got %s", test.expectedErr, err)
+				}
+			}
+		})
+	}
+}
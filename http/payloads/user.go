@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type UserRequest struct {
@@ -33,6 +34,7 @@ func (u *UserRequest) prepare() {
 	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
 	u.CreatedAt = time.Now()
 	u.UpdatedAt = time.Now()
+	u.IsAdmin = false
 }
 
 func (u *UserRequest) validate(action string) error {
@@ -83,3 +85,115 @@ func NewUserResponse(user *app.User, token string) *UserResponse {
 func (rd *UserResponse) Render(http.ResponseWriter, *http.Request) error {
 	return nil
 }
+
+// ProfileRequest changes a user's profile. Fields left out stay as they are.
+type ProfileRequest struct {
+	Username *string `json:"username"`
+	Bio      *string `json:"bio"`
+}
+
+func (p *ProfileRequest) Bind(*http.Request) error {
+	if p.Username == nil && p.Bio == nil {
+		return errors.New("missing required profile fields")
+	}
+
+	//post-process after a decode
+	if p.Username != nil {
+		username := strings.TrimSpace(*p.Username)
+		if username == "" {
+			return errors.New("required username")
+		}
+		if utf8.RuneCountInString(username) > 50 {
+			return errors.New("username too long")
+		}
+		username = html.EscapeString(username)
+		p.Username = &username
+	}
+	if p.Bio != nil && utf8.RuneCountInString(*p.Bio) > 500 {
+		return errors.New("bio too long")
+	}
+	return nil
+}
+
+// Apply copies the changed fields to user.
+func (p *ProfileRequest) Apply(user *app.User) {
+	if p.Username != nil {
+		user.Username = *p.Username
+	}
+	if p.Bio != nil {
+		user.Bio = *p.Bio
+	}
+	user.UpdatedAt = time.Now()
+}
+
+type EmailChangeRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+
+	Action string `json:"-"` // application-level action, helps in controlling logic flow
+}
+
+func (e *EmailChangeRequest) Bind(*http.Request) error {
+	e.Email = html.EscapeString(strings.TrimSpace(e.Email))
+	return e.validate(e.Action)
+}
+
+func (e *EmailChangeRequest) validate(action string) error {
+	switch strings.ToLower(action) {
+	case "request":
+		if e.Email == "" {
+			return errors.New("required email")
+		}
+		if err := checkmail.ValidateFormat(e.Email); err != nil {
+			return errors.New("invalid email")
+		}
+		if e.Password == "" {
+			return errors.New("required password")
+		}
+		return nil
+	case "confirm":
+		if e.Token == "" {
+			return errors.New("required token")
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (p *PasswordChangeRequest) Bind(*http.Request) error {
+	if p.CurrentPassword == "" {
+		return errors.New("required current_password")
+	}
+	if p.NewPassword == "" {
+		return errors.New("required new_password")
+	}
+	return nil
+}
+
+// ProfileResponse is a user's public profile, without their email or password.
+type ProfileResponse struct {
+	ID        uint32    `json:"id"`
+	Username  string    `json:"username"`
+	Bio       string    `json:"bio"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewProfileResponse(user *app.User) *ProfileResponse {
+	return &ProfileResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Bio:       user.Bio,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func (rd *ProfileResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
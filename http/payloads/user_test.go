@@ -1,8 +1,10 @@
 package payloads
 
 import (
+	"encoding/json"
 	"errors"
 	app "github.com/leartgjoni/go-rest-template"
+	"strings"
 	"testing"
 )
 
@@ -129,3 +131,73 @@ func testUserSignup(t *testing.T) {
 		}
 	})
 }
+
+func TestProfileRequest_Bind(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		request     ProfileRequest
+		expectedErr error
+	}{
+		{
+			name:        "no fields",
+			request:     ProfileRequest{},
+			expectedErr: errors.New("missing required profile fields"),
+		},
+		{
+			name:        "empty username",
+			request:     ProfileRequest{Username: str("  ")},
+			expectedErr: errors.New("required username"),
+		},
+		{
+			name:        "username too long",
+			request:     ProfileRequest{Username: str(strings.Repeat("ü", 51))},
+			expectedErr: errors.New("username too long"),
+		},
+		{
+			name:        "bio too long",
+			request:     ProfileRequest{Bio: str(strings.Repeat("a", 501))},
+			expectedErr: errors.New("bio too long"),
+		},
+		{
+			name:        "correct",
+			request:     ProfileRequest{Username: str(" <test> "), Bio: str("")},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.request.Bind(nil)
+
+			if test.expectedErr != nil {
+				if err == nil || err.Error() != test.expectedErr.Error() {
+					t.Fatalf("wrong error. expected %s but got %s", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("wrong error. expected %s but got %s", test.expectedErr, err)
+			}
+
+			user := &app.User{Username: "old", Bio: "old"}
+			test.request.Apply(user)
+			if user.Username != "&lt;test&gt;" || user.Bio != "" {
+				t.Fatalf("wrong user %v", user)
+			}
+		})
+	}
+}
+
+func TestProfileResponse(t *testing.T) {
+	res := NewProfileResponse(&app.User{ID: 1, Username: "test", Email: "test@test.com", Password: "hash"})
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal("cannot marshal", err)
+	}
+	if strings.Contains(string(b), "test@test.com") || strings.Contains(string(b), "hash") {
+		t.Fatalf("profile exposes private fields: %s", b)
+	}
+}
@@ -0,0 +1,123 @@
+package payloads
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// minWebhookSecretLength keeps chosen secrets from being guessable.
+const minWebhookSecretLength = 16
+
+// WebhookRequest creates a webhook, or updates the fields it has.
+type WebhookRequest struct {
+	URL         *string   `json:"url"`
+	Secret      *string   `json:"secret"` // generated on creation if missing
+	Events      *[]string `json:"events"`
+	WorkspaceId *uint32   `json:"workspace_id"`
+	Active      *bool     `json:"active"`
+
+	Action string `json:"-"` // application-level action, helps in controlling logic flow
+}
+
+func (wr *WebhookRequest) Bind(r *http.Request) error {
+	if wr.Action == "create" && wr.URL == nil {
+		return errors.New("required url")
+	}
+
+	if wr.URL != nil {
+		u, err := url.Parse(*wr.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an absolute http or https URL")
+		}
+		if len(*wr.URL) > 2048 {
+			return errors.New("url too long")
+		}
+	}
+	if wr.Secret != nil && len(*wr.Secret) < minWebhookSecretLength {
+		return fmt.Errorf("secret must be at least %d characters", minWebhookSecretLength)
+	}
+	if wr.Events != nil {
+		for _, e := range *wr.Events {
+			if !validEventType(e) {
+				return fmt.Errorf("unknown event %q, expected one of %s", e, strings.Join(app.EventTypes, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Apply sets the fields of the request on w.
+func (wr *WebhookRequest) Apply(w *app.Webhook) {
+	if wr.URL != nil {
+		w.URL = *wr.URL
+	}
+	if wr.Secret != nil {
+		w.Secret = *wr.Secret
+	}
+	if wr.Events != nil {
+		w.Events = *wr.Events
+	}
+	if wr.WorkspaceId != nil {
+		w.WorkspaceId = *wr.WorkspaceId
+	}
+	if wr.Active != nil {
+		w.Active = *wr.Active
+	}
+}
+
+func validEventType(eventType string) bool {
+	for _, t := range app.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// response
+type WebhookResponse struct {
+	*app.Webhook
+}
+
+func (rd *WebhookResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+// NewWebhookResponse leaves out the secret, unless the webhook was just
+// created.
+func NewWebhookResponse(w *app.Webhook, created bool) *WebhookResponse {
+	webhook := *w
+	if !created {
+		webhook.Secret = ""
+	}
+	return &WebhookResponse{Webhook: &webhook}
+}
+
+func NewWebhookListResponse(webhooks []*app.Webhook) []render.Renderer {
+	list := []render.Renderer{}
+	for _, w := range webhooks {
+		list = append(list, NewWebhookResponse(w, false))
+	}
+	return list
+}
+
+type WebhookDeliveryResponse struct {
+	*app.WebhookDelivery
+}
+
+func (rd *WebhookDeliveryResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewWebhookDeliveryListResponse(deliveries []*app.WebhookDelivery) []render.Renderer {
+	list := []render.Renderer{}
+	for _, d := range deliveries {
+		list = append(list, &WebhookDeliveryResponse{WebhookDelivery: d})
+	}
+	return list
+}
@@ -0,0 +1,97 @@
+package payloads
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// workspace slugs are DNS labels, so they can be subdomains
+var workspaceSlug = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type WorkspaceRequest struct {
+	*app.Workspace
+}
+
+func (w *WorkspaceRequest) Bind(r *http.Request) error {
+	// w.Workspace is nil if no Workspace fields are sent in the request. Return
+	// an error to avoid a nil pointer dereference.
+	if w.Workspace == nil {
+		return errors.New("missing required Workspace fields")
+	}
+
+	// everything but slug and name is set by the server
+	*w.Workspace = app.Workspace{
+		Slug: strings.ToLower(strings.TrimSpace(w.Slug)),
+		Name: strings.TrimSpace(w.Name),
+	}
+
+	if !workspaceSlug.MatchString(w.Slug) {
+		return errors.New("slug must be lowercase letters, digits and hyphens")
+	}
+	if w.Name == "" {
+		return errors.New("required name")
+	}
+	if len(w.Name) > 255 {
+		return errors.New("name too long")
+	}
+	return nil
+}
+
+type MembershipRequest struct {
+	Role string `json:"role"`
+}
+
+func (m *MembershipRequest) Bind(r *http.Request) error {
+	for _, role := range app.Roles {
+		if m.Role == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("role must be one of %s", strings.Join(app.Roles, ", "))
+}
+
+// response
+type WorkspaceResponse struct {
+	*app.Workspace
+}
+
+func (rd *WorkspaceResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewWorkspaceResponse(w *app.Workspace) *WorkspaceResponse {
+	return &WorkspaceResponse{Workspace: w}
+}
+
+func NewWorkspaceListResponse(workspaces []*app.Workspace) []render.Renderer {
+	list := []render.Renderer{}
+	for _, w := range workspaces {
+		list = append(list, NewWorkspaceResponse(w))
+	}
+	return list
+}
+
+type MembershipResponse struct {
+	*app.Membership
+}
+
+func (rd *MembershipResponse) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func NewMembershipResponse(m *app.Membership) *MembershipResponse {
+	return &MembershipResponse{Membership: m}
+}
+
+func NewMembershipListResponse(members []*app.Membership) []render.Renderer {
+	list := []render.Renderer{}
+	for _, m := range members {
+		list = append(list, NewMembershipResponse(m))
+	}
+	return list
+}
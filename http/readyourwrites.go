@@ -0,0 +1,73 @@
+package http
+
+import (
+	"context"
+	app "github.com/leartgjoni/go-rest-template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// readPrimaryCookie holds the Unix time until which the client reads from
+// the primary database.
+const readPrimaryCookie = "read_primary_until"
+
+// ReadYourWrites lets clients that wrote within window read their writes,
+// even from replicas lagging behind: writes set a cookie, and requests
+// sending it back read from the primary. The cookie follows the client to
+// any instance.
+func ReadYourWrites(window time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			readPrimary := false
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				if c, err := r.Cookie(readPrimaryCookie); err == nil {
+					until, err := strconv.ParseInt(c.Value, 10, 64)
+					readPrimary = err == nil && now.Unix() < until
+				}
+			default:
+				// whether the write succeeds or not, it's cheaper to assume it did
+				http.SetCookie(w, &http.Cookie{
+					Name:     readPrimaryCookie,
+					Value:    strconv.FormatInt(now.Add(window).Unix(), 10),
+					Path:     "/",
+					MaxAge:   int(math.Ceil(window.Seconds())),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				readPrimary = true
+			}
+
+			if readPrimary {
+				r = r.WithContext(context.WithValue(r.Context(), "readPrimary", true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readsPrimary reports whether the request has to read from the primary,
+// see ReadYourWrites.
+func readsPrimary(r *http.Request) bool {
+	readPrimary, _ := r.Context().Value("readPrimary").(bool)
+	return readPrimary
+}
+
+// primaryArticles returns as reading from the primary if the request has to.
+func primaryArticles(r *http.Request, as app.ArticleService) app.ArticleService {
+	if p, ok := as.(app.PrimaryArticles); ok && readsPrimary(r) {
+		return p.FromPrimary()
+	}
+	return as
+}
+
+// primaryUsers returns us reading from the primary if the request has to.
+func primaryUsers(r *http.Request, us app.UserService) app.UserService {
+	if p, ok := us.(app.PrimaryUsers); ok && readsPrimary(r) {
+		return p.FromPrimary()
+	}
+	return us
+}
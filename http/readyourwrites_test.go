@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	var tests = []struct {
+		name                string
+		method              string
+		cookie              string
+		expectedReadPrimary bool
+		expectedCookie      bool
+	}{
+		{
+			name:                "read",
+			method:              http.MethodGet,
+			expectedReadPrimary: false,
+		},
+		{
+			name:                "write",
+			method:              http.MethodPost,
+			expectedReadPrimary: true,
+			expectedCookie:      true,
+		},
+		{
+			name:                "read after a write",
+			method:              http.MethodGet,
+			cookie:              strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10),
+			expectedReadPrimary: true,
+		},
+		{
+			name:                "read after the window",
+			method:              http.MethodGet,
+			cookie:              strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10),
+			expectedReadPrimary: false,
+		},
+		{
+			name:                "invalid cookie",
+			method:              http.MethodGet,
+			cookie:              "tomorrow",
+			expectedReadPrimary: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readPrimary bool
+			handler := ReadYourWrites(5 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				readPrimary = readsPrimary(r)
+			}))
+
+			req := httptest.NewRequest(tt.method, "/api/articles", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: readPrimaryCookie, Value: tt.cookie})
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if readPrimary != tt.expectedReadPrimary {
+				t.Fatalf("wrong readPrimary. expected %t but got %t", tt.expectedReadPrimary, readPrimary)
+			}
+
+			var cookie *http.Cookie
+			for _, c := range rr.Result().Cookies() {
+				if c.Name == readPrimaryCookie {
+					cookie = c
+				}
+			}
+			if (cookie != nil) != tt.expectedCookie {
+				t.Fatalf("wrong cookie. expected %t but got %v", tt.expectedCookie, cookie)
+			}
+			if cookie != nil && cookie.MaxAge != 5 {
+				t.Fatalf("wrong cookie max age. expected %d but got %d", 5, cookie.MaxAge)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package http
 import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/utils"
 	"net/http"
 )
 
@@ -10,35 +12,184 @@ func (s *Server) router() http.Handler {
 	r := chi.NewRouter()
 
 	// Attach router middleware.
+	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	// streams and export downloads aren't in the formats responses are
+	// rendered in
+	r.Use(utils.NegotiateContentType("text/event-stream", "application/zip"))
+	r.Use(Compress(s.CompressionMinSize))
+	if s.ReadYourWritesWindow > 0 {
+		r.Use(ReadYourWrites(s.ReadYourWritesWindow))
+	}
+	if s.SessionCookies != nil {
+		r.Use(s.SessionCookies.Protect)
+	}
 
 	// Create API routes.
 	r.Route("/", func(r chi.Router) {
 		r.Get("/health", s.handlePing)
 
+		if s.jwksHandler != nil {
+			r.Get("/.well-known/jwks.json", s.jwksHandler.HandleJWKS)
+		}
+
 		r.Route("/auth", func(r chi.Router) {
 			r.Post("/signup", s.authHandler.HandleSignup)
 			r.Post("/login", s.authHandler.HandleLogin)
 			r.With(s.authHandler.Authentication).Get("/me", s.authHandler.HandleMe)
-		})
+			r.With(s.authHandler.Authentication).Post("/logout", s.authHandler.HandleLogout)
+
+			if s.SessionCookies != nil {
+				r.Get("/csrf", s.SessionCookies.HandleCSRFToken)
+			}
+
+			if s.twoFactorHandler != nil {
+				r.Post("/login/2fa", s.twoFactorHandler.HandleLogin)
+				r.Route("/2fa", func(r chi.Router) {
+					r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount))
+					r.Post("/enroll", s.twoFactorHandler.HandleEnroll)
+					r.Post("/confirm", s.twoFactorHandler.HandleConfirm)
+					r.Post("/disable", s.twoFactorHandler.HandleDisable)
+				})
+			}
+
+			if s.oidcHandler != nil {
+				r.Get("/oidc/{provider}", s.oidcHandler.HandleStart)
+				r.Get("/oidc/{provider}/callback", s.oidcHandler.HandleCallback)
+			}
+
+			if s.apiKeyHandler != nil {
+				r.Route("/api-keys", func(r chi.Router) {
+					r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount))
+					r.Post("/", s.apiKeyHandler.HandleCreate)
+					r.Get("/", s.apiKeyHandler.HandleList)
+					r.Delete("/{apiKeyId}", s.apiKeyHandler.HandleRevoke)
+				})
+			}
 
-		r.Route("/articles", func(r chi.Router) {
-			r.Get("/", s.articleHandler.HandleList)
-			r.With(s.articleHandler.ArticleCtx).Get("/{articleSlug}", s.articleHandler.HandleGet)
-			r.Route("/", func(r chi.Router) {
-				r.Use(s.authHandler.Authentication)
-				r.Post("/", s.articleHandler.HandleCreate)
-				r.Route("/{articleSlug}", func(r chi.Router) {
-					r.Use(s.articleHandler.ArticleCtx, s.articleHandler.ArticleOwner)
-
-					r.Patch("/", s.articleHandler.HandleUpdate)
-					r.Delete("/", s.articleHandler.HandleDelete)
+			if s.sessionHandler != nil {
+				r.Route("/sessions", func(r chi.Router) {
+					r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount))
+					r.Get("/", s.sessionHandler.HandleList)
+					r.Delete("/", s.sessionHandler.HandleRevokeOthers)
+					r.Delete("/{sessionId}", s.sessionHandler.HandleRevoke)
 				})
+			}
+		})
+
+		r.Route("/users", func(r chi.Router) {
+			r.Get("/{username}", s.userHandler.HandleGet)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount))
+				r.Get("/", s.authHandler.HandleMe)
+				r.Patch("/", s.userHandler.HandleUpdate)
+				r.Post("/email", s.userHandler.HandleChangeEmail)
+				r.Post("/email/confirm", s.userHandler.HandleConfirmEmail)
+				r.Post("/password", s.userHandler.HandleChangePassword)
+
+				if s.accountHandler != nil {
+					r.Delete("/", s.accountHandler.HandleDelete)
+					r.Post("/restore", s.accountHandler.HandleRestore)
+					r.Post("/export", s.accountHandler.HandleExport)
+					r.Get("/export/{exportId}", s.accountHandler.HandleGetExport)
+				}
 			})
 		})
+
+		if s.accountHandler != nil {
+			r.Get("/exports/{exportId}", s.accountHandler.HandleDownloadExport)
+		}
+
+		if s.adminHandler != nil || s.auditHandler != nil || s.webhookHandler != nil {
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount), s.authHandler.RequireAdmin)
+				if s.adminHandler != nil {
+					r.Post("/users/{userId}/unlock", s.adminHandler.HandleUnlockUser)
+				}
+				if s.auditHandler != nil {
+					r.Get("/audit", s.auditHandler.HandleList)
+					r.Get("/audit/verify", s.auditHandler.HandleVerify)
+				}
+				if s.webhookHandler != nil {
+					r.Route("/webhooks", func(r chi.Router) {
+						r.Post("/", s.webhookHandler.HandleCreate)
+						r.Get("/", s.webhookHandler.HandleList)
+						r.Route("/{webhookId}", func(r chi.Router) {
+							r.Use(s.webhookHandler.WebhookCtx)
+							r.Get("/", s.webhookHandler.HandleGet)
+							r.Patch("/", s.webhookHandler.HandleUpdate)
+							r.Delete("/", s.webhookHandler.HandleDelete)
+							r.Get("/deliveries", s.webhookHandler.HandleListDeliveries)
+						})
+					})
+				}
+			})
+		}
+
+		r.Route("/articles", s.articleRoutes)
+
+		if s.workspaceHandler != nil {
+			r.Route("/w/{workspace}/articles", s.articleRoutes)
+
+			r.Route("/workspaces", func(r chi.Router) {
+				r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeAccount))
+				r.Post("/", s.workspaceHandler.HandleCreate)
+				r.Get("/", s.workspaceHandler.HandleList)
+				r.Route("/{workspace}/members", func(r chi.Router) {
+					r.Use(s.workspaceHandler.WorkspaceCtx)
+					r.With(s.workspaceHandler.RequireRole(app.RoleViewer)).Get("/", s.workspaceHandler.HandleListMembers)
+					r.With(s.workspaceHandler.RequireRole(app.RoleOwner)).Put("/{userId}", s.workspaceHandler.HandleSetMember)
+					r.With(s.workspaceHandler.RequireRole(app.RoleOwner)).Delete("/{userId}", s.workspaceHandler.HandleRemoveMember)
+				})
+			})
+		}
 	})
 
 	return r
 }
+
+// articleRoutes serves the articles of the default workspace, or with
+// workspaces of the one the request names.
+func (s *Server) articleRoutes(r chi.Router) {
+	// reading a workspace other than the default one needs a membership,
+	// writing a role in it
+	nop := func(next http.Handler) http.Handler { return next }
+	requireMember, requireViewer, requireEditor := nop, nop, nop
+	if s.workspaceHandler != nil {
+		r.Use(s.workspaceHandler.WorkspaceCtx)
+		requireMember = s.workspaceHandler.RequireMember(s.authHandler.Authentication)
+		requireViewer = s.workspaceHandler.RequireRole(app.RoleViewer)
+		requireEditor = s.workspaceHandler.RequireRole(app.RoleEditor)
+	}
+
+	r.With(requireMember).Get("/", s.articleHandler.HandleList)
+	if s.streamHandler != nil {
+		r.With(requireMember).Get("/stream", s.streamHandler.HandleStream)
+	}
+	if s.trashHandler != nil {
+		r.With(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeArticlesWrite), requireViewer).Get("/trash", s.trashHandler.HandleList)
+	}
+	r.With(requireMember, s.articleHandler.ArticleCtx).Get("/{articleSlug}", s.articleHandler.HandleGet)
+	if s.collabHandler != nil {
+		r.With(s.collabHandler.WebSocketToken, s.authHandler.Authentication, requireViewer, s.articleHandler.ArticleCtx).Get("/{articleSlug}/live", s.collabHandler.HandleConnect)
+	}
+	r.Route("/", func(r chi.Router) {
+		r.Use(s.authHandler.Authentication, s.authHandler.RequireScope(app.ScopeArticlesWrite), requireEditor)
+		r.Post("/", s.articleHandler.HandleCreate)
+		r.Route("/{articleSlug}", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(s.articleHandler.ArticleCtx, s.articleHandler.ArticleOwner)
+
+				r.Patch("/", s.articleHandler.HandleUpdate)
+				r.Delete("/", s.articleHandler.HandleDelete)
+			})
+
+			// deleted articles aren't found by ArticleCtx
+			if s.trashHandler != nil {
+				r.Post("/restore", s.trashHandler.HandleRestore)
+			}
+		})
+	})
+}
@@ -2,28 +2,75 @@ package http
 
 import (
 	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/collab"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/oidc"
 	"net"
 	"net/http"
+	"time"
 )
 
 type Server struct {
 	ln net.Listener
 
 	// Services
-	UserService    app.UserService
-	ArticleService app.ArticleService
+	UserService      app.UserService
+	ArticleService   app.ArticleService
+	TwoFactorService app.TwoFactorService // optional
+	APIKeyService    app.APIKeyService    // optional
+
+	SigningKeys     *keyring.Ring       // optional, publishes the JWKS
+	IdentityService app.IdentityService // optional, with OIDCProviders
+	LoginThrottle   app.LoginThrottle   // optional
+	AccountService  app.AccountService  // optional, with ExportURLSecret
+	SessionService  app.SessionService  // optional
+	PasswordPolicy  app.PasswordPolicy  // optional, bounds passwords at login
+
+	ArticleTrashService app.ArticleTrashService // optional, makes deleted articles restorable
+	AuditLog            app.AuditLog            // optional, records logins, denials and changes
+	UnitOfWork          app.UnitOfWork          // optional, with AuditLog, makes password changes atomic with their audit
+	WorkspaceService    app.WorkspaceService    // optional, with WorkspaceArticles
+	WorkspaceArticles   app.WorkspaceArticles   // scopes the ArticleService to workspaces
+	WorkspaceTrash      app.WorkspaceTrash      // optional, scopes the ArticleTrashService to workspaces
+	WebhookService      app.WebhookService      // optional
+	EventBroker         app.EventBroker         // optional, streams changes to articles and to editors working on them
 
 	// Handlers
-	authHandler    AuthHandler
-	articleHandler ArticleHandler
+	authHandler      AuthHandler
+	articleHandler   ArticleHandler
+	userHandler      UserHandler
+	twoFactorHandler TwoFactorHandler
+	apiKeyHandler    APIKeyHandler
+	jwksHandler      JWKSHandler
+	oidcHandler      OIDCHandler
+	adminHandler     AdminHandler
+	accountHandler   AccountHandler
+	sessionHandler   SessionHandler
+	trashHandler     TrashHandler
+	auditHandler     AuditHandler
+	workspaceHandler WorkspaceHandler
+	webhookHandler   WebhookHandler
+	streamHandler    StreamHandler
+	collabHandler    CollabHandler
+
+	collabHub *collab.Hub // rooms of the articles being worked on
 
 	// Server options.
-	Addr string // bind address
+	Addr                 string        // bind address
+	CompressionMinSize   int           // smallest response body, in bytes, to compress
+	ReadYourWritesWindow time.Duration // optional, how long clients read from the primary after writing
+
+	OIDCProviders    map[string]*oidc.Client // identity providers by name
+	OIDCStateSecret  []byte                  // signs the login flow cookie
+	ExportURLSecret  []byte                  // signs data export download URLs
+	SessionCookies   *SessionCookies         // optional, enables cookie sessions for browser clients
+	WorkspaceDomain  string                  // optional, resolves workspaces from its subdomains
+	WebSocketOrigins []string                // optional, other sites whose pages may open WebSockets
 }
 
 // NewServer returns a new instance of Server.
 func NewServer() *Server {
-	return &Server{}
+	return &Server{CompressionMinSize: DefaultCompressionMinSize}
 }
 
 func (s *Server) Open() error {
@@ -44,18 +91,112 @@ func (s *Server) Start() error {
 	return s.Open()
 }
 
-// Close closes the socket.
+// Close closes the socket, then the WebSockets of editors.
 func (s *Server) Close() error {
+	var err error
 	if s.ln != nil {
-		return s.ln.Close()
+		err = s.ln.Close()
 	}
-	return nil
+	if s.collabHub != nil {
+		s.collabHub.Close()
+	}
+	return err
 }
 
 // initialize handlers server needs
 func (s *Server) initializeHandlers() {
-	s.authHandler = NewAuthHandler(s.UserService)
-	s.articleHandler = NewArticleHandler(s.ArticleService)
+	authHandler := NewAuthHandler(s.UserService)
+	authHandler.Cookies = s.SessionCookies
+	authHandler.AuditLog = s.AuditLog
+	authHandler.PasswordPolicy = s.PasswordPolicy
+	articleHandler := NewArticleHandler(s.ArticleService)
+	articleHandler.AuditLog = s.AuditLog
+	if s.WorkspaceService != nil && s.WorkspaceArticles != nil {
+		articleHandler.Workspaces = s.WorkspaceArticles
+		workspaceHandler := NewWorkspaceHandler(s.WorkspaceService)
+		workspaceHandler.Domain = s.WorkspaceDomain
+		workspaceHandler.AuditLog = s.AuditLog
+		s.workspaceHandler = workspaceHandler
+	}
+	s.articleHandler = articleHandler
+	userHandler := NewUserHandler(s.UserService)
+	userHandler.Cookies = s.SessionCookies
+	userHandler.AuditLog = s.AuditLog
+	if s.AuditLog != nil {
+		userHandler.UnitOfWork = s.UnitOfWork
+	}
+	s.userHandler = userHandler
+
+	if s.TwoFactorService != nil {
+		authHandler.TwoFactorService = s.TwoFactorService
+		twoFactorHandler := NewTwoFactorHandler(s.TwoFactorService, s.UserService)
+		twoFactorHandler.Cookies = s.SessionCookies
+		twoFactorHandler.AuditLog = s.AuditLog
+		twoFactorHandler.LoginThrottle = s.LoginThrottle
+		s.twoFactorHandler = twoFactorHandler
+	}
+
+	if s.APIKeyService != nil {
+		authHandler.APIKeyService = s.APIKeyService
+		apiKeyHandler := NewAPIKeyHandler(s.APIKeyService)
+		apiKeyHandler.AuditLog = s.AuditLog
+		s.apiKeyHandler = apiKeyHandler
+	}
+
+	if s.SigningKeys != nil {
+		s.jwksHandler = NewJWKSHandler(s.SigningKeys)
+	}
+
+	if s.LoginThrottle != nil {
+		authHandler.LoginThrottle = s.LoginThrottle
+		s.adminHandler = NewAdminHandler(s.LoginThrottle)
+	}
+
+	if s.SessionService != nil {
+		authHandler.SessionService = s.SessionService
+		s.sessionHandler = NewSessionHandler(s.SessionService)
+	}
+
+	if s.AuditLog != nil {
+		s.auditHandler = NewAuditHandler(s.AuditLog)
+	}
+
+	if s.WebhookService != nil {
+		s.webhookHandler = NewWebhookHandler(s.WebhookService)
+	}
+
+	if s.EventBroker != nil {
+		s.streamHandler = NewStreamHandler(s.EventBroker, s.UserService)
+
+		s.collabHub = collab.NewHub()
+		s.collabHub.Follow(s.EventBroker)
+		collabHandler := NewCollabHandler(s.collabHub, s.UserService)
+		collabHandler.Origins = s.WebSocketOrigins
+		s.collabHandler = collabHandler
+	}
+
+	if s.ArticleTrashService != nil {
+		trashHandler := NewTrashHandler(s.ArticleTrashService)
+		if s.WorkspaceService != nil {
+			trashHandler.Workspaces = s.WorkspaceTrash
+		}
+		trashHandler.AuditLog = s.AuditLog
+		s.trashHandler = trashHandler
+	}
+
+	if s.AccountService != nil && len(s.ExportURLSecret) > 0 {
+		s.accountHandler = NewAccountHandler(s.AccountService, s.ExportURLSecret)
+	}
+
+	if s.IdentityService != nil && len(s.OIDCProviders) > 0 {
+		oidcHandler := NewOIDCHandler(s.IdentityService, s.UserService, s.OIDCProviders, s.OIDCStateSecret)
+		oidcHandler.TwoFactorService = s.TwoFactorService
+		oidcHandler.Cookies = s.SessionCookies
+		oidcHandler.AuditLog = s.AuditLog
+		s.oidcHandler = oidcHandler
+	}
+
+	s.authHandler = authHandler
 }
 
 // handlePing handles health check from kubernetes.
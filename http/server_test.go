@@ -67,6 +67,16 @@ func TestServerRoutes(t *testing.T) {
 			"/articles",
 			[]string{"ArticleHandler.HandleList"},
 		},
+		{
+			"GET",
+			"/articles/stream",
+			[]string{"StreamHandler.HandleStream"},
+		},
+		{
+			"GET",
+			"/articles/hello/live",
+			[]string{"CollabHandler.WebSocketToken", "AuthHandler.Authentication", "ArticleHandler.ArticleCtx", "CollabHandler.HandleConnect"},
+		},
 		{
 			"GET",
 			"/articles/random-slug",
@@ -75,17 +85,301 @@ func TestServerRoutes(t *testing.T) {
 		{
 			"POST",
 			"/articles",
-			[]string{"AuthHandler.Authentication", "ArticleHandler.HandleCreate"},
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "ArticleHandler.HandleCreate"},
 		},
 		{
 			"PATCH",
 			"/articles/random-slug",
-			[]string{"AuthHandler.Authentication", "ArticleHandler.ArticleCtx", "ArticleHandler.ArticleOwner", "ArticleHandler.HandleUpdate"},
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "ArticleHandler.ArticleCtx", "ArticleHandler.ArticleOwner", "ArticleHandler.HandleUpdate"},
 		},
 		{
 			"DELETE",
 			"/articles/random-slug",
-			[]string{"AuthHandler.Authentication", "ArticleHandler.ArticleCtx", "ArticleHandler.ArticleOwner", "ArticleHandler.HandleDelete"},
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "ArticleHandler.ArticleCtx", "ArticleHandler.ArticleOwner", "ArticleHandler.HandleDelete"},
+		},
+		{
+			"GET",
+			"/articles/trash",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "TrashHandler.HandleList"},
+		},
+		{
+			"POST",
+			"/articles/random-slug/restore",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "TrashHandler.HandleRestore"},
+		},
+		{
+			"POST",
+			"/auth/login/2fa",
+			[]string{"TwoFactorHandler.HandleLogin"},
+		},
+		{
+			"POST",
+			"/auth/2fa/enroll",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "TwoFactorHandler.HandleEnroll"},
+		},
+		{
+			"POST",
+			"/auth/2fa/confirm",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "TwoFactorHandler.HandleConfirm"},
+		},
+		{
+			"POST",
+			"/auth/2fa/disable",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "TwoFactorHandler.HandleDisable"},
+		},
+		{
+			"POST",
+			"/auth/api-keys",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "APIKeyHandler.HandleCreate"},
+		},
+		{
+			"GET",
+			"/auth/api-keys",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "APIKeyHandler.HandleList"},
+		},
+		{
+			"DELETE",
+			"/auth/api-keys/1",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "APIKeyHandler.HandleRevoke"},
+		},
+		{
+			"POST",
+			"/auth/logout",
+			[]string{"AuthHandler.Authentication", "AuthHandler.HandleLogout"},
+		},
+		{
+			"GET",
+			"/auth/sessions",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "SessionHandler.HandleList"},
+		},
+		{
+			"DELETE",
+			"/auth/sessions",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "SessionHandler.HandleRevokeOthers"},
+		},
+		{
+			"DELETE",
+			"/auth/sessions/abc",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "SessionHandler.HandleRevoke"},
+		},
+		{
+			"GET",
+			"/auth/oidc/google",
+			[]string{"OIDCHandler.HandleStart"},
+		},
+		{
+			"GET",
+			"/auth/oidc/google/callback",
+			[]string{"OIDCHandler.HandleCallback"},
+		},
+		{
+			"GET",
+			"/users/test",
+			[]string{"UserHandler.HandleGet"},
+		},
+		{
+			"GET",
+			"/users/me",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.HandleMe"},
+		},
+		{
+			"PATCH",
+			"/users/me",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "UserHandler.HandleUpdate"},
+		},
+		{
+			"POST",
+			"/users/me/email",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "UserHandler.HandleChangeEmail"},
+		},
+		{
+			"POST",
+			"/users/me/email/confirm",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "UserHandler.HandleConfirmEmail"},
+		},
+		{
+			"POST",
+			"/users/me/password",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "UserHandler.HandleChangePassword"},
+		},
+		{
+			"DELETE",
+			"/users/me",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AccountHandler.HandleDelete"},
+		},
+		{
+			"POST",
+			"/users/me/restore",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AccountHandler.HandleRestore"},
+		},
+		{
+			"POST",
+			"/users/me/export",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AccountHandler.HandleExport"},
+		},
+		{
+			"GET",
+			"/users/me/export/1",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AccountHandler.HandleGetExport"},
+		},
+		{
+			"GET",
+			"/exports/1",
+			[]string{"AccountHandler.HandleDownloadExport"},
+		},
+		{
+			"POST",
+			"/admin/users/1/unlock",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "AdminHandler.HandleUnlockUser"},
+		},
+		{
+			"GET",
+			"/admin/audit",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "AuditHandler.HandleList"},
+		},
+		{
+			"GET",
+			"/admin/audit/verify",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "AuditHandler.HandleVerify"},
+		},
+		{
+			"POST",
+			"/admin/webhooks",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.HandleCreate"},
+		},
+		{
+			"GET",
+			"/admin/webhooks",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.HandleList"},
+		},
+		{
+			"GET",
+			"/admin/webhooks/1",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.WebhookCtx", "WebhookHandler.HandleGet"},
+		},
+		{
+			"PATCH",
+			"/admin/webhooks/1",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.WebhookCtx", "WebhookHandler.HandleUpdate"},
+		},
+		{
+			"DELETE",
+			"/admin/webhooks/1",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.WebhookCtx", "WebhookHandler.HandleDelete"},
+		},
+		{
+			"GET",
+			"/admin/webhooks/1/deliveries",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "AuthHandler.RequireAdmin", "WebhookHandler.WebhookCtx", "WebhookHandler.HandleListDeliveries"},
+		},
+		{
+			"GET",
+			"/.well-known/jwks.json",
+			[]string{"JWKSHandler.HandleJWKS"},
+		},
+	}
+
+	for _, test := range tests {
+		server := NewServer()
+		invoked := &[]string{}
+		// mock handlers
+		server.articleHandler = mock.NewMockArticleHandler(invoked)
+		server.authHandler = mock.NewMockAuthHandler(invoked)
+		server.userHandler = mock.NewMockUserHandler(invoked)
+		server.twoFactorHandler = mock.NewMockTwoFactorHandler(invoked)
+		server.apiKeyHandler = mock.NewMockAPIKeyHandler(invoked)
+		server.jwksHandler = mock.NewMockJWKSHandler(invoked)
+		server.oidcHandler = mock.NewMockOIDCHandler(invoked)
+		server.adminHandler = mock.NewMockAdminHandler(invoked)
+		server.accountHandler = mock.NewMockAccountHandler(invoked)
+		server.sessionHandler = mock.NewMockSessionHandler(invoked)
+		server.trashHandler = mock.NewMockTrashHandler(invoked)
+		server.auditHandler = mock.NewMockAuditHandler(invoked)
+		server.webhookHandler = mock.NewMockWebhookHandler(invoked)
+		server.streamHandler = mock.NewMockStreamHandler(invoked)
+		server.collabHandler = mock.NewMockCollabHandler(invoked)
+
+		router := server.router()
+
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(test.method, test.route, nil)
+		if err != nil {
+			t.Fatal("creating request failed", err)
+		}
+
+		router.ServeHTTP(w, r)
+
+		if !reflect.DeepEqual(*invoked, test.expectedInvoked) {
+			t.Errorf("Expect %s but got %v", test.expectedInvoked, *invoked)
+		}
+	}
+}
+
+func TestServerRoutes_Workspaces(t *testing.T) {
+	var tests = []struct {
+		method          string
+		route           string
+		expectedInvoked []string
+	}{
+		{
+			"GET",
+			"/articles",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireMember", "ArticleHandler.HandleList"},
+		},
+		{
+			"GET",
+			"/w/acme/articles/hello",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireMember", "ArticleHandler.ArticleCtx", "ArticleHandler.HandleGet"},
+		},
+		{
+			"GET",
+			"/w/acme/articles/stream",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireMember", "StreamHandler.HandleStream"},
+		},
+		{
+			"GET",
+			"/w/acme/articles/hello/live",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "CollabHandler.WebSocketToken", "AuthHandler.Authentication", "WorkspaceHandler.RequireRole", "ArticleHandler.ArticleCtx", "CollabHandler.HandleConnect"},
+		},
+		{
+			"GET",
+			"/w/acme/articles/trash",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.RequireRole", "TrashHandler.HandleList"},
+		},
+		{
+			"POST",
+			"/w/acme/articles",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.RequireRole", "ArticleHandler.HandleCreate"},
+		},
+		{
+			"PATCH",
+			"/articles/hello",
+			[]string{"WorkspaceHandler.WorkspaceCtx", "AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.RequireRole", "ArticleHandler.ArticleCtx", "ArticleHandler.ArticleOwner", "ArticleHandler.HandleUpdate"},
+		},
+		{
+			"POST",
+			"/workspaces",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.HandleCreate"},
+		},
+		{
+			"GET",
+			"/workspaces",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.HandleList"},
+		},
+		{
+			"GET",
+			"/workspaces/acme/members",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireRole", "WorkspaceHandler.HandleListMembers"},
+		},
+		{
+			"PUT",
+			"/workspaces/acme/members/2",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireRole", "WorkspaceHandler.HandleSetMember"},
+		},
+		{
+			"DELETE",
+			"/workspaces/acme/members/2",
+			[]string{"AuthHandler.Authentication", "AuthHandler.RequireScope", "WorkspaceHandler.WorkspaceCtx", "WorkspaceHandler.RequireRole", "WorkspaceHandler.HandleRemoveMember"},
 		},
 	}
 
@@ -95,6 +389,14 @@ func TestServerRoutes(t *testing.T) {
 		// mock handlers
 		server.articleHandler = mock.NewMockArticleHandler(invoked)
 		server.authHandler = mock.NewMockAuthHandler(invoked)
+		server.userHandler = mock.NewMockUserHandler(invoked)
+		server.twoFactorHandler = mock.NewMockTwoFactorHandler(invoked)
+		server.apiKeyHandler = mock.NewMockAPIKeyHandler(invoked)
+		server.jwksHandler = mock.NewMockJWKSHandler(invoked)
+		server.workspaceHandler = mock.NewMockWorkspaceHandler(invoked)
+		server.streamHandler = mock.NewMockStreamHandler(invoked)
+		server.collabHandler = mock.NewMockCollabHandler(invoked)
+		server.trashHandler = mock.NewMockTrashHandler(invoked)
 
 		router := server.router()
 
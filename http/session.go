@@ -0,0 +1,78 @@
+package http
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+)
+
+// SessionHandler represents an HTTP handler for managing login sessions.
+type SessionHandler interface {
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleRevoke(w http.ResponseWriter, r *http.Request)
+	HandleRevokeOthers(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type sessionHandler struct {
+	// Services
+	SessionService app.SessionService
+}
+
+func NewSessionHandler(ss app.SessionService) *sessionHandler {
+	return &sessionHandler{SessionService: ss}
+}
+
+func (h *sessionHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	sessions, err := h.SessionService.List(userId)
+	if err != nil {
+		utils.Render(w, r, sessionHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewSessionListResponse(sessions, currentSessionId(r)))
+}
+
+func (h *sessionHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.SessionService.Revoke(userId, chi.URLParam(r, "sessionId")); err != nil {
+		utils.Render(w, r, sessionHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeOthers logs the user out everywhere but on the current session.
+// Requests authenticated with an API key have no session, so all are revoked.
+func (h *sessionHandler) HandleRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.SessionService.RevokeOthers(userId, currentSessionId(r)); err != nil {
+		utils.Render(w, r, sessionHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func currentSessionId(r *http.Request) string {
+	id, _ := r.Context().Value("sessionId").(string)
+	return id
+}
+
+// app error to http error
+func sessionHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrSessionNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionHandler_HandleList(t *testing.T) {
+	// Inject our mock into our handler.
+	var ss mock.SessionService
+	h := NewSessionHandler(&ss)
+
+	// Mock our List() call.
+	ss.ListFn = func(userId uint32) ([]*app.Session, error) {
+		if userId != 1 {
+			t.Fatalf("unexpected id: %d", userId)
+		}
+		return []*app.Session{
+			{ID: "abc", UserId: 1, UserAgent: "curl", IP: "127.0.0.1", CreatedAt: time.Unix(0, 0).UTC(), LastSeenAt: time.Unix(0, 0).UTC()},
+			{ID: "def", UserId: 1, CreatedAt: time.Unix(0, 0).UTC(), LastSeenAt: time.Unix(0, 0).UTC()},
+		}, nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/auth/sessions", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+	ctx = context.WithValue(ctx, "sessionId", "def")
+
+	httpHandler := http.HandlerFunc(h.HandleList)
+	httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+	// Validate mock.
+	if !ss.ListInvoked {
+		t.Fatal("expected ListInvoked to be true")
+	}
+
+	epoch := time.Unix(0, 0).UTC().Format(time.RFC3339)
+	expected := fmt.Sprintf(`[{"id":"abc","user_id":1,"user_agent":"curl","ip":"127.0.0.1","created_at":"%s","last_seen_at":"%s","current":false},{"id":"def","user_id":1,"user_agent":"","ip":"","created_at":"%s","last_seen_at":"%s","current":true}]`, epoch, epoch, epoch, epoch)
+	if received := strings.TrimSpace(w.Body.String()); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
+
+func TestSessionHandler_HandleRevoke(t *testing.T) {
+	var tests = []struct {
+		name           string
+		RevokeFn       func(userId uint32, id string) error
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			RevokeFn: func(userId uint32, id string) error {
+				if userId != 1 || id != "abc" {
+					return errors.New("wrong ids")
+				}
+				return nil
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "not found",
+			RevokeFn: func(userId uint32, id string) error {
+				return app.ErrSessionNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var ss mock.SessionService
+			h := NewSessionHandler(&ss)
+
+			// Mock our Revoke() call.
+			ss.RevokeFn = test.RevokeFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("DELETE", "/auth/sessions/abc", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("sessionId", "abc")
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			ctx = context.WithValue(ctx, "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleRevoke)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if !ss.RevokeInvoked {
+				t.Fatal("expected RevokeInvoked to be true")
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestSessionHandler_HandleRevokeOthers(t *testing.T) {
+	// Inject our mock into our handler.
+	var ss mock.SessionService
+	h := NewSessionHandler(&ss)
+
+	// Mock our RevokeOthers() call.
+	ss.RevokeOthersFn = func(userId uint32, currentId string) error {
+		if userId != 1 || currentId != "abc" {
+			return errors.New("wrong ids")
+		}
+		return nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/auth/sessions", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+	ctx = context.WithValue(ctx, "sessionId", "abc")
+
+	httpHandler := http.HandlerFunc(h.HandleRevokeOthers)
+	httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+	// Validate mock.
+	if !ss.RevokeOthersInvoked {
+		t.Fatal("expected RevokeOthersInvoked to be true")
+	}
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusNoContent, w.Code)
+	}
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often idle streams send a comment, so
+	// proxies don't time them out and clients notice dropped connections.
+	DefaultHeartbeatInterval = 15 * time.Second
+
+	// streamWriteTimeout is how long a client may take to accept an event
+	// before we give up on it.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// StreamHandler represents an HTTP handler streaming changes to articles.
+type StreamHandler interface {
+	HandleStream(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type streamHandler struct {
+	HeartbeatInterval time.Duration
+
+	// Services
+	EventBroker app.EventBroker
+	UserService app.UserService
+}
+
+func NewStreamHandler(b app.EventBroker, us app.UserService) *streamHandler {
+	return &streamHandler{HeartbeatInterval: DefaultHeartbeatInterval, EventBroker: b, UserService: us}
+}
+
+// HandleStream sends the articles of the request's workspace as they are
+// created, updated and deleted, as server-sent events named after the event
+// type, e.g. article.created, with the article as data. ?author=username
+// only sends the articles of a user.
+//
+// Clients reconnecting with Last-Event-ID get the events they missed. When
+// those aren't buffered anymore they get a reset event instead, and should
+// fetch the articles again.
+func (h *streamHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	filter, errResponse := h.filter(r)
+	if errResponse != nil {
+		utils.Render(w, r, errResponse)
+		return
+	}
+
+	var lastId int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if lastId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid Last-Event-ID")))
+			return
+		}
+	}
+
+	sub, missed := h.EventBroker.Subscribe(lastId)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // or nginx holds events back
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(write func(w io.Writer) error) error {
+		// slow clients are dropped rather than blocking us
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := write(w); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := send(func(w io.Writer) error {
+		if missed {
+			_, err := io.WriteString(w, "event: reset\ndata: {}\n\n")
+			return err
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var err error
+	// the id of the latest event filtered out, sent with the next heartbeat
+	// so clients don't resume from before it
+	var skipped int64
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				// the client fell behind or we're shutting down, it resumes
+				// from another connection
+				return
+			}
+			if !filter.match(e) {
+				skipped = e.ID
+				continue
+			}
+			skipped = 0
+			err = send(func(w io.Writer) error { return writeEvent(w, e) })
+		case <-heartbeat.C:
+			id := skipped
+			skipped = 0
+			err = send(func(w io.Writer) error {
+				if id != 0 {
+					// an id without data moves the client on without an event
+					_, err := fmt.Fprintf(w, "id: %d\n\n", id)
+					return err
+				}
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// eventFilter matches the events a stream sends.
+type eventFilter struct {
+	workspaceId uint32
+	authorId    uint32 // any if 0
+}
+
+func (h *streamHandler) filter(r *http.Request) (*eventFilter, render.Renderer) {
+	f := &eventFilter{workspaceId: app.DefaultWorkspaceId}
+	if workspace, ok := r.Context().Value("workspace").(*app.Workspace); ok {
+		f.workspaceId = workspace.ID
+	}
+
+	q := r.URL.Query()
+	if q.Get("tag") != "" {
+		return nil, payloads.ErrInvalidRequest(errors.New("filtering by tag isn't supported, articles have no tags"))
+	}
+	if username := q.Get("author"); username != "" {
+		user, err := primaryUsers(r, h.UserService).GetByUsername(username)
+		if err == app.ErrUserNotFound {
+			return nil, payloads.ErrInvalidRequest(errors.New("author not found"))
+		} else if err != nil {
+			return nil, payloads.ErrServer(err)
+		}
+		f.authorId = user.ID
+	}
+	return f, nil
+}
+
+func (f *eventFilter) match(e *app.Event) bool {
+	if e.WorkspaceId != f.workspaceId {
+		return false
+	}
+	if f.authorId != 0 {
+		var article struct {
+			UserId uint32 `json:"user_id"`
+		}
+		if err := json.Unmarshal(e.Data, &article); err != nil || article.UserId != f.authorId {
+			return false
+		}
+	}
+	return true
+}
+
+// writeEvent writes e as a server-sent event.
+func writeEvent(w io.Writer, e *app.Event) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\nevent: %s\n", e.ID, e.Type)
+	for _, line := range strings.Split(string(e.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
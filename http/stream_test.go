@@ -0,0 +1,142 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/stream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openStream connects to a stream of h in the workspace, returning a reader
+// of its lines.
+func openStream(t *testing.T, h *streamHandler, workspace *app.Workspace, path string, lastEventId string) (*bufio.Reader, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "workspace", workspace)
+		h.HandleStream(w, r.WithContext(ctx))
+	}))
+
+	r, _ := http.NewRequest("GET", ts.URL+path, nil)
+	if lastEventId != "" {
+		r.Header.Set("Last-Event-ID", lastEventId)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(r)
+	if err != nil {
+		ts.Close()
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("wrong response %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	return bufio.NewReader(res.Body), func() {
+		_ = res.Body.Close()
+		ts.Close()
+	}
+}
+
+// readUntil returns the lines read up to and including line.
+func readUntil(t *testing.T, r *bufio.Reader, line string) string {
+	var lines []string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s before %q, got %q", err, line, strings.Join(lines, ""))
+		}
+		lines = append(lines, l)
+		if strings.TrimSuffix(l, "\n") == line {
+			return strings.Join(lines, "")
+		}
+	}
+}
+
+func TestStreamHandler_HandleStream(t *testing.T) {
+	b := stream.NewBroker(10)
+	b.Publish(&app.Event{ID: 1, Type: app.EventArticleCreated, WorkspaceId: 1, Data: []byte(`{"slug":"a","user_id":2}`)})
+	b.Publish(&app.Event{ID: 3, Type: app.EventArticleCreated, WorkspaceId: 2, Data: []byte(`{"slug":"b","user_id":2}`)})
+	b.Publish(&app.Event{ID: 2, Type: app.EventArticleCreated, WorkspaceId: 1, Data: []byte(`{"slug":"c","user_id":3}`)})
+	b.Publish(&app.Event{ID: 4, Type: app.EventArticleUpdated, WorkspaceId: 1, Data: []byte(`{"slug":"a","user_id":2}`)})
+
+	var us mock.UserService
+	us.GetByUsernameFn = func(username string) (*app.User, error) {
+		return &app.User{ID: 2, Username: username}, nil
+	}
+	h := NewStreamHandler(b, &us)
+
+	r, closeStream := openStream(t, h, &app.Workspace{ID: 1}, "/articles/stream?author=alice", "1")
+	defer closeStream()
+
+	// the events of other workspaces and authors are left out
+	expected := "id: 4\nevent: article.updated\ndata: {\"slug\":\"a\",\"user_id\":2}\n"
+	if received := readUntil(t, r, "data: {\"slug\":\"a\",\"user_id\":2}"); received != expected {
+		t.Fatalf("expected %q but received %q", expected, received)
+	}
+
+	b.Publish(&app.Event{ID: 5, Type: app.EventArticleDeleted, WorkspaceId: 1, Data: []byte(`{"slug":"a","user_id":2}`)})
+	expected = "\nid: 5\nevent: article.deleted\ndata: {\"slug\":\"a\",\"user_id\":2}\n"
+	if received := readUntil(t, r, "data: {\"slug\":\"a\",\"user_id\":2}"); received != expected {
+		t.Fatalf("expected %q but received %q", expected, received)
+	}
+}
+
+func TestStreamHandler_HandleStream_Heartbeat(t *testing.T) {
+	b := stream.NewBroker(10)
+	h := NewStreamHandler(b, &mock.UserService{})
+	h.HeartbeatInterval = 10 * time.Millisecond
+
+	// clients that missed events are told to start over
+	r, closeStream := openStream(t, h, &app.Workspace{ID: 1}, "/articles/stream", "7")
+	defer closeStream()
+	readUntil(t, r, "event: reset")
+	readUntil(t, r, ": heartbeat")
+
+	// the heartbeat moves clients past events they don't get
+	b.Publish(&app.Event{ID: 8, Type: app.EventArticleCreated, WorkspaceId: 2, Data: []byte(`{}`)})
+	readUntil(t, r, "id: 8")
+}
+
+func TestStreamHandler_HandleStream_InvalidFilter(t *testing.T) {
+	var tests = []struct {
+		name             string
+		query            string
+		expectedResponse string
+	}{
+		{
+			name:             "tag",
+			query:            "?tag=go",
+			expectedResponse: `{"message":"Invalid request.","error":"filtering by tag isn't supported, articles have no tags"}`,
+		},
+		{
+			name:             "unknown author",
+			query:            "?author=nobody",
+			expectedResponse: `{"message":"Invalid request.","error":"author not found"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var us mock.UserService
+			us.GetByUsernameFn = func(username string) (*app.User, error) {
+				return nil, app.ErrUserNotFound
+			}
+			h := NewStreamHandler(stream.NewBroker(10), &us)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/articles/stream"+test.query, nil)
+			http.HandlerFunc(h.HandleStream).ServeHTTP(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("wrong status code. expected %d but got %d", http.StatusBadRequest, w.Code)
+			}
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+)
+
+// TrashHandler represents an HTTP handler for deleted articles.
+type TrashHandler interface {
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleRestore(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type trashHandler struct {
+	// Services
+	ArticleTrashService app.ArticleTrashService
+	Workspaces          app.WorkspaceTrash // optional, scopes ArticleTrashService to workspaces
+	AuditLog            app.AuditLog       // optional, records restored articles
+}
+
+func NewTrashHandler(ts app.ArticleTrashService) *trashHandler {
+	return &trashHandler{ArticleTrashService: ts}
+}
+
+// HandleList lists the deleted articles of the user.
+func (h *trashHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	articles, err := h.trash(r).Trash(userId)
+	if err != nil {
+		utils.Render(w, r, trashHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewArticleListResponse(articles))
+}
+
+func (h *trashHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	article, err := h.trash(r).Restore(userId, chi.URLParam(r, "articleSlug"))
+	if err != nil {
+		utils.Render(w, r, trashHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{Action: app.AuditArticleRestore, Target: "article:" + article.Slug})
+
+	utils.Render(w, r, payloads.NewArticleResponse(article))
+}
+
+// trash returns the trash service of the request's workspace.
+func (h *trashHandler) trash(r *http.Request) app.ArticleTrashService {
+	workspace, ok := r.Context().Value("workspace").(*app.Workspace)
+	if !ok || workspace.ID == app.DefaultWorkspaceId || h.Workspaces == nil {
+		return h.ArticleTrashService
+	}
+	return h.Workspaces.InWorkspace(workspace.ID)
+}
+
+// app error to http error
+func trashHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrArticleNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
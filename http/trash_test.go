@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashHandler_HandleList(t *testing.T) {
+	// Inject our mock into our handler.
+	var ts mock.ArticleTrashService
+	h := NewTrashHandler(&ts)
+
+	// Mock our Trash() call.
+	epoch := time.Unix(0, 0).UTC()
+	ts.TrashFn = func(userId uint32) ([]*app.Article, error) {
+		if userId != 1 {
+			t.Fatalf("unexpected id: %d", userId)
+		}
+		return []*app.Article{{ID: 1, Slug: "hello-abc", Title: "Hello", Body: "World", UserId: 1, CreatedAt: epoch, UpdatedAt: epoch, DeletedAt: &epoch}}, nil
+	}
+
+	// Invoke the handler.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/articles/trash", nil)
+	ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+	httpHandler := http.HandlerFunc(h.HandleList)
+	httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+	// Validate mock.
+	if !ts.TrashInvoked {
+		t.Fatal("expected TrashInvoked to be true")
+	}
+
+	expected := `[{"id":1,"slug":"hello-abc","title":"Hello","body":"World","user_id":1,"created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z","deleted_at":"1970-01-01T00:00:00Z"}]`
+	if received := strings.TrimSpace(w.Body.String()); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
+
+func TestTrashHandler_HandleRestore(t *testing.T) {
+	var tests = []struct {
+		name           string
+		RestoreFn      func(userId uint32, slug string) (*app.Article, error)
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			RestoreFn: func(userId uint32, slug string) (*app.Article, error) {
+				if userId != 1 || slug != "hello-abc" {
+					return nil, app.ErrArticleNotFound
+				}
+				return &app.Article{ID: 1, Slug: slug, UserId: userId}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "not found",
+			RestoreFn: func(userId uint32, slug string) (*app.Article, error) {
+				return nil, app.ErrArticleNotFound
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var ts mock.ArticleTrashService
+			h := NewTrashHandler(&ts)
+
+			// Mock our Restore() call.
+			ts.RestoreFn = test.RestoreFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/articles/hello-abc/restore", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("articleSlug", "hello-abc")
+			ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+			ctx = context.WithValue(ctx, "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleRestore)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if !ts.RestoreInvoked {
+				t.Fatal("expected RestoreInvoked to be true")
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+)
+
+// TwoFactorHandler represents an HTTP handler for managing two-factor authentication.
+type TwoFactorHandler interface {
+	HandleEnroll(w http.ResponseWriter, r *http.Request)
+	HandleConfirm(w http.ResponseWriter, r *http.Request)
+	HandleDisable(w http.ResponseWriter, r *http.Request)
+	HandleLogin(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type twoFactorHandler struct {
+	// Services
+	TwoFactorService app.TwoFactorService
+	UserService      app.UserService
+	AuditLog         app.AuditLog      // optional, records logins and changes
+	LoginThrottle    app.LoginThrottle // optional
+
+	Cookies *SessionCookies // optional, enables cookie sessions
+}
+
+func NewTwoFactorHandler(tfs app.TwoFactorService, us app.UserService) *twoFactorHandler {
+	return &twoFactorHandler{TwoFactorService: tfs, UserService: us}
+}
+
+func (h *twoFactorHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	enrollment, err := h.TwoFactorService.Enroll(userId)
+	if err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{Action: app.AuditTwoFactorEnroll, Target: userTarget(userId)})
+
+	render.Status(r, http.StatusCreated)
+	utils.Render(w, r, payloads.NewTwoFactorEnrollmentResponse(enrollment))
+}
+
+func (h *twoFactorHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.TwoFactorRequest{Action: "confirm"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	codes, err := h.TwoFactorService.Confirm(userId, data.Code)
+	if err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{Action: app.AuditTwoFactorEnable, Target: userTarget(userId)})
+
+	utils.Render(w, r, payloads.NewRecoveryCodesResponse(codes))
+}
+
+func (h *twoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.TwoFactorRequest{Action: "disable"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.TwoFactorService.Disable(userId, data.Password, data.Code); err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{Action: app.AuditTwoFactorDisable, Target: userTarget(userId)})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleLogin completes a login started with POST /auth/login by
+// exchanging the challenge token and a code for a JWT.
+func (h *twoFactorHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.TwoFactorRequest{Action: "login"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	// codes are throttled like passwords, for the user of the challenge
+	var email string
+	ip := utils.ClientIP(r)
+	if h.LoginThrottle != nil {
+		userId, err := h.TwoFactorService.ChallengeUser(data.Token)
+		if err != nil {
+			utils.Render(w, r, twoFactorHttpError(err))
+			return
+		}
+		user, err := primaryUsers(r, h.UserService).GetById(userId)
+		if err != nil {
+			utils.Render(w, r, twoFactorHttpError(err))
+			return
+		}
+		email = user.Email
+
+		if wait, err := h.LoginThrottle.Check(email, ip); err != nil {
+			handleThrottled(w, r, wait, err)
+			return
+		}
+	}
+
+	userId, err := h.TwoFactorService.VerifyChallenge(data.Token, data.Code)
+	if err == app.ErrWrongTwoFactorCode {
+		recordAudit(h.AuditLog, r, &app.AuditEvent{
+			Action: app.AuditLoginFailed,
+			After:  auditJSON(map[string]string{"method": "two_factor", "reason": err.Error()}),
+		})
+	}
+	if h.LoginThrottle != nil {
+		var tErr error
+		switch err {
+		case app.ErrWrongTwoFactorCode, app.ErrInvalidChallenge:
+			tErr = h.LoginThrottle.Failed(email, ip)
+		case nil:
+			tErr = h.LoginThrottle.Succeeded(email, ip)
+		}
+		if tErr != nil {
+			utils.Render(w, r, authHttpError(tErr))
+			return
+		}
+	}
+	if err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{
+		Action:  app.AuditLoginSucceeded,
+		ActorId: userId,
+		Target:  userTarget(userId),
+		After:   auditJSON(map[string]string{"method": "two_factor"}),
+	})
+
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	jwtToken, err := h.UserService.CreateToken(user.ID)
+	if err != nil {
+		utils.Render(w, r, twoFactorHttpError(err))
+		return
+	}
+
+	if jwtToken, err = issueToken(w, r, h.Cookies, jwtToken); err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewUserResponse(user, jwtToken))
+}
+
+// app error to http error
+func twoFactorHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrTwoFactorAlreadyEnabled,
+		app.ErrTwoFactorNotEnrolled:
+		return payloads.ErrInvalidRequest(err)
+	case app.ErrWrongTwoFactorCode,
+		app.ErrInvalidChallenge,
+		app.ErrWrongCredentials:
+		return payloads.ErrUnauthorized
+	case app.ErrUserNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,410 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorHandler_HandleEnroll(t *testing.T) {
+	var tests = []struct {
+		name             string
+		EnrollFn         func(userId uint32) (*app.TOTPEnrollment, error)
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			EnrollFn: func(userId uint32) (*app.TOTPEnrollment, error) {
+				return &app.TOTPEnrollment{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/test"}, nil
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedResponse: `{"secret":"JBSWY3DPEHPK3PXP","uri":"otpauth://totp/test"}`,
+		},
+		{
+			name: "already enabled",
+			EnrollFn: func(userId uint32) (*app.TOTPEnrollment, error) {
+				return nil, app.ErrTwoFactorAlreadyEnabled
+			},
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"two-factor authentication already enabled"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var tfs mock.TwoFactorService
+			var us mock.UserService
+			h := NewTwoFactorHandler(&tfs, &us)
+
+			// Mock our Enroll() call.
+			tfs.EnrollFn = test.EnrollFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/2fa/enroll", nil)
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleEnroll)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if !tfs.EnrollInvoked {
+				t.Fatal("expected EnrollInvoked to be true")
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestTwoFactorHandler_HandleConfirm(t *testing.T) {
+	var tests = []struct {
+		name             string
+		ConfirmFn        func(userId uint32, code string) ([]string, error)
+		ConfirmInvoked   bool
+		body             []byte
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			ConfirmFn: func(userId uint32, code string) ([]string, error) {
+				return []string{"aaaa-bbbb-cccc-dddd"}, nil
+			},
+			ConfirmInvoked:   true,
+			body:             []byte(`{"code":"123456"}`),
+			expectedResponse: `{"recovery_codes":["aaaa-bbbb-cccc-dddd"]}`,
+		},
+		{
+			name: "wrong code",
+			ConfirmFn: func(userId uint32, code string) ([]string, error) {
+				return nil, app.ErrWrongTwoFactorCode
+			},
+			ConfirmInvoked:   true,
+			body:             []byte(`{"code":"123456"}`),
+			expectedResponse: `{"message":"Unauthorized"}`,
+		},
+		{
+			name:             "Invalid request",
+			ConfirmFn:        nil,
+			ConfirmInvoked:   false,
+			body:             []byte(`{}`),
+			expectedResponse: `{"message":"Invalid request.","error":"required code"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var tfs mock.TwoFactorService
+			var us mock.UserService
+			h := NewTwoFactorHandler(&tfs, &us)
+
+			// Mock our Confirm() call.
+			tfs.ConfirmFn = test.ConfirmFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/2fa/confirm", bytes.NewBuffer(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleConfirm)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if tfs.ConfirmInvoked != test.ConfirmInvoked {
+				t.Fatalf("expected ConfirmInvoked to be %v", test.ConfirmInvoked)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestTwoFactorHandler_HandleDisable(t *testing.T) {
+	var tests = []struct {
+		name             string
+		DisableFn        func(userId uint32, password string, code string) error
+		DisableInvoked   bool
+		body             []byte
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			DisableFn: func(userId uint32, password string, code string) error {
+				return nil
+			},
+			DisableInvoked:   true,
+			body:             []byte(`{"password":"random","code":"123456"}`),
+			expectedStatus:   http.StatusNoContent,
+			expectedResponse: "",
+		},
+		{
+			name: "wrong password",
+			DisableFn: func(userId uint32, password string, code string) error {
+				return app.ErrWrongCredentials
+			},
+			DisableInvoked:   true,
+			body:             []byte(`{"password":"random","code":"123456"}`),
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: `{"message":"Unauthorized"}`,
+		},
+		{
+			name:             "Invalid request",
+			DisableFn:        nil,
+			DisableInvoked:   false,
+			body:             []byte(`{"code":"123456"}`),
+			expectedStatus:   http.StatusBadRequest,
+			expectedResponse: `{"message":"Invalid request.","error":"required password"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var tfs mock.TwoFactorService
+			var us mock.UserService
+			h := NewTwoFactorHandler(&tfs, &us)
+
+			// Mock our Disable() call.
+			tfs.DisableFn = test.DisableFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/2fa/disable", bytes.NewBuffer(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleDisable)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if tfs.DisableInvoked != test.DisableInvoked {
+				t.Fatalf("expected DisableInvoked to be %v", test.DisableInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestTwoFactorHandler_HandleLogin(t *testing.T) {
+	// mock time
+	now := time.Unix(0, 0)
+	nowString := now.Format(time.RFC3339)
+
+	var tests = []struct {
+		name                   string
+		VerifyChallengeFn      func(challenge string, code string) (uint32, error)
+		VerifyChallengeInvoked bool
+		CreateTokenInvoked     bool
+		body                   []byte
+		expectedResponse       string
+	}{
+		{
+			name: "success",
+			VerifyChallengeFn: func(challenge string, code string) (uint32, error) {
+				return 1, nil
+			},
+			VerifyChallengeInvoked: true,
+			CreateTokenInvoked:     true,
+			body:                   []byte(`{"mfa_token":"random-challenge","code":"123456"}`),
+			expectedResponse:       fmt.Sprintf(`{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"%s","updated_at":"%s","token":"random-token"}`, nowString, nowString),
+		},
+		{
+			name: "expired challenge",
+			VerifyChallengeFn: func(challenge string, code string) (uint32, error) {
+				return 0, app.ErrInvalidChallenge
+			},
+			VerifyChallengeInvoked: true,
+			CreateTokenInvoked:     false,
+			body:                   []byte(`{"mfa_token":"random-challenge","code":"123456"}`),
+			expectedResponse:       `{"message":"Unauthorized"}`,
+		},
+		{
+			name: "VerifyChallenge() error",
+			VerifyChallengeFn: func(challenge string, code string) (uint32, error) {
+				return 0, errors.New("verify challenge fn error")
+			},
+			VerifyChallengeInvoked: true,
+			CreateTokenInvoked:     false,
+			body:                   []byte(`{"mfa_token":"random-challenge","code":"123456"}`),
+			expectedResponse:       `{"message":"Server Error","error":"verify challenge fn error"}`,
+		},
+		{
+			name:                   "Invalid request",
+			VerifyChallengeFn:      nil,
+			VerifyChallengeInvoked: false,
+			CreateTokenInvoked:     false,
+			body:                   []byte(`{"code":"123456"}`),
+			expectedResponse:       `{"message":"Invalid request.","error":"required mfa_token"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var tfs mock.TwoFactorService
+			var us mock.UserService
+			h := NewTwoFactorHandler(&tfs, &us)
+
+			// Mock our VerifyChallenge(), GetById() and CreateToken() calls.
+			tfs.VerifyChallengeFn = test.VerifyChallengeFn
+			us.GetByIdFn = func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, Username: "test", Email: "test@test.com", Password: "hashed-password", CreatedAt: now, UpdatedAt: now}, nil
+			}
+			us.CreateTokenFn = func(userId uint32) (string, error) {
+				return "random-token", nil
+			}
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/login/2fa", bytes.NewBuffer(test.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			httpHandler := http.HandlerFunc(h.HandleLogin)
+			httpHandler.ServeHTTP(w, r)
+
+			// Validate mocks.
+			if tfs.VerifyChallengeInvoked != test.VerifyChallengeInvoked {
+				t.Fatalf("expected VerifyChallengeInvoked to be %v", test.VerifyChallengeInvoked)
+			}
+
+			if us.CreateTokenInvoked != test.CreateTokenInvoked {
+				t.Fatalf("expected CreateTokenInvoked to be %v", test.CreateTokenInvoked)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestTwoFactorHandler_HandleLogin_Throttle(t *testing.T) {
+	var tests = []struct {
+		name                   string
+		CheckFn                func(email string, ip string) (time.Duration, error)
+		VerifyChallengeFn      func(challenge string, code string) (uint32, error)
+		VerifyChallengeInvoked bool
+		FailedInvoked          bool
+		SucceededInvoked       bool
+		expectedStatus         int
+	}{
+		{
+			name: "correct code",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				if email != "test@test.com" || ip != "10.0.0.1" {
+					t.Fatalf("wrong email %s or ip %s", email, ip)
+				}
+				return 0, nil
+			},
+			VerifyChallengeFn: func(challenge string, code string) (uint32, error) {
+				return 1, nil
+			},
+			VerifyChallengeInvoked: true,
+			SucceededInvoked:       true,
+			expectedStatus:         http.StatusOK,
+		},
+		{
+			name: "wrong code",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return 0, nil
+			},
+			VerifyChallengeFn: func(challenge string, code string) (uint32, error) {
+				return 0, app.ErrWrongTwoFactorCode
+			},
+			VerifyChallengeInvoked: true,
+			FailedInvoked:          true,
+			expectedStatus:         http.StatusUnauthorized,
+		},
+		{
+			name: "throttled",
+			CheckFn: func(email string, ip string) (time.Duration, error) {
+				return time.Second, app.ErrTooManyLoginAttempts
+			},
+			VerifyChallengeInvoked: false,
+			expectedStatus:         http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var tfs mock.TwoFactorService
+			var us mock.UserService
+			var lt mock.LoginThrottle
+			h := NewTwoFactorHandler(&tfs, &us)
+			h.LoginThrottle = &lt
+
+			tfs.ChallengeUserFn = func(challenge string) (uint32, error) { return 1, nil }
+			tfs.VerifyChallengeFn = test.VerifyChallengeFn
+			us.GetByIdFn = func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, Username: "test", Email: "test@test.com"}, nil
+			}
+			us.CreateTokenFn = func(userId uint32) (string, error) { return "random-token", nil }
+			lt.CheckFn = test.CheckFn
+			lt.FailedFn = func(email string, ip string) error { return nil }
+			lt.SucceededFn = func(email string, ip string) error { return nil }
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/auth/login/2fa", bytes.NewBuffer([]byte(`{"mfa_token":"random-challenge","code":"123456"}`)))
+			r.Header.Set("Content-Type", "application/json")
+			r.RemoteAddr = "10.0.0.1:1234"
+			http.HandlerFunc(h.HandleLogin).ServeHTTP(w, r)
+
+			// Validate mocks.
+			if tfs.VerifyChallengeInvoked != test.VerifyChallengeInvoked {
+				t.Fatalf("expected VerifyChallengeInvoked to be %v", test.VerifyChallengeInvoked)
+			}
+			if lt.FailedInvoked != test.FailedInvoked {
+				t.Fatalf("expected FailedInvoked to be %v", test.FailedInvoked)
+			}
+			if lt.SucceededInvoked != test.SucceededInvoked {
+				t.Fatalf("expected SucceededInvoked to be %v", test.SucceededInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
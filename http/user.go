@@ -0,0 +1,188 @@
+package http
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+)
+
+// UserHandler represents an HTTP handler for managing user profiles.
+type UserHandler interface {
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleUpdate(w http.ResponseWriter, r *http.Request)
+	HandleChangeEmail(w http.ResponseWriter, r *http.Request)
+	HandleConfirmEmail(w http.ResponseWriter, r *http.Request)
+	HandleChangePassword(w http.ResponseWriter, r *http.Request)
+}
+
+// struct that implements interface
+type userHandler struct {
+	// Services
+	UserService app.UserService
+	AuditLog    app.AuditLog   // optional, records password and email changes
+	UnitOfWork  app.UnitOfWork // optional, records password changes in the same transaction
+
+	Cookies *SessionCookies // optional, enables cookie sessions
+}
+
+func NewUserHandler(us app.UserService) *userHandler {
+	return &userHandler{UserService: us}
+}
+
+// HandleGet returns the public profile of a user.
+func (h *userHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	user, err := primaryUsers(r, h.UserService).GetByUsername(chi.URLParam(r, "username"))
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewProfileResponse(user))
+}
+
+func (h *userHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.ProfileRequest{}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	data.Apply(user)
+
+	if err := h.UserService.Update(user); err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewUserResponse(user, ""))
+}
+
+// HandleChangeEmail sends a confirmation to the new address. The email
+// changes once it's confirmed at POST /users/me/email/confirm.
+func (h *userHandler) HandleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.EmailChangeRequest{Action: "request"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.UserService.RequestEmailChange(userId, data.Email, data.Password); err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *userHandler) HandleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.EmailChangeRequest{Action: "confirm"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	before, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	if err := h.UserService.ConfirmEmailChange(userId, data.Token); err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	recordAudit(h.AuditLog, r, &app.AuditEvent{
+		Action: app.AuditEmailChange,
+		Target: userTarget(userId),
+		Before: auditJSON(map[string]string{"email": before.Email}),
+		After:  auditJSON(map[string]string{"email": user.Email}),
+	})
+
+	utils.Render(w, r, payloads.NewUserResponse(user, ""))
+}
+
+// HandleChangePassword signs out every other session and returns a new
+// token for this one.
+func (h *userHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.PasswordChangeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+	event := &app.AuditEvent{Action: app.AuditPasswordChange, Target: userTarget(userId)}
+
+	var jwtToken string
+	var err error
+	if h.UnitOfWork != nil {
+		// a password change that can't be audited doesn't happen
+		err = h.UnitOfWork.Do(func(s *app.Services) error {
+			if jwtToken, err = s.Users.ChangePassword(userId, data.CurrentPassword, data.NewPassword); err != nil {
+				return err
+			}
+			return s.Audit.Record(auditEvent(r, event))
+		})
+	} else if jwtToken, err = h.UserService.ChangePassword(userId, data.CurrentPassword, data.NewPassword); err == nil {
+		recordAudit(h.AuditLog, r, event)
+	}
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	user, err := primaryUsers(r, h.UserService).GetById(userId)
+	if err != nil {
+		utils.Render(w, r, userHttpError(err))
+		return
+	}
+
+	if jwtToken, err = issueToken(w, r, h.Cookies, jwtToken); err != nil {
+		utils.Render(w, r, payloads.ErrServer(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewUserResponse(user, jwtToken))
+}
+
+// app error to http error
+func userHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrEmailAlreadyUsed,
+		app.ErrUsernameAlreadyUsed,
+		app.ErrWrongPasswordFormat,
+		app.ErrPasswordTooShort,
+		app.ErrPasswordTooLong,
+		app.ErrPasswordBreached,
+		app.ErrInvalidEmailChange:
+		return payloads.ErrInvalidRequest(err)
+	case app.ErrWrongCredentials:
+		return payloads.ErrUnauthorized
+	case app.ErrUserNotFound:
+		return payloads.ErrNotFound
+	default:
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,402 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserHandler_HandleGet(t *testing.T) {
+	var tests = []struct {
+		name             string
+		GetByUsernameFn  func(username string) (*app.User, error)
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			GetByUsernameFn: func(username string) (*app.User, error) {
+				return &app.User{ID: 1, Username: username, Email: "test@test.com", Password: "hash", Bio: "Hello", CreatedAt: time.Unix(0, 0).UTC()}, nil
+			},
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"id":1,"username":"test","bio":"Hello","created_at":"1970-01-01T00:00:00Z"}`,
+		},
+		{
+			name: "not found",
+			GetByUsernameFn: func(username string) (*app.User, error) {
+				return &app.User{}, app.ErrUserNotFound
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedResponse: `{"message":"Resource not found."}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var us mock.UserService
+			h := NewUserHandler(&us)
+
+			// Mock our GetByUsername() call.
+			us.GetByUsernameFn = test.GetByUsernameFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/users/test", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("username", "test")
+
+			httpHandler := http.HandlerFunc(h.HandleGet)
+			httpHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestUserHandler_HandleUpdate(t *testing.T) {
+	var tests = []struct {
+		name           string
+		body           string
+		UpdateFn       func(user *app.User) error
+		UpdateInvoked  bool
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			body: `{"bio":"Hello"}`,
+			UpdateFn: func(user *app.User) error {
+				if user.Username != "test" || user.Bio != "Hello" {
+					t.Fatalf("wrong user %v", user)
+				}
+				return nil
+			},
+			UpdateInvoked:  true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "username already used",
+			body: `{"username":"other"}`,
+			UpdateFn: func(user *app.User) error {
+				return app.ErrUsernameAlreadyUsed
+			},
+			UpdateInvoked:  true,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "empty username",
+			body:           `{"username":" "}`,
+			UpdateInvoked:  false,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var us mock.UserService
+			h := NewUserHandler(&us)
+
+			us.GetByIdFn = func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, Username: "test", Email: "test@test.com"}, nil
+			}
+			us.UpdateFn = test.UpdateFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("PATCH", "/users/me", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleUpdate)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if us.UpdateInvoked != test.UpdateInvoked {
+				t.Fatalf("expected UpdateInvoked to be %v", test.UpdateInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_HandleChangeEmail(t *testing.T) {
+	var tests = []struct {
+		name                      string
+		body                      string
+		RequestEmailChangeFn      func(userId uint32, email string, password string) error
+		RequestEmailChangeInvoked bool
+		expectedStatus            int
+	}{
+		{
+			name: "success",
+			body: `{"email":"new@test.com","password":"password"}`,
+			RequestEmailChangeFn: func(userId uint32, email string, password string) error {
+				if userId != 1 || email != "new@test.com" || password != "password" {
+					t.Fatalf("wrong arguments %d %s %s", userId, email, password)
+				}
+				return nil
+			},
+			RequestEmailChangeInvoked: true,
+			expectedStatus:            http.StatusAccepted,
+		},
+		{
+			name: "wrong password",
+			body: `{"email":"new@test.com","password":"wrong"}`,
+			RequestEmailChangeFn: func(userId uint32, email string, password string) error {
+				return app.ErrWrongCredentials
+			},
+			RequestEmailChangeInvoked: true,
+			expectedStatus:            http.StatusUnauthorized,
+		},
+		{
+			name:                      "invalid email",
+			body:                      `{"email":"new","password":"password"}`,
+			RequestEmailChangeInvoked: false,
+			expectedStatus:            http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var us mock.UserService
+			h := NewUserHandler(&us)
+
+			// Mock our RequestEmailChange() call.
+			us.RequestEmailChangeFn = test.RequestEmailChangeFn
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/users/me/email", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleChangeEmail)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if us.RequestEmailChangeInvoked != test.RequestEmailChangeInvoked {
+				t.Fatalf("expected RequestEmailChangeInvoked to be %v", test.RequestEmailChangeInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_HandleConfirmEmail(t *testing.T) {
+	// Inject our mock into our handler.
+	var us mock.UserService
+	h := NewUserHandler(&us)
+
+	us.ConfirmEmailChangeFn = func(userId uint32, token string) error {
+		if token != "confirmation-token" {
+			return app.ErrInvalidEmailChange
+		}
+		return nil
+	}
+	us.GetByIdFn = func(userId uint32) (*app.User, error) {
+		return &app.User{ID: userId, Username: "test", Email: "new@test.com"}, nil
+	}
+
+	for body, expectedStatus := range map[string]int{
+		`{"token":"confirmation-token"}`: http.StatusOK,
+		`{"token":"other-token"}`:        http.StatusBadRequest,
+		`{}`:                             http.StatusBadRequest,
+	} {
+		// Invoke the handler.
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/users/me/email/confirm", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+		httpHandler := http.HandlerFunc(h.HandleConfirmEmail)
+		httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+		if w.Code != expectedStatus {
+			t.Fatalf("wrong status for %s. expected %v but got %v", body, expectedStatus, w.Code)
+		}
+	}
+}
+
+func TestUserHandler_HandleChangePassword(t *testing.T) {
+	var tests = []struct {
+		name                  string
+		body                  string
+		ChangePasswordFn      func(userId uint32, currentPassword string, newPassword string) (string, error)
+		ChangePasswordInvoked bool
+		expectedStatus        int
+		expectedResponse      string
+	}{
+		{
+			name: "success",
+			body: `{"current_password":"password","new_password":"new-password"}`,
+			ChangePasswordFn: func(userId uint32, currentPassword string, newPassword string) (string, error) {
+				if currentPassword != "password" || newPassword != "new-password" {
+					t.Fatalf("wrong passwords %s %s", currentPassword, newPassword)
+				}
+				return "new-token", nil
+			},
+			ChangePasswordInvoked: true,
+			expectedStatus:        http.StatusOK,
+			expectedResponse:      `{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","token":"new-token"}`,
+		},
+		{
+			name: "wrong current password",
+			body: `{"current_password":"wrong","new_password":"new-password"}`,
+			ChangePasswordFn: func(userId uint32, currentPassword string, newPassword string) (string, error) {
+				return "", app.ErrWrongCredentials
+			},
+			ChangePasswordInvoked: true,
+			expectedStatus:        http.StatusUnauthorized,
+			expectedResponse:      `{"message":"Unauthorized"}`,
+		},
+		{
+			name:                  "missing new password",
+			body:                  `{"current_password":"password"}`,
+			ChangePasswordInvoked: false,
+			expectedStatus:        http.StatusBadRequest,
+			expectedResponse:      `{"message":"Invalid request.","error":"required new_password"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mock into our handler.
+			var us mock.UserService
+			h := NewUserHandler(&us)
+
+			us.ChangePasswordFn = test.ChangePasswordFn
+			us.GetByIdFn = func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, Username: "test", Email: "test@test.com", Password: "hash"}, nil
+			}
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/users/me/password", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleChangePassword)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mock.
+			if us.ChangePasswordInvoked != test.ChangePasswordInvoked {
+				t.Fatalf("expected ChangePasswordInvoked to be %v", test.ChangePasswordInvoked)
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
+
+func TestUserHandler_HandleChangePassword_UnitOfWork(t *testing.T) {
+	var tests = []struct {
+		name             string
+		RecordFn         func(e *app.AuditEvent) error
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name: "success",
+			RecordFn: func(e *app.AuditEvent) error {
+				if e.Action != app.AuditPasswordChange || e.ActorId != 1 || e.Target != "user:1" {
+					t.Fatalf("wrong audit event %+v", e)
+				}
+				return nil
+			},
+			expectedStatus:   http.StatusOK,
+			expectedResponse: `{"id":1,"username":"test","email":"test@test.com","bio":"","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z","token":"new-token"}`,
+		},
+		{
+			name: "audit failure",
+			RecordFn: func(e *app.AuditEvent) error {
+				return errors.New("audit failure")
+			},
+			expectedStatus:   http.StatusInternalServerError,
+			expectedResponse: `{"message":"Server Error","error":"audit failure"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Inject our mocks into our handler.
+			var us, txUsers mock.UserService
+			var al mock.AuditLog
+			var uow mock.UnitOfWork
+			h := NewUserHandler(&us)
+			h.UnitOfWork = &uow
+
+			txUsers.ChangePasswordFn = func(userId uint32, currentPassword string, newPassword string) (string, error) {
+				return "new-token", nil
+			}
+			al.RecordFn = test.RecordFn
+			uow.DoFn = func(fn func(s *app.Services) error) error {
+				return fn(&app.Services{Users: &txUsers, Audit: &al})
+			}
+			us.GetByIdFn = func(userId uint32) (*app.User, error) {
+				return &app.User{ID: userId, Username: "test", Email: "test@test.com", Password: "hash"}, nil
+			}
+
+			// Invoke the handler.
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/users/me/password", bytes.NewBufferString(`{"current_password":"password","new_password":"new-password"}`))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+
+			httpHandler := http.HandlerFunc(h.HandleChangePassword)
+			httpHandler.ServeHTTP(w, r.WithContext(ctx))
+
+			// Validate mocks.
+			if !uow.DoInvoked || !txUsers.ChangePasswordInvoked || !al.RecordInvoked {
+				t.Fatal("expected the password change and its audit in the unit of work")
+			}
+			if us.ChangePasswordInvoked {
+				t.Fatal("expected ChangePassword not to be invoked outside the unit of work")
+			}
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			expected := test.expectedResponse
+			received := strings.TrimSpace(w.Body.String())
+
+			if received != expected {
+				t.Fatalf("expected %s but received %s", expected, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AcceptSpec is a single entry of an Accept style header
+// (Accept, Accept-Encoding) together with its quality value.
+type AcceptSpec struct {
+	Value string
+	Q     float64
+}
+
+// ParseAccept parses an Accept style header into its entries, ordered by
+// descending quality. Entries keep their header order on equal quality.
+func ParseAccept(header string) []AcceptSpec {
+	var specs []AcceptSpec
+	for _, field := range strings.Split(header, ",") {
+		parts := strings.Split(field, ";")
+		value := strings.ToLower(strings.TrimSpace(parts[0]))
+		if value == "" {
+			continue
+		}
+
+		spec := AcceptSpec{Value: value, Q: 1}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+			spec.Q = q
+		}
+		specs = append(specs, spec)
+	}
+
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].Q > specs[j].Q })
+	return specs
+}
+
+// Negotiate picks the best of the offered values (in server preference order)
+// for the given Accept style header. Wildcards match the values not listed
+// explicitly. An empty header accepts the first offer. The boolean result is
+// false when nothing offered is acceptable.
+func Negotiate(header string, offers []string) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return offers[0], true
+	}
+
+	specs := ParseAccept(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, found := 0.0, false
+		// the most specific entry wins over wildcards regardless of order
+		specificity := -1
+		for _, spec := range specs {
+			s := matchSpecificity(spec.Value, offer)
+			if s > specificity {
+				q, found, specificity = spec.Q, true, s
+			}
+		}
+		if found && q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+// matchSpecificity returns how specifically the accepted value matches the
+// offer: 2 for an exact match, 1 for a type wildcard (text/*), 0 for a full
+// wildcard and -1 for no match.
+func matchSpecificity(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 2
+	case accepted == "*" || accepted == "*/*":
+		return 0
+	case strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*")):
+		return 1
+	default:
+		return -1
+	}
+}
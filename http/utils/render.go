@@ -1,11 +1,34 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"github.com/go-chi/render"
 	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/ugorji/go/codec"
 	"net/http"
 )
 
+// Content types the API can respond with, in server preference order.
+const (
+	ContentTypeJSON          = "application/json"
+	ContentTypeMsgpack       = "application/msgpack"
+	ContentTypeMsgpackLegacy = "application/x-msgpack"
+	ContentTypeCBOR          = "application/cbor"
+)
+
+var offers = []string{ContentTypeJSON, ContentTypeMsgpack, ContentTypeMsgpackLegacy, ContentTypeCBOR}
+
+var (
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+	cborHandle    = &codec.CborHandle{}
+)
+
+func init() {
+	// every render.Render/RenderList call goes through our negotiating responder
+	render.Respond = Respond
+}
+
 func Render(w http.ResponseWriter, r *http.Request, v render.Renderer) {
 	if err := render.Render(w, r, v); err != nil {
 		err := render.Render(w, r, payloads.ErrRender(err))
@@ -19,3 +42,58 @@ func RenderList(w http.ResponseWriter, r *http.Request, l []render.Renderer) {
 		panic(err)
 	}
 }
+
+// NegotiateContentType picks the format of the response from the request
+// Accept header before the handler runs, so a request whose response can't
+// be written isn't served at all. When none of the supported formats is
+// acceptable it answers 406 with a JSON error body, unless the header
+// accepts one of passthrough: formats the handler writes itself, e.g.
+// text/event-stream.
+func NegotiateContentType(passthrough ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept := r.Header.Get("Accept")
+			if contentType, ok := Negotiate(accept, offers); ok {
+				r = r.WithContext(context.WithValue(r.Context(), "contentType", contentType))
+			} else if _, ok := Negotiate(accept, passthrough); len(passthrough) == 0 || !ok {
+				w.Header().Add("Vary", "Accept")
+				render.Status(r, http.StatusNotAcceptable)
+				render.JSON(w, r, payloads.ErrNotAcceptable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Respond writes v in the format chosen by NegotiateContentType, JSON for
+// requests that didn't go through it.
+func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	contentType, _ := r.Context().Value("contentType").(string)
+	switch contentType {
+	case ContentTypeMsgpack, ContentTypeMsgpackLegacy:
+		encode(w, r, v, contentType, msgpackHandle)
+	case ContentTypeCBOR:
+		encode(w, r, v, contentType, cborHandle)
+	default:
+		render.JSON(w, r, v)
+	}
+}
+
+// encode writes v with the given codec handle, honouring the status code
+// recorded with render.Status.
+func encode(w http.ResponseWriter, r *http.Request, v interface{}, contentType string, h codec.Handle) {
+	buf := &bytes.Buffer{}
+	if err := codec.NewEncoder(buf, h).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"github.com/go-chi/render"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/ugorji/go/codec"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body,omitempty"`
+	Err   error  `json:"-"`
+}
+
+func (p *testPayload) Render(http.ResponseWriter, *http.Request) error {
+	return nil
+}
+
+func TestRender(t *testing.T) {
+	var tests = []struct {
+		name                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		handle              codec.Handle
+	}{
+		{
+			name:                "no accept header",
+			accept:              "",
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:                "wildcard",
+			accept:              "*/*",
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:                "msgpack",
+			accept:              "application/msgpack",
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/msgpack",
+			handle:              msgpackHandle,
+		},
+		{
+			name:                "cbor preferred by quality",
+			accept:              "application/json;q=0.5, application/cbor",
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/cbor",
+			handle:              cborHandle,
+		},
+		{
+			name:                "type wildcard",
+			accept:              "text/html, application/*;q=0.9",
+			expectedStatus:      http.StatusCreated,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:                "not acceptable",
+			accept:              "text/html, application/xml",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+		{
+			name:                "explicitly excluded",
+			accept:              "application/json;q=0, application/msgpack;q=0, application/x-msgpack;q=0, application/cbor;q=0",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json; charset=utf-8",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/", nil)
+			if test.accept != "" {
+				r.Header.Set("Accept", test.accept)
+			}
+
+			NegotiateContentType()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				render.Status(r, http.StatusCreated)
+				Render(w, r, &testPayload{Title: "random title", Body: "random body", Err: nil})
+			})).ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+
+			if w.Header().Get("Content-Type") != test.expectedContentType {
+				t.Fatalf("wrong content type. expected %s but got %s", test.expectedContentType, w.Header().Get("Content-Type"))
+			}
+
+			if w.Header().Get("Vary") != "Accept" {
+				t.Fatalf("expected Vary: Accept but got %q", w.Header().Get("Vary"))
+			}
+
+			if test.expectedStatus == http.StatusNotAcceptable {
+				if strings.TrimSpace(w.Body.String()) != `{"message":"Not acceptable."}` {
+					t.Fatalf("wrong body %s", w.Body.String())
+				}
+				return
+			}
+
+			var decoded map[string]interface{}
+			if test.handle != nil {
+				if err := codec.NewDecoderBytes(w.Body.Bytes(), test.handle).Decode(&decoded); err != nil {
+					t.Fatal("cannot decode body", err)
+				}
+			} else if err := codec.NewDecoderBytes(w.Body.Bytes(), &codec.JsonHandle{}).Decode(&decoded); err != nil {
+				t.Fatal("cannot decode body", err)
+			}
+
+			if decoded["title"] != "random title" || decoded["body"] != "random body" || len(decoded) != 2 {
+				t.Fatalf("wrong payload %v", decoded)
+			}
+		})
+	}
+}
+
+func TestRenderList(t *testing.T) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/msgpack")
+
+	NegotiateContentType()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderList(w, r, []render.Renderer{&testPayload{Title: "one"}, &testPayload{Title: "two"}})
+	})).ServeHTTP(w, r)
+
+	var decoded []map[string]interface{}
+	if err := codec.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&decoded); err != nil {
+		t.Fatal("cannot decode body", err)
+	}
+
+	if len(decoded) != 2 || decoded[0]["title"] != "one" || decoded[1]["title"] != "two" {
+		t.Fatalf("wrong payload %v", decoded)
+	}
+}
+
+func TestRender_Error(t *testing.T) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/cbor")
+
+	NegotiateContentType()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Render(w, r, payloads.ErrNotFound)
+	})).ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("wrong status. expected %v but got %v", http.StatusNotFound, w.Code)
+	}
+
+	var decoded map[string]interface{}
+	if err := codec.NewDecoderBytes(w.Body.Bytes(), cborHandle).Decode(&decoded); err != nil {
+		t.Fatal("cannot decode body", err)
+	}
+
+	if decoded["message"] != "Resource not found." || len(decoded) != 1 {
+		t.Fatalf("wrong payload %v", decoded)
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	var tests = []struct {
+		name            string
+		method          string
+		accept          string
+		expectedServed  bool
+		expectedStatus  int
+		expectedContent string
+	}{
+		{
+			name:            "acceptable",
+			method:          "POST",
+			accept:          "application/cbor",
+			expectedServed:  true,
+			expectedStatus:  http.StatusOK,
+			expectedContent: "application/cbor",
+		},
+		{
+			name:           "write not acceptable",
+			method:         "POST",
+			accept:         "text/html",
+			expectedServed: false,
+			expectedStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:           "passthrough",
+			method:         "GET",
+			accept:         "text/event-stream",
+			expectedServed: true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var served bool
+			var contentType string
+			handler := NegotiateContentType("text/event-stream")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+				contentType, _ = r.Context().Value("contentType").(string)
+			}))
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(test.method, "/", nil)
+			r.Header.Set("Accept", test.accept)
+			handler.ServeHTTP(w, r)
+
+			if served != test.expectedServed {
+				t.Fatalf("expected the handler to be served %t but got %t", test.expectedServed, served)
+			}
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %v but got %v", test.expectedStatus, w.Code)
+			}
+			if contentType != test.expectedContent {
+				t.Fatalf("wrong content type. expected %q but got %q", test.expectedContent, contentType)
+			}
+		})
+	}
+}
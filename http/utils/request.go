@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the IP address of the client. It relies on
+// middleware.RealIP having resolved proxy headers into RemoteAddr.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RealIP stores bare addresses
+		return r.RemoteAddr
+	}
+	return host
+}
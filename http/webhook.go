@@ -0,0 +1,170 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net/http"
+	"strconv"
+)
+
+// DefaultDeliveryListLimit and MaxDeliveryListLimit bound how many
+// deliveries GET /admin/webhooks/{webhookId}/deliveries returns.
+const (
+	DefaultDeliveryListLimit = 20
+	MaxDeliveryListLimit     = 100
+)
+
+// WebhookHandler represents an HTTP handler for managing webhook
+// subscriptions.
+type WebhookHandler interface {
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleUpdate(w http.ResponseWriter, r *http.Request)
+	HandleDelete(w http.ResponseWriter, r *http.Request)
+	HandleListDeliveries(w http.ResponseWriter, r *http.Request)
+	WebhookCtx(next http.Handler) http.Handler
+}
+
+// struct that implements interface
+type webhookHandler struct {
+	// Services
+	WebhookService app.WebhookService
+}
+
+func NewWebhookHandler(ws app.WebhookService) *webhookHandler {
+	return &webhookHandler{WebhookService: ws}
+}
+
+// HandleCreate creates an active webhook. Its secret is only returned here.
+func (h *webhookHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.WebhookRequest{Action: "create"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	webhook := &app.Webhook{Active: true}
+	data.Apply(webhook)
+
+	if err := h.WebhookService.Create(webhook); err != nil {
+		utils.Render(w, r, webhookHttpError(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	utils.Render(w, r, payloads.NewWebhookResponse(webhook, true))
+}
+
+func (h *webhookHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.WebhookService.List()
+	if err != nil {
+		utils.Render(w, r, webhookHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewWebhookListResponse(webhooks))
+}
+
+func (h *webhookHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*app.Webhook)
+
+	utils.Render(w, r, payloads.NewWebhookResponse(webhook, false))
+}
+
+// HandleUpdate changes the fields sent, e.g. {"active":false} pauses the
+// webhook. Its deliveries wait until it's active again.
+func (h *webhookHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*app.Webhook)
+
+	data := &payloads.WebhookRequest{Action: "update"}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+	data.Apply(webhook)
+
+	if err := h.WebhookService.Update(webhook); err != nil {
+		utils.Render(w, r, webhookHttpError(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewWebhookResponse(webhook, false))
+}
+
+func (h *webhookHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*app.Webhook)
+
+	if err := h.WebhookService.Delete(webhook.ID); err != nil {
+		utils.Render(w, r, webhookHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListDeliveries lists the latest deliveries of the webhook, with the
+// log of their attempts.
+func (h *webhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook := r.Context().Value("webhook").(*app.Webhook)
+
+	limit := DefaultDeliveryListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid limit")))
+			return
+		}
+		limit = l
+	}
+	if limit > MaxDeliveryListLimit {
+		limit = MaxDeliveryListLimit
+	}
+
+	deliveries, err := h.WebhookService.Deliveries(webhook.ID, limit)
+	if err != nil {
+		utils.Render(w, r, webhookHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewWebhookDeliveryListResponse(deliveries))
+}
+
+// middlewares
+
+func (h *webhookHandler) WebhookCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "webhookId"), 10, 32)
+		if err != nil {
+			utils.Render(w, r, payloads.ErrNotFound)
+			return
+		}
+
+		webhook, err := h.WebhookService.Get(uint32(id))
+		if err != nil {
+			utils.Render(w, r, webhookHttpError(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "webhook", webhook)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// app error to http error
+func webhookHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrWebhookNotFound:
+		return payloads.ErrNotFound
+	default:
+		if errors.Is(err, app.ErrForeignKeyViolation) {
+			return payloads.ErrInvalidRequest(errors.New("workspace not found"))
+		}
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandler_HandleCreate(t *testing.T) {
+	var tests = []struct {
+		name             string
+		body             string
+		CreateInvoked    bool
+		expectedResponse string
+	}{
+		{
+			name:             "success",
+			body:             `{"url":"https://partner.example.com/hooks","events":["article.created"]}`,
+			CreateInvoked:    true,
+			expectedResponse: `{"id":1,"url":"https://partner.example.com/hooks","secret":"whsec_abc","events":["article.created"],"active":true,"created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z"}`,
+		},
+		{
+			name:             "missing url",
+			body:             `{"events":["article.created"]}`,
+			CreateInvoked:    false,
+			expectedResponse: `{"message":"Invalid request.","error":"required url"}`,
+		},
+		{
+			name:             "invalid url",
+			body:             `{"url":"ftp://partner.example.com"}`,
+			CreateInvoked:    false,
+			expectedResponse: `{"message":"Invalid request.","error":"url must be an absolute http or https URL"}`,
+		},
+		{
+			name:             "unknown event",
+			body:             `{"url":"https://partner.example.com/hooks","events":["user.created"]}`,
+			CreateInvoked:    false,
+			expectedResponse: `{"message":"Invalid request.","error":"unknown event \"user.created\", expected one of article.created, article.updated, article.deleted, article.restored, article.purged"}`,
+		},
+		{
+			name:             "short secret",
+			body:             `{"url":"https://partner.example.com/hooks","secret":"123"}`,
+			CreateInvoked:    false,
+			expectedResponse: `{"message":"Invalid request.","error":"secret must be at least 16 characters"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ws mock.WebhookService
+			ws.CreateFn = func(w *app.Webhook) error {
+				w.ID = 1
+				w.Secret = "whsec_abc"
+				w.CreatedAt = time.Unix(0, 0).UTC()
+				w.UpdatedAt = w.CreatedAt
+				return nil
+			}
+			h := NewWebhookHandler(&ws)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/admin/webhooks", bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			http.HandlerFunc(h.HandleCreate).ServeHTTP(w, r)
+
+			if ws.CreateInvoked != test.CreateInvoked {
+				t.Fatalf("expected CreateInvoked to be %v", test.CreateInvoked)
+			}
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_HandleUpdate(t *testing.T) {
+	var ws mock.WebhookService
+	ws.UpdateFn = func(w *app.Webhook) error {
+		if w.Active || w.URL != "https://partner.example.com/hooks" || w.Secret != "whsec_abc" {
+			t.Fatalf("wrong webhook %+v", w)
+		}
+		return nil
+	}
+	h := NewWebhookHandler(&ws)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("PATCH", "/admin/webhooks/1", bytes.NewBufferString(`{"active":false}`))
+	r.Header.Set("Content-Type", "application/json")
+	webhook := &app.Webhook{ID: 1, URL: "https://partner.example.com/hooks", Secret: "whsec_abc", Events: []string{}, Active: true, CreatedAt: time.Unix(0, 0).UTC(), UpdatedAt: time.Unix(0, 0).UTC()}
+	ctx := context.WithValue(r.Context(), "webhook", webhook)
+	http.HandlerFunc(h.HandleUpdate).ServeHTTP(w, r.WithContext(ctx))
+
+	if !ws.UpdateInvoked {
+		t.Fatal("expected UpdateInvoked to be true")
+	}
+
+	// the secret isn't returned again
+	expected := `{"id":1,"url":"https://partner.example.com/hooks","events":[],"active":false,"created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z"}`
+	if received := strings.TrimSpace(w.Body.String()); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
+
+func TestWebhookHandler_HandleListDeliveries(t *testing.T) {
+	var ws mock.WebhookService
+	ws.DeliveriesFn = func(webhookId uint32, limit int) ([]*app.WebhookDelivery, error) {
+		if webhookId != 1 || limit != MaxDeliveryListLimit {
+			t.Fatalf("wrong arguments %d, %d", webhookId, limit)
+		}
+		epoch := time.Unix(0, 0).UTC()
+		return []*app.WebhookDelivery{{
+			ID:            2,
+			Event:         &app.Event{ID: 3, Type: app.EventArticleDeleted, WorkspaceId: 1, Data: []byte(`{"slug":"hello"}`), CreatedAt: epoch},
+			Status:        app.DeliveryDead,
+			Attempts:      1,
+			NextAttemptAt: epoch,
+			LastError:     "unexpected status 500",
+			UpdatedAt:     epoch,
+			Log:           []*app.WebhookAttempt{{ID: 4, DeliveryId: 2, StatusCode: 500, Error: "unexpected status 500", DurationMs: 12, CreatedAt: epoch}},
+		}}, nil
+	}
+	h := NewWebhookHandler(&ws)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/admin/webhooks/1/deliveries?limit=1000", nil)
+	ctx := context.WithValue(r.Context(), "webhook", &app.Webhook{ID: 1})
+	http.HandlerFunc(h.HandleListDeliveries).ServeHTTP(w, r.WithContext(ctx))
+
+	expected := `[{"id":2,"event":{"id":3,"type":"article.deleted","workspace_id":1,"data":{"slug":"hello"},"created_at":"1970-01-01T00:00:00Z"},"status":"dead","attempts":1,"next_attempt_at":"1970-01-01T00:00:00Z","last_error":"unexpected status 500","updated_at":"1970-01-01T00:00:00Z","log":[{"id":4,"delivery_id":2,"status_code":500,"error":"unexpected status 500","duration_ms":12,"created_at":"1970-01-01T00:00:00Z"}]}]`
+	if received := strings.TrimSpace(w.Body.String()); received != expected {
+		t.Fatalf("expected %s but received %s", expected, received)
+	}
+}
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/http/payloads"
+	"github.com/leartgjoni/go-rest-template/http/utils"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WorkspaceHeader names the workspace of a request, unless its path does.
+const WorkspaceHeader = "X-Workspace"
+
+// WorkspaceHandler represents an HTTP handler for managing workspaces and
+// resolving the workspace of requests.
+type WorkspaceHandler interface {
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleListMembers(w http.ResponseWriter, r *http.Request)
+	HandleSetMember(w http.ResponseWriter, r *http.Request)
+	HandleRemoveMember(w http.ResponseWriter, r *http.Request)
+	WorkspaceCtx(next http.Handler) http.Handler
+	RequireRole(role string) func(next http.Handler) http.Handler
+	RequireMember(authenticate func(next http.Handler) http.Handler) func(next http.Handler) http.Handler
+}
+
+// struct that implements interface
+type workspaceHandler struct {
+	// Services
+	WorkspaceService app.WorkspaceService
+	AuditLog         app.AuditLog // optional, records denied requests
+
+	Domain string // optional, resolves workspaces from subdomains of it
+}
+
+func NewWorkspaceHandler(ws app.WorkspaceService) *workspaceHandler {
+	return &workspaceHandler{WorkspaceService: ws}
+}
+
+// HandleCreate creates a workspace owned by the user.
+func (h *workspaceHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	data := &payloads.WorkspaceRequest{}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	userId := r.Context().Value("userId").(uint32)
+
+	if err := h.WorkspaceService.Create(data.Workspace, userId); err != nil {
+		utils.Render(w, r, workspaceHttpError(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	utils.Render(w, r, payloads.NewWorkspaceResponse(data.Workspace))
+}
+
+// HandleList lists the workspaces the user is a member of.
+func (h *workspaceHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uint32)
+
+	workspaces, err := h.WorkspaceService.List(userId)
+	if err != nil {
+		utils.Render(w, r, workspaceHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewWorkspaceListResponse(workspaces))
+}
+
+func (h *workspaceHandler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	workspace := r.Context().Value("workspace").(*app.Workspace)
+
+	members, err := h.WorkspaceService.Members(workspace.ID)
+	if err != nil {
+		utils.Render(w, r, workspaceHttpError(err))
+		return
+	}
+
+	utils.RenderList(w, r, payloads.NewMembershipListResponse(members))
+}
+
+// HandleSetMember adds a user to the workspace, or changes their role.
+func (h *workspaceHandler) HandleSetMember(w http.ResponseWriter, r *http.Request) {
+	workspace := r.Context().Value("workspace").(*app.Workspace)
+
+	userId, err := strconv.ParseUint(chi.URLParam(r, "userId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid user id")))
+		return
+	}
+
+	data := &payloads.MembershipRequest{}
+	if err := render.Bind(r, data); err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(err))
+		return
+	}
+
+	m := &app.Membership{WorkspaceId: workspace.ID, UserId: uint32(userId), Role: data.Role}
+	if err := h.WorkspaceService.SetMember(m); err != nil {
+		utils.Render(w, r, workspaceHttpError(err))
+		return
+	}
+
+	utils.Render(w, r, payloads.NewMembershipResponse(m))
+}
+
+func (h *workspaceHandler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	workspace := r.Context().Value("workspace").(*app.Workspace)
+
+	userId, err := strconv.ParseUint(chi.URLParam(r, "userId"), 10, 32)
+	if err != nil {
+		utils.Render(w, r, payloads.ErrInvalidRequest(errors.New("invalid user id")))
+		return
+	}
+
+	if err := h.WorkspaceService.RemoveMember(workspace.ID, uint32(userId)); err != nil {
+		utils.Render(w, r, workspaceHttpError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// middlewares
+
+// WorkspaceCtx resolves the workspace a request is for, from the path
+// prefix, the X-Workspace header or the subdomain, in that order. Requests
+// naming none are for the default workspace and get none in the context.
+func (h *workspaceHandler) WorkspaceCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug := h.workspaceSlug(r)
+		if slug == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		workspace, err := h.WorkspaceService.GetBySlug(slug)
+		if err != nil {
+			utils.Render(w, r, workspaceHttpError(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "workspace", workspace)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *workspaceHandler) workspaceSlug(r *http.Request) string {
+	if slug := chi.URLParam(r, "workspace"); slug != "" {
+		return slug
+	}
+	if slug := r.Header.Get(WorkspaceHeader); slug != "" {
+		return slug
+	}
+	if h.Domain == "" {
+		return ""
+	}
+
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	if sub := strings.TrimSuffix(host, "."+strings.ToLower(h.Domain)); sub != host && !strings.Contains(sub, ".") {
+		return sub
+	}
+	return ""
+}
+
+// RequireRole restricts a route to members of the request's workspace with
+// at least role. It must come after Authentication and WorkspaceCtx. The
+// default workspace has no members: everyone may edit it, nobody manage it.
+func (h *workspaceHandler) RequireRole(role string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			workspace, ok := r.Context().Value("workspace").(*app.Workspace)
+			if !ok || workspace.ID == app.DefaultWorkspaceId {
+				if role == app.RoleOwner {
+					recordDenied(h.AuditLog, r, "role "+role)
+					utils.Render(w, r, payloads.ErrForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userId := r.Context().Value("userId").(uint32)
+			m, err := h.WorkspaceService.Membership(workspace.ID, userId)
+			if err == app.ErrMembershipNotFound || (err == nil && !m.HasRole(role)) {
+				recordDenied(h.AuditLog, r, "role "+role)
+				utils.Render(w, r, payloads.ErrForbidden)
+				return
+			}
+			if err != nil {
+				utils.Render(w, r, workspaceHttpError(err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireMember restricts reading a workspace to its members, authenticating
+// requests with authenticate first. Anyone may read the default workspace.
+// It must come after WorkspaceCtx.
+func (h *workspaceHandler) RequireMember(authenticate func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		members := authenticate(h.RequireRole(app.RoleViewer)(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if workspace, ok := r.Context().Value("workspace").(*app.Workspace); ok && workspace.ID != app.DefaultWorkspaceId {
+				members.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// app error to http error
+func workspaceHttpError(err error) render.Renderer {
+	switch err {
+	case app.ErrWorkspaceSlugUsed,
+		app.ErrInvalidRole,
+		app.ErrLastOwner:
+		return payloads.ErrInvalidRequest(err)
+	case app.ErrWorkspaceNotFound,
+		app.ErrMembershipNotFound:
+		return payloads.ErrNotFound
+	default:
+		if errors.Is(err, app.ErrForeignKeyViolation) {
+			// the user to add doesn't exist
+			return payloads.ErrNotFound
+		}
+		return payloads.ErrServer(err)
+	}
+}
@@ -0,0 +1,248 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-chi/chi"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceHandler_WorkspaceCtx(t *testing.T) {
+	var tests = []struct {
+		name             string
+		path             string
+		header           string
+		host             string
+		expectedSlug     string
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{name: "path", path: "/w/acme/articles", header: "other", host: "other.example.com", expectedSlug: "acme", expectedStatus: http.StatusOK},
+		{name: "header", path: "/articles", header: "acme", host: "other.example.com", expectedSlug: "acme", expectedStatus: http.StatusOK},
+		{name: "subdomain", path: "/articles", host: "Acme.example.com:8080", expectedSlug: "acme", expectedStatus: http.StatusOK},
+		{name: "nested subdomain", path: "/articles", host: "a.acme.example.com", expectedStatus: http.StatusOK},
+		{name: "default", path: "/articles", host: "example.com", expectedStatus: http.StatusOK},
+		{name: "not found", path: "/w/missing/articles", expectedSlug: "missing", expectedStatus: http.StatusNotFound, expectedResponse: `{"message":"Resource not found."}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ws mock.WorkspaceService
+			ws.GetBySlugFn = func(slug string) (*app.Workspace, error) {
+				if slug != test.expectedSlug {
+					t.Fatalf("wrong slug. expected %s but got %s", test.expectedSlug, slug)
+				}
+				if slug == "missing" {
+					return nil, app.ErrWorkspaceNotFound
+				}
+				return &app.Workspace{ID: 2, Slug: slug}, nil
+			}
+			h := NewWorkspaceHandler(&ws)
+			h.Domain = "example.com"
+
+			var workspace *app.Workspace
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				workspace, _ = r.Context().Value("workspace").(*app.Workspace)
+			})
+
+			router := chi.NewRouter()
+			router.With(h.WorkspaceCtx).Get("/articles", next)
+			router.With(h.WorkspaceCtx).Get("/w/{workspace}/articles", next)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", test.path, nil)
+			r.Host = test.host
+			if test.header != "" {
+				r.Header.Set(WorkspaceHeader, test.header)
+			}
+			router.ServeHTTP(w, r)
+
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %d but got %d", test.expectedStatus, w.Code)
+			}
+			if ws.GetBySlugInvoked != (test.expectedSlug != "") {
+				t.Fatalf("expected GetBySlugInvoked to be %v", test.expectedSlug != "")
+			}
+			if test.expectedStatus == http.StatusOK && test.expectedSlug != "" && (workspace == nil || workspace.Slug != test.expectedSlug) {
+				t.Fatalf("wrong workspace in context %+v", workspace)
+			}
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
+
+func TestWorkspaceHandler_RequireRole(t *testing.T) {
+	var tests = []struct {
+		name              string
+		workspace         *app.Workspace
+		role              string
+		member            *app.Membership
+		MembershipInvoked bool
+		expectedStatus    int
+	}{
+		{name: "default workspace", role: app.RoleEditor, expectedStatus: http.StatusOK},
+		{name: "default workspace owner", role: app.RoleOwner, expectedStatus: http.StatusForbidden},
+		{name: "member", workspace: &app.Workspace{ID: 2}, role: app.RoleEditor, member: &app.Membership{Role: app.RoleOwner}, MembershipInvoked: true, expectedStatus: http.StatusOK},
+		{name: "lesser role", workspace: &app.Workspace{ID: 2}, role: app.RoleEditor, member: &app.Membership{Role: app.RoleViewer}, MembershipInvoked: true, expectedStatus: http.StatusForbidden},
+		{name: "not a member", workspace: &app.Workspace{ID: 2}, role: app.RoleViewer, MembershipInvoked: true, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ws mock.WorkspaceService
+			ws.MembershipFn = func(workspaceId uint32, userId uint32) (*app.Membership, error) {
+				if workspaceId != 2 || userId != 1 {
+					t.Fatalf("wrong membership %d, %d", workspaceId, userId)
+				}
+				if test.member == nil {
+					return nil, app.ErrMembershipNotFound
+				}
+				return test.member, nil
+			}
+			h := NewWorkspaceHandler(&ws)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("POST", "/articles", nil)
+			ctx := context.WithValue(r.Context(), "userId", uint32(1))
+			if test.workspace != nil {
+				ctx = context.WithValue(ctx, "workspace", test.workspace)
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			h.RequireRole(test.role)(next).ServeHTTP(w, r.WithContext(ctx))
+
+			if ws.MembershipInvoked != test.MembershipInvoked {
+				t.Fatalf("expected MembershipInvoked to be %v", test.MembershipInvoked)
+			}
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %d but got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestWorkspaceHandler_RequireMember(t *testing.T) {
+	var tests = []struct {
+		name                  string
+		workspace             *app.Workspace
+		member                *app.Membership
+		authenticationInvoked bool
+		expectedStatus        int
+	}{
+		{name: "default workspace", authenticationInvoked: false, expectedStatus: http.StatusOK},
+		{name: "member", workspace: &app.Workspace{ID: 2}, member: &app.Membership{Role: app.RoleViewer}, authenticationInvoked: true, expectedStatus: http.StatusOK},
+		{name: "not a member", workspace: &app.Workspace{ID: 2}, authenticationInvoked: true, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ws mock.WorkspaceService
+			ws.MembershipFn = func(workspaceId uint32, userId uint32) (*app.Membership, error) {
+				if test.member == nil {
+					return nil, app.ErrMembershipNotFound
+				}
+				return test.member, nil
+			}
+			h := NewWorkspaceHandler(&ws)
+
+			// stands in for AuthHandler.Authentication
+			var authenticationInvoked bool
+			authenticate := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					authenticationInvoked = true
+					ctx := context.WithValue(r.Context(), "userId", uint32(1))
+					next.ServeHTTP(w, r.WithContext(ctx))
+				})
+			}
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/articles", nil)
+			if test.workspace != nil {
+				r = r.WithContext(context.WithValue(r.Context(), "workspace", test.workspace))
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			h.RequireMember(authenticate)(next).ServeHTTP(w, r)
+
+			if authenticationInvoked != test.authenticationInvoked {
+				t.Fatalf("expected authentication to be invoked %v", test.authenticationInvoked)
+			}
+			if w.Code != test.expectedStatus {
+				t.Fatalf("wrong status. expected %d but got %d", test.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestWorkspaceHandler_HandleSetMember(t *testing.T) {
+	var tests = []struct {
+		name             string
+		userId           string
+		body             string
+		SetMemberFn      func(m *app.Membership) error
+		SetMemberInvoked bool
+		expectedResponse string
+	}{
+		{
+			name:             "success",
+			userId:           "3",
+			body:             `{"role":"editor"}`,
+			SetMemberFn:      func(m *app.Membership) error { return nil },
+			SetMemberInvoked: true,
+			expectedResponse: `{"workspace_id":2,"user_id":3,"role":"editor","created_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:             "invalid role",
+			userId:           "3",
+			body:             `{"role":"admin"}`,
+			SetMemberInvoked: false,
+			expectedResponse: `{"message":"Invalid request.","error":"role must be one of owner, editor, viewer"}`,
+		},
+		{
+			name:             "last owner",
+			userId:           "1",
+			body:             `{"role":"viewer"}`,
+			SetMemberFn:      func(m *app.Membership) error { return app.ErrLastOwner },
+			SetMemberInvoked: true,
+			expectedResponse: `{"message":"Invalid request.","error":"` + app.ErrLastOwner.Error() + `"}`,
+		},
+		{
+			name:             "invalid user id",
+			userId:           "me",
+			body:             `{"role":"viewer"}`,
+			SetMemberInvoked: false,
+			expectedResponse: `{"message":"Invalid request.","error":"invalid user id"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ws mock.WorkspaceService
+			ws.SetMemberFn = test.SetMemberFn
+			h := NewWorkspaceHandler(&ws)
+
+			router := chi.NewRouter()
+			router.Put("/workspaces/{workspace}/members/{userId}", h.HandleSetMember)
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("PUT", "/workspaces/acme/members/"+test.userId, bytes.NewBufferString(test.body))
+			r.Header.Set("Content-Type", "application/json")
+			ctx := context.WithValue(r.Context(), "workspace", &app.Workspace{ID: 2, Slug: "acme"})
+			router.ServeHTTP(w, r.WithContext(ctx))
+
+			if ws.SetMemberInvoked != test.SetMemberInvoked {
+				t.Fatalf("expected SetMemberInvoked to be %v", test.SetMemberInvoked)
+			}
+			if received := strings.TrimSpace(w.Body.String()); received != test.expectedResponse {
+				t.Fatalf("expected %s but received %s", test.expectedResponse, received)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package app
+
+import "time"
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	ID        uint32    `json:"id"`
+	UserId    uint32    `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExternalUser is what an identity provider asserts about a signed in user.
+type ExternalUser struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+type IdentityService interface {
+	// Login returns the user linked to the external account. Unknown accounts
+	// are linked to the user with the same, verified, email or sign up a new
+	// user. Like UserService.Login it returns ErrTwoFactorRequired, with the
+	// user, when a second factor is needed.
+	Login(u *ExternalUser) (*User, error)
+}
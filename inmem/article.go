@@ -0,0 +1,114 @@
+package inmem
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/slug"
+	"sort"
+)
+
+// Ensure service implements interface.
+var _ app.ArticleService = &ArticleService{}
+
+// ArticleService represents a service to manage articles.
+type ArticleService struct {
+	db *DB
+}
+
+// NewArticleService returns a new instance of ArticleService.
+func NewArticleService(db *DB) *ArticleService {
+	return &ArticleService{
+		db: db,
+	}
+}
+
+func (s *ArticleService) GetAll() ([]*app.Article, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	var articles []*app.Article
+	for _, a := range s.db.articles {
+		article := *a
+		articles = append(articles, &article)
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+
+	return articles, nil
+}
+
+func (s *ArticleService) GetBySlug(slug string) (*app.Article, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	a := s.db.articleBySlug(slug)
+	if a == nil {
+		return &app.Article{}, app.ErrArticleNotFound
+	}
+
+	article := *a
+	return &article, nil
+}
+
+func (s *ArticleService) Save(a *app.Article) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[a.UserId]; !ok {
+		return &app.ConstraintError{Err: app.ErrForeignKeyViolation, Constraint: "articles_user_id_fkey"}
+	}
+
+	a.Slug = s.db.newSlug(a.Title)
+	s.db.lastArticleId++
+	a.ID = s.db.lastArticleId
+
+	article := *a
+	s.db.articles[a.ID] = &article
+	return nil
+}
+
+func (s *ArticleService) Update(a *app.Article) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	article := s.db.articleBySlug(a.Slug)
+	if article == nil {
+		return app.ErrArticleNotFound
+	}
+
+	article.Slug = s.db.newSlug(a.Title)
+	article.Title = a.Title
+	article.Body = a.Body
+	article.UpdatedAt = a.UpdatedAt
+
+	a.Slug = article.Slug
+	return nil
+}
+
+func (s *ArticleService) Delete(slug string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if a := s.db.articleBySlug(slug); a != nil {
+		delete(s.db.articles, a.ID)
+	}
+	return nil
+}
+
+// articleBySlug returns the stored article, callers must hold the lock.
+func (db *DB) articleBySlug(slug string) *app.Article {
+	for _, a := range db.articles {
+		if a.Slug == slug {
+			return a
+		}
+	}
+	return nil
+}
+
+// newSlug returns an unused slug for a title, callers must hold the lock.
+func (db *DB) newSlug(title string) string {
+	for {
+		s := slug.New(title, 12)
+		if db.articleBySlug(s) == nil {
+			return s
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package inmem
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// newTestArticleService returns a service with one user to write articles.
+func newTestArticleService(t *testing.T) *ArticleService {
+	db := NewDB()
+	if err := newTestUserService(t, db).Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	return NewArticleService(db)
+}
+
+func TestArticleService_Save(t *testing.T) {
+	as := newTestArticleService(t)
+
+	article := app.Article{Title: "title 1", Body: "body 1", UserId: 1, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := as.Save(&article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	if article.ID != 1 || !regexp.MustCompile(`^title-1-[a-zA-Z0-9]{12}$`).MatchString(article.Slug) {
+		t.Fatalf("save error. expected article id and slug to be set but got %+v", article)
+	}
+
+	err := as.Save(&app.Article{Title: "title 2", UserId: 2})
+	if !errors.Is(err, app.ErrForeignKeyViolation) {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrForeignKeyViolation, err)
+	}
+}
+
+func TestArticleService_GetBySlug(t *testing.T) {
+	as := newTestArticleService(t)
+	article := app.Article{Title: "title 1", UserId: 1}
+	if err := as.Save(&article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+
+	if a, err := as.GetBySlug(article.Slug); err != nil || a.ID != article.ID {
+		t.Fatalf("expected article but got %+v, %v", a, err)
+	}
+	if _, err := as.GetBySlug("other"); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+}
+
+func TestArticleService_GetAll(t *testing.T) {
+	as := newTestArticleService(t)
+	for _, title := range []string{"title 1", "title 2", "title 3"} {
+		if err := as.Save(&app.Article{Title: title, UserId: 1}); err != nil {
+			t.Fatal("cannot save article", err)
+		}
+	}
+
+	articles, err := as.GetAll()
+	if err != nil {
+		t.Fatal("cannot get articles", err)
+	}
+	if len(articles) != 3 || articles[0].Title != "title 1" || articles[2].Title != "title 3" {
+		t.Fatalf("expected articles in order but got %v", articles)
+	}
+}
+
+func TestArticleService_Update(t *testing.T) {
+	as := newTestArticleService(t)
+	article := app.Article{Title: "title 1", UserId: 1}
+	if err := as.Save(&article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	oldSlug := article.Slug
+
+	article.Title = "new title"
+	article.Body = "new body"
+	if err := as.Update(&article); err != nil {
+		t.Fatal("cannot update article", err)
+	}
+	if !regexp.MustCompile(`^new-title-[a-zA-Z0-9]{12}$`).MatchString(article.Slug) {
+		t.Fatalf("expected a new slug but got %s", article.Slug)
+	}
+
+	if _, err := as.GetBySlug(oldSlug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+	if a, err := as.GetBySlug(article.Slug); err != nil || a.Body != "new body" {
+		t.Fatalf("expected updated article but got %+v, %v", a, err)
+	}
+
+	if err := as.Update(&app.Article{Slug: "other", Title: "title"}); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+}
+
+func TestArticleService_Delete(t *testing.T) {
+	as := newTestArticleService(t)
+	article := app.Article{Title: "title 1", UserId: 1}
+	if err := as.Save(&article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+
+	if err := as.Delete(article.Slug); err != nil {
+		t.Fatal("cannot delete article", err)
+	}
+	if _, err := as.GetBySlug(article.Slug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+}
@@ -0,0 +1,224 @@
+package inmem
+
+import (
+	"crypto"
+	"encoding/json"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DB holds the data of the in-memory services. It is safe for concurrent use.
+type DB struct {
+	mu sync.RWMutex
+
+	users            map[uint32]*app.User
+	tokensValidAfter map[uint32]time.Time // by user id, since their last password change
+	articles         map[uint32]*app.Article
+	signingKeys      []*signingKey
+	lastUserId       uint32
+	lastArticleId    uint32
+
+	path          string // snapshot file, empty if the data isn't kept
+	encryptionKey []byte // encrypts the signing keys in snapshots
+}
+
+type signingKey struct {
+	app.SigningKey
+	RetiredAt *time.Time
+}
+
+// snapshot is the JSON representation of a DB.
+type snapshot struct {
+	Users            []*app.User           `json:"users"`
+	TokensValidAfter map[uint32]time.Time  `json:"tokens_valid_after,omitempty"`
+	Articles         []*app.Article        `json:"articles"`
+	SigningKeys      []*signingKeySnapshot `json:"signing_keys"`
+}
+
+type signingKeySnapshot struct {
+	ID                  string     `json:"id"`
+	Algorithm           string     `json:"algorithm"`
+	PrivateKey          []byte     `json:"private_key,omitempty"` // DER, in snapshots written before keys were encrypted
+	EncryptedPrivateKey string     `json:"encrypted_private_key,omitempty"`
+	Active              bool       `json:"active"`
+	CreatedAt           time.Time  `json:"created_at"`
+	ActivatesAt         time.Time  `json:"activates_at"`
+	RotatedAt           *time.Time `json:"rotated_at,omitempty"`
+	RetiredAt           *time.Time `json:"retired_at,omitempty"`
+}
+
+// NewDB returns an empty DB.
+func NewDB() *DB {
+	return &DB{
+		users:            map[uint32]*app.User{},
+		tokensValidAfter: map[uint32]time.Time{},
+		articles:         map[uint32]*app.Article{},
+	}
+}
+
+// Open returns a DB with the data of a snapshot file, which Close writes
+// back. A missing file is created on Close. With an empty path the data
+// is gone on Close. The private signing keys in the file are encrypted with
+// encryptionKey (AES-128, 192 or 256).
+func Open(path string, encryptionKey []byte) (*DB, error) {
+	db := NewDB()
+	db.path = path
+	db.encryptionKey = encryptionKey
+	if path == "" {
+		return db, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s snapshot
+	if err := json.NewDecoder(f).Decode(&s); err != nil {
+		return nil, err
+	}
+	if err := db.restore(&s); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close writes the data to the snapshot file the DB was opened with.
+func (db *DB) Close() error {
+	if db.path == "" {
+		return nil
+	}
+	return db.Snapshot(db.path)
+}
+
+// Snapshot writes the data to a JSON file. The file is replaced at once, so
+// a crash while writing leaves the previous snapshot.
+func (db *DB) Snapshot(path string) error {
+	s, err := db.snapshot()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (db *DB) snapshot() (*snapshot, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	s := &snapshot{
+		Users:       []*app.User{},
+		Articles:    []*app.Article{},
+		SigningKeys: []*signingKeySnapshot{},
+	}
+	// copies, as they are encoded after the lock is released
+	for _, u := range db.users {
+		user := *u
+		s.Users = append(s.Users, &user)
+	}
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].ID < s.Users[j].ID })
+	s.TokensValidAfter = map[uint32]time.Time{}
+	for id, t := range db.tokensValidAfter {
+		s.TokensValidAfter[id] = t
+	}
+	for _, a := range db.articles {
+		article := *a
+		s.Articles = append(s.Articles, &article)
+	}
+	sort.Slice(s.Articles, func(i, j int) bool { return s.Articles[i].ID < s.Articles[j].ID })
+
+	for _, k := range db.signingKeys {
+		encrypted, err := keyring.SealPrivateKey(db.encryptionKey, k.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		s.SigningKeys = append(s.SigningKeys, &signingKeySnapshot{
+			ID:                  k.ID,
+			Algorithm:           k.Algorithm,
+			EncryptedPrivateKey: encrypted,
+			Active:              k.Active,
+			CreatedAt:           k.CreatedAt,
+			ActivatesAt:         k.ActivatesAt,
+			RotatedAt:           k.RotatedAt,
+			RetiredAt:           k.RetiredAt,
+		})
+	}
+
+	return s, nil
+}
+
+func (db *DB) restore(s *snapshot) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, u := range s.Users {
+		db.users[u.ID] = u
+		if u.ID > db.lastUserId {
+			db.lastUserId = u.ID
+		}
+	}
+	for id, t := range s.TokensValidAfter {
+		db.tokensValidAfter[id] = t
+	}
+	for _, a := range s.Articles {
+		db.articles[a.ID] = a
+		if a.ID > db.lastArticleId {
+			db.lastArticleId = a.ID
+		}
+	}
+
+	for _, k := range s.SigningKeys {
+		// keys of older snapshots are encrypted when the next one is written
+		var privateKey crypto.Signer
+		var err error
+		if k.EncryptedPrivateKey != "" {
+			privateKey, err = keyring.OpenPrivateKey(db.encryptionKey, k.Algorithm, k.EncryptedPrivateKey)
+		} else {
+			privateKey, err = keyring.ParsePrivateKey(k.Algorithm, k.PrivateKey)
+		}
+		if err != nil {
+			return err
+		}
+		db.signingKeys = append(db.signingKeys, &signingKey{
+			SigningKey: app.SigningKey{
+				ID:          k.ID,
+				Algorithm:   k.Algorithm,
+				PrivateKey:  privateKey,
+				Active:      k.Active,
+				CreatedAt:   k.CreatedAt,
+				ActivatesAt: k.ActivatesAt,
+				RotatedAt:   k.RotatedAt,
+			},
+			RetiredAt: k.RetiredAt,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package inmem
+
+import (
+	"bytes"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testEncryptionKey encrypts the signing keys of test snapshots.
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestDB_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inmem")
+	if err != nil {
+		t.Fatal("cannot create temp dir", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	// a missing file is an empty DB
+	db, err := Open(path, testEncryptionKey)
+	if err != nil {
+		t.Fatal("cannot open db", err)
+	}
+
+	us := newTestUserService(t, db)
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	article := app.Article{Title: "title 1", UserId: 1}
+	if err := NewArticleService(db).Save(&article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	token, err := us.CreateToken(1)
+	if err != nil {
+		t.Fatal("cannot create token", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal("cannot close db", err)
+	}
+
+	// private keys aren't written in clear
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("cannot read snapshot", err)
+	}
+	if bytes.Contains(b, []byte(`"private_key":`)) || !bytes.Contains(b, []byte(`"encrypted_private_key":`)) {
+		t.Fatalf("expected encrypted signing keys but got %s", b)
+	}
+	if _, err := Open(path, []byte("fedcba9876543210fedcba9876543210")); err == nil {
+		t.Fatal("expected the snapshot to be unreadable with a wrong encryption key")
+	}
+
+	loaded, err := Open(path, testEncryptionKey)
+	if err != nil {
+		t.Fatal("cannot load snapshot", err)
+	}
+
+	if u, err := NewUserService(loaded, nil).GetByUsername("test"); err != nil || u.Email != "test@test.com" {
+		t.Fatalf("expected user but got %+v, %v", u, err)
+	}
+	if a, err := NewArticleService(loaded).GetBySlug(article.Slug); err != nil || a.ID != article.ID {
+		t.Fatalf("expected article but got %+v, %v", a, err)
+	}
+
+	// ids continue after the loaded ones
+	if err := newTestUserService(t, loaded).Save(&app.User{Username: "other", Email: "other@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	if u, _ := NewUserService(loaded, nil).GetByUsername("other"); u.ID != 2 {
+		t.Fatalf("expected id 2 but got %d", u.ID)
+	}
+
+	// tokens signed before keep working
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, err := NewUserService(loaded, keyring.New(NewSigningKeyService(loaded))).ExtractAuthenticationToken(r); err != nil {
+		t.Fatal("cannot extract token signed before the snapshot", err)
+	}
+}
+
+func TestDB_Concurrency(t *testing.T) {
+	db := NewDB()
+	us := newTestUserService(t, db)
+	as := NewArticleService(db)
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			article := app.Article{Title: "title", UserId: 1}
+			if err := as.Save(&article); err != nil {
+				t.Error("cannot save article", err)
+			}
+			if _, err := as.GetAll(); err != nil {
+				t.Error("cannot get articles", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	articles, _ := as.GetAll()
+	if len(articles) != 20 {
+		t.Fatalf("expected 20 articles but got %d", len(articles))
+	}
+}
@@ -0,0 +1,16 @@
+package inmem
+
+import (
+	"github.com/leartgjoni/go-rest-template/servicetest"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T) *servicetest.Services {
+		db := NewDB()
+		return &servicetest.Services{
+			Users:    newTestUserService(t, db),
+			Articles: NewArticleService(db),
+		}
+	})
+}
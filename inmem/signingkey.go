@@ -0,0 +1,82 @@
+package inmem
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"sort"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.SigningKeyService = &SigningKeyService{}
+
+// SigningKeyService represents a service to manage JWT signing keys.
+type SigningKeyService struct {
+	db *DB
+}
+
+// NewSigningKeyService returns a new instance of SigningKeyService.
+func NewSigningKeyService(db *DB) *SigningKeyService {
+	return &SigningKeyService{
+		db: db,
+	}
+}
+
+// Keys returns the keys tokens may still be signed with: the active key and
+// keys rotated out less than a token lifetime ago.
+func (s *SigningKeyService) Keys() ([]*app.SigningKey, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	cutoff := time.Now().Add(-keyring.TokenTTL)
+	keys := []*app.SigningKey{}
+	for _, k := range s.db.signingKeys {
+		if k.RetiredAt != nil || (k.RotatedAt != nil && !k.RotatedAt.After(cutoff)) {
+			continue
+		}
+		key := k.SigningKey
+		keys = append(keys, &key)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Active != keys[j].Active {
+			return keys[i].Active
+		}
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Rotate generates a new active key. It signs once published for
+// keyring.PublishDelay, the previous active key signing until then and
+// verifying until every token it signed has expired; keys rotated out
+// before that are retired.
+func (s *SigningKeyService) Rotate(algorithm string) (*app.SigningKey, error) {
+	k, err := keyring.Generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k.Active = true
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	// without a key to sign with in the meantime, the new one signs right away
+	k.ActivatesAt = now
+	for _, key := range s.db.signingKeys {
+		if key.RetiredAt == nil && !key.Active && key.RotatedAt != nil && key.RotatedAt.Before(now.Add(-keyring.TokenTTL)) {
+			key.RetiredAt = &now
+		}
+		if key.Active {
+			k.ActivatesAt = now.Add(keyring.PublishDelay)
+			rotatedAt := k.ActivatesAt
+			key.Active = false
+			key.RotatedAt = &rotatedAt
+		}
+	}
+	s.db.signingKeys = append(s.db.signingKeys, &signingKey{SigningKey: *k})
+
+	key := *k
+	return &key, nil
+}
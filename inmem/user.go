@@ -0,0 +1,312 @@
+package inmem
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mail"
+	"github.com/leartgjoni/go-rest-template/password"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.UserService = &UserService{}
+
+// UserService represents a service to manage users. Sessions aren't
+// tracked in memory, so tokens stay valid until they expire or the password
+// is changed.
+type UserService struct {
+	db     *DB
+	tokens *keyring.Ring
+
+	Passwords       app.PasswordHasher
+	Policy          app.PasswordPolicy // optional, checked for new passwords
+	Mailer          app.Mailer         // sends email change confirmations
+	ConfirmEmailURL string             // optional, the confirmation token is appended as ?token=
+
+	dummy password.Dummy
+}
+
+// NewUserService returns a new instance of UserService hashing passwords
+// with Argon2id and the default parameters.
+func NewUserService(db *DB, tokens *keyring.Ring) *UserService {
+	return &UserService{
+		db:        db,
+		tokens:    tokens,
+		Passwords: password.NewHasher(password.DefaultParams),
+	}
+}
+
+// CreateToken starts a new session of the user.
+func (s *UserService) CreateToken(userId uint32) (string, error) {
+	return s.tokens.SignSession(userId)
+}
+
+// ExtractAuthenticationToken returns the session of a valid token, unless
+// the user revoked the tokens issued before it by changing their password.
+func (s *UserService) ExtractAuthenticationToken(r *http.Request) (*app.Session, error) {
+	session, err := s.tokens.ParseSession(keyring.BearerToken(r))
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.mu.RLock()
+	_, ok := s.db.users[session.UserId]
+	validAfter := s.db.tokensValidAfter[session.UserId]
+	s.db.mu.RUnlock()
+	if !ok || validAfter.After(session.CreatedAt) {
+		return nil, app.ErrWrongCredentials
+	}
+
+	return session, nil
+}
+
+func (s *UserService) Save(user *app.User) error {
+	if s.Policy != nil {
+		if err := s.Policy.Validate(user.Password); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := s.Passwords.Hash(user.Password)
+	if err != nil {
+		return app.ErrWrongPasswordFormat
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.userByEmail(user.Email) != nil {
+		return app.ErrEmailAlreadyUsed
+	}
+	if s.db.userByUsername(user.Username) != nil {
+		return app.ErrUsernameAlreadyUsed
+	}
+
+	s.db.lastUserId++
+	user.ID = s.db.lastUserId
+	user.Password = hashedPassword
+
+	u := *user
+	u.IsAdmin = false
+	s.db.users[u.ID] = &u
+	return nil
+}
+
+func (s *UserService) GetById(userId uint32) (*app.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	u, ok := s.db.users[userId]
+	if !ok {
+		return &app.User{}, app.ErrUserNotFound
+	}
+
+	user := *u
+	return &user, nil
+}
+
+func (s *UserService) GetByUsername(username string) (*app.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	u := s.db.userByUsername(username)
+	if u == nil {
+		return &app.User{}, app.ErrUserNotFound
+	}
+
+	user := *u
+	return &user, nil
+}
+
+func (s *UserService) Update(user *app.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if u := s.db.userByUsername(user.Username); u != nil && u.ID != user.ID {
+		return app.ErrUsernameAlreadyUsed
+	}
+
+	u, ok := s.db.users[user.ID]
+	if !ok {
+		return app.ErrUserNotFound
+	}
+
+	u.Username = user.Username
+	u.Bio = user.Bio
+	u.UpdatedAt = user.UpdatedAt
+	return nil
+}
+
+func (s *UserService) ChangePassword(userId uint32, currentPassword string, newPassword string) (string, error) {
+	user, err := s.GetById(userId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := password.Verify(user.Password, currentPassword); err != nil {
+		return "", app.ErrWrongCredentials
+	}
+
+	if s.Policy != nil {
+		if err := s.Policy.Validate(newPassword); err != nil {
+			return "", err
+		}
+	}
+
+	newHash, err := s.Passwords.Hash(newPassword)
+	if err != nil {
+		return "", app.ErrWrongPasswordFormat
+	}
+
+	// tokens carry their issue time in seconds, so the new one mustn't be
+	// older than the cutoff
+	now := time.Now().Truncate(time.Second)
+	s.db.mu.Lock()
+	if u, ok := s.db.users[userId]; ok {
+		u.Password = newHash
+		u.UpdatedAt = now
+		s.db.tokensValidAfter[userId] = now
+	}
+	s.db.mu.Unlock()
+
+	return s.CreateToken(userId)
+}
+
+func (s *UserService) RequestEmailChange(userId uint32, email string, plain string) error {
+	if s.Mailer == nil {
+		return errors.New("email changes need a mailer")
+	}
+
+	user, err := s.GetById(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := password.Verify(user.Password, plain); err != nil {
+		return app.ErrWrongCredentials
+	}
+
+	s.db.mu.RLock()
+	taken := s.db.userByEmail(email) != nil
+	s.db.mu.RUnlock()
+	if taken {
+		return app.ErrEmailAlreadyUsed
+	}
+
+	token, err := s.tokens.SignEmailChange(userId, email, user.Email)
+	if err != nil {
+		return err
+	}
+	return mail.SendEmailChange(s.Mailer, email, user.Username, token, s.ConfirmEmailURL)
+}
+
+// ConfirmEmailChange applies a change requested with RequestEmailChange. A
+// token only works once, as long as the email hasn't changed meanwhile.
+func (s *UserService) ConfirmEmailChange(userId uint32, tokenString string) error {
+	email, from, err := s.tokens.ParseEmailChange(tokenString, userId)
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	if s.db.userByEmail(email) != nil {
+		s.db.mu.Unlock()
+		return app.ErrEmailAlreadyUsed
+	}
+	u, ok := s.db.users[userId]
+	if !ok || u.Email != from {
+		s.db.mu.Unlock()
+		return app.ErrInvalidEmailChange
+	}
+	u.Email = email
+	u.UpdatedAt = time.Now()
+	username := u.Username
+	s.db.mu.Unlock()
+
+	// let the previous address know, in case the account was taken over
+	if s.Mailer != nil {
+		if err := mail.SendEmailChanged(s.Mailer, from, username, email); err != nil {
+			log.Printf("cannot send email change notification to user %d: %s", userId, err)
+		}
+	}
+	return nil
+}
+
+func (s *UserService) Login(u *app.User) (string, error) {
+	// long passwords would take long to hash, whether the email is known or not
+	if s.Policy != nil && s.Policy.TooLong(u.Password) {
+		return "", app.ErrWrongCredentials
+	}
+
+	s.db.mu.RLock()
+	found := s.db.userByEmail(u.Email)
+	var user app.User
+	if found != nil {
+		user = *found
+	}
+	s.db.mu.RUnlock()
+
+	if found == nil {
+		// hash anyway, so unknown emails take as long as wrong passwords
+		_ = s.Passwords.Verify(s.dummy.Hash(s.Passwords), u.Password)
+		return "", app.ErrWrongCredentials
+	}
+	if err := s.Passwords.Verify(user.Password, u.Password); err != nil {
+		return "", app.ErrWrongCredentials
+	}
+
+	if s.Passwords.NeedsRehash(user.Password) {
+		user.Password = s.rehash(user.ID, user.Password, u.Password)
+	}
+
+	u.ID = user.ID
+	u.Username = user.Username
+	u.Password = user.Password
+	u.CreatedAt = user.CreatedAt
+	u.UpdatedAt = user.UpdatedAt
+	u.IsAdmin = user.IsAdmin
+
+	return s.CreateToken(u.ID)
+}
+
+// rehash upgrades the hash of a password that was just verified, returning
+// the new hash. Failing to do so doesn't fail the login.
+func (s *UserService) rehash(userId uint32, oldHash string, plain string) string {
+	return password.Rehash(s.Passwords, userId, oldHash, plain, func(newHash string) (bool, error) {
+		s.db.mu.Lock()
+		defer s.db.mu.Unlock()
+
+		// unless the password was changed meanwhile
+		u, ok := s.db.users[userId]
+		if !ok || u.Password != oldHash {
+			return false, nil
+		}
+		u.Password = newHash
+		return true, nil
+	})
+}
+
+// userByEmail returns the stored user, callers must hold the lock. Emails
+// differing only in case are the same.
+func (db *DB) userByEmail(email string) *app.User {
+	for _, u := range db.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+// userByUsername returns the stored user, callers must hold the lock.
+func (db *DB) userByUsername(username string) *app.User {
+	for _, u := range db.users {
+		if u.Username == username {
+			return u
+		}
+	}
+	return nil
+}
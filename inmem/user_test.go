@@ -0,0 +1,293 @@
+package inmem
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/password"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUserService returns a service with cheap password hashes and its
+// own signing key.
+func newTestUserService(t *testing.T, db *DB) *UserService {
+	ks := NewSigningKeyService(db)
+	if _, err := ks.Rotate(app.AlgorithmEdDSA); err != nil {
+		t.Fatal("cannot create signing key", err)
+	}
+
+	us := NewUserService(db, keyring.New(ks))
+	us.Passwords = password.NewHasher(password.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	return us
+}
+
+func TestUserService_Save(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+
+	user := &app.User{Username: "test", Email: "test@test.com", Password: "password"}
+	if err := us.Save(user); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	if user.ID != 1 || user.Password == "password" {
+		t.Fatalf("expected id and hashed password to be set but got %+v", user)
+	}
+
+	tests := []struct {
+		name     string
+		user     *app.User
+		expected error
+	}{
+		{
+			name:     "Email already used",
+			user:     &app.User{Username: "other", Email: "Test@Test.com", Password: "password"},
+			expected: app.ErrEmailAlreadyUsed,
+		},
+		{
+			name:     "Username already used",
+			user:     &app.User{Username: "test", Email: "other@test.com", Password: "password"},
+			expected: app.ErrUsernameAlreadyUsed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := us.Save(test.user); err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestUserService_Save_Policy(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	us.Policy = password.NewPolicy(8, 1024)
+
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "short"}); err != app.ErrPasswordTooShort {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrPasswordTooShort, err)
+	}
+}
+
+func TestUserService_Get(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	user := &app.User{Username: "test", Email: "test@test.com", Password: "password"}
+	if err := us.Save(user); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+
+	if u, err := us.GetById(user.ID); err != nil || u.Username != "test" {
+		t.Fatalf("expected user but got %+v, %v", u, err)
+	}
+	if u, err := us.GetByUsername("test"); err != nil || u.ID != user.ID {
+		t.Fatalf("expected user but got %+v, %v", u, err)
+	}
+
+	// changing the result doesn't change the stored user
+	u, _ := us.GetById(user.ID)
+	u.Username = "changed"
+	if _, err := us.GetByUsername("test"); err != nil {
+		t.Fatal("expected stored user to be unchanged", err)
+	}
+
+	if _, err := us.GetById(2); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+	if _, err := us.GetByUsername("other"); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+}
+
+func TestUserService_Update(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	for _, u := range []*app.User{
+		{Username: "test", Email: "test@test.com", Password: "password"},
+		{Username: "other", Email: "other@test.com", Password: "password"},
+	} {
+		if err := us.Save(u); err != nil {
+			t.Fatal("cannot save user", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		user     *app.User
+		expected error
+	}{
+		{
+			name:     "Username already used",
+			user:     &app.User{ID: 1, Username: "other"},
+			expected: app.ErrUsernameAlreadyUsed,
+		},
+		{
+			name:     "Not found",
+			user:     &app.User{ID: 3, Username: "new"},
+			expected: app.ErrUserNotFound,
+		},
+		{
+			name:     "Success",
+			user:     &app.User{ID: 1, Username: "new", Bio: "Hello", UpdatedAt: time.Now()},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := us.Update(test.user); err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+		})
+	}
+
+	if u, err := us.GetById(1); err != nil || u.Username != "new" || u.Bio != "Hello" {
+		t.Fatalf("expected updated user but got %+v, %v", u, err)
+	}
+}
+
+func TestUserService_Login(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     *app.User
+		expected error
+	}{
+		{
+			name:     "correct login",
+			user:     &app.User{Email: "TEST@test.com", Password: "password"},
+			expected: nil,
+		},
+		{
+			name:     "wrong email",
+			user:     &app.User{Email: "other@test.com", Password: "password"},
+			expected: app.ErrWrongCredentials,
+		},
+		{
+			name:     "wrong password",
+			user:     &app.User{Email: "test@test.com", Password: "wrong"},
+			expected: app.ErrWrongCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := us.Login(test.user)
+			if err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+			if err != nil {
+				return
+			}
+
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			session, err := us.ExtractAuthenticationToken(r)
+			if err != nil {
+				t.Fatal("cannot extract token", err)
+			}
+			if session.UserId != 1 || session.ID == "" {
+				t.Fatalf("wrong session %+v", session)
+			}
+		})
+	}
+}
+
+func TestUserService_Login_Rehash(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	old, _ := us.GetById(1)
+
+	us.Passwords = password.NewHasher(password.Params{Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot login", err)
+	}
+
+	if u, _ := us.GetById(1); u.Password == old.Password {
+		t.Fatal("expected password to be rehashed")
+	}
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	us := newTestUserService(t, NewDB())
+	if err := us.Save(&app.User{Username: "test", Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+
+	if _, err := us.ChangePassword(1, "wrong", "new-password"); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+	if _, err := us.ChangePassword(2, "password", "new-password"); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+
+	token, err := us.ChangePassword(1, "password", "new-password")
+	if err != nil || token == "" {
+		t.Fatalf("expected a token but got %q, %v", token, err)
+	}
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "new-password"}); err != nil {
+		t.Fatal("cannot login with the new password", err)
+	}
+}
+
+func TestUserService_EmailChange(t *testing.T) {
+	var sent []string
+	us := newTestUserService(t, NewDB())
+	us.Mailer = &mock.Mailer{SendFn: func(to, subject, body string) error {
+		sent = append(sent, to)
+		return nil
+	}}
+	for _, u := range []*app.User{
+		{Username: "test", Email: "test@test.com", Password: "password"},
+		{Username: "other", Email: "other@test.com", Password: "password"},
+	} {
+		if err := us.Save(u); err != nil {
+			t.Fatal("cannot save user", err)
+		}
+	}
+
+	if err := us.RequestEmailChange(1, "OTHER@test.com", "password"); err != app.ErrEmailAlreadyUsed {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrEmailAlreadyUsed, err)
+	}
+	if err := us.RequestEmailChange(1, "new@test.com", "wrong"); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+
+	var token string
+	us.Mailer = &mock.Mailer{SendFn: func(to, subject, body string) error {
+		sent = append(sent, to)
+		if fields := strings.Fields(body); len(fields) > 0 {
+			token = fields[len(fields)-1]
+		}
+		return nil
+	}}
+	if err := us.RequestEmailChange(1, "new@test.com", "password"); err != nil {
+		t.Fatal("cannot request email change", err)
+	}
+	if len(sent) != 1 || sent[0] != "new@test.com" {
+		t.Fatalf("expected a confirmation to the new address but got %v", sent)
+	}
+
+	if err := us.ConfirmEmailChange(2, token); err != app.ErrInvalidEmailChange {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrInvalidEmailChange, err)
+	}
+	if err := us.ConfirmEmailChange(1, token); err != nil {
+		t.Fatal("cannot confirm email change", err)
+	}
+	if len(sent) != 2 || sent[1] != "test@test.com" {
+		t.Fatalf("expected a notification to the previous address but got %v", sent)
+	}
+	if u, _ := us.GetById(1); u.Email != "new@test.com" {
+		t.Fatalf("expected email to change but got %s", u.Email)
+	}
+
+	// the token only works once
+	if err := us.ConfirmEmailChange(1, token); err != app.ErrInvalidEmailChange {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrInvalidEmailChange, err)
+	}
+}
@@ -0,0 +1,218 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"math/big"
+	"time"
+)
+
+// RSAKeySize is the modulus size of generated RS256 keys.
+const RSAKeySize = 2048
+
+// Generate returns a new inactive key for algorithm, identified by its thumbprint.
+func Generate(algorithm string) (*app.SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case app.AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, RSAKeySize)
+	case app.AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, app.ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := publicJWK(algorithm, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &app.SigningKey{
+		ID:          thumbprint(jwk),
+		Algorithm:   algorithm,
+		PrivateKey:  signer,
+		CreatedAt:   now,
+		ActivatesAt: now,
+	}, nil
+}
+
+// MarshalPrivateKey encodes a private key as PKCS #8 DER.
+func MarshalPrivateKey(k crypto.Signer) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(k)
+}
+
+// ParsePrivateKey decodes a PKCS #8 DER private key, checking it fits algorithm.
+func ParsePrivateKey(algorithm string, der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == app.AlgorithmRS256 {
+			return k, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == app.AlgorithmEdDSA {
+			return k, nil
+		}
+	}
+
+	return nil, errors.New("private key doesn't match algorithm " + algorithm)
+}
+
+// SealPrivateKey encrypts a private key for storage with AES-GCM under
+// encryptionKey (AES-128, 192 or 256). The nonce and ciphertext of its DER
+// are base64 encoded.
+func SealPrivateKey(encryptionKey []byte, k crypto.Signer) (string, error) {
+	der, err := MarshalPrivateKey(k)
+	if err != nil {
+		return "", err
+	}
+	return SealDER(encryptionKey, der)
+}
+
+// SealDER encrypts a private key already encoded by MarshalPrivateKey, like
+// SealPrivateKey.
+func SealDER(encryptionKey []byte, der []byte) (string, error) {
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, der, nil)), nil
+}
+
+// OpenPrivateKey decrypts a private key sealed by SealPrivateKey, checking
+// it fits algorithm.
+func OpenPrivateKey(encryptionKey []byte, algorithm string, sealed string) (crypto.Signer, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("malformed ciphertext")
+	}
+
+	der, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(algorithm, der)
+}
+
+func newGCM(encryptionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// JWK is the public part of a signing key, as defined by RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKSet returns the public parts of keys.
+func PublicJWKSet(keys []*app.SigningKey) (*JWKSet, error) {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, k := range keys {
+		jwk, err := publicJWK(k.Algorithm, k.PrivateKey.Public())
+		if err != nil {
+			return nil, err
+		}
+		jwk.Kid = k.ID
+		jwk.Use = "sig"
+		jwk.Alg = k.Algorithm
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+func publicJWK(algorithm string, pub crypto.PublicKey) (JWK, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if algorithm == app.AlgorithmRS256 {
+			return JWK{
+				Kty: "RSA",
+				N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			}, nil
+		}
+	case ed25519.PublicKey:
+		if algorithm == app.AlgorithmEdDSA {
+			return JWK{
+				Kty: "OKP",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(k),
+			}, nil
+		}
+	}
+	return JWK{}, app.ErrUnsupportedAlgorithm
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a public JWK. Only the
+// required members take part, in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	// marshalling plain strings can't fail
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
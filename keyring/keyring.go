@@ -0,0 +1,186 @@
+// Package keyring signs JWTs with the active signing key and verifies them
+// with any key that hasn't been retired, so keys can be rotated without
+// invalidating tokens already issued.
+package keyring
+
+import (
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	app "github.com/leartgjoni/go-rest-template"
+	"sync"
+	"time"
+)
+
+const (
+	// RefreshInterval is how long keys are cached before being reloaded, so
+	// rotations made by other processes are picked up.
+	RefreshInterval = 5 * time.Minute
+
+	// minReloadInterval limits reloads triggered by tokens with an unknown kid.
+	minReloadInterval = 30 * time.Second
+
+	// PublishDelay is how long a rotated key is published before it signs:
+	// the time verifiers may cache the key set.
+	PublishDelay = 5 * time.Minute
+)
+
+// Ring holds the signing keys loaded from a SigningKeyService.
+type Ring struct {
+	source app.SigningKeyService
+	now    func() time.Time
+
+	mu       sync.RWMutex
+	keys     map[string]*app.SigningKey
+	signers  []*app.SigningKey // in the source's order, active key first
+	jwks     *JWKSet
+	loadedAt time.Time
+}
+
+// New returns a ring backed by source. Keys are loaded lazily.
+func New(source app.SigningKeyService) *Ring {
+	return &Ring{
+		source: source,
+		now:    time.Now,
+	}
+}
+
+// Load replaces the cached keys with the ones from the source.
+func (r *Ring) Load() error {
+	keys, err := r.source.Keys()
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[string]*app.SigningKey, len(keys))
+	for _, k := range keys {
+		byId[k.ID] = k
+	}
+	jwks, err := PublicJWKSet(keys)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.keys = byId
+	r.signers = keys
+	r.jwks = jwks
+	r.loadedAt = r.now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Sign returns a token for claims signed with the active key.
+func (r *Ring) Sign(claims jwt.MapClaims) (string, error) {
+	if err := r.refresh(RefreshInterval); err != nil {
+		return "", err
+	}
+
+	active := r.signer()
+	if active == nil {
+		return "", app.ErrNoActiveSigningKey
+	}
+
+	method := jwt.GetSigningMethod(active.Algorithm)
+	if method == nil {
+		return "", app.ErrUnsupportedAlgorithm
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = active.ID
+
+	return token.SignedString(active.PrivateKey)
+}
+
+// PublicJWKSet returns the public keys verifying the tokens, as loaded.
+func (r *Ring) PublicJWKSet() (*JWKSet, error) {
+	if err := r.refresh(RefreshInterval); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jwks, nil
+}
+
+// Parse verifies a token with the key named by its kid header.
+func (r *Ring) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, r.keyFunc)
+}
+
+func (r *Ring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	if err := r.refresh(RefreshInterval); err != nil {
+		return nil, err
+	}
+
+	k := r.key(kid)
+	if k == nil {
+		// the key may have been created after our last load
+		if err := r.refresh(minReloadInterval); err != nil {
+			return nil, err
+		}
+		if k = r.key(kid); k == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	// never let the token pick the algorithm a key is used with
+	if token.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return k.PrivateKey.Public(), nil
+}
+
+// signer returns the key that activated last, so a rotated key only signs
+// once verifiers had time to see it published.
+func (r *Ring) signer() *app.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+	var signer *app.SigningKey
+	for _, k := range r.signers {
+		if k.ActivatesAt.After(now) {
+			continue
+		}
+		if signer == nil || k.ActivatesAt.After(signer.ActivatesAt) {
+			signer = k
+		}
+	}
+	return signer
+}
+
+func (r *Ring) key(kid string) *app.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[kid]
+}
+
+// refresh reloads the keys if they were loaded more than maxAge ago. A
+// failed reload keeps serving the keys already loaded until the next attempt.
+func (r *Ring) refresh(maxAge time.Duration) error {
+	r.mu.RLock()
+	loaded := r.keys != nil
+	stale := r.now().Sub(r.loadedAt) > maxAge
+	r.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+
+	if err := r.Load(); err != nil {
+		if !loaded {
+			return err
+		}
+		r.mu.Lock()
+		r.loadedAt = r.now()
+		r.mu.Unlock()
+	}
+	return nil
+}
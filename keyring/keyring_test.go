@@ -0,0 +1,255 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"testing"
+	"time"
+)
+
+func generate(t *testing.T, algorithm string, active bool) *app.SigningKey {
+	k, err := Generate(algorithm)
+	if err != nil {
+		t.Fatal("cannot generate key", err)
+	}
+	k.Active = active
+	return k
+}
+
+func TestRing_SignAndParse(t *testing.T) {
+	for _, algorithm := range []string{app.AlgorithmRS256, app.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			k := generate(t, algorithm, true)
+			ring := New(&mock.SigningKeyService{
+				KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{k}, nil },
+			})
+
+			tokenString, err := ring.Sign(jwt.MapClaims{"userId": 1})
+			if err != nil {
+				t.Fatal("cannot sign", err)
+			}
+
+			token, err := ring.Parse(tokenString)
+			if err != nil || !token.Valid {
+				t.Fatal("cannot parse", err)
+			}
+
+			if token.Header["kid"] != k.ID || token.Header["alg"] != algorithm {
+				t.Fatalf("wrong header %v", token.Header)
+			}
+		})
+	}
+}
+
+func TestRing_Rotation(t *testing.T) {
+	old := generate(t, app.AlgorithmRS256, true)
+	keys := []*app.SigningKey{old}
+	ks := &mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return keys, nil },
+	}
+
+	ring := New(ks)
+	oldToken, err := ring.Sign(jwt.MapClaims{"userId": 1})
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+
+	// another process rotates
+	current := generate(t, app.AlgorithmEdDSA, true)
+	old.Active = false
+	keys = []*app.SigningKey{current, old}
+
+	other := New(ks)
+	newToken, err := other.Sign(jwt.MapClaims{"userId": 1})
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+
+	// the first ring learns about the new kid on demand, but doesn't let
+	// unknown kids hit the source on every request
+	if _, err := ring.Parse(newToken); err == nil {
+		t.Fatal("expected reload to be rate limited")
+	}
+	ring.now = func() time.Time { return time.Now().Add(minReloadInterval + time.Second) }
+	if _, err := ring.Parse(newToken); err != nil {
+		t.Fatal("expected new key to verify", err)
+	}
+	if _, err := other.Parse(oldToken); err != nil {
+		t.Fatal("expected rotated key to verify", err)
+	}
+
+	// once retired, the old key stops verifying
+	keys = []*app.SigningKey{current}
+	if err := other.Load(); err != nil {
+		t.Fatal("cannot load", err)
+	}
+	if _, err := other.Parse(oldToken); err == nil {
+		t.Fatal("expected retired key to be rejected")
+	}
+}
+
+func TestRing_PublishDelay(t *testing.T) {
+	old := generate(t, app.AlgorithmRS256, false)
+	pending := generate(t, app.AlgorithmEdDSA, true)
+	pending.ActivatesAt = time.Now().Add(PublishDelay)
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{pending, old}, nil },
+	})
+
+	// the new key is published, but the old one signs until it activates
+	tokenString, err := ring.Sign(jwt.MapClaims{"userId": 1})
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+	token, err := ring.Parse(tokenString)
+	if err != nil {
+		t.Fatal("cannot parse", err)
+	}
+	if token.Header["kid"] != old.ID {
+		t.Fatalf("wrong kid. expected %s but got %v", old.ID, token.Header["kid"])
+	}
+
+	ring.now = func() time.Time { return time.Now().Add(PublishDelay) }
+	if tokenString, err = ring.Sign(jwt.MapClaims{"userId": 1}); err != nil {
+		t.Fatal("cannot sign", err)
+	}
+	token, err = ring.Parse(tokenString)
+	if err != nil {
+		t.Fatal("cannot parse", err)
+	}
+	if token.Header["kid"] != pending.ID {
+		t.Fatalf("wrong kid. expected %s but got %v", pending.ID, token.Header["kid"])
+	}
+}
+
+func TestRing_Parse(t *testing.T) {
+	k := generate(t, app.AlgorithmRS256, true)
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{k}, nil },
+	})
+
+	hmacWithKid := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userId": 1})
+	hmacWithKid.Header["kid"] = k.ID
+
+	tests := []struct {
+		name   string
+		token  *jwt.Token
+		secret interface{}
+		valid  bool
+	}{
+		{
+			name:   "hs256 without kid",
+			token:  jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userId": 1}),
+			secret: []byte("random"),
+			valid:  false,
+		},
+		{
+			name:   "algorithm confusion",
+			token:  hmacWithKid,
+			secret: []byte(k.ID),
+			valid:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenString, err := test.token.SignedString(test.secret)
+			if err != nil {
+				t.Fatal("cannot sign", err)
+			}
+
+			_, err = ring.Parse(tokenString)
+			if (err == nil) != test.valid {
+				t.Fatalf("expected valid to be %v but got %v", test.valid, err)
+			}
+		})
+	}
+}
+
+func TestRing_Sign_NoActiveKey(t *testing.T) {
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{}, nil },
+	})
+
+	if _, err := ring.Sign(jwt.MapClaims{}); err != app.ErrNoActiveSigningKey {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrNoActiveSigningKey, err)
+	}
+}
+
+func TestRing_LoadError(t *testing.T) {
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return nil, errors.New("db down") },
+	})
+
+	if _, err := ring.Sign(jwt.MapClaims{}); err == nil || err.Error() != "db down" {
+		t.Fatalf("wrong error. expected db down but got %v", err)
+	}
+}
+
+func TestPublicJWKSet(t *testing.T) {
+	// RFC 8037, appendix A.3
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	seed, _ := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	priv := ed25519.NewKeyFromSeed(seed)
+	if !priv.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Fatal("wrong test vector")
+	}
+
+	set, err := PublicJWKSet([]*app.SigningKey{
+		{ID: "kid-1", Algorithm: app.AlgorithmEdDSA, PrivateKey: priv},
+	})
+	if err != nil {
+		t.Fatal("cannot build jwks", err)
+	}
+
+	expected := JWK{Kty: "OKP", Kid: "kid-1", Use: "sig", Alg: app.AlgorithmEdDSA, Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	if len(set.Keys) != 1 || set.Keys[0] != expected {
+		t.Fatalf("expected %v but got %v", expected, set.Keys)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	k := generate(t, app.AlgorithmEdDSA, false)
+
+	der, err := MarshalPrivateKey(k.PrivateKey)
+	if err != nil {
+		t.Fatal("cannot marshal", err)
+	}
+
+	if _, err := ParsePrivateKey(app.AlgorithmRS256, der); err == nil {
+		t.Fatal("expected algorithm mismatch to be rejected")
+	}
+
+	parsed, err := ParsePrivateKey(app.AlgorithmEdDSA, der)
+	if err != nil || !parsed.(ed25519.PrivateKey).Equal(k.PrivateKey) {
+		t.Fatal("private key didn't round trip", err)
+	}
+
+	if _, err := Generate("HS256"); err != app.ErrUnsupportedAlgorithm {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUnsupportedAlgorithm, err)
+	}
+
+}
+
+func TestSealPrivateKey(t *testing.T) {
+	k := generate(t, app.AlgorithmEdDSA, false)
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	sealed, err := SealPrivateKey(key, k.PrivateKey)
+	if err != nil {
+		t.Fatal("cannot seal", err)
+	}
+
+	opened, err := OpenPrivateKey(key, app.AlgorithmEdDSA, sealed)
+	if err != nil || !opened.(ed25519.PrivateKey).Equal(k.PrivateKey) {
+		t.Fatal("private key didn't round trip", err)
+	}
+
+	if _, err := OpenPrivateKey([]byte("fedcba9876543210fedcba9876543210"), app.AlgorithmEdDSA, sealed); err == nil {
+		t.Fatal("expected a wrong encryption key to be rejected")
+	}
+}
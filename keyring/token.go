@@ -0,0 +1,157 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenTTL is how long authentication tokens are valid.
+const TokenTTL = 24 * time.Hour
+
+const (
+	emailChangePurpose = "email_change"
+	emailChangeTTL     = 24 * time.Hour
+)
+
+// SignSession returns an authentication token starting a new session of the
+// user.
+func (r *Ring) SignSession(userId uint32) (string, error) {
+	sessionId, err := NewId()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return r.Sign(jwt.MapClaims{
+		"userId": userId,
+		"sid":    sessionId,
+		"iat":    now.Unix(),
+		"exp":    now.Add(TokenTTL).Unix(),
+	})
+}
+
+// ParseSession returns the session of a valid authentication token. Whether
+// the session has been revoked is up to the caller.
+func (r *Ring) ParseSession(tokenString string) (*app.Session, error) {
+	claims, err := r.parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// purpose-bound tokens, like two-factor challenges, don't authenticate
+	if _, ok := claims["purpose"]; ok {
+		return nil, app.ErrWrongCredentials
+	}
+	// neither do tokens issued before sessions existed
+	sessionId, _ := claims["sid"].(string)
+	if sessionId == "" {
+		return nil, app.ErrWrongCredentials
+	}
+	userId, err := userIdClaim(claims)
+	if err != nil {
+		return nil, err
+	}
+	iat, _ := claims["iat"].(float64)
+
+	return &app.Session{
+		ID:        sessionId,
+		UserId:    userId,
+		CreatedAt: time.Unix(int64(iat), 0),
+	}, nil
+}
+
+// SignPurpose returns a token of the user that is only good for purpose,
+// e.g. completing a two-step login, with extra claims. It expires after ttl.
+func (r *Ring) SignPurpose(purpose string, userId uint32, ttl time.Duration, claims jwt.MapClaims) (string, error) {
+	signed := jwt.MapClaims{}
+	for k, v := range claims {
+		signed[k] = v
+	}
+	signed["userId"] = userId
+	signed["purpose"] = purpose
+	signed["exp"] = time.Now().Add(ttl).Unix()
+
+	return r.Sign(signed)
+}
+
+// ParsePurpose returns the user and the claims of a valid token signed with
+// SignPurpose for purpose. It fails with app.ErrWrongCredentials otherwise.
+func (r *Ring) ParsePurpose(tokenString string, purpose string) (uint32, jwt.MapClaims, error) {
+	claims, err := r.parseClaims(tokenString)
+	if err != nil || claims["purpose"] != purpose {
+		return 0, nil, app.ErrWrongCredentials
+	}
+
+	userId, err := userIdClaim(claims)
+	if err != nil {
+		return 0, nil, app.ErrWrongCredentials
+	}
+	return userId, claims, nil
+}
+
+// SignEmailChange returns the token confirming that the user changes their
+// email from one address to another.
+func (r *Ring) SignEmailChange(userId uint32, email string, from string) (string, error) {
+	return r.SignPurpose(emailChangePurpose, userId, emailChangeTTL, jwt.MapClaims{
+		"email": email,
+		"from":  from,
+	})
+}
+
+// ParseEmailChange returns the addresses of a token signed with
+// SignEmailChange for the user, or app.ErrInvalidEmailChange.
+func (r *Ring) ParseEmailChange(tokenString string, userId uint32) (email string, from string, err error) {
+	uid, claims, err := r.ParsePurpose(tokenString, emailChangePurpose)
+	if err != nil || uid != userId {
+		return "", "", app.ErrInvalidEmailChange
+	}
+
+	email, _ = claims["email"].(string)
+	from, _ = claims["from"].(string)
+	return email, from, nil
+}
+
+// BearerToken returns the token of the request's Authorization header.
+func BearerToken(r *http.Request) string {
+	bearerToken := r.Header.Get("Authorization")
+	if len(strings.Split(bearerToken, " ")) == 2 {
+		return strings.Split(bearerToken, " ")[1]
+	}
+	return ""
+}
+
+// NewId returns a random id of 32 hex characters, e.g. for sessions.
+func NewId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (r *Ring) parseClaims(tokenString string) (jwt.MapClaims, error) {
+	token, err := r.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, app.ErrWrongCredentials
+	}
+	return claims, nil
+}
+
+func userIdClaim(claims jwt.MapClaims) (uint32, error) {
+	uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["userId"]), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(uid), nil
+}
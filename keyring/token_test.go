@@ -0,0 +1,62 @@
+package keyring
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"net/http"
+	"testing"
+)
+
+func TestRing_Session(t *testing.T) {
+	k := generate(t, app.AlgorithmEdDSA, true)
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{k}, nil },
+	})
+
+	token, err := ring.SignSession(1)
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	session, err := ring.ParseSession(BearerToken(r))
+	if err != nil {
+		t.Fatal("cannot parse", err)
+	}
+	if session.UserId != 1 || len(session.ID) != 32 || session.CreatedAt.IsZero() {
+		t.Fatalf("wrong session %+v", session)
+	}
+
+	// sessions aren't good for anything else
+	if _, _, err := ring.ParsePurpose(token, emailChangePurpose); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrWrongCredentials, err)
+	}
+}
+
+func TestRing_EmailChange(t *testing.T) {
+	k := generate(t, app.AlgorithmEdDSA, true)
+	ring := New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{k}, nil },
+	})
+
+	token, err := ring.SignEmailChange(1, "new@test.com", "old@test.com")
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+
+	email, from, err := ring.ParseEmailChange(token, 1)
+	if err != nil || email != "new@test.com" || from != "old@test.com" {
+		t.Fatalf("wrong addresses %q, %q (%v)", email, from, err)
+	}
+
+	// of another user
+	if _, _, err := ring.ParseEmailChange(token, 2); err != app.ErrInvalidEmailChange {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrInvalidEmailChange, err)
+	}
+
+	// purpose-bound tokens don't authenticate
+	if _, err := ring.ParseSession(token); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrWrongCredentials, err)
+	}
+}
@@ -0,0 +1,16 @@
+package app
+
+import "time"
+
+// LoginThrottle slows down and locks out repeated failed logins, per account
+// and per client IP. Unknown emails are throttled like known ones so
+// responses don't reveal which accounts exist.
+type LoginThrottle interface {
+	// Check returns ErrTooManyLoginAttempts, with how long to wait, if a
+	// login for email from ip isn't allowed yet.
+	Check(email string, ip string) (time.Duration, error)
+	Failed(email string, ip string) error
+	Succeeded(email string, ip string) error
+	// Unlock lifts a user's lockout and forgets their failed attempts.
+	Unlock(userId uint32) error
+}
@@ -0,0 +1,24 @@
+package mail
+
+import (
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/url"
+)
+
+// SendEmailChange asks to confirm a new email address with token. With a
+// confirmURL, the token is appended to it as ?token= instead.
+func SendEmailChange(m app.Mailer, to string, username string, token string, confirmURL string) error {
+	body := fmt.Sprintf("Hi %s,\n\nTo use this address for your account, confirm it with the following token within 24 hours:\n\n%s\n", username, token)
+	if confirmURL != "" {
+		body = fmt.Sprintf("Hi %s,\n\nTo use this address for your account, open the following link within 24 hours:\n\n%s?token=%s\n", username, confirmURL, url.QueryEscape(token))
+	}
+	return m.Send(to, "Confirm your new email address", body)
+}
+
+// SendEmailChanged lets the previous address of an account know it was
+// changed to email, in case the account was taken over.
+func SendEmailChanged(m app.Mailer, from string, username string, email string) error {
+	body := fmt.Sprintf("Hi %s,\n\nThe email address of your account has been changed to %s.\nIf this wasn't you, please contact us.\n", username, email)
+	return m.Send(from, "Your email address has been changed", body)
+}
@@ -0,0 +1,111 @@
+// Package mail implements app.Mailer.
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Ensure mailers implement interface.
+var _ app.Mailer = &SMTPMailer{}
+var _ app.Mailer = &LogMailer{}
+
+// DefaultTimeout bounds sending an email, from connecting to the server on.
+const DefaultTimeout = 30 * time.Second
+
+// SMTPMailer sends emails through an SMTP server.
+type SMTPMailer struct {
+	Addr    string // host:port
+	From    string
+	Auth    smtp.Auth // optional
+	Timeout time.Duration
+}
+
+// NewSMTPMailer returns a new instance of SMTPMailer, authenticating with
+// PLAIN auth if username is set.
+func NewSMTPMailer(addr, from, username, password string) *SMTPMailer {
+	m := &SMTPMailer{Addr: addr, From: from, Timeout: DefaultTimeout}
+	if username != "" {
+		m.Auth = smtp.PlainAuth("", username, password, m.host())
+	}
+	return m
+}
+
+// Send sends an email like smtp.SendMail, but gives up after m.Timeout.
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	conn, err := net.DialTimeout("tcp", m.Addr, m.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(m.Timeout))
+	}
+
+	c, err := smtp.NewClient(conn, m.host())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host()}); err != nil {
+			return err
+		}
+	}
+	if m.Auth != nil {
+		if err := c.Auth(m.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message(m.From, to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (m *SMTPMailer) host() string {
+	if i := strings.LastIndex(m.Addr, ":"); i >= 0 {
+		return m.Addr[:i]
+	}
+	return m.Addr
+}
+
+// LogMailer writes emails to W instead of sending them, for local development.
+type LogMailer struct {
+	W io.Writer
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	_, err := m.W.Write(message("", to, subject, body))
+	return err
+}
+
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	if from != "" {
+		_, _ = fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	_, _ = fmt.Fprintf(&b, "To: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", to, subject, body)
+	return []byte(b.String())
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLogMailer_Send(t *testing.T) {
+	var buf bytes.Buffer
+	m := &LogMailer{W: &buf}
+
+	if err := m.Send("test@test.com", "Hello", "Some text"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	expected := "To: test@test.com\r\nSubject: Hello\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nSome text\r\n"
+	if buf.String() != expected {
+		t.Fatalf("wrong message. expected %q but got %q", expected, buf.String())
+	}
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	if m := NewSMTPMailer("localhost:25", "noreply@test.com", "", ""); m.Auth != nil {
+		t.Fatal("expected no auth without username")
+	}
+	if m := NewSMTPMailer("localhost:25", "noreply@test.com", "user", "pass"); m.Auth == nil {
+		t.Fatal("expected auth with username")
+	}
+}
+
+func TestSMTPMailer_Send_Timeout(t *testing.T) {
+	// a server that never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	m := NewSMTPMailer(ln.Addr().String(), "noreply@test.com", "", "")
+	m.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	if err := m.Send("test@test.com", "Hello", "Some text"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("expected sending to time out")
+	}
+}
@@ -0,0 +1,42 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// APIKeyService represents a mock implementation of app.APIKeyService.
+type APIKeyService struct {
+	CreateFn      func(k *app.APIKey) (string, error)
+	CreateInvoked bool
+
+	ListFn      func(userId uint32) ([]*app.APIKey, error)
+	ListInvoked bool
+
+	RevokeFn      func(userId uint32, id uint32) error
+	RevokeInvoked bool
+
+	AuthenticateFn      func(key string, ip string) (*app.APIKey, error)
+	AuthenticateInvoked bool
+}
+
+// Create invokes the mock implementation and marks the function as invoked.
+func (s *APIKeyService) Create(k *app.APIKey) (string, error) {
+	s.CreateInvoked = true
+	return s.CreateFn(k)
+}
+
+// List invokes the mock implementation and marks the function as invoked.
+func (s *APIKeyService) List(userId uint32) ([]*app.APIKey, error) {
+	s.ListInvoked = true
+	return s.ListFn(userId)
+}
+
+// Revoke invokes the mock implementation and marks the function as invoked.
+func (s *APIKeyService) Revoke(userId uint32, id uint32) error {
+	s.RevokeInvoked = true
+	return s.RevokeFn(userId, id)
+}
+
+// Authenticate invokes the mock implementation and marks the function as invoked.
+func (s *APIKeyService) Authenticate(key string, ip string) (*app.APIKey, error) {
+	s.AuthenticateInvoked = true
+	return s.AuthenticateFn(key, ip)
+}
@@ -0,0 +1,69 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// AccountService represents a mock implementation of app.AccountService.
+type AccountService struct {
+	ScheduleDeletionFn      func(d *app.AccountDeletion, password string) error
+	ScheduleDeletionInvoked bool
+
+	CancelDeletionFn      func(userId uint32) error
+	CancelDeletionInvoked bool
+
+	PurgeDeletedFn      func() (int, error)
+	PurgeDeletedInvoked bool
+
+	RequestExportFn      func(userId uint32) (*app.DataExport, error)
+	RequestExportInvoked bool
+
+	GetExportFn      func(userId uint32, exportId uint32) (*app.DataExport, error)
+	GetExportInvoked bool
+
+	ProcessExportsFn      func() (int, error)
+	ProcessExportsInvoked bool
+
+	ExportArchiveFn      func(exportId uint32) ([]byte, error)
+	ExportArchiveInvoked bool
+}
+
+// ScheduleDeletion invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) ScheduleDeletion(d *app.AccountDeletion, password string) error {
+	s.ScheduleDeletionInvoked = true
+	return s.ScheduleDeletionFn(d, password)
+}
+
+// CancelDeletion invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) CancelDeletion(userId uint32) error {
+	s.CancelDeletionInvoked = true
+	return s.CancelDeletionFn(userId)
+}
+
+// PurgeDeleted invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) PurgeDeleted() (int, error) {
+	s.PurgeDeletedInvoked = true
+	return s.PurgeDeletedFn()
+}
+
+// RequestExport invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) RequestExport(userId uint32) (*app.DataExport, error) {
+	s.RequestExportInvoked = true
+	return s.RequestExportFn(userId)
+}
+
+// GetExport invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) GetExport(userId uint32, exportId uint32) (*app.DataExport, error) {
+	s.GetExportInvoked = true
+	return s.GetExportFn(userId, exportId)
+}
+
+// ProcessExports invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) ProcessExports() (int, error) {
+	s.ProcessExportsInvoked = true
+	return s.ProcessExportsFn()
+}
+
+// ExportArchive invokes the mock implementation and marks the function as invoked.
+func (s *AccountService) ExportArchive(exportId uint32) ([]byte, error) {
+	s.ExportArchiveInvoked = true
+	return s.ExportArchiveFn(exportId)
+}
@@ -0,0 +1,33 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// ArticleTrashService represents a mock implementation of app.ArticleTrashService.
+type ArticleTrashService struct {
+	TrashFn      func(userId uint32) ([]*app.Article, error)
+	TrashInvoked bool
+
+	RestoreFn      func(userId uint32, slug string) (*app.Article, error)
+	RestoreInvoked bool
+
+	PurgeTrashFn      func() (int, error)
+	PurgeTrashInvoked bool
+}
+
+// Trash invokes the mock implementation and marks the function as invoked.
+func (s *ArticleTrashService) Trash(userId uint32) ([]*app.Article, error) {
+	s.TrashInvoked = true
+	return s.TrashFn(userId)
+}
+
+// Restore invokes the mock implementation and marks the function as invoked.
+func (s *ArticleTrashService) Restore(userId uint32, slug string) (*app.Article, error) {
+	s.RestoreInvoked = true
+	return s.RestoreFn(userId, slug)
+}
+
+// PurgeTrash invokes the mock implementation and marks the function as invoked.
+func (s *ArticleTrashService) PurgeTrash() (int, error) {
+	s.PurgeTrashInvoked = true
+	return s.PurgeTrashFn()
+}
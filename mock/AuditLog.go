@@ -0,0 +1,33 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// AuditLog represents a mock implementation of app.AuditLog.
+type AuditLog struct {
+	RecordFn      func(e *app.AuditEvent) error
+	RecordInvoked bool
+
+	QueryFn      func(f app.AuditFilter) ([]*app.AuditEvent, error)
+	QueryInvoked bool
+
+	VerifyFn      func() (int64, error)
+	VerifyInvoked bool
+}
+
+// Record invokes the mock implementation and marks the function as invoked.
+func (l *AuditLog) Record(e *app.AuditEvent) error {
+	l.RecordInvoked = true
+	return l.RecordFn(e)
+}
+
+// Query invokes the mock implementation and marks the function as invoked.
+func (l *AuditLog) Query(f app.AuditFilter) ([]*app.AuditEvent, error) {
+	l.QueryInvoked = true
+	return l.QueryFn(f)
+}
+
+// Verify invokes the mock implementation and marks the function as invoked.
+func (l *AuditLog) Verify() (int64, error) {
+	l.VerifyInvoked = true
+	return l.VerifyFn()
+}
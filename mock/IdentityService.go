@@ -0,0 +1,15 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// IdentityService represents a mock implementation of app.IdentityService.
+type IdentityService struct {
+	LoginFn      func(u *app.ExternalUser) (*app.User, error)
+	LoginInvoked bool
+}
+
+// Login invokes the mock implementation and marks the function as invoked.
+func (s *IdentityService) Login(u *app.ExternalUser) (*app.User, error) {
+	s.LoginInvoked = true
+	return s.LoginFn(u)
+}
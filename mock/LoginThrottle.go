@@ -0,0 +1,42 @@
+package mock
+
+import "time"
+
+// LoginThrottle represents a mock implementation of app.LoginThrottle.
+type LoginThrottle struct {
+	CheckFn      func(email string, ip string) (time.Duration, error)
+	CheckInvoked bool
+
+	FailedFn      func(email string, ip string) error
+	FailedInvoked bool
+
+	SucceededFn      func(email string, ip string) error
+	SucceededInvoked bool
+
+	UnlockFn      func(userId uint32) error
+	UnlockInvoked bool
+}
+
+// Check invokes the mock implementation and marks the function as invoked.
+func (l *LoginThrottle) Check(email string, ip string) (time.Duration, error) {
+	l.CheckInvoked = true
+	return l.CheckFn(email, ip)
+}
+
+// Failed invokes the mock implementation and marks the function as invoked.
+func (l *LoginThrottle) Failed(email string, ip string) error {
+	l.FailedInvoked = true
+	return l.FailedFn(email, ip)
+}
+
+// Succeeded invokes the mock implementation and marks the function as invoked.
+func (l *LoginThrottle) Succeeded(email string, ip string) error {
+	l.SucceededInvoked = true
+	return l.SucceededFn(email, ip)
+}
+
+// Unlock invokes the mock implementation and marks the function as invoked.
+func (l *LoginThrottle) Unlock(userId uint32) error {
+	l.UnlockInvoked = true
+	return l.UnlockFn(userId)
+}
@@ -0,0 +1,13 @@
+package mock
+
+// Mailer represents a mock implementation of app.Mailer.
+type Mailer struct {
+	SendFn      func(to string, subject string, body string) error
+	SendInvoked bool
+}
+
+// Send invokes the mock implementation and marks the function as invoked.
+func (m *Mailer) Send(to string, subject string, body string) error {
+	m.SendInvoked = true
+	return m.SendFn(to, subject, body)
+}
@@ -0,0 +1,42 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// SessionService represents a mock implementation of app.SessionService.
+type SessionService struct {
+	TouchFn      func(s *app.Session) error
+	TouchInvoked bool
+
+	ListFn      func(userId uint32) ([]*app.Session, error)
+	ListInvoked bool
+
+	RevokeFn      func(userId uint32, id string) error
+	RevokeInvoked bool
+
+	RevokeOthersFn      func(userId uint32, currentId string) error
+	RevokeOthersInvoked bool
+}
+
+// Touch invokes the mock implementation and marks the function as invoked.
+func (s *SessionService) Touch(session *app.Session) error {
+	s.TouchInvoked = true
+	return s.TouchFn(session)
+}
+
+// List invokes the mock implementation and marks the function as invoked.
+func (s *SessionService) List(userId uint32) ([]*app.Session, error) {
+	s.ListInvoked = true
+	return s.ListFn(userId)
+}
+
+// Revoke invokes the mock implementation and marks the function as invoked.
+func (s *SessionService) Revoke(userId uint32, id string) error {
+	s.RevokeInvoked = true
+	return s.RevokeFn(userId, id)
+}
+
+// RevokeOthers invokes the mock implementation and marks the function as invoked.
+func (s *SessionService) RevokeOthers(userId uint32, currentId string) error {
+	s.RevokeOthersInvoked = true
+	return s.RevokeOthersFn(userId, currentId)
+}
@@ -0,0 +1,24 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// SigningKeyService represents a mock implementation of app.SigningKeyService.
+type SigningKeyService struct {
+	KeysFn      func() ([]*app.SigningKey, error)
+	KeysInvoked bool
+
+	RotateFn      func(algorithm string) (*app.SigningKey, error)
+	RotateInvoked bool
+}
+
+// Keys invokes the mock implementation and marks the function as invoked.
+func (s *SigningKeyService) Keys() ([]*app.SigningKey, error) {
+	s.KeysInvoked = true
+	return s.KeysFn()
+}
+
+// Rotate invokes the mock implementation and marks the function as invoked.
+func (s *SigningKeyService) Rotate(algorithm string) (*app.SigningKey, error) {
+	s.RotateInvoked = true
+	return s.RotateFn(algorithm)
+}
@@ -0,0 +1,60 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// TwoFactorService represents a mock implementation of app.TwoFactorService.
+type TwoFactorService struct {
+	EnrollFn      func(userId uint32) (*app.TOTPEnrollment, error)
+	EnrollInvoked bool
+
+	ConfirmFn      func(userId uint32, code string) ([]string, error)
+	ConfirmInvoked bool
+
+	DisableFn      func(userId uint32, password string, code string) error
+	DisableInvoked bool
+
+	CreateChallengeFn      func(userId uint32) (string, error)
+	CreateChallengeInvoked bool
+
+	ChallengeUserFn      func(challenge string) (uint32, error)
+	ChallengeUserInvoked bool
+
+	VerifyChallengeFn      func(challenge string, code string) (uint32, error)
+	VerifyChallengeInvoked bool
+}
+
+// Enroll invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) Enroll(userId uint32) (*app.TOTPEnrollment, error) {
+	s.EnrollInvoked = true
+	return s.EnrollFn(userId)
+}
+
+// Confirm invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) Confirm(userId uint32, code string) ([]string, error) {
+	s.ConfirmInvoked = true
+	return s.ConfirmFn(userId, code)
+}
+
+// Disable invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) Disable(userId uint32, password string, code string) error {
+	s.DisableInvoked = true
+	return s.DisableFn(userId, password, code)
+}
+
+// CreateChallenge invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) CreateChallenge(userId uint32) (string, error) {
+	s.CreateChallengeInvoked = true
+	return s.CreateChallengeFn(userId)
+}
+
+// ChallengeUser invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) ChallengeUser(challenge string) (uint32, error) {
+	s.ChallengeUserInvoked = true
+	return s.ChallengeUserFn(challenge)
+}
+
+// VerifyChallenge invokes the mock implementation and marks the function as invoked.
+func (s *TwoFactorService) VerifyChallenge(challenge string, code string) (uint32, error) {
+	s.VerifyChallengeInvoked = true
+	return s.VerifyChallengeFn(challenge, code)
+}
@@ -0,0 +1,15 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// UnitOfWork represents a mock implementation of app.UnitOfWork.
+type UnitOfWork struct {
+	DoFn      func(fn func(s *app.Services) error) error
+	DoInvoked bool
+}
+
+// Do invokes the mock implementation and marks the function as invoked.
+func (u *UnitOfWork) Do(fn func(s *app.Services) error) error {
+	u.DoInvoked = true
+	return u.DoFn(fn)
+}
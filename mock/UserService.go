@@ -10,7 +10,7 @@ type UserService struct {
 	CreateTokenFn      func(userId uint32) (string, error)
 	CreateTokenInvoked bool
 
-	ExtractAuthenticationTokenFn      func(r *http.Request) (uint32, error)
+	ExtractAuthenticationTokenFn      func(r *http.Request) (*app.Session, error)
 	ExtractAuthenticationTokenInvoked bool
 
 	SaveFn      func(user *app.User) error
@@ -19,8 +19,23 @@ type UserService struct {
 	GetByIdFn      func(userId uint32) (*app.User, error)
 	GetByIdInvoked bool
 
+	GetByUsernameFn      func(username string) (*app.User, error)
+	GetByUsernameInvoked bool
+
 	LoginFn      func(u *app.User) (string, error)
 	LoginInvoked bool
+
+	UpdateFn      func(user *app.User) error
+	UpdateInvoked bool
+
+	ChangePasswordFn      func(userId uint32, currentPassword string, newPassword string) (string, error)
+	ChangePasswordInvoked bool
+
+	RequestEmailChangeFn      func(userId uint32, email string, password string) error
+	RequestEmailChangeInvoked bool
+
+	ConfirmEmailChangeFn      func(userId uint32, token string) error
+	ConfirmEmailChangeInvoked bool
 }
 
 // CreateToken invokes the mock implementation and marks the function as invoked.
@@ -30,7 +45,7 @@ func (s *UserService) CreateToken(userId uint32) (string, error) {
 }
 
 // ExtractAuthenticationToken invokes the mock implementation and marks the function as invoked.
-func (s *UserService) ExtractAuthenticationToken(r *http.Request) (uint32, error) {
+func (s *UserService) ExtractAuthenticationToken(r *http.Request) (*app.Session, error) {
 	s.ExtractAuthenticationTokenInvoked = true
 	return s.ExtractAuthenticationTokenFn(r)
 }
@@ -47,8 +62,38 @@ func (s *UserService) GetById(userId uint32) (*app.User, error) {
 	return s.GetByIdFn(userId)
 }
 
+// GetByUsername invokes the mock implementation and marks the function as invoked.
+func (s *UserService) GetByUsername(username string) (*app.User, error) {
+	s.GetByUsernameInvoked = true
+	return s.GetByUsernameFn(username)
+}
+
 // Login invokes the mock implementation and marks the function as invoked.
 func (s *UserService) Login(u *app.User) (string, error) {
 	s.LoginInvoked = true
 	return s.LoginFn(u)
 }
+
+// Update invokes the mock implementation and marks the function as invoked.
+func (s *UserService) Update(user *app.User) error {
+	s.UpdateInvoked = true
+	return s.UpdateFn(user)
+}
+
+// ChangePassword invokes the mock implementation and marks the function as invoked.
+func (s *UserService) ChangePassword(userId uint32, currentPassword string, newPassword string) (string, error) {
+	s.ChangePasswordInvoked = true
+	return s.ChangePasswordFn(userId, currentPassword, newPassword)
+}
+
+// RequestEmailChange invokes the mock implementation and marks the function as invoked.
+func (s *UserService) RequestEmailChange(userId uint32, email string, password string) error {
+	s.RequestEmailChangeInvoked = true
+	return s.RequestEmailChangeFn(userId, email, password)
+}
+
+// ConfirmEmailChange invokes the mock implementation and marks the function as invoked.
+func (s *UserService) ConfirmEmailChange(userId uint32, token string) error {
+	s.ConfirmEmailChangeInvoked = true
+	return s.ConfirmEmailChangeFn(userId, token)
+}
@@ -0,0 +1,36 @@
+package mock
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"time"
+)
+
+// WebhookQueue represents a mock implementation of app.WebhookQueue.
+type WebhookQueue struct {
+	ClaimFn      func(limit int, lease time.Duration) ([]*app.WebhookDelivery, error)
+	ClaimInvoked bool
+
+	RecordFn      func(d *app.WebhookDelivery, a *app.WebhookAttempt) error
+	RecordInvoked bool
+
+	PurgeFn      func() (int, error)
+	PurgeInvoked bool
+}
+
+// Claim invokes the mock implementation and marks the function as invoked.
+func (q *WebhookQueue) Claim(limit int, lease time.Duration) ([]*app.WebhookDelivery, error) {
+	q.ClaimInvoked = true
+	return q.ClaimFn(limit, lease)
+}
+
+// Record invokes the mock implementation and marks the function as invoked.
+func (q *WebhookQueue) Record(d *app.WebhookDelivery, a *app.WebhookAttempt) error {
+	q.RecordInvoked = true
+	return q.RecordFn(d, a)
+}
+
+// Purge invokes the mock implementation and marks the function as invoked.
+func (q *WebhookQueue) Purge() (int, error) {
+	q.PurgeInvoked = true
+	return q.PurgeFn()
+}
@@ -0,0 +1,60 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// WebhookService represents a mock implementation of app.WebhookService.
+type WebhookService struct {
+	CreateFn      func(w *app.Webhook) error
+	CreateInvoked bool
+
+	GetFn      func(id uint32) (*app.Webhook, error)
+	GetInvoked bool
+
+	ListFn      func() ([]*app.Webhook, error)
+	ListInvoked bool
+
+	UpdateFn      func(w *app.Webhook) error
+	UpdateInvoked bool
+
+	DeleteFn      func(id uint32) error
+	DeleteInvoked bool
+
+	DeliveriesFn      func(webhookId uint32, limit int) ([]*app.WebhookDelivery, error)
+	DeliveriesInvoked bool
+}
+
+// Create invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) Create(w *app.Webhook) error {
+	s.CreateInvoked = true
+	return s.CreateFn(w)
+}
+
+// Get invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) Get(id uint32) (*app.Webhook, error) {
+	s.GetInvoked = true
+	return s.GetFn(id)
+}
+
+// List invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) List() ([]*app.Webhook, error) {
+	s.ListInvoked = true
+	return s.ListFn()
+}
+
+// Update invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) Update(w *app.Webhook) error {
+	s.UpdateInvoked = true
+	return s.UpdateFn(w)
+}
+
+// Delete invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) Delete(id uint32) error {
+	s.DeleteInvoked = true
+	return s.DeleteFn(id)
+}
+
+// Deliveries invokes the mock implementation and marks the function as invoked.
+func (s *WebhookService) Deliveries(webhookId uint32, limit int) ([]*app.WebhookDelivery, error) {
+	s.DeliveriesInvoked = true
+	return s.DeliveriesFn(webhookId, limit)
+}
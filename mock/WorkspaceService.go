@@ -0,0 +1,69 @@
+package mock
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// WorkspaceService represents a mock implementation of app.WorkspaceService.
+type WorkspaceService struct {
+	CreateFn      func(w *app.Workspace, ownerId uint32) error
+	CreateInvoked bool
+
+	GetBySlugFn      func(slug string) (*app.Workspace, error)
+	GetBySlugInvoked bool
+
+	ListFn      func(userId uint32) ([]*app.Workspace, error)
+	ListInvoked bool
+
+	MembershipFn      func(workspaceId uint32, userId uint32) (*app.Membership, error)
+	MembershipInvoked bool
+
+	MembersFn      func(workspaceId uint32) ([]*app.Membership, error)
+	MembersInvoked bool
+
+	SetMemberFn      func(m *app.Membership) error
+	SetMemberInvoked bool
+
+	RemoveMemberFn      func(workspaceId uint32, userId uint32) error
+	RemoveMemberInvoked bool
+}
+
+// Create invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) Create(w *app.Workspace, ownerId uint32) error {
+	s.CreateInvoked = true
+	return s.CreateFn(w, ownerId)
+}
+
+// GetBySlug invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) GetBySlug(slug string) (*app.Workspace, error) {
+	s.GetBySlugInvoked = true
+	return s.GetBySlugFn(slug)
+}
+
+// List invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) List(userId uint32) ([]*app.Workspace, error) {
+	s.ListInvoked = true
+	return s.ListFn(userId)
+}
+
+// Membership invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) Membership(workspaceId uint32, userId uint32) (*app.Membership, error) {
+	s.MembershipInvoked = true
+	return s.MembershipFn(workspaceId, userId)
+}
+
+// Members invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) Members(workspaceId uint32) ([]*app.Membership, error) {
+	s.MembersInvoked = true
+	return s.MembersFn(workspaceId)
+}
+
+// SetMember invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) SetMember(m *app.Membership) error {
+	s.SetMemberInvoked = true
+	return s.SetMemberFn(m)
+}
+
+// RemoveMember invokes the mock implementation and marks the function as invoked.
+func (s *WorkspaceService) RemoveMember(workspaceId uint32, userId uint32) error {
+	s.RemoveMemberInvoked = true
+	return s.RemoveMemberFn(workspaceId, userId)
+}
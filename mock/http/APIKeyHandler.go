@@ -0,0 +1,21 @@
+package mock
+
+import "net/http"
+
+type APIKeyHandler struct {
+	Invoked *[]string
+}
+
+func NewMockAPIKeyHandler(invoked *[]string) *APIKeyHandler {
+	return &APIKeyHandler{invoked}
+}
+
+func (h *APIKeyHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "APIKeyHandler.HandleCreate")
+}
+func (h *APIKeyHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "APIKeyHandler.HandleList")
+}
+func (h *APIKeyHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "APIKeyHandler.HandleRevoke")
+}
@@ -0,0 +1,27 @@
+package mock
+
+import "net/http"
+
+type AccountHandler struct {
+	Invoked *[]string
+}
+
+func NewMockAccountHandler(invoked *[]string) *AccountHandler {
+	return &AccountHandler{invoked}
+}
+
+func (h *AccountHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AccountHandler.HandleDelete")
+}
+func (h *AccountHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AccountHandler.HandleRestore")
+}
+func (h *AccountHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AccountHandler.HandleExport")
+}
+func (h *AccountHandler) HandleGetExport(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AccountHandler.HandleGetExport")
+}
+func (h *AccountHandler) HandleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AccountHandler.HandleDownloadExport")
+}
@@ -0,0 +1,15 @@
+package mock
+
+import "net/http"
+
+type AdminHandler struct {
+	Invoked *[]string
+}
+
+func NewMockAdminHandler(invoked *[]string) *AdminHandler {
+	return &AdminHandler{invoked}
+}
+
+func (h *AdminHandler) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AdminHandler.HandleUnlockUser")
+}
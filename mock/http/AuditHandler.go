@@ -0,0 +1,18 @@
+package mock
+
+import "net/http"
+
+type AuditHandler struct {
+	Invoked *[]string
+}
+
+func NewMockAuditHandler(invoked *[]string) *AuditHandler {
+	return &AuditHandler{invoked}
+}
+
+func (h *AuditHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AuditHandler.HandleList")
+}
+func (h *AuditHandler) HandleVerify(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AuditHandler.HandleVerify")
+}
@@ -19,9 +19,26 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
 	*h.Invoked = append(*h.Invoked, "AuthHandler.HandleMe")
 }
+func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "AuthHandler.HandleLogout")
+}
 func (h *AuthHandler) Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		*h.Invoked = append(*h.Invoked, "AuthHandler.Authentication")
 		next.ServeHTTP(w, r)
 	})
 }
+func (h *AuthHandler) RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*h.Invoked = append(*h.Invoked, "AuthHandler.RequireScope")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+func (h *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*h.Invoked = append(*h.Invoked, "AuthHandler.RequireAdmin")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,21 @@
+package mock
+
+import "net/http"
+
+type CollabHandler struct {
+	Invoked *[]string
+}
+
+func NewMockCollabHandler(invoked *[]string) *CollabHandler {
+	return &CollabHandler{invoked}
+}
+
+func (h *CollabHandler) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "CollabHandler.HandleConnect")
+}
+func (h *CollabHandler) WebSocketToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*h.Invoked = append(*h.Invoked, "CollabHandler.WebSocketToken")
+		next.ServeHTTP(w, r)
+	})
+}
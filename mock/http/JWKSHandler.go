@@ -0,0 +1,15 @@
+package mock
+
+import "net/http"
+
+type JWKSHandler struct {
+	Invoked *[]string
+}
+
+func NewMockJWKSHandler(invoked *[]string) *JWKSHandler {
+	return &JWKSHandler{invoked}
+}
+
+func (h *JWKSHandler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "JWKSHandler.HandleJWKS")
+}
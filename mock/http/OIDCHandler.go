@@ -0,0 +1,18 @@
+package mock
+
+import "net/http"
+
+type OIDCHandler struct {
+	Invoked *[]string
+}
+
+func NewMockOIDCHandler(invoked *[]string) *OIDCHandler {
+	return &OIDCHandler{invoked}
+}
+
+func (h *OIDCHandler) HandleStart(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "OIDCHandler.HandleStart")
+}
+func (h *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "OIDCHandler.HandleCallback")
+}
@@ -0,0 +1,21 @@
+package mock
+
+import "net/http"
+
+type SessionHandler struct {
+	Invoked *[]string
+}
+
+func NewMockSessionHandler(invoked *[]string) *SessionHandler {
+	return &SessionHandler{invoked}
+}
+
+func (h *SessionHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "SessionHandler.HandleList")
+}
+func (h *SessionHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "SessionHandler.HandleRevoke")
+}
+func (h *SessionHandler) HandleRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "SessionHandler.HandleRevokeOthers")
+}
@@ -0,0 +1,15 @@
+package mock
+
+import "net/http"
+
+type StreamHandler struct {
+	Invoked *[]string
+}
+
+func NewMockStreamHandler(invoked *[]string) *StreamHandler {
+	return &StreamHandler{invoked}
+}
+
+func (h *StreamHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "StreamHandler.HandleStream")
+}
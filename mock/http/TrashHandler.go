@@ -0,0 +1,18 @@
+package mock
+
+import "net/http"
+
+type TrashHandler struct {
+	Invoked *[]string
+}
+
+func NewMockTrashHandler(invoked *[]string) *TrashHandler {
+	return &TrashHandler{invoked}
+}
+
+func (h *TrashHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TrashHandler.HandleList")
+}
+func (h *TrashHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TrashHandler.HandleRestore")
+}
@@ -0,0 +1,24 @@
+package mock
+
+import "net/http"
+
+type TwoFactorHandler struct {
+	Invoked *[]string
+}
+
+func NewMockTwoFactorHandler(invoked *[]string) *TwoFactorHandler {
+	return &TwoFactorHandler{invoked}
+}
+
+func (h *TwoFactorHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TwoFactorHandler.HandleEnroll")
+}
+func (h *TwoFactorHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TwoFactorHandler.HandleConfirm")
+}
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TwoFactorHandler.HandleDisable")
+}
+func (h *TwoFactorHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "TwoFactorHandler.HandleLogin")
+}
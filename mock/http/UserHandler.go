@@ -0,0 +1,27 @@
+package mock
+
+import "net/http"
+
+type UserHandler struct {
+	Invoked *[]string
+}
+
+func NewMockUserHandler(invoked *[]string) *UserHandler {
+	return &UserHandler{invoked}
+}
+
+func (h *UserHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "UserHandler.HandleGet")
+}
+func (h *UserHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "UserHandler.HandleUpdate")
+}
+func (h *UserHandler) HandleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "UserHandler.HandleChangeEmail")
+}
+func (h *UserHandler) HandleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "UserHandler.HandleConfirmEmail")
+}
+func (h *UserHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "UserHandler.HandleChangePassword")
+}
@@ -0,0 +1,36 @@
+package mock
+
+import "net/http"
+
+type WebhookHandler struct {
+	Invoked *[]string
+}
+
+func NewMockWebhookHandler(invoked *[]string) *WebhookHandler {
+	return &WebhookHandler{invoked}
+}
+
+func (h *WebhookHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleCreate")
+}
+func (h *WebhookHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleList")
+}
+func (h *WebhookHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleGet")
+}
+func (h *WebhookHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleUpdate")
+}
+func (h *WebhookHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleDelete")
+}
+func (h *WebhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WebhookHandler.HandleListDeliveries")
+}
+func (h *WebhookHandler) WebhookCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*h.Invoked = append(*h.Invoked, "WebhookHandler.WebhookCtx")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+package mock
+
+import "net/http"
+
+type WorkspaceHandler struct {
+	Invoked *[]string
+}
+
+func NewMockWorkspaceHandler(invoked *[]string) *WorkspaceHandler {
+	return &WorkspaceHandler{invoked}
+}
+
+func (h *WorkspaceHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WorkspaceHandler.HandleCreate")
+}
+func (h *WorkspaceHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WorkspaceHandler.HandleList")
+}
+func (h *WorkspaceHandler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WorkspaceHandler.HandleListMembers")
+}
+func (h *WorkspaceHandler) HandleSetMember(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WorkspaceHandler.HandleSetMember")
+}
+func (h *WorkspaceHandler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	*h.Invoked = append(*h.Invoked, "WorkspaceHandler.HandleRemoveMember")
+}
+func (h *WorkspaceHandler) WorkspaceCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*h.Invoked = append(*h.Invoked, "WorkspaceHandler.WorkspaceCtx")
+		next.ServeHTTP(w, r)
+	})
+}
+func (h *WorkspaceHandler) RequireRole(role string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*h.Invoked = append(*h.Invoked, "WorkspaceHandler.RequireRole")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+func (h *WorkspaceHandler) RequireMember(authenticate func(next http.Handler) http.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*h.Invoked = append(*h.Invoked, "WorkspaceHandler.RequireMember")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,386 @@
+// Package oidc implements the relying party side of OpenID Connect: the
+// authorization code flow with PKCE, and ID token verification with the keys
+// the provider publishes.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// discoveryPath is appended to the issuer to find the provider metadata.
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// minKeysRefresh limits JWKS fetches triggered by tokens with an unknown kid.
+	minKeysRefresh = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+	ErrNonceMismatch  = errors.New("oidc: nonce mismatch")
+)
+
+// Config describes a provider and our registration with it.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // defaults to openid, email and profile
+}
+
+// Metadata is the subset of the discovery document the flow needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims we use.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Flow is the per-login state the relying party keeps between sending the
+// user to the provider and handling the callback.
+type Flow struct {
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// NewFlow returns a flow with fresh random values.
+func NewFlow() (*Flow, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &Flow{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// Challenge returns the S256 PKCE challenge of a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Client talks to a single provider. Metadata and keys are fetched on first
+// use and cached.
+type Client struct {
+	config Config
+	http   *http.Client
+	now    func() time.Time
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewClient returns a client for the provider described by config.
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		config: config,
+		http:   httpClient,
+		now:    time.Now,
+	}
+}
+
+// AuthCodeURL returns the provider URL to send the user to.
+func (c *Client) AuthCodeURL(flow *Flow) (string, error) {
+	m, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(m.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.config.ClientID)
+	q.Set("redirect_uri", c.config.RedirectURL)
+	q.Set("scope", strings.Join(c.config.Scopes, " "))
+	q.Set("state", flow.State)
+	q.Set("nonce", flow.Nonce)
+	q.Set("code_challenge", Challenge(flow.Verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for the ID token and verifies it.
+func (c *Client) Exchange(code string, flow *Flow) (*Claims, error) {
+	m, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"code_verifier": {flow.Verifier},
+	}
+	req, err := http.NewRequest("POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := c.do(req, &token); err != nil {
+		if token.Error != "" {
+			return nil, fmt.Errorf("oidc: token endpoint: %s %s", token.Error, token.ErrorDescription)
+		}
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("oidc: token response without id_token")
+	}
+
+	return c.Verify(token.IDToken, flow.Nonce)
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce.
+func (c *Client) Verify(rawIDToken string, nonce string) (*Claims, error) {
+	m, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}}
+	token, err := parser.Parse(rawIDToken, c.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+
+	now := c.now().Unix()
+	if !claims.VerifyIssuer(m.Issuer, true) || !claims.VerifyExpiresAt(now, true) || !c.verifyAudience(claims) {
+		return nil, ErrInvalidIDToken
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, ErrNonceMismatch
+	}
+
+	result := &Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string: // some providers send "true"
+		result.EmailVerified = v == "true"
+	}
+
+	if result.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	return result, nil
+}
+
+// verifyAudience requires our client id in aud and, with several audiences,
+// as the authorized party.
+func (c *Client) verifyAudience(claims jwt.MapClaims) bool {
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	found := false
+	for _, a := range audiences {
+		if a == c.config.ClientID {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+
+	if azp, ok := claims["azp"].(string); ok || len(audiences) > 1 {
+		return azp == c.config.ClientID
+	}
+	return true
+}
+
+func (c *Client) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := c.key(kid, false)
+	if err == nil && key == nil {
+		// the provider may have rotated its keys since we fetched them
+		key, err = c.key(kid, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("oidc: unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// key looks a key up by kid, fetching the JWKS if it hasn't been yet or, on
+// refetch, if the last fetch is old enough. An empty kid matches a lone key.
+func (c *Client) key(kid string, refetch bool) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keys == nil || (refetch && c.now().Sub(c.keysFetchedAt) > minKeysRefresh) {
+		keys, err := c.fetchKeys()
+		if err != nil {
+			return nil, err
+		}
+		c.keys = keys
+		c.keysFetchedAt = c.now()
+	}
+
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, nil
+		}
+	}
+	return c.keys[kid], nil
+}
+
+func (c *Client) fetchKeys() (map[string]interface{}, error) {
+	m, err := c.discoverLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", m.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := c.do(req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// skip key types we don't support rather than failing every login
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (c *Client) discover() (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discoverLocked()
+}
+
+func (c *Client) discoverLocked() (*Metadata, error) {
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.config.Issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Metadata
+	if err := c.do(req, &m); err != nil {
+		return nil, err
+	}
+
+	// the document must be about the issuer we were configured with
+	if m.Issuer != c.config.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch, expected %q but got %q", c.config.Issuer, m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc: incomplete discovery document")
+	}
+
+	c.metadata = &m
+	return c.metadata, nil
+}
+
+// do sends req and decodes the JSON response into v. Error responses are
+// decoded too, so callers can read provider error codes.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	decodeErr := json.Unmarshal(body, v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return decodeErr
+}
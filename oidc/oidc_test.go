@@ -0,0 +1,183 @@
+package oidc_test
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/leartgjoni/go-rest-template/oidc"
+	"github.com/leartgjoni/go-rest-template/oidc/oidctest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const redirectURL = "http://localhost:8080/auth/oidc/stub/callback"
+
+func TestClient_Flow(t *testing.T) {
+	provider := oidctest.NewProvider("client-id", "client-secret")
+	defer provider.Close()
+
+	client := oidc.NewClient(provider.Config(redirectURL), nil)
+
+	flow, err := oidc.NewFlow()
+	if err != nil {
+		t.Fatal("cannot create flow", err)
+	}
+
+	authURL, err := client.AuthCodeURL(flow)
+	if err != nil {
+		t.Fatal("cannot build auth url", err)
+	}
+	if !strings.HasPrefix(authURL, provider.URL+"/authorize?") || !strings.Contains(authURL, "code_challenge="+oidc.Challenge(flow.Verifier)) || strings.Contains(authURL, flow.Verifier) {
+		t.Fatalf("wrong auth url %s", authURL)
+	}
+
+	callback, err := provider.Authorize(authURL)
+	if err != nil {
+		t.Fatal("cannot authorize", err)
+	}
+	u, _ := url.Parse(callback)
+	if u.Query().Get("state") != flow.State {
+		t.Fatalf("state not round tripped: %s", callback)
+	}
+
+	claims, err := client.Exchange(u.Query().Get("code"), flow)
+	if err != nil {
+		t.Fatal("cannot exchange code", err)
+	}
+	if claims.Subject != "stub-subject" || claims.Email != "test@test.com" || !claims.EmailVerified || claims.Name != "Test User" {
+		t.Fatalf("wrong claims %v", claims)
+	}
+
+	// codes are single use
+	if _, err := client.Exchange(u.Query().Get("code"), flow); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expected invalid_grant but got %v", err)
+	}
+}
+
+func TestClient_Exchange_WrongVerifier(t *testing.T) {
+	provider := oidctest.NewProvider("client-id", "client-secret")
+	defer provider.Close()
+
+	client := oidc.NewClient(provider.Config(redirectURL), nil)
+	flow, _ := oidc.NewFlow()
+	authURL, err := client.AuthCodeURL(flow)
+	if err != nil {
+		t.Fatal("cannot build auth url", err)
+	}
+	callback, _ := provider.Authorize(authURL)
+	u, _ := url.Parse(callback)
+
+	other, _ := oidc.NewFlow()
+	other.Nonce = flow.Nonce
+	if _, err := client.Exchange(u.Query().Get("code"), other); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("expected invalid_grant but got %v", err)
+	}
+}
+
+func TestClient_Verify(t *testing.T) {
+	provider := oidctest.NewProvider("client-id", "client-secret")
+	defer provider.Close()
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		nonce  string
+		sign   func(nonce string) (string, error)
+		error  error
+	}{
+		{
+			name:  "valid",
+			nonce: "nonce",
+			error: nil,
+		},
+		{
+			name:  "wrong nonce",
+			nonce: "other",
+			error: oidc.ErrNonceMismatch,
+		},
+		{
+			name:   "wrong audience",
+			claims: map[string]interface{}{"aud": "other-client"},
+			nonce:  "nonce",
+			error:  oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "several audiences without azp",
+			claims: map[string]interface{}{"aud": []string{"client-id", "other-client"}},
+			nonce:  "nonce",
+			error:  oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "several audiences with azp",
+			claims: map[string]interface{}{"aud": []string{"client-id", "other-client"}, "azp": "client-id"},
+			nonce:  "nonce",
+			error:  nil,
+		},
+		{
+			name:   "wrong issuer",
+			claims: map[string]interface{}{"iss": "https://evil.example.com"},
+			nonce:  "nonce",
+			error:  oidc.ErrInvalidIDToken,
+		},
+		{
+			name:   "expired",
+			claims: map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()},
+			nonce:  "nonce",
+			error:  oidc.ErrInvalidIDToken,
+		},
+		{
+			name:  "hmac signed with the client secret",
+			nonce: "nonce",
+			sign: func(nonce string) (string, error) {
+				return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"iss": provider.URL, "aud": "client-id", "sub": "stub-subject", "nonce": nonce, "exp": time.Now().Add(time.Hour).Unix(),
+				}).SignedString([]byte("client-secret"))
+			},
+			error: oidc.ErrInvalidIDToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defaults := provider.Claims
+			provider.Claims = map[string]interface{}{}
+			for k, v := range defaults {
+				provider.Claims[k] = v
+			}
+			for k, v := range test.claims {
+				provider.Claims[k] = v
+			}
+			defer func() { provider.Claims = defaults }()
+
+			sign := provider.IDToken
+			if test.sign != nil {
+				sign = test.sign
+			}
+			idToken, err := sign("nonce")
+			if err != nil {
+				t.Fatal("cannot sign id token", err)
+			}
+
+			client := oidc.NewClient(provider.Config(redirectURL), nil)
+			_, err = client.Verify(idToken, test.nonce)
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %v but got %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestClient_Discovery_IssuerMismatch(t *testing.T) {
+	provider := oidctest.NewProvider("client-id", "client-secret")
+	defer provider.Close()
+
+	config := provider.Config(redirectURL)
+	config.Issuer = provider.URL + "/"
+	client := oidc.NewClient(config, nil)
+
+	flow, _ := oidc.NewFlow()
+	if _, err := client.AuthCodeURL(flow); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("expected issuer mismatch but got %v", err)
+	}
+}
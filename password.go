@@ -0,0 +1,19 @@
+package app
+
+// PasswordHasher hashes passwords for storage and checks them.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrWrongCredentials if password doesn't match hash.
+	Verify(hash string, password string) error
+	// NeedsRehash reports whether hash was made with another algorithm
+	// or weaker parameters than new hashes are.
+	NeedsRehash(hash string) bool
+}
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy interface {
+	Validate(password string) error
+	// TooLong reports whether password is longer than any password may be,
+	// so logins can reject it without hashing it.
+	TooLong(password string) bool
+}
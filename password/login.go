@@ -0,0 +1,45 @@
+package password
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"log"
+	"sync"
+)
+
+// Dummy is a hash no password matches, compared against when there's no
+// user so that failing takes as long either way. The zero value is ready
+// to use.
+type Dummy struct {
+	once sync.Once
+	hash string
+}
+
+// Hash returns the dummy hash, hashed with h the first time.
+func (d *Dummy) Hash(h app.PasswordHasher) string {
+	d.once.Do(func() {
+		d.hash, _ = h.Hash("no user has this password")
+	})
+	return d.hash
+}
+
+// Rehash upgrades the hash of a password that was just verified, storing
+// the new hash with store, and returns the hash in use afterwards. store
+// reports false if the password was changed meanwhile. Failing to rehash
+// doesn't fail the login.
+func Rehash(h app.PasswordHasher, userId uint32, oldHash string, plain string, store func(newHash string) (bool, error)) string {
+	newHash, err := h.Hash(plain)
+	if err != nil {
+		log.Printf("cannot rehash password of user %d: %s", userId, err)
+		return oldHash
+	}
+
+	stored, err := store(newHash)
+	if err != nil {
+		log.Printf("cannot rehash password of user %d: %s", userId, err)
+		return oldHash
+	}
+	if !stored {
+		return oldHash
+	}
+	return newHash
+}
@@ -0,0 +1,142 @@
+// Package password hashes passwords with Argon2id in the PHC string format,
+// e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>, and still verifies the
+// bcrypt hashes stored before.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Ensure Hasher implements interface.
+var _ app.PasswordHasher = &Hasher{}
+
+// Params are the Argon2id parameters of new hashes.
+type Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendation for Argon2id.
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// ErrInvalidHash is returned for hashes in an unknown format.
+var ErrInvalidHash = errors.New("invalid password hash")
+
+var encoding = base64.RawStdEncoding
+
+// Hasher hashes passwords with Argon2id.
+type Hasher struct {
+	Params Params
+}
+
+// NewHasher returns a new instance of Hasher.
+func NewHasher(params Params) *Hasher {
+	return &Hasher{Params: params}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return encode(h.Params, salt, key), nil
+}
+
+// Verify checks a password against an Argon2id or a bcrypt hash.
+func (h *Hasher) Verify(hash string, password string) error {
+	return Verify(hash, password)
+}
+
+func (h *Hasher) NeedsRehash(hash string) bool {
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		// bcrypt, or something we can't read
+		return true
+	}
+	return p.Memory < h.Params.Memory || p.Iterations < h.Params.Iterations || p.Parallelism != h.Params.Parallelism ||
+		uint32(len(salt)) < h.Params.SaltLength || uint32(len(key)) < h.Params.KeyLength
+}
+
+// Verify checks a password against an Argon2id or a bcrypt hash. Only the
+// parameters stored in the hash are used, so it needs no Hasher.
+func Verify(hash string, password string) error {
+	if isBcrypt(hash) {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return app.ErrWrongCredentials
+		}
+		return nil
+	}
+
+	p, salt, key, err := decode(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return app.ErrWrongCredentials
+	}
+	return nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func encode(p Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism, encoding.EncodeToString(salt), encoding.EncodeToString(key))
+}
+
+func decode(hash string) (Params, []byte, []byte, error) {
+	var p Params
+
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,85 @@
+package password
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// testParams keep the tests fast.
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	h := NewHasher(testParams)
+
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal("cannot hash password", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("wrong hash format %s", hash)
+	}
+
+	if err := h.Verify(hash, "correct horse"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if err := h.Verify(hash, "wrong horse"); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+
+	other, _ := h.Hash("correct horse")
+	if other == hash {
+		t.Fatal("expected a random salt")
+	}
+}
+
+func TestVerify_Bcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("cannot hash password", err)
+	}
+
+	if err := Verify(string(hash), "password"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if err := Verify(string(hash), "wrong"); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+}
+
+func TestVerify_InvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5",
+	} {
+		if err := Verify(hash, "password"); err != ErrInvalidHash {
+			t.Fatalf("wrong error for %q. expected %s but got %s", hash, ErrInvalidHash, err)
+		}
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	h := NewHasher(testParams)
+
+	hash, _ := h.Hash("password")
+	if h.NeedsRehash(hash) {
+		t.Fatal("current hash shouldn't need a rehash")
+	}
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if !h.NeedsRehash(string(bcryptHash)) {
+		t.Fatal("bcrypt hash should need a rehash")
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+	if !NewHasher(stronger).NeedsRehash(hash) {
+		t.Fatal("hash with fewer iterations should need a rehash")
+	}
+}
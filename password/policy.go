@@ -0,0 +1,95 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	app "github.com/leartgjoni/go-rest-template"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ensure Policy implements interface.
+var _ app.PasswordPolicy = &Policy{}
+
+// Policy requires passwords of a certain length that aren't known from
+// data breaches.
+type Policy struct {
+	MinLength int // in characters
+	MaxLength int // in bytes, bounds the hashing work per request
+
+	// SHA-1 hex digests, upper case, of breached passwords
+	breached map[string]struct{}
+}
+
+// NewPolicy returns a new instance of Policy.
+func NewPolicy(minLength, maxLength int) *Policy {
+	return &Policy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		breached:  map[string]struct{}{},
+	}
+}
+
+func (p *Policy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return app.ErrPasswordTooShort
+	}
+	if p.TooLong(password) {
+		return app.ErrPasswordTooLong
+	}
+	if _, ok := p.breached[digest(password)]; ok {
+		return app.ErrPasswordBreached
+	}
+	return nil
+}
+
+func (p *Policy) TooLong(password string) bool {
+	return p.MaxLength > 0 && len(password) > p.MaxLength
+}
+
+// LoadBreached reads breached passwords, one per line. Lines can be the
+// password itself or its SHA-1 hex digest, optionally followed by
+// ":<count>" as in the Have I Been Pwned downloads.
+func (p *Policy) LoadBreached(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if i := strings.IndexByte(line, ':'); i == 40 && isHex(line[:40]) {
+			line = line[:40]
+		}
+		if len(line) == 40 && isHex(line) {
+			p.breached[strings.ToUpper(line)] = struct{}{}
+		} else {
+			p.breached[digest(line)] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadBreachedFile reads breached passwords from a file, see LoadBreached.
+func (p *Policy) LoadBreachedFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.LoadBreached(f)
+}
+
+func digest(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,44 @@
+package password
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	p := NewPolicy(8, 64)
+	breached := "password123\n" +
+		// sha1("qwertyuiop") as in the Have I Been Pwned downloads
+		"B0399D2029F64D445BD131FFAA399A42D2F8E7DC:3912816\n"
+	if err := p.LoadBreached(strings.NewReader(breached)); err != nil {
+		t.Fatal("cannot load breached passwords", err)
+	}
+
+	tests := []struct {
+		password string
+		error    error
+	}{
+		{"short", app.ErrPasswordTooShort},
+		{"ünïcödé", app.ErrPasswordTooShort},
+		{strings.Repeat("a", 65), app.ErrPasswordTooLong},
+		{"password123", app.ErrPasswordBreached},
+		{"qwertyuiop", app.ErrPasswordBreached},
+		{"correct horse battery", nil},
+	}
+
+	for _, test := range tests {
+		if err := p.Validate(test.password); err != test.error {
+			t.Fatalf("wrong error for %q. expected %s but got %s", test.password, test.error, err)
+		}
+	}
+}
+
+func TestPolicy_TooLong(t *testing.T) {
+	if p := NewPolicy(8, 64); p.TooLong(strings.Repeat("a", 64)) || !p.TooLong(strings.Repeat("a", 65)) {
+		t.Fatal("wrong maximum length")
+	}
+	if p := NewPolicy(8, 0); p.TooLong(strings.Repeat("a", 4096)) {
+		t.Fatal("expected no maximum length")
+	}
+}
@@ -0,0 +1,376 @@
+package postgres
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	app "github.com/leartgjoni/go-rest-template"
+	"log"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.AccountService = &AccountService{}
+
+// DefaultDeletionGracePeriod is how long a deleted account can be restored.
+const DefaultDeletionGracePeriod = 14 * 24 * time.Hour
+
+// exportTTL is how long a data export can be downloaded.
+const exportTTL = 7 * 24 * time.Hour
+
+// AccountService represents a service to delete and export accounts.
+type AccountService struct {
+	db          *DB
+	gracePeriod time.Duration
+}
+
+// NewAccountService returns a new instance of AccountService.
+func NewAccountService(db *DB, gracePeriod time.Duration) *AccountService {
+	return &AccountService{
+		db:          db,
+		gracePeriod: gracePeriod,
+	}
+}
+
+func (s *AccountService) ScheduleDeletion(d *app.AccountDeletion, password string) error {
+	var transferTo *uint32
+	switch d.Articles {
+	case app.ArticlesDelete, app.ArticlesAnonymise:
+	case app.ArticlesTransfer:
+		var id uint32
+		err := s.db.QueryRow("SELECT id FROM users WHERE username = $1 AND delete_after IS NULL", d.TransferTo).Scan(&id)
+		if err == sql.ErrNoRows || id == d.UserId {
+			return app.ErrInvalidTransferTarget
+		} else if err != nil {
+			return err
+		}
+		transferTo = &id
+	default:
+		return app.ErrInvalidArticleStrategy
+	}
+
+	var hashedPassword string
+	err := s.db.QueryRow("SELECT password FROM users WHERE id = $1", d.UserId).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return app.ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if hashedPassword != "" {
+		if err := verifyPassword(hashedPassword, password); err != nil {
+			return app.ErrWrongCredentials
+		}
+	}
+
+	d.DeleteAfter = time.Now().Add(s.gracePeriod)
+	_, err = s.db.Exec("UPDATE users SET delete_after = $1, deletion_articles = $2, deletion_transfer_to = $3 WHERE id = $4", d.DeleteAfter, d.Articles, transferTo, d.UserId)
+	return err
+}
+
+func (s *AccountService) CancelDeletion(userId uint32) error {
+	res, err := s.db.Exec("UPDATE users SET delete_after = NULL, deletion_articles = NULL, deletion_transfer_to = NULL WHERE id = $1 AND delete_after IS NOT NULL", userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrDeletionNotScheduled
+	}
+
+	return nil
+}
+
+func (s *AccountService) PurgeDeleted() (int, error) {
+	if _, err := s.db.Exec("DELETE FROM data_exports WHERE expires_at <= $1", time.Now()); err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query("SELECT id FROM users WHERE delete_after <= $1", time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []uint32
+	for rows.Next() {
+		var id uint32
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+
+	// one account failing doesn't hold up the others
+	deleted := 0
+	for _, id := range ids {
+		if err := s.deleteAccount(id); err != nil {
+			log.Printf("cannot delete account of user %d: %s", id, err)
+			continue
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// deleteAccount deletes a user whose grace period is over, handling their
+// articles as they asked. Everything else of theirs is deleted by cascade.
+func (s *AccountService) deleteAccount(userId uint32) error {
+	return s.db.Transact(func(tx *DB) error {
+		var email, articles string
+		var transferTo *uint32
+		err := tx.QueryRow("SELECT email, deletion_articles, deletion_transfer_to FROM users WHERE id = $1 AND delete_after <= $2 FOR UPDATE", userId, time.Now()).Scan(&email, &articles, &transferTo)
+		if err == sql.ErrNoRows {
+			// cancelled meanwhile
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// articles in the trash were deleted already, their events say so
+		// when they're purged
+		switch {
+		case articles == app.ArticlesDelete:
+			err = writeArticlesEvent(tx, app.EventArticleDeleted, "DELETE FROM articles WHERE user_id = $1 AND deleted_at IS NULL RETURNING "+articleColumns, userId)
+			if err == nil {
+				err = writeArticlesEvent(tx, app.EventArticlePurged, "DELETE FROM articles WHERE user_id = $1 RETURNING "+articleColumns, userId)
+			}
+		case articles == app.ArticlesTransfer && transferTo != nil:
+			err = writeArticlesEvent(tx, app.EventArticleUpdated, "UPDATE articles SET user_id = $1 WHERE user_id = $2 RETURNING "+articleColumns, *transferTo, userId)
+		default:
+			// anonymise, also if the user to transfer to has been deleted since
+			err = writeArticlesEvent(tx, app.EventArticleUpdated, "UPDATE articles SET user_id = NULL WHERE user_id = $1 RETURNING "+articleColumns, userId)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM login_attempts WHERE scope = $1 AND key = $2", emailScope, normalizeEmail(email)); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM users WHERE id = $1", userId)
+		return err
+	})
+}
+
+// writeArticlesEvent runs a write to articles returning articleColumns, and
+// adds an event for each article not in the trash.
+func writeArticlesEvent(tx *DB, eventType string, query string, args ...interface{}) error {
+	articles, err := queryArticles(tx, query, args...)
+	if err != nil {
+		return err
+	}
+	for _, a := range articles {
+		if a.DeletedAt != nil && eventType != app.EventArticlePurged {
+			continue
+		}
+		if err := writeEvent(tx, eventType, a.WorkspaceId, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequestExport starts an export, or returns the one still pending.
+func (s *AccountService) RequestExport(userId uint32) (*app.DataExport, error) {
+	e, err := scanExport(s.db.QueryRow("SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports WHERE user_id = $1 AND status = $2", userId, app.ExportPending))
+	if err == nil {
+		return e, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	now := time.Now()
+	e = &app.DataExport{
+		UserId:    userId,
+		Status:    app.ExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(exportTTL),
+	}
+
+	row := s.db.QueryRow("INSERT INTO data_exports (user_id, status, created_at, expires_at) VALUES ($1, $2, $3, $4) RETURNING id", e.UserId, e.Status, e.CreatedAt, e.ExpiresAt)
+	if err := row.Scan(&e.ID); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (s *AccountService) GetExport(userId uint32, exportId uint32) (*app.DataExport, error) {
+	e, err := scanExport(s.db.QueryRow("SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports WHERE id = $1 AND user_id = $2 AND expires_at > $3", exportId, userId, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, app.ErrExportNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ProcessExports builds pending exports one at a time. Exports being
+// built by another instance are skipped.
+func (s *AccountService) ProcessExports() (int, error) {
+	processed := 0
+	for {
+		ok, err := s.processExport()
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			return processed, nil
+		}
+		processed++
+	}
+}
+
+func (s *AccountService) processExport() (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id, userId uint32
+	err = tx.QueryRow("SELECT id, user_id FROM data_exports WHERE status = $1 ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED", app.ExportPending).Scan(&id, &userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	status := app.ExportReady
+	archive, err := buildExport(tx, userId)
+	if err != nil {
+		log.Printf("cannot build export %d: %s", id, err)
+		status, archive = app.ExportFailed, nil
+	}
+
+	if _, err := tx.Exec("UPDATE data_exports SET status = $1, archive = $2, completed_at = $3 WHERE id = $4", status, archive, time.Now(), id); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (s *AccountService) ExportArchive(exportId uint32) ([]byte, error) {
+	var archive []byte
+	err := s.db.QueryRow("SELECT archive FROM data_exports WHERE id = $1 AND status = $2 AND expires_at > $3", exportId, app.ExportReady, time.Now()).Scan(&archive)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrExportNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func scanExport(row scanner) (*app.DataExport, error) {
+	var e app.DataExport
+	if err := row.Scan(&e.ID, &e.UserId, &e.Status, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// buildExport zips what is stored about a user as JSON files: their
+// profile, articles, linked identities and API keys. Secrets, like the
+// password hash, are left out.
+func buildExport(tx querier, userId uint32) ([]byte, error) {
+	var profile struct {
+		ID        uint32    `json:"id"`
+		Username  string    `json:"username"`
+		Email     string    `json:"email"`
+		Bio       string    `json:"bio"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	err := tx.QueryRow("SELECT id, username, email, bio, created_at, updated_at FROM users WHERE id = $1", userId).Scan(&profile.ID, &profile.Username, &profile.Email, &profile.Bio, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	articles := []*app.Article{}
+	err = queryEach(tx, "SELECT id, slug, title, COALESCE(body, ''), created_at, updated_at FROM articles WHERE user_id = $1 ORDER BY id", userId, func(rows *sql.Rows) error {
+		a := &app.Article{UserId: userId}
+		articles = append(articles, a)
+		return rows.Scan(&a.ID, &a.Slug, &a.Title, &a.Body, &a.CreatedAt, &a.UpdatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	identities := []*app.Identity{}
+	err = queryEach(tx, "SELECT id, provider, subject, COALESCE(email, ''), created_at FROM identities WHERE user_id = $1 ORDER BY id", userId, func(rows *sql.Rows) error {
+		i := &app.Identity{UserId: userId}
+		identities = append(identities, i)
+		return rows.Scan(&i.ID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys := []*app.APIKey{}
+	err = queryEach(tx, "SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, created_at FROM api_keys WHERE user_id = $1 ORDER BY id", userId, func(rows *sql.Rows) error {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return err
+		}
+		apiKeys = append(apiKeys, k)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", profile},
+		{"articles.json", articles},
+		{"identities.json", identities},
+		{"api_keys.json", apiKeys},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// queryEach calls fn for every row of a query for a user's records.
+func queryEach(tx querier, query string, userId uint32, fn func(rows *sql.Rows) error) error {
+	rows, err := tx.Query(query, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestAccountServiceIntegration_PurgeDeleted(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	for _, strategy := range []string{app.ArticlesDelete, app.ArticlesAnonymise, app.ArticlesTransfer} {
+		t.Run(strategy, func(t *testing.T) {
+			db := Suite.GetDb(t)
+			Suite.CleanDb(t)
+
+			userId := createUser(db, t)
+			var otherId uint32
+			if err := db.QueryRow("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", "other", "other@test.com", "", time.Now(), time.Now()).Scan(&otherId); err != nil {
+				t.Fatal("error while inserting user", err)
+			}
+
+			var articleId uint32
+			if err := db.QueryRow("INSERT INTO articles (slug, title, body, user_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", "hello-abc", "Hello", "World", userId, time.Now(), time.Now()).Scan(&articleId); err != nil {
+				t.Fatal("error while inserting article", err)
+			}
+
+			// a negative grace period makes the deletion due right away
+			s := NewAccountService(db, -time.Second)
+			if err := s.ScheduleDeletion(&app.AccountDeletion{UserId: userId, Articles: strategy, TransferTo: "other"}, "random-password"); err != app.ErrWrongCredentials {
+				t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+			}
+			if _, err := db.Exec("UPDATE users SET password = '' WHERE id = $1", userId); err != nil {
+				t.Fatal("cannot clear password", err)
+			}
+			if err := s.ScheduleDeletion(&app.AccountDeletion{UserId: userId, Articles: strategy, TransferTo: "other"}, ""); err != nil {
+				t.Fatal("cannot schedule deletion", err)
+			}
+
+			n, err := s.PurgeDeleted()
+			if err != nil || n != 1 {
+				t.Fatalf("expected 1 deleted account but got %d (%v)", n, err)
+			}
+
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE id = $1", userId).Scan(&count); err != nil || count != 0 {
+				t.Fatalf("expected user to be deleted (%v)", err)
+			}
+
+			var author *uint32
+			err = db.QueryRow("SELECT user_id FROM articles WHERE id = $1", articleId).Scan(&author)
+			switch strategy {
+			case app.ArticlesDelete:
+				if err == nil {
+					t.Fatal("expected article to be deleted")
+				}
+			case app.ArticlesAnonymise:
+				if err != nil || author != nil {
+					t.Fatalf("expected article without author but got %v (%v)", author, err)
+				}
+			case app.ArticlesTransfer:
+				if err != nil || author == nil || *author != otherId {
+					t.Fatalf("expected article of user %d but got %v (%v)", otherId, author, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAccountServiceIntegration_Export(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	userId := createUser(db, t)
+	s := NewAccountService(db, DefaultDeletionGracePeriod)
+
+	e, err := s.RequestExport(userId)
+	if err != nil {
+		t.Fatal("cannot request export", err)
+	}
+
+	if _, err := s.ExportArchive(e.ID); err != app.ErrExportNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrExportNotFound, err)
+	}
+
+	if n, err := s.ProcessExports(); err != nil || n != 1 {
+		t.Fatalf("expected 1 processed export but got %d (%v)", n, err)
+	}
+
+	e, err = s.GetExport(userId, e.ID)
+	if err != nil || e.Status != app.ExportReady {
+		t.Fatalf("expected ready export but got %v (%v)", e, err)
+	}
+
+	if archive, err := s.ExportArchive(e.ID); err != nil || len(archive) == 0 {
+		t.Fatalf("expected archive (%v)", err)
+	}
+}
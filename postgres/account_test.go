@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountService_ScheduleDeletion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
+	tests := []struct {
+		name     string
+		deletion app.AccountDeletion
+		password string
+		expect   func()
+		error    error
+	}{
+		{
+			name:     "anonymise",
+			deletion: app.AccountDeletion{UserId: 1, Articles: app.ArticlesAnonymise},
+			password: "password",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+				mock.ExpectExec("^UPDATE users SET delete_after*").WithArgs(sqlmock.AnyArg(), app.ArticlesAnonymise, nil, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			error: nil,
+		},
+		{
+			name:     "transfer",
+			deletion: app.AccountDeletion{UserId: 1, Articles: app.ArticlesTransfer, TransferTo: "other"},
+			password: "password",
+			expect: func() {
+				mock.ExpectQuery("^SELECT id FROM users WHERE username*").WithArgs("other").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery("^SELECT password FROM users*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+				mock.ExpectExec("^UPDATE users SET delete_after*").WithArgs(sqlmock.AnyArg(), app.ArticlesTransfer, 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			error: nil,
+		},
+		{
+			name:     "transfer to self",
+			deletion: app.AccountDeletion{UserId: 1, Articles: app.ArticlesTransfer, TransferTo: "test"},
+			password: "password",
+			expect: func() {
+				mock.ExpectQuery("^SELECT id FROM users WHERE username*").WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+			error: app.ErrInvalidTransferTarget,
+		},
+		{
+			name:     "unknown strategy",
+			deletion: app.AccountDeletion{UserId: 1, Articles: "keep"},
+			password: "password",
+			expect:   func() {},
+			error:    app.ErrInvalidArticleStrategy,
+		},
+		{
+			name:     "wrong password",
+			deletion: app.AccountDeletion{UserId: 1, Articles: app.ArticlesDelete},
+			password: "wrong",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+			},
+			error: app.ErrWrongCredentials,
+		},
+		{
+			name:     "without password",
+			deletion: app.AccountDeletion{UserId: 1, Articles: app.ArticlesDelete},
+			password: "",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(""))
+				mock.ExpectExec("^UPDATE users SET delete_after*").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			error: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expect()
+
+			s := NewAccountService(&DB{DB: db}, time.Hour)
+
+			err := s.ScheduleDeletion(&test.deletion, test.password)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if err == nil && time.Until(test.deletion.DeleteAfter) < 59*time.Minute {
+				t.Fatalf("wrong delete after %s", test.deletion.DeleteAfter)
+			}
+		})
+	}
+}
+
+func TestAccountService_CancelDeletion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewAccountService(&DB{DB: db}, time.Hour)
+
+	mock.ExpectExec("^UPDATE users SET delete_after = NULL*").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.CancelDeletion(1); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	mock.ExpectExec("^UPDATE users SET delete_after = NULL*").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.CancelDeletion(1); err != app.ErrDeletionNotScheduled {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrDeletionNotScheduled, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAccountService_RequestExport(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	exportRows := []string{"id", "user_id", "status", "created_at", "completed_at", "expires_at"}
+	s := NewAccountService(&DB{DB: db}, time.Hour)
+
+	t.Run("new", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT (.+) FROM data_exports WHERE user_id*").WithArgs(1, app.ExportPending).WillReturnRows(sqlmock.NewRows(exportRows))
+		mock.ExpectQuery("^INSERT INTO data_exports*").WithArgs(1, app.ExportPending, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+		e, err := s.RequestExport(1)
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+		if e.ID != 5 || e.Status != app.ExportPending {
+			t.Fatalf("wrong export %v", e)
+		}
+	})
+
+	t.Run("already pending", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT (.+) FROM data_exports WHERE user_id*").WithArgs(1, app.ExportPending).WillReturnRows(sqlmock.NewRows(exportRows).AddRow(4, 1, app.ExportPending, time.Now(), nil, time.Now().Add(time.Hour)))
+
+		e, err := s.RequestExport(1)
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+		if e.ID != 4 {
+			t.Fatalf("expected the pending export but got %v", e)
+		}
+	})
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAccountService_ProcessExports(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	var archive []byte
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT id, user_id FROM data_exports*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(5, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "bio", "created_at", "updated_at"}).AddRow(1, "test", "test@test.com", "", now, now))
+	mock.ExpectQuery("^SELECT (.+) FROM articles WHERE user_id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "title", "body", "created_at", "updated_at"}).AddRow(1, "hello-abc", "Hello", "World", now, now))
+	mock.ExpectQuery("^SELECT (.+) FROM identities WHERE user_id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "provider", "subject", "email", "created_at"}))
+	mock.ExpectQuery("^SELECT (.+) FROM api_keys WHERE user_id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "last_used_at", "last_used_ip", "created_at"}))
+	mock.ExpectExec("^UPDATE data_exports SET status*").WithArgs(app.ExportReady, archiveArg{&archive}, sqlmock.AnyArg(), 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT id, user_id FROM data_exports*").WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+	mock.ExpectRollback()
+
+	s := NewAccountService(&DB{DB: db}, time.Hour)
+
+	n, err := s.ProcessExports()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected 1 processed export but got %d", n)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal("cannot read archive", err)
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal("cannot open", f.Name, err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	if !strings.Contains(files["profile.json"], `"email": "test@test.com"`) || strings.Contains(files["profile.json"], "password") {
+		t.Fatalf("wrong profile %s", files["profile.json"])
+	}
+	if !strings.Contains(files["articles.json"], `"title": "Hello"`) {
+		t.Fatalf("wrong articles %s", files["articles.json"])
+	}
+	if files["identities.json"] != "[]\n" || files["api_keys.json"] != "[]\n" {
+		t.Fatalf("expected empty identities and api keys but got %v", files)
+	}
+}
+
+// archiveArg matches any []byte argument and keeps it.
+type archiveArg struct {
+	dest *[]byte
+}
+
+func (a archiveArg) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	*a.dest = b
+	return ok
+}
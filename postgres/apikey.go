@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.APIKeyService = &APIKeyService{}
+
+// apiKeyPrefix makes keys recognizable, e.g. by secret scanners.
+const apiKeyPrefix = "grt"
+
+// APIKeyService represents a service to manage personal API keys.
+type APIKeyService struct {
+	db *DB
+}
+
+// NewAPIKeyService returns a new instance of APIKeyService.
+func NewAPIKeyService(db *DB) *APIKeyService {
+	return &APIKeyService{
+		db: db,
+	}
+}
+
+// Create generates and stores a new key, returning it in plain text. This
+// is the only time the full key is available.
+func (s *APIKeyService) Create(k *app.APIKey) (string, error) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	k.Prefix = prefix
+	if k.Scopes == nil {
+		k.Scopes = []string{}
+	}
+
+	row := s.db.QueryRow("INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", k.UserId, k.Name, k.Prefix, hashAPIKey(key), pq.Array(k.Scopes), k.ExpiresAt, k.CreatedAt)
+	if err := row.Scan(&k.ID); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// List returns the user's keys that haven't been revoked.
+func (s *APIKeyService) List(userId uint32) ([]*app.APIKey, error) {
+	rows, err := s.db.Query("SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, created_at FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id", userId)
+	if err != nil {
+		return []*app.APIKey{}, err
+	}
+	defer func() {
+		if dErr := rows.Close(); dErr != nil && err == nil {
+			err = dErr
+		}
+	}()
+
+	keys := []*app.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return []*app.APIKey{}, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *APIKeyService) Revoke(userId uint32, id uint32) error {
+	res, err := s.db.Exec("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL", time.Now(), id, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Authenticate resolves a plain text key to the stored key, recording when
+// and from where it was used.
+func (s *APIKeyService) Authenticate(key string, ip string) (*app.APIKey, error) {
+	prefix, ok := apiKeyPrefixOf(key)
+	if !ok {
+		return nil, app.ErrInvalidAPIKey
+	}
+
+	var keyHash string
+	row := s.db.QueryRow("SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, last_used_ip, created_at, key_hash FROM api_keys WHERE prefix = $1 AND revoked_at IS NULL", prefix)
+	k, err := scanAPIKey(row, &keyHash)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashAPIKey(key))) != 1 {
+		return nil, app.ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return nil, app.ErrInvalidAPIKey
+	}
+
+	if _, err := s.db.Exec("UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3", now, ip, k.ID); err != nil {
+		return nil, err
+	}
+	k.LastUsedAt = &now
+	k.LastUsedIP = ip
+
+	return k, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAPIKey scans the public columns of an api key followed by any extra columns.
+func scanAPIKey(row scanner, extra ...interface{}) (*app.APIKey, error) {
+	var k app.APIKey
+	var lastUsedIP sql.NullString
+	dest := append([]interface{}{&k.ID, &k.UserId, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.ExpiresAt, &k.LastUsedAt, &lastUsedIP, &k.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	k.LastUsedIP = lastUsedIP.String
+	if k.Scopes == nil {
+		k.Scopes = []string{}
+	}
+	return &k, nil
+}
+
+// generateAPIKey returns a new key of the form grt_<prefix>_<secret> along
+// with its visible prefix (grt_<prefix>).
+func generateAPIKey() (string, string, error) {
+	b := make([]byte, 4+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix := apiKeyPrefix + "_" + hex.EncodeToString(b[:4])
+	return prefix + "_" + hex.EncodeToString(b[4:]), prefix, nil
+}
+
+func apiKeyPrefixOf(key string) (string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[0] + "_" + parts[1], true
+}
+
+// hashAPIKey hashes a key. Keys carry 256 random bits so a fast hash is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	userId := createUser(db, t)
+	s := NewAPIKeyService(db)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	k := app.APIKey{UserId: userId, Name: "ci", Scopes: []string{app.ScopeArticlesWrite}, ExpiresAt: &expiresAt, CreatedAt: time.Now()}
+	key, err := s.Create(&k)
+	if err != nil {
+		t.Fatal("cannot create api key", err)
+	}
+
+	var keyHash string
+	if err := db.QueryRow("SELECT key_hash FROM api_keys WHERE id = $1", k.ID).Scan(&keyHash); err != nil {
+		t.Fatal("cannot read api key", err)
+	}
+	if keyHash == key {
+		t.Fatal("key stored in plain text")
+	}
+
+	authenticated, err := s.Authenticate(key, "10.0.0.1")
+	if err != nil {
+		t.Fatal("cannot authenticate", err)
+	}
+	if authenticated.ID != k.ID || authenticated.UserId != userId || len(authenticated.Scopes) != 1 || !authenticated.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Expected %v but got %v", k, authenticated)
+	}
+
+	keys, err := s.List(userId)
+	if err != nil {
+		t.Fatal("cannot list api keys", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedAt == nil || keys[0].LastUsedIP != "10.0.0.1" {
+		t.Fatalf("expected last use to be recorded but got %v", keys)
+	}
+
+	if err := s.Revoke(userId+1, k.ID); err != app.ErrAPIKeyNotFound {
+		t.Fatal("expected other users not to revoke the key", err)
+	}
+	if err := s.Revoke(userId, k.ID); err != nil {
+		t.Fatal("cannot revoke api key", err)
+	}
+
+	if _, err := s.Authenticate(key, "10.0.0.1"); err != app.ErrInvalidAPIKey {
+		t.Fatal("expected revoked key to be rejected", err)
+	}
+
+	keys, err = s.List(userId)
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys but got %v (%v)", keys, err)
+	}
+}
@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var apiKeyColumns = []string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "last_used_at", "last_used_ip", "created_at"}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("^INSERT INTO api_keys (.+) VALUES (.+) RETURNING id").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	s := NewAPIKeyService(&DB{DB: db})
+
+	k := app.APIKey{UserId: 1, Name: "ci", CreatedAt: time.Now()}
+	key, err := s.Create(&k)
+	if err != nil {
+		t.Fatal("cannot create api key", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if !regexp.MustCompile(`^grt_[a-f0-9]{8}_[a-f0-9]{64}$`).MatchString(key) {
+		t.Fatal("key format is wrong", key)
+	}
+
+	if k.ID != 1 || key[:len(k.Prefix)] != k.Prefix || len(k.Prefix) != 12 {
+		t.Fatalf("wrong api key %v for key %s", k, key)
+	}
+}
+
+func TestAPIKeyService_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("^SELECT (.+) FROM api_keys WHERE user_id*").WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+		AddRow(1, 1, "ci", "grt_aaaaaaaa", "{articles:write}", nil, nil, nil, now).
+		AddRow(2, 1, "deploy", "grt_bbbbbbbb", "{}", now, now, "10.0.0.1", now))
+
+	s := NewAPIKeyService(&DB{DB: db})
+
+	keys, err := s.List(1)
+	if err != nil {
+		t.Fatal("cannot list api keys", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("wrong length. %v instead of 2", len(keys))
+	}
+
+	if keys[0].Name != "ci" || len(keys[0].Scopes) != 1 || keys[0].Scopes[0] != app.ScopeArticlesWrite || keys[0].ExpiresAt != nil || keys[0].LastUsedIP != "" {
+		t.Fatalf("wrong api key %v", keys[0])
+	}
+
+	if keys[1].Name != "deploy" || len(keys[1].Scopes) != 0 || keys[1].ExpiresAt == nil || keys[1].LastUsedIP != "10.0.0.1" {
+		t.Fatalf("wrong api key %v", keys[1])
+	}
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name     string
+		affected int64
+		error    error
+	}{
+		{
+			name:     "revoked",
+			affected: 1,
+			error:    nil,
+		},
+		{
+			name:     "not found",
+			affected: 0,
+			error:    app.ErrAPIKeyNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectExec("^UPDATE api_keys SET revoked_at*").WillReturnResult(sqlmock.NewResult(0, test.affected))
+
+			s := NewAPIKeyService(&DB{DB: db})
+
+			err := s.Revoke(1, 1)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_Authenticate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatal("cannot generate key", err)
+	}
+	otherKey, _, _ := generateAPIKey()
+
+	now := time.Now()
+	columns := append(apiKeyColumns, "key_hash")
+
+	tests := []struct {
+		name      string
+		key       string
+		sqlResult *sqlmock.Rows
+		used      bool
+		error     error
+	}{
+		{
+			name:      "valid key",
+			key:       key,
+			sqlResult: sqlmock.NewRows(columns).AddRow(1, 1, "ci", prefix, "{}", now.Add(time.Hour), nil, nil, now, hashAPIKey(key)),
+			used:      true,
+			error:     nil,
+		},
+		{
+			name:      "wrong secret",
+			key:       prefix + otherKey[len(prefix):],
+			sqlResult: sqlmock.NewRows(columns).AddRow(1, 1, "ci", prefix, "{}", nil, nil, nil, now, hashAPIKey(key)),
+			error:     app.ErrInvalidAPIKey,
+		},
+		{
+			name:      "expired",
+			key:       key,
+			sqlResult: sqlmock.NewRows(columns).AddRow(1, 1, "ci", prefix, "{}", now.Add(-time.Hour), nil, nil, now, hashAPIKey(key)),
+			error:     app.ErrInvalidAPIKey,
+		},
+		{
+			name:      "revoked or unknown",
+			key:       key,
+			sqlResult: sqlmock.NewRows(columns),
+			error:     app.ErrInvalidAPIKey,
+		},
+		{
+			name:  "malformed",
+			key:   "random",
+			error: app.ErrInvalidAPIKey,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.sqlResult != nil {
+				mock.ExpectQuery("^SELECT (.+) FROM api_keys WHERE prefix*").WithArgs(prefix).WillReturnRows(test.sqlResult)
+			}
+			if test.used {
+				mock.ExpectExec("^UPDATE api_keys SET last_used_at*").WithArgs(sqlmock.AnyArg(), "10.0.0.1", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			s := NewAPIKeyService(&DB{DB: db})
+
+			k, err := s.Authenticate(test.key, "10.0.0.1")
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if err == nil && (k.ID != 1 || k.UserId != 1 || k.LastUsedAt == nil || k.LastUsedIP != "10.0.0.1") {
+				t.Fatalf("wrong api key %v", k)
+			}
+		})
+	}
+}
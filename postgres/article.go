@@ -1,11 +1,11 @@
 package postgres
 
 import (
+	"database/sql"
 	"errors"
-	"fmt"
 	app "github.com/leartgjoni/go-rest-template"
-	"math/rand"
-	"strings"
+	"github.com/leartgjoni/go-rest-template/slug"
+	"strconv"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -13,38 +13,65 @@ import (
 
 // Ensure service implements interface.
 var _ app.ArticleService = &ArticleService{}
+var _ app.WorkspaceArticles = &ArticleService{}
+var _ app.PrimaryArticles = &ArticleService{}
 
-// ArticleService represents a service to manage users.
+// ArticleService represents a service to manage the articles of a workspace.
 type ArticleService struct {
-	db *DB
+	db          *DB
+	workspaceId uint32
+
+	// RowLevelSecurity also scopes queries with the articles policy, by
+	// running them in transactions setting app.workspace_id. It only takes
+	// effect for database roles not owning the table.
+	RowLevelSecurity bool
 }
 
-// NewArticleService returns a new instance of ArticleService.
+// NewArticleService returns a new instance of ArticleService, for the
+// default workspace.
 func NewArticleService(db *DB) *ArticleService {
 	return &ArticleService{
-		db: db,
+		db:          db,
+		workspaceId: app.DefaultWorkspaceId,
 	}
 }
 
-func (s *ArticleService) GetAll() ([]*app.Article, error) {
-	rows, err := s.db.Query("SELECT * FROM articles")
-	if err != nil {
-		return []*app.Article{}, err
-	}
-	defer func() {
-		if dErr := rows.Close(); dErr != nil && err == nil {
-			err = dErr
-		}
-	}()
+// InWorkspace returns the service for the articles of another workspace.
+func (s *ArticleService) InWorkspace(workspaceId uint32) app.ArticleService {
+	scoped := *s
+	scoped.workspaceId = workspaceId
+	return &scoped
+}
+
+// FromPrimary returns the service reading from the primary rather than
+// from replicas.
+func (s *ArticleService) FromPrimary() app.ArticleService {
+	primary := *s
+	primary.db = s.db.primary()
+	return &primary
+}
 
+func (s *ArticleService) GetAll() ([]*app.Article, error) {
 	var articles []*app.Article
-	for rows.Next() {
-		var article app.Article
-		err := rows.Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.CreatedAt, &article.UpdatedAt)
+	err := s.read(func(q querier) error {
+		rows, err := q.Query("SELECT id, slug, title, body, COALESCE(user_id, 0), workspace_id, created_at, updated_at FROM articles WHERE workspace_id = $1 AND deleted_at IS NULL ORDER BY id", s.workspaceId)
 		if err != nil {
-			return []*app.Article{}, err
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var article app.Article
+			err := rows.Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.WorkspaceId, &article.CreatedAt, &article.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			articles = append(articles, &article)
 		}
-		articles = append(articles, &article)
+		return rows.Err()
+	})
+	if err != nil {
+		return []*app.Article{}, err
 	}
 
 	return articles, nil
@@ -52,7 +79,9 @@ func (s *ArticleService) GetAll() ([]*app.Article, error) {
 
 func (s *ArticleService) GetBySlug(slug string) (*app.Article, error) {
 	var article app.Article
-	err := s.db.QueryRow("SELECT * FROM articles WHERE slug = $1", slug).Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.CreatedAt, &article.UpdatedAt)
+	err := s.read(func(q querier) error {
+		return q.QueryRow("SELECT id, slug, title, body, COALESCE(user_id, 0), workspace_id, created_at, updated_at FROM articles WHERE slug = $1 AND workspace_id = $2 AND deleted_at IS NULL", slug, s.workspaceId).Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.WorkspaceId, &article.CreatedAt, &article.UpdatedAt)
+	})
 
 	if err != nil || article.ID == 0 {
 		return &app.Article{}, app.ErrArticleNotFound
@@ -61,12 +90,30 @@ func (s *ArticleService) GetBySlug(slug string) (*app.Article, error) {
 	return &article, nil
 }
 
-func (s *ArticleService) Save(a *app.Article) error {
+// maxSlugAttempts bounds how often a write is retried with a new slug when
+// the random suffix collides with an existing one.
+const maxSlugAttempts = 3
 
-	a.Slug = getSlug(a.Title, 12)
-	row := s.db.QueryRow("INSERT INTO articles (slug, title, body, user_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", a.Slug, a.Title, a.Body, a.UserId, a.CreatedAt, a.UpdatedAt)
+func (s *ArticleService) Save(a *app.Article) error {
+	a.WorkspaceId = s.workspaceId
+	var err error
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		a.Slug = slug.New(a.Title, 12)
+		err = s.write(func(db *DB) error {
+			if err := db.QueryRow("INSERT INTO articles (slug, title, body, user_id, workspace_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", a.Slug, a.Title, a.Body, a.UserId, a.WorkspaceId, a.CreatedAt, a.UpdatedAt).Scan(&a.ID); err != nil {
+				return err
+			}
+			return writeEvent(db, app.EventArticleCreated, a.WorkspaceId, a)
+		})
+		if !isConstraint(err, articlesSlugConstraint) {
+			break
+		}
+	}
 
-	if err := row.Scan(&a.ID); err != nil || a.ID == 0 {
+	if err != nil {
+		return translateError(err)
+	}
+	if a.ID == 0 {
 		return errors.New("unable to save")
 	}
 
@@ -74,23 +121,72 @@ func (s *ArticleService) Save(a *app.Article) error {
 }
 
 func (s *ArticleService) Update(a *app.Article) error {
-	err := s.db.QueryRow("UPDATE articles SET slug = $1, title = $2, body = $3, updated_at = $4 WHERE slug = $5 RETURNING slug", getSlug(a.Title, 12), a.Title, a.Body, a.UpdatedAt, a.Slug).Scan(&a.Slug)
-	return err
+	oldSlug := a.Slug
+	var err error
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		err = s.write(func(db *DB) error {
+			if err := db.QueryRow("UPDATE articles SET slug = $1, title = $2, body = $3, updated_at = $4 WHERE slug = $5 AND workspace_id = $6 AND deleted_at IS NULL RETURNING id, slug, COALESCE(user_id, 0), workspace_id, created_at", slug.New(a.Title, 12), a.Title, a.Body, a.UpdatedAt, oldSlug, s.workspaceId).Scan(&a.ID, &a.Slug, &a.UserId, &a.WorkspaceId, &a.CreatedAt); err != nil {
+				return err
+			}
+			return writeEvent(db, app.EventArticleUpdated, a.WorkspaceId, a)
+		})
+		if !isConstraint(err, articlesSlugConstraint) {
+			break
+		}
+	}
+
+	if err == sql.ErrNoRows {
+		return app.ErrArticleNotFound
+	} else if err != nil {
+		return translateError(err)
+	}
+
+	return nil
 }
 
+// Delete moves an article to the trash, see ArticleTrashService.
 func (s *ArticleService) Delete(slug string) error {
-	_, err := s.db.Query("DELETE FROM articles WHERE slug LIKE $1", slug)
-	return err
+	err := s.write(func(db *DB) error {
+		var a app.Article
+		err := db.QueryRow("UPDATE articles SET deleted_at = $1 WHERE slug = $2 AND workspace_id = $3 AND deleted_at IS NULL RETURNING id, slug, title, body, COALESCE(user_id, 0), workspace_id, created_at, updated_at, deleted_at", time.Now(), slug, s.workspaceId).Scan(&a.ID, &a.Slug, &a.Title, &a.Body, &a.UserId, &a.WorkspaceId, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return writeEvent(db, app.EventArticleDeleted, a.WorkspaceId, &a)
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// read runs reads of the workspace, on a replica unless the service reads
+// from the primary.
+func (s *ArticleService) read(fn func(q querier) error) error {
+	if s.RowLevelSecurity {
+		return s.scoped(func(tx *DB) error { return fn(tx) })
+	}
+	return fn(s.db.reader())
 }
 
-func getSlug(title string, length int) string {
-	rand.Seed(time.Now().UnixNano())
-	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
-	var b strings.Builder
-	for i := 0; i < length; i++ {
-		b.WriteRune(chars[rand.Intn(len(chars))])
+// write runs writes in a transaction, which the events of the outbox they
+// write commit with.
+func (s *ArticleService) write(fn func(db *DB) error) error {
+	if s.RowLevelSecurity {
+		return s.scoped(fn)
 	}
-	randomString := b.String()
+	return s.db.Transact(fn)
+}
 
-	return fmt.Sprintf("%s-%s", strings.Replace(strings.ToLower(title), " ", "-", -1), randomString)
+// scoped runs fn in a transaction the row-level security policy limits to
+// the workspace.
+func (s *ArticleService) scoped(fn func(tx *DB) error) error {
+	return s.db.Transact(func(tx *DB) error {
+		if _, err := tx.Exec("SELECT set_config('app.workspace_id', $1, true)", strconv.FormatUint(uint64(s.workspaceId), 10)); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
 }
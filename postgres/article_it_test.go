@@ -137,7 +137,7 @@ func TestArticleServiceIntegration_Save(t *testing.T) {
 	}
 
 	var dbArticle app.Article
-	if err := db.QueryRow("SELECT * FROM articles WHERE id = $1", article.ID).Scan(&dbArticle.ID, &dbArticle.Slug, &dbArticle.Title, &dbArticle.Body, &dbArticle.UserId, &dbArticle.CreatedAt, &dbArticle.UpdatedAt); err != nil {
+	if err := db.QueryRow("SELECT id, slug, title, body, user_id, created_at, updated_at FROM articles WHERE id = $1", article.ID).Scan(&dbArticle.ID, &dbArticle.Slug, &dbArticle.Title, &dbArticle.Body, &dbArticle.UserId, &dbArticle.CreatedAt, &dbArticle.UpdatedAt); err != nil {
 		t.Fatal("cannot read article from db", err)
 	}
 
@@ -187,7 +187,7 @@ func TestArticleServiceIntegration_Update(t *testing.T) {
 	}
 
 	var dbArticle app.Article
-	if err := db.QueryRow("SELECT * FROM articles WHERE id = $1", article.ID).Scan(&dbArticle.ID, &dbArticle.Slug, &dbArticle.Title, &dbArticle.Body, &dbArticle.UserId, &dbArticle.CreatedAt, &dbArticle.UpdatedAt); err != nil {
+	if err := db.QueryRow("SELECT id, slug, title, body, user_id, created_at, updated_at FROM articles WHERE id = $1", article.ID).Scan(&dbArticle.ID, &dbArticle.Slug, &dbArticle.Title, &dbArticle.Body, &dbArticle.UserId, &dbArticle.CreatedAt, &dbArticle.UpdatedAt); err != nil {
 		t.Fatal("cannot read article from db", err)
 	}
 
@@ -229,14 +229,19 @@ func TestArticleServiceIntegration_Delete(t *testing.T) {
 		t.Fatal("cannot delete article", err)
 	}
 
-	count := 0
-	err := db.QueryRow("SELECT COUNT(id) FROM articles WHERE slug = $1", article.Slug).Scan(&count)
+	// it's in the trash
+	var deletedAt *time.Time
+	err := db.QueryRow("SELECT deleted_at FROM articles WHERE slug = $1", article.Slug).Scan(&deletedAt)
 	if err != nil {
-		t.Fatal("could not count articles", err)
+		t.Fatal("could not read article", err)
 	}
 
-	if count != 0 {
-		t.Fatal("article not deleted", count)
+	if deletedAt == nil {
+		t.Fatal("article not deleted")
+	}
+
+	if _, err := as.GetBySlug(article.Slug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	app "github.com/leartgjoni/go-rest-template"
+	"github.com/lib/pq"
 	"regexp"
 	"testing"
 	"time"
@@ -45,9 +46,9 @@ func TestArticleService_GetAll(t *testing.T) {
 	}{
 		{
 			name: "normal case",
-			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "created_at", "updated_at"}).
-				AddRow(articles[0].ID, articles[0].Slug, articles[0].Title, articles[0].Body, articles[0].UserId, articles[0].CreatedAt, articles[0].UpdatedAt).
-				AddRow(articles[1].ID, articles[1].Slug, articles[1].Title, articles[1].Body, articles[1].UserId, articles[1].CreatedAt, articles[1].UpdatedAt),
+			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}).
+				AddRow(articles[0].ID, articles[0].Slug, articles[0].Title, articles[0].Body, articles[0].UserId, app.DefaultWorkspaceId, articles[0].CreatedAt, articles[0].UpdatedAt).
+				AddRow(articles[1].ID, articles[1].Slug, articles[1].Title, articles[1].Body, articles[1].UserId, app.DefaultWorkspaceId, articles[1].CreatedAt, articles[1].UpdatedAt),
 			error:  nil,
 			result: articles,
 		},
@@ -55,9 +56,9 @@ func TestArticleService_GetAll(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			mock.ExpectQuery("^SELECT (.+) FROM articles").WillReturnRows(test.sqlResult)
+			mock.ExpectQuery("^SELECT (.+) FROM articles WHERE workspace_id = \\$1").WithArgs(app.DefaultWorkspaceId).WillReturnRows(test.sqlResult)
 
-			as := NewArticleService(&DB{db})
+			as := NewArticleService(&DB{DB: db})
 
 			articles, err = as.GetAll()
 
@@ -111,14 +112,14 @@ func TestArticleService_GetBySlug(t *testing.T) {
 	}{
 		{
 			name: "normal case",
-			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "created_at", "updated_at"}).
-				AddRow(article.ID, article.Slug, article.Title, article.Body, article.UserId, article.CreatedAt, article.UpdatedAt),
+			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}).
+				AddRow(article.ID, article.Slug, article.Title, article.Body, article.UserId, app.DefaultWorkspaceId, article.CreatedAt, article.UpdatedAt),
 			error:  nil,
 			result: article,
 		},
 		{
 			name:      "article not found",
-			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "created_at", "updated_at"}),
+			sqlResult: sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}),
 			error:     app.ErrArticleNotFound,
 			result:    app.Article{},
 		},
@@ -126,9 +127,9 @@ func TestArticleService_GetBySlug(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			mock.ExpectQuery("^SELECT (.+) FROM articles WHERE slug=*").WillReturnRows(test.sqlResult)
+			mock.ExpectQuery("^SELECT (.+) FROM articles WHERE slug = \\$1 AND workspace_id = \\$2").WithArgs("random-slug", app.DefaultWorkspaceId).WillReturnRows(test.sqlResult)
 
-			as := NewArticleService(&DB{db})
+			as := NewArticleService(&DB{DB: db})
 
 			result, err := as.GetBySlug("random-slug")
 
@@ -195,9 +196,12 @@ func TestArticleService_Save(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectBegin()
 			mock.ExpectQuery("^INSERT INTO (.+) VALUES (.+) RETURNING id").WillReturnRows(test.sqlResult)
+			mock.ExpectExec("^INSERT INTO outbox").WithArgs(app.EventArticleCreated, app.DefaultWorkspaceId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
 
-			as := NewArticleService(&DB{db})
+			as := NewArticleService(&DB{DB: db})
 
 			err := as.Save(&test.article)
 
@@ -216,3 +220,151 @@ func TestArticleService_Save(t *testing.T) {
 		})
 	}
 }
+
+func TestArticleService_Save_SlugConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	as := NewArticleService(&DB{DB: db})
+	slugConflict := &pq.Error{Code: "23505", Constraint: "articles_slug_key"}
+
+	t.Run("retries with a new slug", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO (.+) VALUES (.+) RETURNING id").WillReturnError(slugConflict)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO (.+) VALUES (.+) RETURNING id").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec("^INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		article := app.Article{Title: "title 1", UserId: 1}
+		if err := as.Save(&article); err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+		if article.ID != 1 {
+			t.Fatal("save error. expected article id to be set")
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		for i := 0; i < maxSlugAttempts; i++ {
+			mock.ExpectBegin()
+			mock.ExpectQuery("^INSERT INTO (.+) VALUES (.+) RETURNING id").WillReturnError(slugConflict)
+			mock.ExpectRollback()
+		}
+
+		err := as.Save(&app.Article{Title: "title 1", UserId: 1})
+		if !errors.Is(err, app.ErrUniqueViolation) {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrUniqueViolation, err)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO (.+) VALUES (.+) RETURNING id").WillReturnError(&pq.Error{Code: "23503", Constraint: "articles_user_id_fkey"})
+		mock.ExpectRollback()
+
+		err := as.Save(&app.Article{Title: "title 1", UserId: 2})
+		var constraintErr *app.ConstraintError
+		if !errors.As(err, &constraintErr) || constraintErr.Err != app.ErrForeignKeyViolation || constraintErr.Constraint != "articles_user_id_fkey" {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrForeignKeyViolation, err)
+		}
+	})
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestArticleService_Update(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "slug", "user_id", "workspace_id", "created_at"}
+	tests := []struct {
+		name      string
+		sqlResult *sqlmock.Rows
+		error     error
+	}{
+		{
+			name:      "normal case",
+			sqlResult: sqlmock.NewRows(columns).AddRow(1, "new-title-123456789012", 1, app.DefaultWorkspaceId, time.Now()),
+			error:     nil,
+		},
+		{
+			name:      "not found",
+			sqlResult: sqlmock.NewRows(columns),
+			error:     app.ErrArticleNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery("^UPDATE articles SET (.+) RETURNING id, slug").WillReturnRows(test.sqlResult)
+			if test.error == nil {
+				mock.ExpectExec("^INSERT INTO outbox").WithArgs(app.EventArticleUpdated, app.DefaultWorkspaceId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			as := NewArticleService(&DB{DB: db})
+
+			err := as.Update(&app.Article{Slug: "title-123456789012", Title: "new title"})
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+		})
+	}
+}
+
+func TestArticleService_InWorkspace(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	as := NewArticleService(&DB{DB: db})
+	as.RowLevelSecurity = true
+	scoped := as.InWorkspace(2)
+
+	// the policy is scoped to the workspace too
+	mock.ExpectBegin()
+	mock.ExpectExec("^SELECT set_config\\('app.workspace_id', \\$1, true\\)").WithArgs("2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^SELECT (.+) FROM articles WHERE slug = \\$1 AND workspace_id = \\$2").WithArgs("random-slug", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}).AddRow(1, "random-slug", "title", "body", 1, 2, time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	a, err := scoped.GetBySlug("random-slug")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if a.WorkspaceId != 2 {
+		t.Fatalf("wrong workspace. expected %d but got %d", 2, a.WorkspaceId)
+	}
+
+	// the service it was scoped from stays in the default workspace
+	if as.workspaceId != app.DefaultWorkspaceId {
+		t.Fatalf("wrong workspace. expected %d but got %d", app.DefaultWorkspaceId, as.workspaceId)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"strings"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.AuditLog = &AuditLog{}
+
+// MaxAuditQueryLimit bounds the events a query returns.
+const MaxAuditQueryLimit = 500
+
+// auditLockId is the advisory lock serializing appends, so each event
+// chains to the one before it.
+const auditLockId = 7311001
+
+// verifyBatchSize is how many events Verify reads at a time.
+const verifyBatchSize = 1000
+
+// AuditLog represents an append-only log of audit events. The table rejects
+// updates and deletes, and each event is hashed together with the previous
+// one, so tampering by someone able to bypass that shows in Verify.
+type AuditLog struct {
+	db *DB
+}
+
+// NewAuditLog returns a new instance of AuditLog.
+func NewAuditLog(db *DB) *AuditLog {
+	return &AuditLog{db: db}
+}
+
+func (s *AuditLog) Record(e *app.AuditEvent) error {
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond) // as stored
+	e.UserAgent = truncate(e.UserAgent, 255)
+	e.RequestId = truncate(e.RequestId, 100)
+	e.Target = truncate(e.Target, 255)
+	if len(e.Before) == 0 {
+		e.Before = nil
+	}
+	if len(e.After) == 0 {
+		e.After = nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", auditLockId); err != nil {
+		return err
+	}
+
+	var prev string
+	err = tx.QueryRow("SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	hash, err := auditHash(prev, e)
+	if err != nil {
+		return err
+	}
+
+	var actorId *uint32
+	if e.ActorId != 0 {
+		actorId = &e.ActorId
+	}
+	err = tx.QueryRow("INSERT INTO audit_events (action, actor_id, target, ip, user_agent, request_id, before, after, created_at, hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id", e.Action, actorId, e.Target, e.IP, e.UserAgent, e.RequestId, nullJSON(e.Before), nullJSON(e.After), e.CreatedAt, hash).Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	e.Hash = hash
+	return nil
+}
+
+func (s *AuditLog) Query(f app.AuditFilter) ([]*app.AuditEvent, error) {
+	var conds []string
+	var args []interface{}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ActorId != 0 {
+		where("actor_id = $%d", f.ActorId)
+	}
+	if f.Action != "" {
+		where("action = $%d", f.Action)
+	}
+	if f.Target != "" {
+		where("target = $%d", f.Target)
+	}
+	if !f.Since.IsZero() {
+		where("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		where("created_at < $%d", f.Until)
+	}
+	if f.BeforeId != 0 {
+		where("id < $%d", f.BeforeId)
+	}
+
+	limit := f.Limit
+	if limit <= 0 || limit > MaxAuditQueryLimit {
+		limit = MaxAuditQueryLimit
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_events"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d", limit)
+
+	return s.query(query, args...)
+}
+
+func (s *AuditLog) Verify() (int64, error) {
+	var prev string
+	var lastId int64
+	for {
+		events, err := s.query("SELECT "+auditColumns+" FROM audit_events WHERE id > $1 ORDER BY id LIMIT $2", lastId, verifyBatchSize)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, e := range events {
+			hash, err := auditHash(prev, e)
+			if err != nil || hash != e.Hash {
+				return e.ID, app.ErrAuditChainBroken
+			}
+			prev = e.Hash
+			lastId = e.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			return 0, nil
+		}
+	}
+}
+
+const auditColumns = "id, action, actor_id, target, ip, user_agent, request_id, before, after, created_at, hash"
+
+func (s *AuditLog) query(query string, args ...interface{}) ([]*app.AuditEvent, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*app.AuditEvent{}
+	for rows.Next() {
+		var e app.AuditEvent
+		var actorId *uint32
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.Action, &actorId, &e.Target, &e.IP, &e.UserAgent, &e.RequestId, &before, &after, &e.CreatedAt, &e.Hash); err != nil {
+			return nil, err
+		}
+		if actorId != nil {
+			e.ActorId = *actorId
+		}
+		e.Before, e.After = before, after
+		e.CreatedAt = e.CreatedAt.UTC()
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// auditHash chains e to the previous event's hash. It covers every field as
+// stored, except the ID.
+func auditHash(prev string, e *app.AuditEvent) (string, error) {
+	b, err := json.Marshal(struct {
+		Prev      string          `json:"prev"`
+		Action    string          `json:"action"`
+		ActorId   uint32          `json:"actor_id"`
+		Target    string          `json:"target"`
+		IP        string          `json:"ip"`
+		UserAgent string          `json:"user_agent"`
+		RequestId string          `json:"request_id"`
+		Before    json.RawMessage `json:"before"` // null if nil
+		After     json.RawMessage `json:"after"`
+		CreatedAt string          `json:"created_at"`
+	}{prev, e.Action, e.ActorId, e.Target, e.IP, e.UserAgent, e.RequestId, e.Before, e.After, e.CreatedAt.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// nullJSON stores missing JSON as NULL.
+func nullJSON(b json.RawMessage) interface{} {
+	if b == nil {
+		return nil
+	}
+	return []byte(b)
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+)
+
+func TestAuditLogIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	s := NewAuditLog(db)
+
+	// the table can't be cleaned, so other runs' events may come before
+	signup := &app.AuditEvent{Action: app.AuditSignup, ActorId: 1, Target: "user:1", IP: "1.2.3.4", After: []byte(`{"username": "test"}`)}
+	denied := &app.AuditEvent{Action: app.AuditPermissionDenied, ActorId: 1, Target: "DELETE /articles/hello", After: []byte(`{"required":"article owner"}`)}
+	for _, e := range []*app.AuditEvent{signup, denied} {
+		if err := s.Record(e); err != nil {
+			t.Fatal("cannot record event", err)
+		}
+	}
+
+	events, err := s.Query(app.AuditFilter{ActorId: 1, Limit: 2})
+	if err != nil || len(events) != 2 || events[0].ID != denied.ID || events[1].ID != signup.ID {
+		t.Fatalf("wrong events %v, %v", events, err)
+	}
+	if events[1].Hash != signup.Hash || !events[1].CreatedAt.Equal(signup.CreatedAt) {
+		t.Fatalf("wrong event %+v", events[1])
+	}
+
+	if id, err := s.Verify(); err != nil {
+		t.Fatalf("expected an intact chain but got %v at %d", err, id)
+	}
+
+	// events can't be changed or removed
+	if _, err := db.Exec("UPDATE audit_events SET target = 'user:2' WHERE id = $1", signup.ID); err == nil {
+		t.Fatal("expected the update to be rejected")
+	}
+	if _, err := db.Exec("DELETE FROM audit_events WHERE id = $1", signup.ID); err == nil {
+		t.Fatal("expected the delete to be rejected")
+	}
+}
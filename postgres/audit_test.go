@@ -0,0 +1,122 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+var auditRowColumns = []string{"id", "action", "actor_id", "target", "ip", "user_agent", "request_id", "before", "after", "created_at", "hash"}
+
+func TestAuditLog_Record(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewAuditLog(&DB{DB: db})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^SELECT pg_advisory_xact_lock*").WithArgs(auditLockId).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1$").WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("previous"))
+	mock.ExpectQuery("^INSERT INTO audit_events*").WithArgs(app.AuditLoginFailed, nil, "email:test@test.com", "1.2.3.4", "", "", nil, []byte(`{"reason":"wrong credentials"}`), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	e := &app.AuditEvent{Action: app.AuditLoginFailed, Target: "email:test@test.com", IP: "1.2.3.4", Before: []byte{}, After: []byte(`{"reason":"wrong credentials"}`)}
+	if err := s.Record(e); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	// the event is chained to the previous one
+	expected, _ := auditHash("previous", e)
+	if e.ID != 7 || e.Hash != expected || e.Before != nil {
+		t.Fatalf("wrong event %+v", e)
+	}
+	if e.CreatedAt.Nanosecond()%1000 != 0 {
+		t.Fatalf("expected created_at in microseconds but got %s", e.CreatedAt)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuditLog_Query(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewAuditLog(&DB{DB: db})
+
+	since := time.Unix(0, 0)
+	mock.ExpectQuery(`^SELECT (.+) FROM audit_events WHERE actor_id = \$1 AND target = \$2 AND created_at >= \$3 ORDER BY id DESC LIMIT 500$`).WithArgs(1, "article:hello", since).WillReturnRows(sqlmock.NewRows(auditRowColumns).AddRow(3, app.AuditArticleDelete, 1, "article:hello", "", "", "", []byte(`{"title":"Hello"}`), nil, since, "abc"))
+
+	events, err := s.Query(app.AuditFilter{ActorId: 1, Target: "article:hello", Since: since, Limit: 1000})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if len(events) != 1 || events[0].ID != 3 || events[0].ActorId != 1 || string(events[0].Before) != `{"title":"Hello"}` || events[0].After != nil {
+		t.Fatalf("wrong events %+v", events)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuditLog_Verify(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	first := &app.AuditEvent{ID: 1, Action: app.AuditSignup, ActorId: 1, Target: "user:1", After: []byte(`{"username":"test"}`), CreatedAt: now}
+	first.Hash, _ = auditHash("", first)
+	second := &app.AuditEvent{ID: 2, Action: app.AuditArticleDelete, ActorId: 1, Target: "article:hello", CreatedAt: now}
+	second.Hash, _ = auditHash(first.Hash, second)
+
+	rows := func(target string) *sqlmock.Rows {
+		return sqlmock.NewRows(auditRowColumns).
+			AddRow(first.ID, first.Action, first.ActorId, first.Target, "", "", "", nil, []byte(` { "username": "test" } `), first.CreatedAt, first.Hash).
+			AddRow(second.ID, second.Action, second.ActorId, target, "", "", "", nil, nil, second.CreatedAt, second.Hash)
+	}
+
+	var tests = []struct {
+		name          string
+		target        string
+		expectedId    int64
+		expectedError error
+	}{
+		{"intact", "article:hello", 0, nil},
+		{"tampered", "article:other", 2, app.ErrAuditChainBroken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			s := NewAuditLog(&DB{DB: db})
+
+			mock.ExpectQuery(`^SELECT (.+) FROM audit_events WHERE id > \$1 ORDER BY id LIMIT \$2$`).WithArgs(0, verifyBatchSize).WillReturnRows(rows(test.target))
+
+			id, err := s.Verify()
+			if err != test.expectedError {
+				t.Fatalf("wrong error. expected %v but got %v", test.expectedError, err)
+			}
+			if id != test.expectedId {
+				t.Fatalf("wrong event. expected %d but got %d", test.expectedId, id)
+			}
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -1,24 +1,251 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"math/rand"
+	"time"
 )
 
+// querier runs queries, either directly on the database or in a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// DB is a database handle. The DB passed to a Transact function runs its
+// queries in the transaction, so services created with it do as well.
 type DB struct {
 	*sql.DB
+
+	tx         *sql.Tx  // set on the DB of a transaction
+	savepoints int      // number of savepoints created in tx
+	committed  []func() // run once tx commits
+
+	replicas    *replicas // optional, serves reads
+	fromPrimary bool      // reads don't go to replicas
+}
+
+// PoolOptions configure the connection pool of a DB. Zero limits keep the
+// database/sql defaults.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// The database may still be starting, e.g. next to the app in docker
+	// compose, so the first ping is retried, waiting PingBackoff at first
+	// and twice as long after every attempt.
+	PingAttempts int
+	PingBackoff  time.Duration
+}
+
+// DefaultPoolOptions keep the database/sql pool defaults and try to reach
+// the database for about 15 seconds.
+var DefaultPoolOptions = PoolOptions{
+	PingAttempts: 5,
+	PingBackoff:  time.Second,
 }
 
+// maxPingBackoff caps the wait between ping attempts.
+const maxPingBackoff = 10 * time.Second
+
 // Open returns a DB reference for a data source.
-func Open(dataSourceName string) (*DB, error) {
-	db, err := sql.Open("postgres", dataSourceName)
+func Open(dataSourceName string, opts PoolOptions) (*DB, error) {
+	db, err := open(dataSourceName, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	// check db is available
-	if err := db.Ping(); err != nil {
+	if err := ping(db, opts.PingAttempts, opts.PingBackoff); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &DB{DB: db}, nil
+}
+
+// open returns a pool for a data source, without connecting yet.
+func open(dataSourceName string, opts PoolOptions) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dataSourceName)
+	if err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	if opts.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	return db, nil
+}
+
+// ping pings the database until it answers or attempts run out.
+func ping(db *sql.DB, attempts int, backoff time.Duration) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = db.Ping(); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("cannot reach database after %d attempts: %s", attempt, err)
+		}
+
+		log.Printf("cannot reach database, retrying in %s: %s", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxPingBackoff {
+			backoff = maxPingBackoff
+		}
+	}
+}
+
+func (db *DB) querier() querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.DB
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	db.served("primary", query)
+	return db.querier().Exec(query, args...)
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	db.served("primary", query)
+	return db.querier().Query(query, args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	db.served("primary", query)
+	return db.querier().QueryRow(query, args...)
+}
+
+// Begin starts a transaction. On the DB of a transaction it starts a
+// savepoint instead, which commits with the transaction.
+func (db *DB) Begin() (*Tx, error) {
+	if db.tx == nil {
+		tx, err := db.DB.Begin()
+		if err != nil {
+			return nil, err
+		}
+		return &Tx{Tx: tx}, nil
+	}
+
+	db.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", db.savepoints)
+	if _, err := db.tx.Exec("SAVEPOINT " + savepoint); err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: db.tx, savepoint: savepoint}, nil
+}
+
+// Tx is a transaction, or a savepoint within one.
+type Tx struct {
+	*sql.Tx
+
+	savepoint string
+	done      bool
+}
+
+func (tx *Tx) Commit() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Commit()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+// Rollback can be deferred right after Begin, it does nothing once the
+// transaction committed.
+func (tx *Tx) Rollback() error {
+	if tx.savepoint == "" {
+		return tx.Tx.Rollback()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	_, err := tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + tx.savepoint)
+	return err
+}
+
+// maxTransactAttempts bounds how often Transact runs a function whose
+// transaction keeps failing to serialize.
+const maxTransactAttempts = 5
+
+// Transact runs fn in a serializable transaction, committing if it returns
+// nil. Transactions that fail to serialize with concurrent ones are retried,
+// so fn must be safe to run more than once and shouldn't have side effects
+// outside the database. On the DB of a transaction, fn runs in that one.
+func (db *DB) Transact(fn func(tx *DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxTransactAttempts; attempt++ {
+		err = db.transact(fn)
+		if !isSerializationFailure(err) {
+			return err
+		}
+
+		// back off a little, with jitter so the conflicting transactions
+		// don't collide again
+		time.Sleep(time.Duration(attempt*attempt)*5*time.Millisecond + time.Duration(rand.Int63n(int64(5*time.Millisecond))))
+	}
+	return err
+}
+
+func (db *DB) transact(fn func(tx *DB) error) error {
+	tx, err := db.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	txDB := &DB{DB: db.DB, tx: tx, replicas: db.replicas}
+	if err := fn(txDB); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, f := range txDB.committed {
+		f()
+	}
+	return nil
+}
+
+// afterCommit runs f once the writes made so far are committed: right away,
+// or on the DB of a transaction when the transaction commits. f is dropped
+// if it doesn't.
+func (db *DB) afterCommit(f func()) {
+	if db.tx == nil {
+		f()
+		return
+	}
+	db.committed = append(db.committed, f)
+}
+
+// isSerializationFailure reports whether a transaction failed because of
+// concurrent ones and may succeed when retried.
+func isSerializationFailure(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		// serialization_failure, deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
 }
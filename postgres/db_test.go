@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDB_Transact(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name     string
+		expect   func()
+		errors   []error // returned by fn, one per attempt
+		expected error
+	}{
+		{
+			name: "commits",
+			expect: func() {
+				mock.ExpectBegin()
+				mock.ExpectCommit()
+			},
+			errors:   []error{nil},
+			expected: nil,
+		},
+		{
+			name: "rolls back",
+			expect: func() {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+			errors:   []error{errors.New("fn error")},
+			expected: errors.New("fn error"),
+		},
+		{
+			name: "retries serialization failures",
+			expect: func() {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+				mock.ExpectBegin()
+				mock.ExpectCommit()
+			},
+			errors:   []error{&pq.Error{Code: "40001"}, nil},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expect()
+
+			attempts := 0
+			err := (&DB{DB: db}).Transact(func(tx *DB) error {
+				attempts++
+				return test.errors[attempts-1]
+			})
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if (err == nil) != (test.expected == nil) || (err != nil && err.Error() != test.expected.Error()) {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+
+			if attempts != len(test.errors) {
+				t.Fatalf("wrong number of attempts. expected %d but got %d", len(test.errors), attempts)
+			}
+		})
+	}
+}
+
+func TestDB_Transact_Nested(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_2").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = (&DB{DB: db}).Transact(func(tx *DB) error {
+		// services beginning their own transaction get a savepoint
+		committed, err := tx.Begin()
+		if err != nil {
+			return err
+		}
+		if err := committed.Commit(); err != nil {
+			return err
+		}
+		// like the deferred rollback after committing
+		if err := committed.Rollback(); err == nil {
+			t.Fatal("expected rolling back a committed savepoint to fail")
+		}
+
+		rolledBack, err := tx.Begin()
+		if err != nil {
+			return err
+		}
+		if err := rolledBack.Rollback(); err != nil {
+			return err
+		}
+
+		// and nested calls run in the outer transaction
+		return tx.Transact(func(inner *DB) error {
+			if inner != tx {
+				t.Fatal("expected the same transaction")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal("cannot run transaction", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOpen_PingRetries(t *testing.T) {
+	// nothing listens on port 1
+	_, err := Open("host=localhost port=1 user=test dbname=test sslmode=disable connect_timeout=1", PoolOptions{PingAttempts: 3, PingBackoff: time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("expected an error after 3 attempts but got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/lib/pq"
+)
+
+// constraint names the services map to app errors
+const (
+	usersEmailConstraint     = "users_email_lower_key"
+	usersUsernameConstraint  = "users_username_key"
+	articlesSlugConstraint   = "articles_slug_key"
+	workspacesSlugConstraint = "workspaces_slug_key"
+)
+
+// constraintErrors maps Postgres error codes to app constraint errors.
+var constraintErrors = map[pq.ErrorCode]error{
+	"23505": app.ErrUniqueViolation,
+	"23503": app.ErrForeignKeyViolation,
+	"23502": app.ErrNotNullViolation,
+	"23514": app.ErrCheckViolation,
+}
+
+// translateError turns constraint violations into app.ConstraintError, other
+// errors are returned as is.
+func translateError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	constraintErr, ok := constraintErrors[pqErr.Code]
+	if !ok {
+		return err
+	}
+
+	constraint := pqErr.Constraint
+	if constraint == "" {
+		// not-null violations name the column instead
+		constraint = pqErr.Column
+	}
+	return &app.ConstraintError{Err: constraintErr, Constraint: constraint}
+}
+
+// isConstraint reports whether err violates the named constraint.
+func isConstraint(err error, constraint string) bool {
+	constraintErr, ok := translateError(err).(*app.ConstraintError)
+	return ok && constraintErr.Constraint == constraint
+}
+
+// userConstraintError maps conflicts on the users table to the app errors
+// clients understand.
+func userConstraintError(err error) error {
+	switch {
+	case isConstraint(err, usersEmailConstraint):
+		return app.ErrEmailAlreadyUsed
+	case isConstraint(err, usersUsernameConstraint):
+		return app.ErrUsernameAlreadyUsed
+	}
+	return translateError(err)
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"strings"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.IdentityService = &IdentityService{}
+
+// IdentityService represents a service to sign users in with external identity providers.
+type IdentityService struct {
+	db *DB
+}
+
+// NewIdentityService returns a new instance of IdentityService.
+func NewIdentityService(db *DB) *IdentityService {
+	return &IdentityService{
+		db: db,
+	}
+}
+
+const identityUserColumns = "users.id, users.username, users.email, users.password, users.created_at, users.updated_at, EXISTS (SELECT 1 FROM user_totp WHERE user_id = users.id AND confirmed_at IS NOT NULL)"
+
+func (s *IdentityService) Login(u *app.ExternalUser) (*app.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// known identity
+	user, twoFactorEnabled, err := scanIdentityUser(tx.QueryRow("SELECT "+identityUserColumns+" FROM identities JOIN users ON users.id = identities.user_id WHERE identities.provider = $1 AND identities.subject = $2", u.Provider, u.Subject))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err == sql.ErrNoRows {
+		// linking by email is only safe if the provider vouches for it,
+		// otherwise anyone could take over an account
+		if u.Email == "" || !u.EmailVerified {
+			return nil, app.ErrEmailNotVerified
+		}
+
+		user, twoFactorEnabled, err = scanIdentityUser(tx.QueryRow("SELECT "+identityUserColumns+" FROM users WHERE LOWER(email) = LOWER($1) LIMIT 1", u.Email))
+		if err == sql.ErrNoRows {
+			user, err = signUpExternalUser(tx, u)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec("INSERT INTO identities (user_id, provider, subject, email, created_at) VALUES ($1, $2, $3, $4, $5)", user.ID, u.Provider, u.Subject, u.Email, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if twoFactorEnabled {
+		return user, app.ErrTwoFactorRequired
+	}
+	return user, nil
+}
+
+func scanIdentityUser(row scanner) (*app.User, bool, error) {
+	var user app.User
+	var twoFactorEnabled bool
+	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &twoFactorEnabled); err != nil {
+		return nil, false, err
+	}
+	return &user, twoFactorEnabled, nil
+}
+
+// signUpExternalUser creates a user without a password; they can only sign
+// in through their identity provider.
+func signUpExternalUser(tx querier, u *app.ExternalUser) (*app.User, error) {
+	now := time.Now()
+	user := &app.User{
+		Username:  externalUsername(u),
+		Email:     u.Email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// usernames are unique, a taken one gets a random suffix
+	row := tx.QueryRow("INSERT INTO users (username, email, password, created_at, updated_at) VALUES (CASE WHEN EXISTS (SELECT 1 FROM users WHERE username = $1) THEN LEFT($1, 43) || '-' || SUBSTR(MD5(RANDOM()::text), 1, 6) ELSE $1 END, $2, $3, $4, $5) RETURNING id, username", user.Username, user.Email, "", user.CreatedAt, user.UpdatedAt)
+	if err := row.Scan(&user.ID, &user.Username); err != nil {
+		return nil, userConstraintError(err)
+	}
+
+	return user, nil
+}
+
+func externalUsername(u *app.ExternalUser) string {
+	username := strings.TrimSpace(u.Username)
+	if username == "" {
+		username = strings.SplitN(u.Email, "@", 2)[0]
+	}
+	if runes := []rune(username); len(runes) > 50 {
+		username = string(runes[:50])
+	}
+	return username
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+)
+
+func TestIdentityServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	s := NewIdentityService(db)
+
+	t.Run("signs up and signs in again", func(t *testing.T) {
+		external := app.ExternalUser{Provider: "stub", Subject: "new-subject", Email: "new@test.com", EmailVerified: true, Username: "new"}
+
+		user, err := s.Login(&external)
+		if err != nil {
+			t.Fatal("cannot sign up", err)
+		}
+		if user.ID == 0 || user.Email != "new@test.com" || user.Username != "new" {
+			t.Fatalf("wrong user %v", user)
+		}
+
+		// later logins don't depend on the email anymore
+		external.Email = "changed@test.com"
+		external.EmailVerified = false
+		again, err := s.Login(&external)
+		if err != nil || again.ID != user.ID {
+			t.Fatalf("expected user %v but got %v (%v)", user.ID, again, err)
+		}
+
+		// an external account can't log in with a password
+		if _, err := NewUserService(db, testRing(t)).Login(&app.User{Email: "new@test.com", Password: ""}); err != app.ErrWrongCredentials {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+		}
+	})
+
+	t.Run("links existing account", func(t *testing.T) {
+		userId := createUser(db, t)
+
+		var email string
+		if err := db.QueryRow("SELECT email FROM users WHERE id = $1", userId).Scan(&email); err != nil {
+			t.Fatal("cannot read user", err)
+		}
+
+		if _, err := s.Login(&app.ExternalUser{Provider: "stub", Subject: "unverified", Email: email}); err != app.ErrEmailNotVerified {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrEmailNotVerified, err)
+		}
+
+		user, err := s.Login(&app.ExternalUser{Provider: "stub", Subject: "existing", Email: email, EmailVerified: true})
+		if err != nil || user.ID != userId {
+			t.Fatalf("expected user %v but got %v (%v)", userId, user, err)
+		}
+	})
+}
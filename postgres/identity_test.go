@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+var identityUserRows = []string{"id", "username", "email", "password", "created_at", "updated_at", "exists"}
+
+func TestIdentityService_Login(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	verified := app.ExternalUser{Provider: "stub", Subject: "sub", Email: "test@test.com", EmailVerified: true, Username: "test"}
+	unverified := verified
+	unverified.EmailVerified = false
+
+	tests := []struct {
+		name     string
+		external app.ExternalUser
+		expect   func()
+		userId   uint32
+		error    error
+	}{
+		{
+			name:     "known identity",
+			external: unverified,
+			expect: func() {
+				mock.ExpectQuery("^SELECT (.+) FROM identities JOIN users*").WithArgs("stub", "sub").WillReturnRows(sqlmock.NewRows(identityUserRows).AddRow(1, "test", "test@test.com", "hash", now, now, false))
+				mock.ExpectCommit()
+			},
+			userId: 1,
+			error:  nil,
+		},
+		{
+			name:     "known identity with two-factor",
+			external: verified,
+			expect: func() {
+				mock.ExpectQuery("^SELECT (.+) FROM identities JOIN users*").WillReturnRows(sqlmock.NewRows(identityUserRows).AddRow(1, "test", "test@test.com", "hash", now, now, true))
+				mock.ExpectCommit()
+			},
+			userId: 1,
+			error:  app.ErrTwoFactorRequired,
+		},
+		{
+			name:     "links existing email",
+			external: verified,
+			expect: func() {
+				mock.ExpectQuery("^SELECT (.+) FROM identities JOIN users*").WillReturnRows(sqlmock.NewRows(identityUserRows))
+				mock.ExpectQuery("^SELECT (.+) FROM users WHERE LOWER\\(email\\)*").WithArgs("test@test.com").WillReturnRows(sqlmock.NewRows(identityUserRows).AddRow(2, "test", "test@test.com", "hash", now, now, false))
+				mock.ExpectExec("^INSERT INTO identities*").WithArgs(2, "stub", "sub", "test@test.com", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			userId: 2,
+			error:  nil,
+		},
+		{
+			name:     "signs up new user",
+			external: verified,
+			expect: func() {
+				mock.ExpectQuery("^SELECT (.+) FROM identities JOIN users*").WillReturnRows(sqlmock.NewRows(identityUserRows))
+				mock.ExpectQuery("^SELECT (.+) FROM users WHERE LOWER\\(email\\)*").WillReturnRows(sqlmock.NewRows(identityUserRows))
+				mock.ExpectQuery("^INSERT INTO users (.+) RETURNING id").WithArgs("test", "test@test.com", "", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(3, "test"))
+				mock.ExpectExec("^INSERT INTO identities*").WithArgs(3, "stub", "sub", "test@test.com", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			userId: 3,
+			error:  nil,
+		},
+		{
+			name:     "unverified email",
+			external: unverified,
+			expect: func() {
+				mock.ExpectQuery("^SELECT (.+) FROM identities JOIN users*").WillReturnRows(sqlmock.NewRows(identityUserRows))
+				mock.ExpectRollback()
+			},
+			userId: 0,
+			error:  app.ErrEmailNotVerified,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectBegin()
+			test.expect()
+
+			s := NewIdentityService(&DB{DB: db})
+
+			user, err := s.Login(&test.external)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if test.userId != 0 && user.ID != test.userId {
+				t.Fatalf("wrong user id. Expected %v but got %v", test.userId, user.ID)
+			}
+		})
+	}
+}
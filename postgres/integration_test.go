@@ -37,7 +37,7 @@ func (s *TestSuite) GetDb(t *testing.T) *DB {
 
 	dbUrl := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", s.config.DbHost, s.config.DbPort, s.config.DbUser, s.config.DbName, s.config.DbPassword)
 
-	db, err := Open(dbUrl)
+	db, err := Open(dbUrl, DefaultPoolOptions)
 	if err != nil {
 		t.Fatal("cannot connect to db", err)
 	}
@@ -55,6 +55,10 @@ func (s *TestSuite) CleanDb(t *testing.T) {
 	if err != nil {
 		t.Fatal("error deleting users", err)
 	}
+	_, err = s.db.Exec("DELETE FROM outbox WHERE true")
+	if err != nil {
+		t.Fatal("error deleting events", err)
+	}
 }
 
 func loadConfig() (Config, error) {
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/lib/pq"
+	"log"
+	"strconv"
+	"time"
+)
+
+// outboxChannel is notified of the id of every event written to the outbox,
+// by a trigger, when its transaction commits.
+const outboxChannel = "outbox"
+
+const (
+	// listenerPingInterval is how often an idle listener checks its
+	// connection is still alive.
+	listenerPingInterval = 90 * time.Second
+
+	// catchUpMargin is how long before the last notification we look for
+	// events missed while reconnecting. Events are created before their
+	// transactions commit, so ones committing later may be older.
+	catchUpMargin = time.Minute
+
+	// maxCatchUpEvents bounds the events published after reconnecting.
+	maxCatchUpEvents = 1000
+)
+
+// EventListener publishes the events of the outbox in the order they're
+// committed, by any instance.
+type EventListener struct {
+	db       *DB
+	listener *pq.Listener
+	publish  func(e *app.Event)
+
+	since time.Time // of the last notification
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// ListenEvents listens for the events of the outbox on a connection of its
+// own to dataSourceName, passing them to publish until Close is called.
+func ListenEvents(db *DB, dataSourceName string, publish func(e *app.Event)) (*EventListener, error) {
+	listener := pq.NewListener(dataSourceName, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("postgres: event listener: %s", err)
+		}
+	})
+	if err := listener.Listen(outboxChannel); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	l := &EventListener{
+		db:       db,
+		listener: listener,
+		publish:  publish,
+		since:    time.Now(),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+func (l *EventListener) run() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case n := <-l.listener.Notify:
+			var err error
+			if n == nil {
+				// the connection was lost, notifications sent meanwhile too
+				err = l.catchUp()
+			} else {
+				err = l.notified(n.Extra)
+			}
+			if err != nil {
+				log.Printf("postgres: cannot publish events: %s", err)
+			}
+		case <-ticker.C:
+			go func() { _ = l.listener.Ping() }()
+		}
+	}
+}
+
+// notified publishes the event with the id of a notification.
+func (l *EventListener) notified(payload string) error {
+	l.since = time.Now()
+
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	e, err := scanEvent(l.db.QueryRow("SELECT id, type, workspace_id, data, created_at FROM outbox WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		// purged already
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	l.publish(e)
+	return nil
+}
+
+// catchUp publishes the events that may have been missed while the
+// connection was lost. Subscribers ignore the ones they got already.
+func (l *EventListener) catchUp() error {
+	rows, err := l.db.Query("SELECT id, type, workspace_id, data, created_at FROM outbox WHERE created_at > $1 ORDER BY id LIMIT $2", l.since.Add(-catchUpMargin), maxCatchUpEvents)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var events []*app.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		l.publish(e)
+	}
+	return nil
+}
+
+// Close stops listening.
+func (l *EventListener) Close() error {
+	close(l.done)
+	<-l.stopped
+	return l.listener.Close()
+}
+
+func scanEvent(row scanner) (*app.Event, error) {
+	e := &app.Event{}
+	if err := row.Scan(&e.ID, &e.Type, &e.WorkspaceId, &e.Data, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
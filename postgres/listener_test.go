@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestEventListener_Notified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var published []*app.Event
+	l := &EventListener{db: &DB{DB: db}, publish: func(e *app.Event) { published = append(published, e) }}
+	now := time.Now()
+
+	columns := []string{"id", "type", "workspace_id", "data", "created_at"}
+	mock.ExpectQuery("^SELECT (.+) FROM outbox WHERE id = \\$1").WithArgs(3).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, app.EventArticleCreated, 1, []byte(`{"slug":"hello"}`), now))
+	// purged before we got to it
+	mock.ExpectQuery("^SELECT (.+) FROM outbox WHERE id = \\$1").WithArgs(4).WillReturnRows(sqlmock.NewRows(columns))
+
+	if err := l.notified("3"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if err := l.notified("4"); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if err := l.notified("x"); err == nil {
+		t.Fatal("expected an error for an invalid payload")
+	}
+
+	if len(published) != 1 || published[0].ID != 3 || string(published[0].Data) != `{"slug":"hello"}` {
+		t.Fatalf("wrong events published %+v", published)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEventListener_CatchUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var published []int64
+	since := time.Now()
+	l := &EventListener{db: &DB{DB: db}, publish: func(e *app.Event) { published = append(published, e.ID) }, since: since}
+
+	mock.ExpectQuery("^SELECT (.+) FROM outbox WHERE created_at > \\$1 ORDER BY id").WithArgs(since.Add(-catchUpMargin), maxCatchUpEvents).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "workspace_id", "data", "created_at"}).
+			AddRow(5, app.EventArticleUpdated, 1, []byte(`{}`), since).
+			AddRow(6, app.EventArticleDeleted, 1, []byte(`{}`), since))
+
+	if err := l.catchUp(); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if len(published) != 2 || published[0] != 5 || published[1] != 6 {
+		t.Fatalf("wrong events published %v", published)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.LoginThrottle = &LoginThrottleService{}
+
+const (
+	emailScope = "email"
+	ipScope    = "ip"
+)
+
+// LoginThrottlePolicy configures when failed logins get delayed and locked out.
+type LoginThrottlePolicy struct {
+	FreeAttempts int           // failures per account before delays start
+	BaseDelay    time.Duration // first delay, doubled on every further failure
+	MaxDelay     time.Duration
+	LockAfter    int // failures per account before it gets locked
+	LockDuration time.Duration
+	IPLockAfter  int           // failures per IP, over all accounts, before it gets locked
+	Window       time.Duration // failures older than this are forgotten
+}
+
+// DefaultLoginThrottlePolicy is used unless configured otherwise.
+var DefaultLoginThrottlePolicy = LoginThrottlePolicy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	LockAfter:    10,
+	LockDuration: 15 * time.Minute,
+	IPLockAfter:  100,
+	Window:       time.Hour,
+}
+
+// accountBlock returns how long an account is blocked after failures
+// consecutive failures, and whether that is a lockout.
+func (p LoginThrottlePolicy) accountBlock(failures int) (time.Duration, bool) {
+	if failures >= p.LockAfter {
+		return p.LockDuration, true
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, false
+}
+
+// LoginThrottleService represents a service to throttle failed logins.
+type LoginThrottleService struct {
+	db     *DB
+	policy LoginThrottlePolicy
+
+	Mailer app.Mailer // optional, tells users their account got locked
+
+	notifications sync.WaitGroup
+}
+
+// NewLoginThrottleService returns a new instance of LoginThrottleService.
+func NewLoginThrottleService(db *DB, policy LoginThrottlePolicy) *LoginThrottleService {
+	return &LoginThrottleService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func (s *LoginThrottleService) Check(email string, ip string) (time.Duration, error) {
+	var lockedUntil *time.Time
+	err := s.db.QueryRow("SELECT MAX(locked_until) FROM login_attempts WHERE (scope = $1 AND key = $2) OR (scope = $3 AND key = $4)", emailScope, normalizeEmail(email), ipScope, ip).Scan(&lockedUntil)
+	if err != nil {
+		return 0, err
+	}
+
+	if lockedUntil != nil {
+		if wait := time.Until(*lockedUntil); wait > 0 {
+			return wait, app.ErrTooManyLoginAttempts
+		}
+	}
+	return 0, nil
+}
+
+func (s *LoginThrottleService) Failed(email string, ip string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+
+	failures, err := recordFailure(tx, emailScope, normalizeEmail(email), now, s.policy.Window)
+	if err != nil {
+		return err
+	}
+
+	var locked *app.User
+	if block, lockout := s.policy.accountBlock(failures); block > 0 {
+		until := now.Add(block)
+		if _, err := tx.Exec("UPDATE login_attempts SET locked_until = $1 WHERE scope = $2 AND key = $3", until, emailScope, normalizeEmail(email)); err != nil {
+			return err
+		}
+
+		if lockout {
+			var user app.User
+			err := tx.QueryRow("UPDATE users SET locked_until = $1 WHERE LOWER(email) = LOWER($2) RETURNING id, username, email", until, email).Scan(&user.ID, &user.Username, &user.Email)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err == nil {
+				locked = &user
+			}
+		}
+	}
+
+	ipFailures, err := recordFailure(tx, ipScope, ip, now, s.policy.Window)
+	if err != nil {
+		return err
+	}
+	if ipFailures >= s.policy.IPLockAfter {
+		if _, err := tx.Exec("UPDATE login_attempts SET locked_until = $1 WHERE scope = $2 AND key = $3", now.Add(s.policy.LockDuration), ipScope, ip); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// in the background, so failures take as long whether the email is
+	// registered or not
+	if locked != nil && s.Mailer != nil {
+		s.notifications.Add(1)
+		go func() {
+			defer s.notifications.Done()
+			s.notifyLockout(locked, now.Add(s.policy.LockDuration))
+		}()
+	}
+	return nil
+}
+
+// Succeeded forgets the account's failures. Those of the IP are kept, so
+// a valid account can't be used to reset them.
+func (s *LoginThrottleService) Succeeded(email string, ip string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE scope = $1 AND key = $2", emailScope, normalizeEmail(email))
+	return err
+}
+
+func (s *LoginThrottleService) Unlock(userId uint32) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var email string
+	err = tx.QueryRow("UPDATE users SET locked_until = NULL WHERE id = $1 RETURNING email", userId).Scan(&email)
+	if err == sql.ErrNoRows {
+		return app.ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM login_attempts WHERE scope = $1 AND key = $2", emailScope, normalizeEmail(email)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Wait waits for the lockout notifications being sent.
+func (s *LoginThrottleService) Wait() {
+	s.notifications.Wait()
+}
+
+// notifyLockout emails the owner of a locked account. Failing to do so
+// doesn't fail the login attempt.
+func (s *LoginThrottleService) notifyLockout(user *app.User, until time.Time) {
+	body := fmt.Sprintf("Hi %s,\n\nYour account has been locked until %s after too many failed login attempts.\nIf this wasn't you, consider changing your password once it is unlocked.\n", user.Username, until.UTC().Format(time.RFC1123))
+	if err := s.Mailer.Send(user.Email, "Your account has been locked", body); err != nil {
+		log.Printf("cannot send lockout notification to user %d: %s", user.ID, err)
+	}
+}
+
+// recordFailure counts a failure, starting over if the last one is older
+// than window, and returns the number of failures.
+func recordFailure(tx querier, scope string, key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+	err := tx.QueryRow("INSERT INTO login_attempts (scope, key, failures, last_failed_at) VALUES ($1, $2, 1, $3) ON CONFLICT (scope, key) DO UPDATE SET failures = CASE WHEN login_attempts.last_failed_at < $4 THEN 1 ELSE login_attempts.failures + 1 END, last_failed_at = $3 RETURNING failures", scope, key, now, now.Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
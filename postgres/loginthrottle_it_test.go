@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+	if _, err := db.Exec("DELETE FROM login_attempts WHERE true"); err != nil {
+		t.Fatal("error deleting login attempts", err)
+	}
+
+	userId := createUser(db, t)
+
+	policy := DefaultLoginThrottlePolicy
+	policy.BaseDelay = time.Millisecond
+	policy.MaxDelay = time.Millisecond
+	s := NewLoginThrottleService(db, policy)
+
+	for i := 0; i < policy.LockAfter; i++ {
+		if err := s.Failed("test@test.com", "10.0.0.1"); err != nil {
+			t.Fatal("cannot record failure", err)
+		}
+	}
+
+	if _, err := s.Check("TEST@test.com", "10.0.0.2"); err != app.ErrTooManyLoginAttempts {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrTooManyLoginAttempts, err)
+	}
+
+	// unknown emails are throttled the same way
+	for i := 0; i < policy.LockAfter; i++ {
+		if err := s.Failed("unknown@test.com", "10.0.0.3"); err != nil {
+			t.Fatal("cannot record failure", err)
+		}
+	}
+	if _, err := s.Check("unknown@test.com", "10.0.0.4"); err != app.ErrTooManyLoginAttempts {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrTooManyLoginAttempts, err)
+	}
+
+	var lockedUntil *time.Time
+	if err := db.QueryRow("SELECT locked_until FROM users WHERE id = $1", userId).Scan(&lockedUntil); err != nil || lockedUntil == nil {
+		t.Fatalf("expected account to be locked (%v)", err)
+	}
+
+	if err := s.Unlock(userId); err != nil {
+		t.Fatal("cannot unlock", err)
+	}
+
+	if _, err := s.Check("test@test.com", "10.0.0.2"); err != nil {
+		t.Fatal("expected unlocked account to be allowed", err)
+	}
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	appmock "github.com/leartgjoni/go-rest-template/mock"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottlePolicy_AccountBlock(t *testing.T) {
+	p := DefaultLoginThrottlePolicy
+
+	tests := []struct {
+		failures int
+		block    time.Duration
+		lockout  bool
+	}{
+		{failures: 1, block: 0, lockout: false},
+		{failures: 3, block: 0, lockout: false},
+		{failures: 4, block: time.Second, lockout: false},
+		{failures: 5, block: 2 * time.Second, lockout: false},
+		{failures: 6, block: 4 * time.Second, lockout: false},
+		{failures: 9, block: 32 * time.Second, lockout: false},
+		{failures: 10, block: 15 * time.Minute, lockout: true},
+	}
+
+	for _, test := range tests {
+		block, lockout := p.accountBlock(test.failures)
+		if block != test.block || lockout != test.lockout {
+			t.Fatalf("wrong block for %d failures. expected %v %v but got %v %v", test.failures, test.block, test.lockout, block, lockout)
+		}
+	}
+
+	p.MaxDelay = 3 * time.Second
+	if block, _ := p.accountBlock(9); block != 3*time.Second {
+		t.Fatalf("expected delay to be capped but got %v", block)
+	}
+}
+
+func TestLoginThrottleService_Check(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name        string
+		lockedUntil interface{}
+		error       error
+	}{
+		{
+			name:        "never failed",
+			lockedUntil: nil,
+			error:       nil,
+		},
+		{
+			name:        "block expired",
+			lockedUntil: time.Now().Add(-time.Second),
+			error:       nil,
+		},
+		{
+			name:        "blocked",
+			lockedUntil: time.Now().Add(time.Minute),
+			error:       app.ErrTooManyLoginAttempts,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectQuery("^SELECT MAX\\(locked_until\\) FROM login_attempts*").WithArgs("email", "test@test.com", "ip", "10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(test.lockedUntil))
+
+			s := NewLoginThrottleService(&DB{DB: db}, DefaultLoginThrottlePolicy)
+
+			wait, err := s.Check(" Test@Test.com", "10.0.0.1")
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if (err != nil) != (wait > 0) {
+				t.Fatalf("wrong wait %v", wait)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleService_Failed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name        string
+		failures    int
+		ipFailures  int
+		expect      func()
+		mailInvoked bool
+	}{
+		{
+			name:        "free attempt",
+			failures:    1,
+			ipFailures:  1,
+			expect:      func() {},
+			mailInvoked: false,
+		},
+		{
+			name:       "delayed",
+			failures:   4,
+			ipFailures: 4,
+			expect: func() {
+				mock.ExpectExec("^UPDATE login_attempts SET locked_until*").WithArgs(sqlmock.AnyArg(), "email", "test@test.com").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			mailInvoked: false,
+		},
+		{
+			name:       "locked out",
+			failures:   10,
+			ipFailures: 10,
+			expect: func() {
+				mock.ExpectExec("^UPDATE login_attempts SET locked_until*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("^UPDATE users SET locked_until*").WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(1, "test", "test@test.com"))
+			},
+			mailInvoked: true,
+		},
+		{
+			name:       "unknown email locked out",
+			failures:   10,
+			ipFailures: 10,
+			expect: func() {
+				mock.ExpectExec("^UPDATE login_attempts SET locked_until*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("^UPDATE users SET locked_until*").WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}))
+			},
+			mailInvoked: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectQuery("^INSERT INTO login_attempts*").WithArgs("email", "test@test.com", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(test.failures))
+			test.expect()
+			mock.ExpectQuery("^INSERT INTO login_attempts*").WithArgs("ip", "10.0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(test.ipFailures))
+			mock.ExpectCommit()
+
+			mailer := &appmock.Mailer{SendFn: func(to string, subject string, body string) error {
+				if to != "test@test.com" {
+					t.Fatalf("wrong recipient %s", to)
+				}
+				return nil
+			}}
+			s := NewLoginThrottleService(&DB{DB: db}, DefaultLoginThrottlePolicy)
+			s.Mailer = mailer
+
+			if err := s.Failed("test@test.com", "10.0.0.1"); err != nil {
+				t.Fatal("cannot record failure", err)
+			}
+			s.Wait()
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if mailer.SendInvoked != test.mailInvoked {
+				t.Fatalf("expected SendInvoked to be %v", test.mailInvoked)
+			}
+		})
+	}
+
+	t.Run("ip locked out", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^INSERT INTO login_attempts*").WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+		mock.ExpectQuery("^INSERT INTO login_attempts*").WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(100))
+		mock.ExpectExec("^UPDATE login_attempts SET locked_until*").WithArgs(sqlmock.AnyArg(), "ip", "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		s := NewLoginThrottleService(&DB{DB: db}, DefaultLoginThrottlePolicy)
+		if err := s.Failed("other@test.com", "10.0.0.1"); err != nil {
+			t.Fatal("cannot record failure", err)
+		}
+
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+func TestLoginThrottleService_Unlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("unlocked", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^UPDATE users SET locked_until = NULL*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("Test@test.com"))
+		mock.ExpectExec("^DELETE FROM login_attempts*").WithArgs("email", "test@test.com").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		s := NewLoginThrottleService(&DB{DB: db}, DefaultLoginThrottlePolicy)
+		if err := s.Unlock(1); err != nil {
+			t.Fatal("cannot unlock", err)
+		}
+
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^UPDATE users SET locked_until = NULL*").WillReturnRows(sqlmock.NewRows([]string{"email"}))
+		mock.ExpectRollback()
+
+		s := NewLoginThrottleService(&DB{DB: db}, DefaultLoginThrottlePolicy)
+		if err := s.Unlock(1); err != app.ErrUserNotFound {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+		}
+
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+CREATE TABLE user_totp(
+                      user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                      secret TEXT NOT NULL,
+                      last_used_step BIGINT NOT NULL DEFAULT 0,
+                      confirmed_at TIMESTAMPTZ,
+                      created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE user_recovery_codes(
+                      id serial PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      code_hash VARCHAR (64) NOT NULL,
+                      used_at TIMESTAMPTZ,
+                      created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX user_recovery_codes_user_id_idx ON user_recovery_codes (user_id);
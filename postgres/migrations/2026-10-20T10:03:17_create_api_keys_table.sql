@@ -0,0 +1,15 @@
+CREATE TABLE api_keys(
+                      id serial PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      name VARCHAR (100) NOT NULL,
+                      prefix VARCHAR (32) UNIQUE NOT NULL,
+                      key_hash VARCHAR (64) NOT NULL,
+                      scopes TEXT[] NOT NULL DEFAULT '{}',
+                      expires_at TIMESTAMPTZ,
+                      last_used_at TIMESTAMPTZ,
+                      last_used_ip VARCHAR (45),
+                      revoked_at TIMESTAMPTZ,
+                      created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE signing_keys(
+                      id VARCHAR (64) PRIMARY KEY,
+                      algorithm VARCHAR (16) NOT NULL,
+                      private_key BYTEA NOT NULL,
+                      active BOOLEAN NOT NULL DEFAULT false,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      rotated_at TIMESTAMPTZ,
+                      retired_at TIMESTAMPTZ
+);
+
+-- at most one key signs at a time
+CREATE UNIQUE INDEX signing_keys_active_idx ON signing_keys (active) WHERE active;
@@ -0,0 +1,11 @@
+CREATE TABLE identities(
+                      id serial PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      provider VARCHAR (50) NOT NULL,
+                      subject VARCHAR (255) NOT NULL,
+                      email VARCHAR (255),
+                      created_at TIMESTAMPTZ NOT NULL,
+                      UNIQUE (provider, subject)
+);
+
+CREATE INDEX identities_user_id_idx ON identities (user_id);
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- failed logins, per email (scope 'email') and per client IP (scope 'ip')
+CREATE TABLE login_attempts(
+                      scope VARCHAR (10) NOT NULL,
+                      key VARCHAR (255) NOT NULL,
+                      failures INTEGER NOT NULL DEFAULT 0,
+                      last_failed_at TIMESTAMPTZ NOT NULL,
+                      locked_until TIMESTAMPTZ,
+                      PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+-- tokens issued before this are rejected, e.g. after a password change
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMPTZ;
+
+-- profiles are looked up by username, so it has to be unique
+UPDATE users SET username = LEFT(username, 39) || '-' || id
+WHERE id NOT IN (SELECT MIN(id) FROM users GROUP BY username);
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
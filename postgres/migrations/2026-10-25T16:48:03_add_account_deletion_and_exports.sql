@@ -0,0 +1,23 @@
+-- anonymised articles outlive their author
+ALTER TABLE articles ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE articles DROP CONSTRAINT articles_user_id_fkey;
+ALTER TABLE articles ADD CONSTRAINT articles_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE users ADD COLUMN delete_after TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN deletion_articles VARCHAR (10);
+ALTER TABLE users ADD COLUMN deletion_transfer_to INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
+
+CREATE TABLE data_exports(
+                      id serial PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      status VARCHAR (10) NOT NULL,
+                      archive BYTEA,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      completed_at TIMESTAMPTZ,
+                      expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+CREATE INDEX data_exports_pending_idx ON data_exports (created_at) WHERE status = 'pending';
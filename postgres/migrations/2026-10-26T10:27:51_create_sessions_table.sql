@@ -0,0 +1,11 @@
+CREATE TABLE sessions(
+                      id VARCHAR (32) PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      user_agent VARCHAR (255) NOT NULL DEFAULT '',
+                      ip VARCHAR (45) NOT NULL DEFAULT '',
+                      revoked_at TIMESTAMPTZ,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      last_seen_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,13 @@
+-- emails differing only in case belong to the same person, accounts sharing
+-- one have to be merged by hand before the index can be created
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM users GROUP BY LOWER(email) HAVING COUNT(*) > 1) THEN
+        RAISE EXCEPTION 'users with emails differing only in case exist, see SELECT LOWER(email) FROM users GROUP BY LOWER(email) HAVING COUNT(*) > 1';
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX users_email_lower_key ON users (LOWER(email));
+
+-- implied by the new index
+ALTER TABLE users DROP CONSTRAINT users_email_key;
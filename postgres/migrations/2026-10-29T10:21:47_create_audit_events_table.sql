@@ -0,0 +1,30 @@
+-- actor_id isn't a foreign key, events outlive the users they mention
+CREATE TABLE audit_events(
+                      id bigserial PRIMARY KEY,
+                      action VARCHAR (50) NOT NULL,
+                      actor_id INTEGER,
+                      target VARCHAR (255) NOT NULL DEFAULT '',
+                      ip VARCHAR (45) NOT NULL DEFAULT '',
+                      user_agent VARCHAR (255) NOT NULL DEFAULT '',
+                      request_id VARCHAR (100) NOT NULL DEFAULT '',
+                      -- JSON rather than JSONB keeps the text as hashed
+                      before JSON,
+                      after JSON,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      hash CHAR (64) NOT NULL
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_target_idx ON audit_events (target, id);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
@@ -0,0 +1,32 @@
+CREATE TABLE workspaces(
+                      id serial PRIMARY KEY,
+                      slug VARCHAR (63) UNIQUE NOT NULL,
+                      name VARCHAR (255) NOT NULL,
+                      created_at TIMESTAMPTZ NOT NULL
+);
+
+-- existing articles move to the default workspace
+INSERT INTO workspaces (id, slug, name, created_at) VALUES (1, 'default', 'Default', NOW());
+SELECT setval('workspaces_id_seq', 1);
+
+CREATE TABLE workspace_members(
+                      workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE NOT NULL,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      role VARCHAR (10) NOT NULL,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX workspace_members_user_id_idx ON workspace_members (user_id);
+
+ALTER TABLE articles ADD COLUMN workspace_id INTEGER NOT NULL DEFAULT 1 REFERENCES workspaces(id) ON DELETE CASCADE;
+CREATE INDEX articles_workspace_id_idx ON articles (workspace_id, id) WHERE deleted_at IS NULL;
+
+-- Row-level security backs up the workspace filter of every query, for
+-- roles other than the table owner and when the app sets app.workspace_id
+-- (see DB_ROW_LEVEL_SECURITY). Without the setting, e.g. for account
+-- deletion, every row is visible.
+ALTER TABLE articles ENABLE ROW LEVEL SECURITY;
+CREATE POLICY articles_workspace_isolation ON articles
+    USING (NULLIF(current_setting('app.workspace_id', true), '') IS NULL
+           OR workspace_id = current_setting('app.workspace_id', true)::integer);
@@ -0,0 +1,49 @@
+-- events are written with the changes causing them, and queued for their
+-- webhooks by the dispatcher
+CREATE TABLE outbox(
+                      id bigserial PRIMARY KEY,
+                      type VARCHAR (50) NOT NULL,
+                      workspace_id INTEGER NOT NULL,
+                      data JSON NOT NULL,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      queued_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_unqueued_idx ON outbox (id) WHERE queued_at IS NULL;
+
+CREATE TABLE webhooks(
+                      id serial PRIMARY KEY,
+                      url VARCHAR (2048) NOT NULL,
+                      secret VARCHAR (255) NOT NULL,
+                      events VARCHAR (50)[] NOT NULL DEFAULT '{}',
+                      workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+                      active BOOLEAN NOT NULL DEFAULT TRUE,
+                      created_at TIMESTAMPTZ NOT NULL,
+                      updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE webhook_deliveries(
+                      id bigserial PRIMARY KEY,
+                      webhook_id INTEGER REFERENCES webhooks(id) ON DELETE CASCADE NOT NULL,
+                      event_id BIGINT REFERENCES outbox(id) ON DELETE CASCADE NOT NULL,
+                      status VARCHAR (10) NOT NULL,
+                      attempts INTEGER NOT NULL DEFAULT 0,
+                      next_attempt_at TIMESTAMPTZ NOT NULL,
+                      last_error TEXT NOT NULL DEFAULT '',
+                      updated_at TIMESTAMPTZ NOT NULL,
+                      UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_event_id_idx ON webhook_deliveries (event_id);
+
+CREATE TABLE webhook_attempts(
+                      id bigserial PRIMARY KEY,
+                      delivery_id BIGINT REFERENCES webhook_deliveries(id) ON DELETE CASCADE NOT NULL,
+                      status_code INTEGER NOT NULL DEFAULT 0,
+                      error TEXT NOT NULL DEFAULT '',
+                      duration_ms INTEGER NOT NULL,
+                      created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX webhook_attempts_delivery_id_idx ON webhook_attempts (delivery_id, id);
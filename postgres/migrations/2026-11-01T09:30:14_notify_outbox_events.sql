@@ -0,0 +1,11 @@
+-- notifies listeners of every event when its transaction commits, so clients
+-- streaming changes get them from whichever instance they're connected to
+CREATE FUNCTION outbox_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('outbox', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER outbox_notify AFTER INSERT ON outbox
+    FOR EACH ROW EXECUTE PROCEDURE outbox_notify();
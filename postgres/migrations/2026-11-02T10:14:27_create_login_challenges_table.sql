@@ -0,0 +1,9 @@
+CREATE TABLE login_challenges(
+                      jti VARCHAR (32) PRIMARY KEY,
+                      user_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+                      attempts INTEGER NOT NULL DEFAULT 0,
+                      used_at TIMESTAMPTZ,
+                      expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX login_challenges_user_id_idx ON login_challenges (user_id);
@@ -0,0 +1,9 @@
+-- private keys are stored encrypted; the ones stored in clear before are
+-- encrypted by the server on start
+ALTER TABLE signing_keys ADD COLUMN encrypted_private_key TEXT;
+ALTER TABLE signing_keys ALTER COLUMN private_key DROP NOT NULL;
+
+-- rotated keys are published before they sign
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMPTZ;
+UPDATE signing_keys SET activates_at = created_at;
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"encoding/json"
+	app "github.com/leartgjoni/go-rest-template"
+	"time"
+)
+
+// writeEvent adds an event to the outbox. It must run in the transaction of
+// the write causing it, so the event exists if and only if the write does.
+func writeEvent(tx *DB, eventType string, workspaceId uint32, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO outbox (type, workspace_id, data, created_at) VALUES ($1, $2, $3, $4)", eventType, workspaceId, b, time.Now())
+	return err
+}
+
+// articleColumns are returned by writes to articles, for their events.
+const articleColumns = "id, slug, title, body, COALESCE(user_id, 0), workspace_id, created_at, updated_at, deleted_at"
+
+// queryArticles runs a write to articles returning articleColumns, and
+// returns the articles written.
+func queryArticles(tx *DB, query string, args ...interface{}) ([]*app.Article, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []*app.Article
+	for rows.Next() {
+		var a app.Article
+		if err := rows.Scan(&a.ID, &a.Slug, &a.Title, &a.Body, &a.UserId, &a.WorkspaceId, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt); err != nil {
+			return nil, err
+		}
+		articles = append(articles, &a)
+	}
+	return articles, rows.Err()
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// poolQueries counts the queries each pool served, published at
+// /debug/vars as postgres_pool_queries, e.g. {"primary": 10, "replica1": 25}.
+var poolQueries = expvar.NewMap("postgres_pool_queries")
+
+// ReplicaOptions configure how reads are routed to replicas.
+type ReplicaOptions struct {
+	// Unhealthy replicas are pinged this often and used again once they
+	// answer. Healthy ones are pinged as well, so a replica that went away
+	// is noticed before a query fails on it.
+	HealthCheckInterval time.Duration
+
+	// LogQueries logs the pool serving each query.
+	LogQueries bool
+}
+
+// DefaultReplicaOptions notice a replica going away or coming back within
+// seconds.
+var DefaultReplicaOptions = ReplicaOptions{
+	HealthCheckInterval: 5 * time.Second,
+}
+
+// replica is a read-only pool.
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy int32 // atomic, 1 if queries may use it
+}
+
+// replicas routes the reads of a DB and its transactions.
+type replicas struct {
+	pools []*replica
+	next  uint32 // atomic, round-robin counter
+	opts  ReplicaOptions
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// OpenReplica returns a DB reference for a replica, without waiting for it
+// to answer: UseReplicas reads from the primary until it does.
+func OpenReplica(dataSourceName string, opts PoolOptions) (*DB, error) {
+	db, err := open(dataSourceName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: db}, nil
+}
+
+// UseReplicas routes the reads of services that allow it to the replicas,
+// round-robin among the healthy ones. Replicas not answering yet are
+// unhealthy until a health check reaches them, and queries failing on a
+// replica because it can't be reached run on the primary instead. Close
+// closes the replicas as well.
+func (db *DB) UseReplicas(opts ReplicaOptions, pools ...*DB) {
+	rs := &replicas{
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	for i, p := range pools {
+		r := &replica{name: fmt.Sprintf("replica%d", i+1), db: p.DB, healthy: 1}
+		r.setHealthy(p.DB.Ping())
+		rs.pools = append(rs.pools, r)
+	}
+	db.replicas = rs
+
+	if opts.HealthCheckInterval > 0 {
+		rs.wg.Add(1)
+		go rs.checkHealth()
+	}
+}
+
+// Close closes the primary and the replicas.
+func (db *DB) Close() error {
+	if rs := db.replicas; rs != nil {
+		rs.closeOnce.Do(func() {
+			close(rs.done)
+			rs.wg.Wait()
+			for _, r := range rs.pools {
+				_ = r.db.Close()
+			}
+		})
+	}
+	return db.DB.Close()
+}
+
+func (rs *replicas) checkHealth() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-ticker.C:
+			for _, r := range rs.pools {
+				r.setHealthy(r.db.Ping())
+			}
+		}
+	}
+}
+
+func (r *replica) setHealthy(err error) {
+	if err == nil {
+		if atomic.SwapInt32(&r.healthy, 1) == 0 {
+			log.Printf("postgres: %s is back", r.name)
+		}
+		return
+	}
+	if atomic.SwapInt32(&r.healthy, 0) == 1 {
+		log.Printf("postgres: %s is unavailable, reading from the primary: %s", r.name, err)
+	}
+}
+
+// pick returns the next healthy replica, or nil if there is none.
+func (rs *replicas) pick() *replica {
+	n := uint32(len(rs.pools))
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := uint32(0); i < n; i++ {
+		r := rs.pools[(start+i)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r
+		}
+	}
+	return nil
+}
+
+// primary returns a copy of db whose reads don't go to replicas, e.g. for
+// a user who just wrote and has to read their writes.
+func (db *DB) primary() *DB {
+	p := *db
+	p.fromPrimary = true
+	return &p
+}
+
+// reader returns where to run read-only queries: a healthy replica, unless
+// the DB reads from the primary. A transaction always reads from itself.
+func (db *DB) reader() querier {
+	if db.tx != nil || db.replicas == nil || db.fromPrimary {
+		return db
+	}
+	r := db.replicas.pick()
+	if r == nil {
+		return db
+	}
+	return &replicaReader{primary: db, replica: r}
+}
+
+// replicaReader runs queries on a replica, falling back to the primary.
+type replicaReader struct {
+	primary *DB
+	replica *replica
+}
+
+func (rr *replicaReader) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("writes can't run on a replica")
+}
+
+func (rr *replicaReader) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := rr.replica.db.Query(query, args...)
+	if isUnavailable(err) {
+		rr.replica.setHealthy(err)
+		return rr.primary.Query(query, args...)
+	}
+	rr.primary.served(rr.replica.name, query)
+	return rows, err
+}
+
+func (rr *replicaReader) QueryRow(query string, args ...interface{}) *sql.Row {
+	row := rr.replica.db.QueryRow(query, args...)
+	if err := row.Err(); isUnavailable(err) {
+		rr.replica.setHealthy(err)
+		return rr.primary.QueryRow(query, args...)
+	}
+	rr.primary.served(rr.replica.name, query)
+	return row
+}
+
+// served counts a query of a pool, and logs it if asked to.
+func (db *DB) served(pool string, query string) {
+	poolQueries.Add(pool, 1)
+	if db.replicas != nil && db.replicas.opts.LogQueries {
+		log.Printf("postgres: %s: %s", pool, strings.Join(strings.Fields(query), " "))
+	}
+}
+
+// isUnavailable reports whether a query failed because the server can't be
+// reached, rather than because of the query.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == driver.ErrBadConn {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		// connection_exception, and the server shutting down or starting
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	return false
+}
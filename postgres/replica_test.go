@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"net"
+	"testing"
+	"time"
+)
+
+const getArticleQuery = "SELECT id, slug, title, body, COALESCE\\(user_id, 0\\), workspace_id, created_at, updated_at FROM articles WHERE slug = \\$1 AND workspace_id = \\$2"
+
+func newTestReplicas(t *testing.T) (*DB, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	return newTestReplicasPinged(t, nil)
+}
+
+// newTestReplicasPinged opens a primary and a replica answering the first
+// ping with pingErr.
+func newTestReplicasPinged(t *testing.T, pingErr error) (*DB, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	primary, primaryMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	replica, replicaMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	replicaMock.ExpectPing().WillReturnError(pingErr)
+
+	db := &DB{DB: primary}
+	db.UseReplicas(ReplicaOptions{}, &DB{DB: replica})
+	return db, primaryMock, replicaMock
+}
+
+func articleRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}).
+		AddRow(1, "title-abc", "title", "body", 1, app.DefaultWorkspaceId, time.Now(), time.Now())
+}
+
+// expectDelete expects an article to be deleted, with its event.
+func expectDelete(mock sqlmock.Sqlmock, slug string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE articles SET deleted_at = \\$1 WHERE slug = \\$2 AND workspace_id = \\$3").WithArgs(sqlmock.AnyArg(), slug, app.DefaultWorkspaceId).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at", "deleted_at"}).AddRow(1, slug, "title", "body", 1, app.DefaultWorkspaceId, time.Now(), time.Now(), time.Now()))
+	mock.ExpectExec("^INSERT INTO outbox").WithArgs(app.EventArticleDeleted, app.DefaultWorkspaceId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestDB_Replicas(t *testing.T) {
+	db, primaryMock, replicaMock := newTestReplicas(t)
+	defer db.Close()
+	s := NewArticleService(db)
+
+	// reads go to the replica
+	replicaMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	if _, err := s.GetBySlug("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// writes go to the primary
+	expectDelete(primaryMock, "title-abc")
+	if err := s.Delete("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// and so do the reads of clients who have to read their writes
+	primaryMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if _, err := s.FromPrimary().GetBySlug("title-abc"); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+	}
+
+	// while the others still read from the replica
+	replicaMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	if _, err := s.GetBySlug("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDB_Replicas_UnreachableAtStart(t *testing.T) {
+	db, primaryMock, replicaMock := newTestReplicasPinged(t, &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}})
+	defer db.Close()
+	s := NewArticleService(db)
+
+	// the replica didn't answer, so reads go to the primary
+	primaryMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	if _, err := s.GetBySlug("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// until a health check reaches it
+	replicaMock.ExpectPing()
+	db.replicas.pools[0].setHealthy(db.replicas.pools[0].db.Ping())
+	replicaMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	if _, err := s.GetBySlug("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDB_Replicas_Fallback(t *testing.T) {
+	db, primaryMock, replicaMock := newTestReplicas(t)
+	defer db.Close()
+	s := NewArticleService(db)
+
+	poolQueries.Add("primary", 0)
+	before := poolQueries.Get("primary").String()
+
+	// the replica is down, so the query runs on the primary
+	replicaMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}})
+	primaryMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	if _, err := s.GetBySlug("title-abc"); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// and so do the next ones, until a health check gets an answer
+	primaryMock.ExpectQuery("SELECT (.+) FROM articles WHERE workspace_id = \\$1 AND deleted_at IS NULL ORDER BY id").WillReturnRows(articleRows())
+	if _, err := s.GetAll(); err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	if poolQueries.Get("primary").String() == before {
+		t.Fatal("expected primary queries to be counted")
+	}
+
+	// we make sure that all expectations were met
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDB_Replicas_Transaction(t *testing.T) {
+	db, primaryMock, replicaMock := newTestReplicas(t)
+	defer db.Close()
+
+	// transactions read what they wrote
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectQuery(getArticleQuery).WithArgs("title-abc", app.DefaultWorkspaceId).WillReturnRows(articleRows())
+	primaryMock.ExpectCommit()
+	err := db.Transact(func(tx *DB) error {
+		_, err := NewArticleService(tx).GetBySlug("title-abc")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("wrong error. expected %v but got %s", nil, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
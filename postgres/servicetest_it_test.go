@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"github.com/leartgjoni/go-rest-template/servicetest"
+	"testing"
+)
+
+func TestServicesIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	servicetest.Run(t, func(t *testing.T) *servicetest.Services {
+		db := Suite.GetDb(t)
+		Suite.CleanDb(t)
+
+		return &servicetest.Services{
+			Users:    NewUserService(db, testRing(t)),
+			Articles: NewArticleService(db),
+			Sessions: NewSessionService(db, 0),
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package postgres
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"sync"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.SessionService = &SessionService{}
+
+// DefaultSessionCacheTTL is how long a session check is remembered. Sessions
+// revoked through another instance keep working for up to this long.
+const DefaultSessionCacheTTL = 30 * time.Second
+
+// SessionService represents a service to manage the sessions of logged in users.
+type SessionService struct {
+	db       *DB
+	cacheTTL time.Duration
+	cache    *sessionCache
+}
+
+// sessionCache is shared by the copies of a service running in
+// transactions, so their revocations drop its entries.
+type sessionCache struct {
+	mu        sync.Mutex
+	entries   map[string]sessionCacheEntry
+	lastSweep time.Time
+}
+
+type sessionCacheEntry struct {
+	err     error
+	expires time.Time
+}
+
+// NewSessionService returns a new instance of SessionService.
+func NewSessionService(db *DB, cacheTTL time.Duration) *SessionService {
+	return &SessionService{
+		db:       db,
+		cacheTTL: cacheTTL,
+		cache:    &sessionCache{entries: map[string]sessionCacheEntry{}},
+	}
+}
+
+// withDB returns a copy of the service running its queries on db, e.g. in
+// a transaction.
+func (s *SessionService) withDB(db *DB) *SessionService {
+	return &SessionService{
+		db:       db,
+		cacheTTL: s.cacheTTL,
+		cache:    s.cache,
+	}
+}
+
+// Touch validates the session and updates its last seen time, at most once
+// per cache TTL.
+func (s *SessionService) Touch(session *app.Session) error {
+	if err, ok := s.cached(session.ID); ok {
+		return err
+	}
+
+	err := s.touch(session)
+	if err != nil && err != app.ErrWrongCredentials {
+		return err
+	}
+
+	s.remember(session.ID, err)
+	return err
+}
+
+func (s *SessionService) touch(session *app.Session) error {
+	now := time.Now()
+	userAgent := session.UserAgent
+	if runes := []rune(userAgent); len(runes) > 255 {
+		userAgent = string(runes[:255])
+	}
+
+	var valid bool
+	err := s.db.QueryRow("UPDATE sessions SET user_agent = $1, ip = $2, last_seen_at = $3 WHERE id = $4 AND user_id = $5 RETURNING revoked_at IS NULL", userAgent, session.IP, now, session.ID, session.UserId).Scan(&valid)
+	if err == nil {
+		if !valid {
+			return app.ErrWrongCredentials
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	// The first request of a session records it, unless the user is gone or
+	// revoked their sessions after the token was issued.
+	result, err := s.db.Exec("INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen_at) SELECT $1, id, $3, $4, $5, $6 FROM users WHERE id = $2 AND (tokens_valid_after IS NULL OR tokens_valid_after <= $5) ON CONFLICT (id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at WHERE sessions.revoked_at IS NULL", session.ID, session.UserId, userAgent, session.IP, session.CreatedAt, now)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrWrongCredentials
+	}
+
+	// sessions outlive their tokens only until here
+	if _, err := s.db.Exec("DELETE FROM sessions WHERE user_id = $1 AND created_at < $2", session.UserId, now.Add(-keyring.TokenTTL)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// List returns the user's sessions whose tokens haven't expired, most
+// recently used first.
+func (s *SessionService) List(userId uint32) ([]*app.Session, error) {
+	rows, err := s.db.Query("SELECT id, user_id, user_agent, ip, created_at, last_seen_at FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND created_at > $2 ORDER BY last_seen_at DESC", userId, time.Now().Add(-keyring.TokenTTL))
+	if err != nil {
+		return []*app.Session{}, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	sessions := []*app.Session{}
+	for rows.Next() {
+		var session app.Session
+		if err := rows.Scan(&session.ID, &session.UserId, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return []*app.Session{}, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *SessionService) Revoke(userId uint32, id string) error {
+	result, err := s.db.Exec("UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL", time.Now(), id, userId)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrSessionNotFound
+	}
+
+	s.db.afterCommit(func() { s.forget(id) })
+	return nil
+}
+
+// RevokeOthers also rejects the user's tokens that haven't been used yet.
+func (s *SessionService) RevokeOthers(userId uint32, currentId string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// tokens carry their issue time in seconds
+	now := time.Now().Truncate(time.Second)
+	rows, err := tx.Query("UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL RETURNING id", now, userId, currentId)
+	if err != nil {
+		return err
+	}
+	var revoked []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		revoked = append(revoked, id)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET tokens_valid_after = $1 WHERE id = $2", now, userId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// in a transaction, a check before it commits would cache the session
+	// again
+	s.db.afterCommit(func() {
+		for _, id := range revoked {
+			s.forget(id)
+		}
+	})
+	return nil
+}
+
+func (s *SessionService) cached(id string) (error, bool) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	entry, ok := s.cache.entries[id]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.err, true
+}
+
+func (s *SessionService) remember(id string, err error) {
+	if s.cacheTTL <= 0 {
+		return
+	}
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	now := time.Now()
+	// drop expired entries now and then, so the cache doesn't grow unbounded
+	if now.Sub(s.cache.lastSweep) > s.cacheTTL {
+		for k, entry := range s.cache.entries {
+			if now.After(entry.expires) {
+				delete(s.cache.entries, k)
+			}
+		}
+		s.cache.lastSweep = now
+	}
+	s.cache.entries[id] = sessionCacheEntry{err: err, expires: now.Add(s.cacheTTL)}
+}
+
+func (s *SessionService) forget(id string) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	delete(s.cache.entries, id)
+}
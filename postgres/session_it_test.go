@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestSessionServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	userId := createUser(db, t)
+	s := NewSessionService(db, 0)
+
+	// tokens only have second precision
+	issuedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	current := &app.Session{ID: "current", UserId: userId, UserAgent: "curl", IP: "10.0.0.1", CreatedAt: issuedAt}
+	other := &app.Session{ID: "other", UserId: userId, UserAgent: "firefox", IP: "10.0.0.2", CreatedAt: issuedAt}
+	for _, session := range []*app.Session{current, other, current} {
+		if err := s.Touch(session); err != nil {
+			t.Fatal("cannot touch session", err)
+		}
+	}
+
+	sessions, err := s.List(userId)
+	if err != nil {
+		t.Fatal("cannot list sessions", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "current" || sessions[1].UserAgent != "firefox" || !sessions[1].CreatedAt.Equal(issuedAt) {
+		t.Fatalf("wrong sessions %v", sessions)
+	}
+
+	if err := s.Revoke(userId+1, "other"); err != app.ErrSessionNotFound {
+		t.Fatal("expected other users not to revoke the session", err)
+	}
+	if err := s.Revoke(userId, "other"); err != nil {
+		t.Fatal("cannot revoke session", err)
+	}
+	if err := s.Touch(other); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+
+	// a token that was issued but not used yet
+	unused := &app.Session{ID: "unused", UserId: userId, CreatedAt: issuedAt}
+	if err := s.RevokeOthers(userId, "current"); err != nil {
+		t.Fatal("cannot revoke other sessions", err)
+	}
+	if err := s.Touch(unused); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+	if err := s.Touch(current); err != nil {
+		t.Fatal("current session should stay valid", err)
+	}
+
+	// deleted users have no sessions
+	if err := s.Touch(&app.Session{ID: "deleted", UserId: userId + 1, CreatedAt: time.Now()}); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+}
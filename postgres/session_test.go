@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestSessionService_Touch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name         string
+		updateResult *sqlmock.Rows
+		insertResult driver.Result
+		error        error
+	}{
+		{
+			name:         "known session",
+			updateResult: sqlmock.NewRows([]string{"valid"}).AddRow(true),
+			error:        nil,
+		},
+		{
+			name:         "revoked session",
+			updateResult: sqlmock.NewRows([]string{"valid"}).AddRow(false),
+			error:        app.ErrWrongCredentials,
+		},
+		{
+			name:         "first request",
+			updateResult: sqlmock.NewRows([]string{"valid"}),
+			insertResult: sqlmock.NewResult(0, 1),
+			error:        nil,
+		},
+		{
+			name:         "issued before sessions were revoked",
+			updateResult: sqlmock.NewRows([]string{"valid"}),
+			insertResult: sqlmock.NewResult(0, 0),
+			error:        app.ErrWrongCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectQuery("^UPDATE sessions SET (.+) RETURNING revoked_at IS NULL").WithArgs("curl", "127.0.0.1", sqlmock.AnyArg(), "abc", 1).WillReturnRows(test.updateResult)
+			if test.insertResult != nil {
+				mock.ExpectExec("^INSERT INTO sessions (.+) SELECT (.+) FROM users WHERE id = (.+) AND \\(tokens_valid_after*").WillReturnResult(test.insertResult)
+			}
+			if test.insertResult != nil && test.error == nil {
+				mock.ExpectExec("^DELETE FROM sessions WHERE user_id*").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			s := NewSessionService(&DB{DB: db}, time.Minute)
+			session := &app.Session{ID: "abc", UserId: 1, UserAgent: "curl", IP: "127.0.0.1", CreatedAt: time.Now()}
+
+			err := s.Touch(session)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			// the second check is answered from the cache
+			if err := s.Touch(session); err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+		})
+	}
+}
+
+func TestSessionService_Revoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewSessionService(&DB{DB: db}, time.Minute)
+	session := &app.Session{ID: "abc", UserId: 1, CreatedAt: time.Now()}
+
+	mock.ExpectQuery("^UPDATE sessions SET (.+) RETURNING revoked_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"valid"}).AddRow(true))
+	if err := s.Touch(session); err != nil {
+		t.Fatal("cannot touch session", err)
+	}
+
+	mock.ExpectExec("^UPDATE sessions SET revoked_at = (.+) WHERE id = (.+) AND user_id*").WithArgs(sqlmock.AnyArg(), "abc", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.Revoke(1, "abc"); err != nil {
+		t.Fatal("cannot revoke session", err)
+	}
+
+	// revoking drops the cached result
+	mock.ExpectQuery("^UPDATE sessions SET (.+) RETURNING revoked_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"valid"}).AddRow(false))
+	if err := s.Touch(session); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+
+	mock.ExpectExec("^UPDATE sessions SET revoked_at = (.+) WHERE id = (.+) AND user_id*").WithArgs(sqlmock.AnyArg(), "abc", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.Revoke(1, "abc"); err != app.ErrSessionNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrSessionNotFound, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSessionService_RevokeOthers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^UPDATE sessions SET revoked_at = (.+) WHERE user_id = (.+) AND id <> (.+) RETURNING id").WithArgs(sqlmock.AnyArg(), 1, "abc").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("def"))
+	mock.ExpectExec("^UPDATE users SET tokens_valid_after*").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	s := NewSessionService(&DB{DB: db}, time.Minute)
+	s.remember("def", nil)
+
+	if err := s.RevokeOthers(1, "abc"); err != nil {
+		t.Fatal("cannot revoke sessions", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if _, ok := s.cached("def"); ok {
+		t.Fatal("revoked session should not be cached")
+	}
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"testing"
+)
+
+func TestSigningKeyServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+	if _, err := db.Exec("DELETE FROM signing_keys WHERE true"); err != nil {
+		t.Fatal("error deleting signing keys", err)
+	}
+
+	s := NewSigningKeyService(db, testEncryptionKey)
+	ring := keyring.New(s)
+
+	first, err := s.Rotate(app.AlgorithmRS256)
+	if err != nil {
+		t.Fatal("cannot rotate", err)
+	}
+
+	token, err := ring.Sign(jwt.MapClaims{"userId": 1})
+	if err != nil {
+		t.Fatal("cannot sign", err)
+	}
+
+	second, err := s.Rotate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot rotate", err)
+	}
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatal("cannot list keys", err)
+	}
+	if len(keys) != 2 || keys[0].ID != second.ID || !keys[0].Active || keys[1].ID != first.ID || keys[1].Active || keys[1].RotatedAt == nil {
+		t.Fatalf("wrong keys %v", keys)
+	}
+
+	// the new key is published before it signs
+	if second.ActivatesAt.Before(first.ActivatesAt.Add(keyring.PublishDelay)) {
+		t.Fatalf("expected the new key to activate after %s but got %s", keyring.PublishDelay, second.ActivatesAt)
+	}
+
+	// tokens signed before the rotation keep verifying
+	if err := ring.Load(); err != nil {
+		t.Fatal("cannot load keys", err)
+	}
+	if _, err := ring.Parse(token); err != nil {
+		t.Fatal("expected rotated key to verify", err)
+	}
+}
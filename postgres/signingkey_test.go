@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"testing"
+	"time"
+)
+
+var sharedTestRing *keyring.Ring
+
+// testRing returns a ring with a single EdDSA key, shared by every test so
+// tokens issued by one service verify in another.
+func testRing(t *testing.T) *keyring.Ring {
+	if sharedTestRing != nil {
+		return sharedTestRing
+	}
+
+	k, err := keyring.Generate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot generate signing key", err)
+	}
+	k.Active = true
+
+	sharedTestRing = keyring.New(&mock.SigningKeyService{
+		KeysFn: func() ([]*app.SigningKey, error) { return []*app.SigningKey{k}, nil },
+	})
+	return sharedTestRing
+}
+
+func TestSigningKeyService_Keys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	k, err := keyring.Generate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot generate signing key", err)
+	}
+	der, err := keyring.MarshalPrivateKey(k.PrivateKey)
+	if err != nil {
+		t.Fatal("cannot marshal signing key", err)
+	}
+	encrypted, err := encrypt(testEncryptionKey, string(der))
+	if err != nil {
+		t.Fatal("cannot encrypt signing key", err)
+	}
+	rotated, err := keyring.Generate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot generate signing key", err)
+	}
+	rotatedDer, err := keyring.MarshalPrivateKey(rotated.PrivateKey)
+	if err != nil {
+		t.Fatal("cannot marshal signing key", err)
+	}
+
+	// keys stored before encryption are read as well
+	mock.ExpectQuery("^SELECT (.+) FROM signing_keys WHERE retired_at IS NULL*").WillReturnRows(sqlmock.NewRows([]string{"id", "algorithm", "private_key", "encrypted_private_key", "active", "created_at", "activates_at", "rotated_at"}).
+		AddRow(k.ID, k.Algorithm, nil, encrypted, true, k.CreatedAt, k.ActivatesAt, nil).
+		AddRow(rotated.ID, rotated.Algorithm, rotatedDer, nil, false, rotated.CreatedAt, rotated.ActivatesAt, k.CreatedAt))
+
+	s := NewSigningKeyService(&DB{DB: db}, testEncryptionKey)
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatal("cannot list keys", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if len(keys) != 2 || keys[0].ID != k.ID || !keys[0].Active || keys[0].PrivateKey == nil || keys[1].ID != rotated.ID || keys[1].PrivateKey == nil {
+		t.Fatalf("wrong keys %v", keys)
+	}
+}
+
+func TestSigningKeyService_Rotate(t *testing.T) {
+	tests := []struct {
+		name      string
+		rotated   int64
+		published bool
+	}{
+		{
+			name:      "first key",
+			rotated:   0,
+			published: false,
+		},
+		{
+			name:      "next key",
+			rotated:   1,
+			published: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("^UPDATE signing_keys SET retired_at*").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("^UPDATE signing_keys SET active = false*").WillReturnResult(sqlmock.NewResult(0, test.rotated))
+			mock.ExpectExec("^INSERT INTO signing_keys*").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			s := NewSigningKeyService(&DB{DB: db}, testEncryptionKey)
+
+			k, err := s.Rotate(app.AlgorithmEdDSA)
+			if err != nil {
+				t.Fatal("cannot rotate", err)
+			}
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if !k.Active || k.ID == "" || k.Algorithm != app.AlgorithmEdDSA {
+				t.Fatalf("wrong key %v", k)
+			}
+			if published := k.ActivatesAt.After(time.Now()); published != test.published {
+				t.Fatalf("expected published to be %v but activates at %s", test.published, k.ActivatesAt)
+			}
+
+			if _, err := s.Rotate("HS256"); err != app.ErrUnsupportedAlgorithm {
+				t.Fatalf("wrong error. expected %s but got %s", app.ErrUnsupportedAlgorithm, err)
+			}
+		})
+	}
+}
+
+func TestSigningKeyService_EncryptKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT id, private_key FROM signing_keys WHERE private_key IS NOT NULL FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "private_key"}).AddRow("kid-1", []byte("der")))
+	mock.ExpectExec("^UPDATE signing_keys SET encrypted_private_key = \\$1, private_key = NULL WHERE id = \\$2").WithArgs(sqlmock.AnyArg(), "kid-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	s := NewSigningKeyService(&DB{DB: db}, testEncryptionKey)
+	if err := s.EncryptKeys(); err != nil {
+		t.Fatal("cannot encrypt keys", err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
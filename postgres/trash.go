@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.ArticleTrashService = &ArticleTrashService{}
+var _ app.WorkspaceTrash = &ArticleTrashService{}
+
+// DefaultTrashRetention is how long deleted articles can be restored.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// ArticleTrashService represents a service to manage the articles of a
+// workspace deleted with ArticleService.Delete.
+type ArticleTrashService struct {
+	db          *DB
+	retention   time.Duration
+	workspaceId uint32
+}
+
+// NewArticleTrashService returns a new instance of ArticleTrashService, for
+// the default workspace.
+func NewArticleTrashService(db *DB, retention time.Duration) *ArticleTrashService {
+	return &ArticleTrashService{
+		db:          db,
+		retention:   retention,
+		workspaceId: app.DefaultWorkspaceId,
+	}
+}
+
+// InWorkspace returns the service for the deleted articles of another
+// workspace.
+func (s *ArticleTrashService) InWorkspace(workspaceId uint32) app.ArticleTrashService {
+	scoped := *s
+	scoped.workspaceId = workspaceId
+	return &scoped
+}
+
+func (s *ArticleTrashService) Trash(userId uint32) ([]*app.Article, error) {
+	rows, err := s.db.Query("SELECT id, slug, title, body, user_id, workspace_id, created_at, updated_at, deleted_at FROM articles WHERE user_id = $1 AND workspace_id = $2 AND deleted_at > $3 ORDER BY deleted_at DESC, id DESC", userId, s.workspaceId, s.cutoff())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := []*app.Article{}
+	for rows.Next() {
+		var a app.Article
+		if err := rows.Scan(&a.ID, &a.Slug, &a.Title, &a.Body, &a.UserId, &a.WorkspaceId, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt); err != nil {
+			return nil, err
+		}
+		articles = append(articles, &a)
+	}
+	return articles, rows.Err()
+}
+
+// Restore undeletes an article of the user, as long as it's still in the
+// trash. Articles of others aren't found.
+func (s *ArticleTrashService) Restore(userId uint32, slug string) (*app.Article, error) {
+	var a app.Article
+	err := s.db.Transact(func(tx *DB) error {
+		err := tx.QueryRow("UPDATE articles SET deleted_at = NULL WHERE slug = $1 AND user_id = $2 AND workspace_id = $3 AND deleted_at > $4 RETURNING id, slug, title, body, user_id, workspace_id, created_at, updated_at", slug, userId, s.workspaceId, s.cutoff()).Scan(&a.ID, &a.Slug, &a.Title, &a.Body, &a.UserId, &a.WorkspaceId, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return writeEvent(tx, app.EventArticleRestored, a.WorkspaceId, &a)
+	})
+	if err == sql.ErrNoRows {
+		return nil, app.ErrArticleNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// PurgeTrash purges the trash of every workspace.
+func (s *ArticleTrashService) PurgeTrash() (int, error) {
+	var n int
+	err := s.db.Transact(func(tx *DB) error {
+		articles, err := queryArticles(tx, "DELETE FROM articles WHERE deleted_at <= $1 RETURNING "+articleColumns, s.cutoff())
+		if err != nil {
+			return err
+		}
+		for _, a := range articles {
+			if err := writeEvent(tx, app.EventArticlePurged, a.WorkspaceId, a); err != nil {
+				return err
+			}
+		}
+		n = len(articles)
+		return nil
+	})
+	return n, err
+}
+
+// cutoff is when articles deleted earlier are gone for good.
+func (s *ArticleTrashService) cutoff() time.Time {
+	return time.Now().Add(-s.retention)
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestArticleTrashServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	userId := createUser(db, t)
+	as := NewArticleService(db)
+	ts := NewArticleTrashService(db, time.Hour)
+
+	kept := &app.Article{Title: "kept", Body: "body", UserId: userId, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	trashed := &app.Article{Title: "trashed", Body: "body", UserId: userId, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for _, a := range []*app.Article{kept, trashed} {
+		if err := as.Save(a); err != nil {
+			t.Fatal("cannot save article", err)
+		}
+	}
+
+	if err := as.Delete(trashed.Slug); err != nil {
+		t.Fatal("cannot delete article", err)
+	}
+
+	// deleted articles are only in the trash
+	articles, err := as.GetAll()
+	if err != nil || len(articles) != 1 || articles[0].ID != kept.ID {
+		t.Fatalf("wrong articles %v, %v", articles, err)
+	}
+	trash, err := ts.Trash(userId)
+	if err != nil || len(trash) != 1 || trash[0].ID != trashed.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("wrong trash %v, %v", trash, err)
+	}
+	if trash, err := ts.InWorkspace(app.DefaultWorkspaceId + 1).Trash(userId); err != nil || len(trash) != 0 {
+		t.Fatalf("expected the trash of other workspaces to be empty but got %v, %v", trash, err)
+	}
+	if err := as.Update(&app.Article{Slug: trashed.Slug, Title: "new", Body: "new"}); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+	}
+
+	if _, err := ts.Restore(userId+1, trashed.Slug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+	}
+	restored, err := ts.Restore(userId, trashed.Slug)
+	if err != nil || restored.ID != trashed.ID {
+		t.Fatalf("wrong article %v, %v", restored, err)
+	}
+	if _, err := as.GetBySlug(trashed.Slug); err != nil {
+		t.Fatal("expected the restored article to be found", err)
+	}
+
+	// articles deleted before the retention period are purged
+	if err := as.Delete(trashed.Slug); err != nil {
+		t.Fatal("cannot delete article", err)
+	}
+	if _, err := db.Exec("UPDATE articles SET deleted_at = $1 WHERE id = $2", time.Now().Add(-2*time.Hour), trashed.ID); err != nil {
+		t.Fatal("cannot age article", err)
+	}
+	if n, err := ts.PurgeTrash(); err != nil || n != 1 {
+		t.Fatalf("expected one article to be purged but got %d, %v", n, err)
+	}
+	if trash, _ := ts.Trash(userId); len(trash) != 0 {
+		t.Fatalf("expected an empty trash but got %v", trash)
+	}
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestArticleTrashService_Restore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewArticleTrashService(&DB{DB: db}, time.Hour)
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("^UPDATE articles SET deleted_at = NULL*").WithArgs("hello-abc", 1, app.DefaultWorkspaceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at"}).AddRow(1, "hello-abc", "Hello", "World", 1, app.DefaultWorkspaceId, now, now))
+	mock.ExpectExec("^INSERT INTO outbox").WithArgs(app.EventArticleRestored, app.DefaultWorkspaceId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	article, err := s.Restore(1, "hello-abc")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if article.ID != 1 || article.DeletedAt != nil {
+		t.Fatalf("wrong article %+v", article)
+	}
+
+	// not in the trash, or of another user
+	mock.ExpectBegin()
+	mock.ExpectQuery("^UPDATE articles SET deleted_at = NULL*").WithArgs("hello-abc", 2, app.DefaultWorkspaceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	if _, err := s.Restore(2, "hello-abc"); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+	}
+
+	// or of another workspace
+	mock.ExpectBegin()
+	mock.ExpectQuery("^UPDATE articles SET deleted_at = NULL*").WithArgs("hello-abc", 1, 2, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	if _, err := s.InWorkspace(2).Restore(1, "hello-abc"); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %v", app.ErrArticleNotFound, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestArticleTrashService_PurgeTrash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewArticleTrashService(&DB{DB: db}, time.Hour)
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "slug", "title", "body", "user_id", "workspace_id", "created_at", "updated_at", "deleted_at"})
+	for i := 1; i <= 3; i++ {
+		rows.AddRow(i, "hello", "Hello", "World", 1, app.DefaultWorkspaceId, now, now, now)
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("^DELETE FROM articles WHERE deleted_at <= (.+) RETURNING").WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
+	for i := 1; i <= 3; i++ {
+		mock.ExpectExec("^INSERT INTO outbox").WithArgs(app.EventArticlePurged, app.DefaultWorkspaceId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(int64(i), 1))
+	}
+	mock.ExpectCommit()
+	n, err := s.PurgeTrash()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if n != 3 {
+		t.Fatalf("wrong number of purged articles. expected %d but got %d", 3, n)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
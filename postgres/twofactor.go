@@ -0,0 +1,372 @@
+package postgres
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/totp"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Ensure service implements interface.
+var _ app.TwoFactorService = &TwoFactorService{}
+
+const (
+	// challengeTTL is how long a user has to enter a code after the password step.
+	challengeTTL = 5 * time.Minute
+	// challengePurpose marks challenge tokens so they can't be used to authenticate.
+	challengePurpose = "mfa"
+	// maxChallengeAttempts is how many codes can be tried with a challenge.
+	maxChallengeAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+// TwoFactorService represents a service to manage TOTP two-factor authentication.
+type TwoFactorService struct {
+	db            *DB
+	tokens        *keyring.Ring
+	encryptionKey []byte
+	issuer        string
+}
+
+// NewTwoFactorService returns a new instance of TwoFactorService. TOTP
+// secrets are stored encrypted with encryptionKey (AES-128, 192 or 256).
+func NewTwoFactorService(db *DB, tokens *keyring.Ring, encryptionKey []byte, issuer string) *TwoFactorService {
+	return &TwoFactorService{
+		db:            db,
+		tokens:        tokens,
+		encryptionKey: encryptionKey,
+		issuer:        issuer,
+	}
+}
+
+// Enroll generates a new secret for the user. It only takes effect once
+// confirmed with a first code.
+func (s *TwoFactorService) Enroll(userId uint32) (*app.TOTPEnrollment, error) {
+	var email string
+	var enabled bool
+	err := s.db.QueryRow("SELECT email, EXISTS (SELECT 1 FROM user_totp WHERE user_id = users.id AND confirmed_at IS NOT NULL) FROM users WHERE id = $1", userId).Scan(&email, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		return nil, app.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encrypt(s.encryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec("INSERT INTO user_totp (user_id, secret, last_used_step, created_at) VALUES ($1, $2, 0, $3) ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = EXCLUDED.created_at", userId, encrypted, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &app.TOTPEnrollment{Secret: secret, URI: totp.URI(s.issuer, email, secret)}, nil
+}
+
+// Confirm enables two-factor authentication once the user proves the
+// authenticator app works. It returns the one-time recovery codes, which are
+// only stored hashed.
+func (s *TwoFactorService) Confirm(userId uint32, code string) ([]string, error) {
+	var encrypted string
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRow("SELECT secret, confirmed_at FROM user_totp WHERE user_id = $1", userId).Scan(&encrypted, &confirmedAt)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrTwoFactorNotEnrolled
+	} else if err != nil {
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		return nil, app.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := decrypt(s.encryptionKey, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, app.ErrWrongTwoFactorCode
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE user_totp SET confirmed_at = $1, last_used_step = $2 WHERE user_id = $3", time.Now(), step, userId); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userId); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	for _, c := range codes {
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)", userId, hashRecoveryCode(c), time.Now()); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off. The user has to provide both
+// their password and a current code (or recovery code).
+func (s *TwoFactorService) Disable(userId uint32, password string, code string) error {
+	var hashedPassword string
+	err := s.db.QueryRow("SELECT password FROM users WHERE id = $1", userId).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return app.ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := verifyPassword(hashedPassword, password); err != nil {
+		return app.ErrWrongCredentials
+	}
+
+	if err := s.verifyCode(userId, code); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userId); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_totp WHERE user_id = $1", userId); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateChallenge returns a short-lived token proving the user passed the
+// password step of the login. It can be used once, for a few attempts.
+func (s *TwoFactorService) CreateChallenge(userId uint32) (string, error) {
+	jti, err := keyring.NewId()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec("DELETE FROM login_challenges WHERE user_id = $1 AND expires_at <= $2", userId, now); err != nil {
+		return "", err
+	}
+	if _, err := s.db.Exec("INSERT INTO login_challenges (jti, user_id, expires_at) VALUES ($1, $2, $3)", jti, userId, now.Add(challengeTTL)); err != nil {
+		return "", err
+	}
+
+	return s.tokens.SignPurpose(challengePurpose, userId, challengeTTL, jwt.MapClaims{"jti": jti})
+}
+
+// ChallengeUser returns the id of the user a challenge was issued for,
+// without using it up.
+func (s *TwoFactorService) ChallengeUser(challenge string) (uint32, error) {
+	userId, _, err := s.parseChallenge(challenge)
+	return userId, err
+}
+
+// VerifyChallenge completes a two-step login, returning the id of the user
+// the challenge was issued for. The challenge is used up by a correct code,
+// or by too many wrong ones.
+func (s *TwoFactorService) VerifyChallenge(challenge string, code string) (uint32, error) {
+	userId, jti, err := s.parseChallenge(challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	// counting the attempt first guards against concurrent guesses
+	res, err := s.db.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE jti = $1 AND user_id = $2 AND used_at IS NULL AND attempts < $3 AND expires_at > $4", jti, userId, maxChallengeAttempts, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return 0, app.ErrInvalidChallenge
+	}
+
+	if err := s.verifyCode(userId, code); err != nil {
+		return 0, err
+	}
+
+	res, err = s.db.Exec("UPDATE login_challenges SET used_at = $1 WHERE jti = $2 AND used_at IS NULL", time.Now(), jti)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return 0, app.ErrInvalidChallenge
+	}
+
+	return userId, nil
+}
+
+// parseChallenge returns the user and the id of a challenge token.
+func (s *TwoFactorService) parseChallenge(challenge string) (uint32, string, error) {
+	userId, claims, err := s.tokens.ParsePurpose(challenge, challengePurpose)
+	if err != nil {
+		return 0, "", app.ErrInvalidChallenge
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return 0, "", app.ErrInvalidChallenge
+	}
+
+	return userId, jti, nil
+}
+
+// verifyCode accepts either a TOTP code, which can't be replayed, or an
+// unused recovery code, which gets consumed.
+func (s *TwoFactorService) verifyCode(userId uint32, code string) error {
+	var encrypted string
+	var lastUsedStep int64
+	err := s.db.QueryRow("SELECT secret, last_used_step FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL", userId).Scan(&encrypted, &lastUsedStep)
+	if err == sql.ErrNoRows {
+		return app.ErrTwoFactorNotEnrolled
+	} else if err != nil {
+		return err
+	}
+
+	secret, err := decrypt(s.encryptionKey, encrypted)
+	if err != nil {
+		return err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		if step <= lastUsedStep {
+			return app.ErrWrongTwoFactorCode
+		}
+
+		// the condition on last_used_step guards against concurrent replays
+		res, err := s.db.Exec("UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1", step, userId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			return app.ErrWrongTwoFactorCode
+		}
+		return nil
+	}
+
+	res, err := s.db.Exec("UPDATE user_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL", time.Now(), userId, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return app.ErrWrongTwoFactorCode
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns n random codes formatted as xxxx-xxxx-xxxx-xxxx.
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		h := hex.EncodeToString(b)
+		codes[i] = fmt.Sprintf("%s-%s-%s-%s", h[0:4], h[4:8], h[8:12], h[12:16])
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case, spaces and dashes.
+// The codes carry 64 random bits so a fast hash is enough.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// encrypt seals plaintext with AES-GCM, returning base64(nonce|ciphertext).
+func encrypt(key []byte, plaintext string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// decrypt opens a value sealed by encrypt.
+func decrypt(key []byte, encoded string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/totp"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorServiceIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal("cannot hash password", err)
+	}
+
+	var userId uint32
+	row := db.QueryRow("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", "test", "test@test.com", hashedPassword, time.Now(), time.Now())
+	if err := row.Scan(&userId); err != nil {
+		t.Fatal("error while inserting user", err)
+	}
+
+	us := NewUserService(db, testRing(t))
+	s := NewTwoFactorService(db, testRing(t), testEncryptionKey, "go-rest-template")
+
+	enrollment, err := s.Enroll(userId)
+	if err != nil {
+		t.Fatal("cannot enroll", err)
+	}
+
+	// an unconfirmed enrollment doesn't affect login
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("err with login", err)
+	}
+
+	// the first code is accepted on confirmation and cannot be reused afterwards
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	recoveryCodes, err := s.Confirm(userId, code)
+	if err != nil {
+		t.Fatal("cannot confirm", err)
+	}
+
+	var storedSecret string
+	if err := db.QueryRow("SELECT secret FROM user_totp WHERE user_id = $1", userId).Scan(&storedSecret); err != nil {
+		t.Fatal("cannot read secret", err)
+	}
+	if storedSecret == enrollment.Secret {
+		t.Fatal("secret stored in plain text")
+	}
+
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "password"}); err != app.ErrTwoFactorRequired {
+		t.Fatal("expected two-factor to be required", err)
+	}
+
+	challenge, err := s.CreateChallenge(userId)
+	if err != nil {
+		t.Fatal("cannot create challenge", err)
+	}
+
+	if _, err := s.VerifyChallenge(challenge, code); err != app.ErrWrongTwoFactorCode {
+		t.Fatal("expected replayed code to be rejected", err)
+	}
+
+	// recovery codes work exactly once, and so do challenges
+	id, err := s.VerifyChallenge(challenge, recoveryCodes[0])
+	if err != nil || id != userId {
+		t.Fatalf("expected recovery code to verify user %v but got %v (%v)", userId, id, err)
+	}
+	if _, err := s.VerifyChallenge(challenge, recoveryCodes[1]); err != app.ErrInvalidChallenge {
+		t.Fatal("expected used challenge to be rejected", err)
+	}
+	if challenge, err = s.CreateChallenge(userId); err != nil {
+		t.Fatal("cannot create challenge", err)
+	}
+	if _, err := s.VerifyChallenge(challenge, recoveryCodes[0]); err != app.ErrWrongTwoFactorCode {
+		t.Fatal("expected used recovery code to be rejected", err)
+	}
+
+	// a challenge allows a few attempts only
+	for i := 1; i < maxChallengeAttempts; i++ {
+		if _, err := s.VerifyChallenge(challenge, "000000"); err != app.ErrWrongTwoFactorCode {
+			t.Fatal("expected wrong code to be rejected", err)
+		}
+	}
+	if _, err := s.VerifyChallenge(challenge, recoveryCodes[1]); err != app.ErrInvalidChallenge {
+		t.Fatal("expected challenge to be used up", err)
+	}
+
+	if err := s.Disable(userId, "password-edit", recoveryCodes[1]); err != app.ErrWrongCredentials {
+		t.Fatal("expected wrong password to be rejected", err)
+	}
+	if err := s.Disable(userId, "password", recoveryCodes[1]); err != nil {
+		t.Fatal("cannot disable", err)
+	}
+
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "password"}); err != nil {
+		t.Fatal("err with login after disabling", err)
+	}
+}
@@ -0,0 +1,399 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/totp"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestTwoFactorService_Enroll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name      string
+		sqlResult *sqlmock.Rows
+		inserted  bool
+		error     error
+	}{
+		{
+			name:      "user not found",
+			sqlResult: sqlmock.NewRows([]string{"email", "exists"}),
+			error:     app.ErrUserNotFound,
+		},
+		{
+			name:      "already enabled",
+			sqlResult: sqlmock.NewRows([]string{"email", "exists"}).AddRow("test@test.com", true),
+			error:     app.ErrTwoFactorAlreadyEnabled,
+		},
+		{
+			name:      "success",
+			sqlResult: sqlmock.NewRows([]string{"email", "exists"}).AddRow("test@test.com", false),
+			inserted:  true,
+			error:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectQuery("^SELECT email, (.+) FROM users WHERE id*").WillReturnRows(test.sqlResult)
+			if test.inserted {
+				mock.ExpectExec("^INSERT INTO user_totp *").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			s := NewTwoFactorService(&DB{DB: db}, testRing(t), testEncryptionKey, "go-rest-template")
+
+			enrollment, err := s.Enroll(1)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if err == nil && (enrollment.Secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/go-rest-template:test@test.com?")) {
+				t.Fatalf("wrong enrollment %v", enrollment)
+			}
+		})
+	}
+}
+
+func TestTwoFactorService_Confirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	secret, encrypted := testSecret(t)
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+
+	tests := []struct {
+		name      string
+		sqlResult *sqlmock.Rows
+		code      string
+		confirmed bool
+		error     error
+	}{
+		{
+			name:      "not enrolled",
+			sqlResult: sqlmock.NewRows([]string{"secret", "confirmed_at"}),
+			code:      code,
+			error:     app.ErrTwoFactorNotEnrolled,
+		},
+		{
+			name:      "already enabled",
+			sqlResult: sqlmock.NewRows([]string{"secret", "confirmed_at"}).AddRow(encrypted, time.Now()),
+			code:      code,
+			error:     app.ErrTwoFactorAlreadyEnabled,
+		},
+		{
+			name:      "wrong code",
+			sqlResult: sqlmock.NewRows([]string{"secret", "confirmed_at"}).AddRow(encrypted, nil),
+			code:      "000000x",
+			error:     app.ErrWrongTwoFactorCode,
+		},
+		{
+			name:      "success",
+			sqlResult: sqlmock.NewRows([]string{"secret", "confirmed_at"}).AddRow(encrypted, nil),
+			code:      code,
+			confirmed: true,
+			error:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectQuery("^SELECT secret, confirmed_at FROM user_totp WHERE user_id*").WillReturnRows(test.sqlResult)
+			if test.confirmed {
+				mock.ExpectBegin()
+				mock.ExpectExec("^UPDATE user_totp SET confirmed_at*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("^DELETE FROM user_recovery_codes*").WillReturnResult(sqlmock.NewResult(0, 0))
+				for i := 0; i < recoveryCodeCount; i++ {
+					mock.ExpectExec("^INSERT INTO user_recovery_codes*").WillReturnResult(sqlmock.NewResult(1, 1))
+				}
+				mock.ExpectCommit()
+			}
+
+			s := NewTwoFactorService(&DB{DB: db}, testRing(t), testEncryptionKey, "go-rest-template")
+
+			codes, err := s.Confirm(1, test.code)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if err == nil {
+				if len(codes) != recoveryCodeCount {
+					t.Fatalf("expected %v recovery codes but got %v", recoveryCodeCount, len(codes))
+				}
+				for _, c := range codes {
+					if !regexp.MustCompile(`^[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}-[a-f0-9]{4}$`).MatchString(c) {
+						t.Fatal("recovery code format is wrong", c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTwoFactorService_VerifyChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	secret, encrypted := testSecret(t)
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+
+	s := NewTwoFactorService(&DB{DB: db}, testRing(t), testEncryptionKey, "go-rest-template")
+	mock.ExpectExec("^DELETE FROM login_challenges WHERE user_id*").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO login_challenges*").WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	challenge, err := s.CreateChallenge(1)
+	if err != nil {
+		t.Fatal("cannot create challenge", err)
+	}
+
+	if userId, err := s.ChallengeUser(challenge); err != nil || userId != 1 {
+		t.Fatalf("wrong challenge user %v (%v)", userId, err)
+	}
+
+	tests := []struct {
+		name          string
+		challenge     string
+		code          string
+		attemptResult driver.Result
+		sqlResult     *sqlmock.Rows
+		updateQuery   string
+		updateResult  driver.Result
+		usedResult    driver.Result
+		userId        uint32
+		error         error
+	}{
+		{
+			name:          "totp code",
+			challenge:     challenge,
+			code:          code,
+			attemptResult: sqlmock.NewResult(0, 1),
+			sqlResult:     sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, 0),
+			updateQuery:   "^UPDATE user_totp SET last_used_step*",
+			updateResult:  sqlmock.NewResult(0, 1),
+			usedResult:    sqlmock.NewResult(0, 1),
+			userId:        1,
+			error:         nil,
+		},
+		{
+			name:          "replayed totp code",
+			challenge:     challenge,
+			code:          code,
+			attemptResult: sqlmock.NewResult(0, 1),
+			sqlResult:     sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, step+totp.Skew),
+			error:         app.ErrWrongTwoFactorCode,
+		},
+		{
+			name:          "recovery code",
+			challenge:     challenge,
+			code:          "ABCD-1234-abcd-1234",
+			attemptResult: sqlmock.NewResult(0, 1),
+			sqlResult:     sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, 0),
+			updateQuery:   "^UPDATE user_recovery_codes SET used_at*",
+			updateResult:  sqlmock.NewResult(0, 1),
+			usedResult:    sqlmock.NewResult(0, 1),
+			userId:        1,
+			error:         nil,
+		},
+		{
+			name:          "wrong code",
+			challenge:     challenge,
+			code:          "abcd-1234-abcd-1234",
+			attemptResult: sqlmock.NewResult(0, 1),
+			sqlResult:     sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, 0),
+			updateQuery:   "^UPDATE user_recovery_codes SET used_at*",
+			updateResult:  sqlmock.NewResult(0, 0),
+			error:         app.ErrWrongTwoFactorCode,
+		},
+		{
+			name:          "used up challenge",
+			challenge:     challenge,
+			code:          code,
+			attemptResult: sqlmock.NewResult(0, 0),
+			error:         app.ErrInvalidChallenge,
+		},
+		{
+			name:          "challenge used concurrently",
+			challenge:     challenge,
+			code:          code,
+			attemptResult: sqlmock.NewResult(0, 1),
+			sqlResult:     sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, 0),
+			updateQuery:   "^UPDATE user_totp SET last_used_step*",
+			updateResult:  sqlmock.NewResult(0, 1),
+			usedResult:    sqlmock.NewResult(0, 0),
+			error:         app.ErrInvalidChallenge,
+		},
+		{
+			name:      "invalid challenge",
+			challenge: challenge + "x",
+			code:      code,
+			error:     app.ErrInvalidChallenge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.attemptResult != nil {
+				mock.ExpectExec("^UPDATE login_challenges SET attempts = attempts \\+ 1*").WithArgs(sqlmock.AnyArg(), 1, maxChallengeAttempts, sqlmock.AnyArg()).WillReturnResult(test.attemptResult)
+			}
+			if test.sqlResult != nil {
+				mock.ExpectQuery("^SELECT secret, last_used_step FROM user_totp WHERE user_id*").WillReturnRows(test.sqlResult)
+			}
+			if test.updateQuery != "" {
+				mock.ExpectExec(test.updateQuery).WillReturnResult(test.updateResult)
+			}
+			if test.usedResult != nil {
+				mock.ExpectExec("^UPDATE login_challenges SET used_at*").WillReturnResult(test.usedResult)
+			}
+
+			userId, err := s.VerifyChallenge(test.challenge, test.code)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+
+			if userId != test.userId {
+				t.Fatalf("wrong user id. Expected %v but got %v", test.userId, userId)
+			}
+		})
+	}
+
+	t.Run("challenge does not authenticate", func(t *testing.T) {
+		us := NewUserService(&DB{DB: db}, testRing(t))
+
+		r, _ := http.NewRequest("", "", nil)
+		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", challenge))
+
+		if _, err := us.ExtractAuthenticationToken(r); err != app.ErrWrongCredentials {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+		}
+	})
+}
+
+func TestTwoFactorService_Disable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
+	secret, encrypted := testSecret(t)
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+
+	tests := []struct {
+		name     string
+		password string
+		disabled bool
+		error    error
+	}{
+		{
+			name:     "wrong password",
+			password: "password-edit",
+			error:    app.ErrWrongCredentials,
+		},
+		{
+			name:     "success",
+			password: "password",
+			disabled: true,
+			error:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock.ExpectQuery("^SELECT password FROM users WHERE id*").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+			if test.disabled {
+				mock.ExpectQuery("^SELECT secret, last_used_step FROM user_totp*").WillReturnRows(sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(encrypted, 0))
+				mock.ExpectExec("^UPDATE user_totp SET last_used_step*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("^DELETE FROM user_recovery_codes*").WillReturnResult(sqlmock.NewResult(0, 10))
+				mock.ExpectExec("^DELETE FROM user_totp*").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			s := NewTwoFactorService(&DB{DB: db}, testRing(t), testEncryptionKey, "go-rest-template")
+
+			err := s.Disable(1, test.password, code)
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.error {
+				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+			}
+		})
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	encrypted, err := encrypt(testEncryptionKey, "secret")
+	if err != nil {
+		t.Fatal("cannot encrypt", err)
+	}
+
+	if encrypted == "secret" {
+		t.Fatal("value was not encrypted")
+	}
+
+	decrypted, err := decrypt(testEncryptionKey, encrypted)
+	if err != nil || decrypted != "secret" {
+		t.Fatalf("wrong decryption. expected secret but got %s (%v)", decrypted, err)
+	}
+
+	if _, err := decrypt([]byte("fedcba9876543210fedcba9876543210"), encrypted); err == nil {
+		t.Fatal("expected error decrypting with another key")
+	}
+}
+
+func testSecret(t *testing.T) (string, string) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal("cannot generate secret", err)
+	}
+	encrypted, err := encrypt(testEncryptionKey, secret)
+	if err != nil {
+		t.Fatal("cannot encrypt secret", err)
+	}
+	return secret, encrypted
+}
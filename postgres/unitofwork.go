@@ -0,0 +1,32 @@
+package postgres
+
+import app "github.com/leartgjoni/go-rest-template"
+
+// Ensure service implements interface.
+var _ app.UnitOfWork = &UnitOfWork{}
+
+// UnitOfWork runs writes through several services in one transaction.
+type UnitOfWork struct {
+	db    *DB
+	users *UserService
+}
+
+// NewUnitOfWork returns a new instance of UnitOfWork. Its user services are
+// configured like users.
+func NewUnitOfWork(db *DB, users *UserService) *UnitOfWork {
+	return &UnitOfWork{
+		db:    db,
+		users: users,
+	}
+}
+
+func (u *UnitOfWork) Do(fn func(s *app.Services) error) error {
+	return u.db.Transact(func(tx *DB) error {
+		return fn(&app.Services{
+			Users:    u.users.withDB(tx),
+			Articles: NewArticleService(tx),
+			APIKeys:  NewAPIKeyService(tx),
+			Audit:    NewAuditLog(tx),
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestUnitOfWorkIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	uow := NewUnitOfWork(db, NewUserService(db, testRing(t)))
+
+	// the audit events can't be cleaned, so only the ones after now count
+	var lastEvent int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM audit_events").Scan(&lastEvent); err != nil {
+		t.Fatal("cannot get last audit event", err)
+	}
+
+	signUp := func(s *app.Services) error {
+		user := &app.User{Username: "writer", Email: "writer@test.com", Password: "random-password", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := s.Users.Save(user); err != nil {
+			return err
+		}
+		if err := s.Articles.Save(&app.Article{Title: "Hello", Body: "World", UserId: user.ID, CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+			return err
+		}
+		return s.Audit.Record(&app.AuditEvent{Action: app.AuditSignup, ActorId: user.ID, Target: "user:" + user.Username})
+	}
+
+	// nothing is written when the work fails
+	failure := errors.New("failure")
+	err := uow.Do(func(s *app.Services) error {
+		if err := signUp(s); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("wrong error. expected %s but got %s", failure, err)
+	}
+
+	var users, articles, events int
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM articles), (SELECT COUNT(*) FROM audit_events WHERE id > $1)", lastEvent).Scan(&users, &articles, &events); err != nil {
+		t.Fatal("cannot count rows", err)
+	}
+	if users != 0 || articles != 0 || events != 0 {
+		t.Fatalf("expected no rows but got %d users, %d articles and %d audit events", users, articles, events)
+	}
+
+	if err := uow.Do(signUp); err != nil {
+		t.Fatal("cannot sign up", err)
+	}
+
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM articles), (SELECT COUNT(*) FROM audit_events WHERE id > $1)", lastEvent).Scan(&users, &articles, &events); err != nil {
+		t.Fatal("cannot count rows", err)
+	}
+	if users != 1 || articles != 1 || events != 1 {
+		t.Fatalf("expected one row each but got %d users, %d articles and %d audit events", users, articles, events)
+	}
+}
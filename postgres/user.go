@@ -1,14 +1,14 @@
 package postgres
 
 import (
+	"database/sql"
 	"errors"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	app "github.com/leartgjoni/go-rest-template"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mail"
+	"github.com/leartgjoni/go-rest-template/password"
+	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -16,86 +16,105 @@ import (
 
 // Ensure service implements interface.
 var _ app.UserService = &UserService{}
+var _ app.PrimaryUsers = &UserService{}
 
 // UserService represents a service to manage users.
 type UserService struct {
-	db        *DB
-	apiSecret string
+	db     *DB
+	tokens *keyring.Ring
+
+	Passwords       app.PasswordHasher
+	Policy          app.PasswordPolicy // optional, checked for new passwords
+	Mailer          app.Mailer         // sends email change confirmations
+	ConfirmEmailURL string             // optional, the confirmation token is appended as ?token=
+	Sessions        *SessionService    // optional, drops the sessions ChangePassword revokes from its cache
+
+	dummy password.Dummy
 }
 
-// NewUserService returns a new instance of UserService.
-func NewUserService(db *DB, apiSecret string) *UserService {
+// NewUserService returns a new instance of UserService hashing passwords
+// with Argon2id and the default parameters.
+func NewUserService(db *DB, tokens *keyring.Ring) *UserService {
 	return &UserService{
 		db:        db,
-		apiSecret: apiSecret,
+		tokens:    tokens,
+		Passwords: password.NewHasher(password.DefaultParams),
 	}
 }
 
-func (s *UserService) CreateToken(userId uint32) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId": userId,
-		"exp":    time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	return token.SignedString([]byte(s.apiSecret))
+// FromPrimary returns the service reading from the primary rather than
+// from replicas.
+func (s *UserService) FromPrimary() app.UserService {
+	return s.withDB(s.db.primary())
 }
 
-func (s *UserService) ExtractAuthenticationToken(r *http.Request) (uint32, error) {
-	tokenString := extractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.apiSecret), nil
-	})
-	if err != nil {
-		return 0, err
-	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["userId"]), 10, 32)
-		if err != nil {
-			return 0, err
-		}
-		return uint32(uid), nil
+// withDB returns a copy of the service running its queries on db, e.g. in
+// a transaction.
+func (s *UserService) withDB(db *DB) *UserService {
+	return &UserService{
+		db:              db,
+		tokens:          s.tokens,
+		Passwords:       s.Passwords,
+		Policy:          s.Policy,
+		Mailer:          s.Mailer,
+		ConfirmEmailURL: s.ConfirmEmailURL,
+		Sessions:        s.Sessions,
 	}
-	return 0, nil
 }
 
-func (s *UserService) Save(user *app.User) error {
-	count := 0
-	err := s.db.QueryRow("SELECT COUNT(id) FROM users WHERE email = $1", user.Email).Scan(&count)
-	if err != nil {
-		return err
-	}
+// CreateToken starts a new session of the user. The session is recorded on
+// the first request authenticated with the token.
+func (s *UserService) CreateToken(userId uint32) (string, error) {
+	return s.tokens.SignSession(userId)
+}
 
-	if count > 0 {
-		return app.ErrEmailAlreadyUsed
+// ExtractAuthenticationToken returns the session of a valid token. Whether
+// the session has been revoked is up to the SessionService.
+func (s *UserService) ExtractAuthenticationToken(r *http.Request) (*app.Session, error) {
+	return s.tokens.ParseSession(keyring.BearerToken(r))
+}
+
+func (s *UserService) Save(user *app.User) error {
+	if s.Policy != nil {
+		if err := s.Policy.Validate(user.Password); err != nil {
+			return err
+		}
 	}
 
-	hashedPassword, err := hash(user.Password)
+	hashedPassword, err := s.Passwords.Hash(user.Password)
 	if err != nil {
 		return app.ErrWrongPasswordFormat
 	}
 
-	user.Password = string(hashedPassword)
-
-	row := s.db.QueryRow("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt)
-
+	// the unique constraints decide who gets the email or username, so
+	// concurrent signups can't both take them
+	row := s.db.QueryRow("INSERT INTO users (username, email, password, bio, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", user.Username, user.Email, hashedPassword, user.Bio, user.CreatedAt, user.UpdatedAt)
 	if err := row.Scan(&user.ID); err != nil {
-		return nil
+		return userConstraintError(err)
 	}
 
 	if user.ID == 0 {
 		return errors.New("unable to save")
 	}
 
+	user.Password = hashedPassword
 	return nil
 }
 
 func (s *UserService) GetById(userId uint32) (*app.User, error) {
 	var user app.User
-	err := s.db.QueryRow("SELECT * FROM users WHERE id = $1", userId).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.reader().QueryRow("SELECT id, username, email, password, bio, created_at, updated_at, is_admin FROM users WHERE id = $1", userId).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Bio, &user.CreatedAt, &user.UpdatedAt, &user.IsAdmin)
+
+	if err != nil || user.ID == 0 {
+		return &app.User{}, app.ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (s *UserService) GetByUsername(username string) (*app.User, error) {
+	var user app.User
+	err := s.db.QueryRow("SELECT id, username, email, password, bio, created_at, updated_at, is_admin FROM users WHERE username = $1", username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Bio, &user.CreatedAt, &user.UpdatedAt, &user.IsAdmin)
 
 	if err != nil || user.ID == 0 {
 		return &app.User{}, app.ErrUserNotFound
@@ -104,46 +123,199 @@ func (s *UserService) GetById(userId uint32) (*app.User, error) {
 	return &user, nil
 }
 
+func (s *UserService) Update(user *app.User) error {
+	res, err := s.db.Exec("UPDATE users SET username = $1, bio = $2, updated_at = $3 WHERE id = $4", user.Username, user.Bio, user.UpdatedAt, user.ID)
+	if err != nil {
+		return userConstraintError(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *UserService) ChangePassword(userId uint32, currentPassword string, newPassword string) (string, error) {
+	var hashedPassword string
+	err := s.db.QueryRow("SELECT password FROM users WHERE id = $1", userId).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return "", app.ErrUserNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := verifyPassword(hashedPassword, currentPassword); err != nil {
+		return "", app.ErrWrongCredentials
+	}
+
+	if s.Policy != nil {
+		if err := s.Policy.Validate(newPassword); err != nil {
+			return "", err
+		}
+	}
+
+	newHash, err := s.Passwords.Hash(newPassword)
+	if err != nil {
+		return "", app.ErrWrongPasswordFormat
+	}
+
+	err = s.db.Transact(func(tx *DB) error {
+		if _, err := tx.Exec("UPDATE users SET password = $1, updated_at = $2 WHERE id = $3", newHash, time.Now(), userId); err != nil {
+			return err
+		}
+		return s.sessions(tx).RevokeOthers(userId, "")
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.CreateToken(userId)
+}
+
+// sessions returns the session service running its queries on db.
+func (s *UserService) sessions(db *DB) *SessionService {
+	if s.Sessions == nil {
+		return NewSessionService(db, 0)
+	}
+	return s.Sessions.withDB(db)
+}
+
+func (s *UserService) RequestEmailChange(userId uint32, email string, password string) error {
+	if s.Mailer == nil {
+		return errors.New("email changes need a mailer")
+	}
+
+	user, err := s.GetById(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyPassword(user.Password, password); err != nil {
+		return app.ErrWrongCredentials
+	}
+
+	if err := s.checkEmailAvailable(email); err != nil {
+		return err
+	}
+
+	token, err := s.tokens.SignEmailChange(userId, email, user.Email)
+	if err != nil {
+		return err
+	}
+	return mail.SendEmailChange(s.Mailer, email, user.Username, token, s.ConfirmEmailURL)
+}
+
+// ConfirmEmailChange applies a change requested with RequestEmailChange. A
+// token only works once, as long as the email hasn't changed meanwhile.
+func (s *UserService) ConfirmEmailChange(userId uint32, tokenString string) error {
+	email, from, err := s.tokens.ParseEmailChange(tokenString, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkEmailAvailable(email); err != nil {
+		return err
+	}
+
+	var username string
+	err = s.db.QueryRow("UPDATE users SET email = $1, updated_at = $2 WHERE id = $3 AND email = $4 RETURNING username", email, time.Now(), userId, from).Scan(&username)
+	if err == sql.ErrNoRows {
+		return app.ErrInvalidEmailChange
+	} else if err != nil {
+		// taken since the check above
+		return userConstraintError(err)
+	}
+
+	// let the previous address know, in case the account was taken over
+	if s.Mailer != nil {
+		if err := mail.SendEmailChanged(s.Mailer, from, username, email); err != nil {
+			log.Printf("cannot send email change notification to user %d: %s", userId, err)
+		}
+	}
+	return nil
+}
+
+func (s *UserService) checkEmailAvailable(email string) error {
+	count := 0
+	if err := s.db.QueryRow("SELECT COUNT(id) FROM users WHERE LOWER(email) = LOWER($1)", email).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return app.ErrEmailAlreadyUsed
+	}
+	return nil
+}
+
 func (s *UserService) Login(u *app.User) (string, error) {
+	// long passwords would take long to hash, whether the email is known or not
+	if s.Policy != nil && s.Policy.TooLong(u.Password) {
+		return "", app.ErrWrongCredentials
+	}
+
 	var row struct {
-		id        uint32
-		username  string
-		password  string
-		createdAt time.Time
-		updatedAt time.Time
+		id               uint32
+		username         string
+		password         string
+		createdAt        time.Time
+		updatedAt        time.Time
+		lockedUntil      *time.Time
+		isAdmin          bool
+		twoFactorEnabled bool
 	}
 
-	err := s.db.QueryRow("SELECT id, username, password, created_at, updated_at FROM users WHERE email = $1 LIMIT 1", u.Email).Scan(&row.id, &row.username, &row.password, &row.createdAt, &row.updatedAt)
+	err := s.db.QueryRow("SELECT id, username, password, created_at, updated_at, locked_until, is_admin, EXISTS (SELECT 1 FROM user_totp WHERE user_id = users.id AND confirmed_at IS NOT NULL) FROM users WHERE LOWER(email) = LOWER($1) LIMIT 1", u.Email).Scan(&row.id, &row.username, &row.password, &row.createdAt, &row.updatedAt, &row.lockedUntil, &row.isAdmin, &row.twoFactorEnabled)
 
 	if err != nil || row.id == 0 {
+		// hash anyway, so unknown emails take as long as wrong passwords
+		_ = s.Passwords.Verify(s.dummy.Hash(s.Passwords), u.Password)
 		return "", app.ErrWrongCredentials
 	}
-	err = verifyPassword(row.password, u.Password)
+	err = s.Passwords.Verify(row.password, u.Password)
+	if row.lockedUntil != nil && row.lockedUntil.After(time.Now()) {
+		return "", app.ErrAccountLocked
+	}
 	if err != nil {
 		return "", app.ErrWrongCredentials
 	}
 
+	if s.Passwords.NeedsRehash(row.password) {
+		row.password = s.rehash(row.id, row.password, u.Password)
+	}
+
 	u.ID = row.id
 	u.Username = row.username
 	u.Password = row.password
 	u.CreatedAt = row.createdAt
 	u.UpdatedAt = row.updatedAt
+	u.IsAdmin = row.isAdmin
 
-	return s.CreateToken(u.ID)
-}
-
-func extractToken(r *http.Request) string {
-	bearerToken := r.Header.Get("Authorization")
-	if len(strings.Split(bearerToken, " ")) == 2 {
-		return strings.Split(bearerToken, " ")[1]
+	// the caller has to complete a two-factor challenge to get a token
+	if row.twoFactorEnabled {
+		return "", app.ErrTwoFactorRequired
 	}
-	return ""
+
+	return s.CreateToken(u.ID)
 }
 
-func hash(password string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// rehash upgrades the hash of a password that was just verified, returning
+// the new hash. Failing to do so doesn't fail the login.
+func (s *UserService) rehash(userId uint32, oldHash string, plain string) string {
+	return password.Rehash(s.Passwords, userId, oldHash, plain, func(newHash string) (bool, error) {
+		// unless the password was changed meanwhile
+		res, err := s.db.Exec("UPDATE users SET password = $1 WHERE id = $2 AND password = $3", newHash, userId, oldHash)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	})
 }
 
-func verifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+// verifyPassword checks a password against a hash of any supported algorithm.
+func verifyPassword(hashedPassword, plain string) error {
+	return password.Verify(hashedPassword, plain)
 }
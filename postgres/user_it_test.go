@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"github.com/dgrijalva/jwt-go"
 	app "github.com/leartgjoni/go-rest-template"
 	"golang.org/x/crypto/bcrypt"
+	"net/http"
 	"testing"
 	"time"
 )
@@ -27,7 +29,7 @@ func TestUserServiceIntegration_Save(t *testing.T) {
 			UpdatedAt: timeNow,
 		}
 
-		us := NewUserService(db, "random-api-string")
+		us := NewUserService(db, testRing(t))
 		if err := us.Save(&user); err != nil {
 			t.Fatal("cannot save user", err)
 		}
@@ -37,7 +39,7 @@ func TestUserServiceIntegration_Save(t *testing.T) {
 		}
 
 		var dbUser app.User
-		if err := db.QueryRow("SELECT * FROM users WHERE id = $1", user.ID).Scan(&dbUser.ID, &dbUser.Username, &dbUser.Email, &dbUser.Password, &dbUser.CreatedAt, &dbUser.UpdatedAt); err != nil {
+		if err := db.QueryRow("SELECT id, username, email, password, created_at, updated_at FROM users WHERE id = $1", user.ID).Scan(&dbUser.ID, &dbUser.Username, &dbUser.Email, &dbUser.Password, &dbUser.CreatedAt, &dbUser.UpdatedAt); err != nil {
 			t.Fatal("cannot read user from db", err)
 		}
 
@@ -52,7 +54,8 @@ func TestUserServiceIntegration_Save(t *testing.T) {
 
 		email := "test@test.com"
 
-		if _, err := db.Exec("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)", "random username", email, "random-password", time.Now(), time.Now()); err != nil {
+		// emails differing only in case are the same
+		if _, err := db.Exec("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)", "random username", "Test@Test.com", "random-password", time.Now(), time.Now()); err != nil {
 			t.Fatal("cannot insert user", err)
 		}
 
@@ -65,7 +68,7 @@ func TestUserServiceIntegration_Save(t *testing.T) {
 			UpdatedAt: time.Now(),
 		}
 
-		us := NewUserService(db, "random-api-string")
+		us := NewUserService(db, testRing(t))
 		err := us.Save(&user)
 		if err != app.ErrEmailAlreadyUsed {
 			t.Fatal("incorrect error", err)
@@ -97,7 +100,7 @@ func TestUserServiceIntegration_GetById(t *testing.T) {
 		t.Fatal("error while inserting user", err)
 	}
 
-	us := NewUserService(db, "random-api-string")
+	us := NewUserService(db, testRing(t))
 	// actual user
 	aUser, err := us.GetById(eUser.ID)
 	if err != nil {
@@ -138,7 +141,7 @@ func TestUserServiceIntegration_Login(t *testing.T) {
 			t.Fatal("cannot insert user", err)
 		}
 
-		us := NewUserService(db, "random-api-string")
+		us := NewUserService(db, testRing(t))
 		token, err := us.Login(&user)
 		if !(token != "" && err == nil) {
 			t.Fatal("err with login", err)
@@ -169,7 +172,7 @@ func TestUserServiceIntegration_Login(t *testing.T) {
 			t.Fatal("cannot insert user", err)
 		}
 
-		us := NewUserService(db, "random-api-string")
+		us := NewUserService(db, testRing(t))
 		// change password
 		user.Password = "password-edit"
 		_, err = us.Login(&user)
@@ -178,3 +181,59 @@ func TestUserServiceIntegration_Login(t *testing.T) {
 		}
 	})
 }
+
+func TestUserServiceIntegration_ChangePassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal("cannot hash password", err)
+	}
+
+	var userId uint32
+	if err := db.QueryRow("INSERT INTO users (username, email, password, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", "test", "test@test.com", hashedPassword, time.Now(), time.Now()).Scan(&userId); err != nil {
+		t.Fatal("cannot insert user", err)
+	}
+
+	us := NewUserService(db, testRing(t))
+	ss := NewSessionService(db, 0)
+	authenticate := func(token string) error {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		session, err := us.ExtractAuthenticationToken(r)
+		if err != nil {
+			return err
+		}
+		return ss.Touch(session)
+	}
+
+	// backdate the other session, tokens only have second precision
+	other, err := testRing(t).Sign(jwt.MapClaims{"userId": userId, "sid": "other", "iat": time.Now().Add(-time.Minute).Unix(), "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal("cannot sign token", err)
+	}
+	if err := authenticate(other); err != nil {
+		t.Fatal("token should be valid before the change", err)
+	}
+
+	token, err := us.ChangePassword(userId, "password", "new-password")
+	if err != nil {
+		t.Fatal("cannot change password", err)
+	}
+
+	if err := authenticate(other); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+	if err := authenticate(token); err != nil {
+		t.Fatal("new token should be valid", err)
+	}
+
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "new-password"}); err != nil {
+		t.Fatal("cannot login with new password", err)
+	}
+}
@@ -1,72 +1,88 @@
 package postgres
 
 import (
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgrijalva/jwt-go"
 	app "github.com/leartgjoni/go-rest-template"
+	appmock "github.com/leartgjoni/go-rest-template/mock"
+	"github.com/leartgjoni/go-rest-template/password"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestUserService_ExtractAuthenticationToken(t *testing.T) {
-	db, _, err := sqlmock.New()
+	ring := testRing(t)
+	us := NewUserService(nil, ring)
+
+	token, err := us.CreateToken(1)
 	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		t.Fatal("cannot create token", token)
+	}
+
+	// issued before sessions existed
+	legacyToken, err := ring.Sign(jwt.MapClaims{"userId": 1, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal("cannot create token", err)
 	}
-	defer db.Close()
 
 	tests := []struct {
-		name    string
-		userId  uint32
-		invalid string
-		error   error
+		name          string
+		authorization string
+		userId        uint32
+		error         error
 	}{
 		{
-			name:    "extracts correctly",
-			userId:  1,
-			invalid: "",
-			error:   nil,
+			name:          "extracts correctly",
+			authorization: fmt.Sprintf("Bearer %s", token),
+			userId:        1,
+			error:         nil,
 		},
 		{
-			name:    "wrong token encoding",
-			userId:  0,
-			invalid: "wrong format",
-			error:   errors.New("token contains an invalid number of segments"),
+			name:          "token without session",
+			authorization: fmt.Sprintf("Bearer %s", legacyToken),
+			error:         app.ErrWrongCredentials,
 		},
 		{
-			name:    "wrong header format",
-			userId:  0,
-			invalid: "random",
-			error:   errors.New("token contains an invalid number of segments"),
+			name:          "wrong token encoding",
+			authorization: "wrong format",
+			error:         errors.New("token contains an invalid number of segments"),
+		},
+		{
+			name:          "wrong header format",
+			authorization: "random",
+			error:         errors.New("token contains an invalid number of segments"),
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			us := NewUserService(&DB{db}, "random")
-
-			token, err := us.CreateToken(test.userId)
-			if err != nil {
-				t.Fatal("cannot create token", token)
-			}
-
 			r, _ := http.NewRequest("", "", nil)
-			if test.invalid != "" {
-				r.Header.Set("Authorization", test.invalid)
-			} else {
-				r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-			}
+			r.Header.Set("Authorization", test.authorization)
 
-			userId, err := us.ExtractAuthenticationToken(r)
+			session, err := us.ExtractAuthenticationToken(r)
 
-			if test.invalid != "" && err.Error() != test.error.Error() {
+			if test.error != nil {
+				if err == nil || err.Error() != test.error.Error() {
+					t.Fatalf("wrong error. expected %s but got %s", test.error, err)
+				}
+				return
+			}
+			if err != nil {
 				t.Fatalf("wrong error. expected %s but got %s", test.error, err)
 			}
 
-			if userId != test.userId {
-				t.Fatalf("wrong user id. Expected %v but got %v", test.userId, userId)
+			if session.UserId != test.userId {
+				t.Fatalf("wrong user id. Expected %v but got %v", test.userId, session.UserId)
+			}
+			if session.ID == "" || session.CreatedAt.IsZero() {
+				t.Fatalf("wrong session %+v", session)
 			}
 		})
 	}
@@ -81,29 +97,33 @@ func TestUserService_Save(t *testing.T) {
 
 	tests := []struct {
 		name         string
-		countResult  *sqlmock.Rows
 		insertResult *sqlmock.Rows
+		insertError  error
 		expected     error
 	}{
 		{
-			name: "Email already used",
-			countResult: sqlmock.NewRows([]string{"count"}).
-				AddRow(1),
-			insertResult: nil,
-			expected:     app.ErrEmailAlreadyUsed,
+			name:        "Email already used",
+			insertError: &pq.Error{Code: "23505", Constraint: "users_email_lower_key"},
+			expected:    app.ErrEmailAlreadyUsed,
+		},
+		{
+			name:        "Username already used",
+			insertError: &pq.Error{Code: "23505", Constraint: "users_username_key"},
+			expected:    app.ErrUsernameAlreadyUsed,
+		},
+		{
+			name:        "Other constraint",
+			insertError: &pq.Error{Code: "23502", Column: "username"},
+			expected:    &app.ConstraintError{Err: app.ErrNotNullViolation, Constraint: "username"},
 		},
 		{
 			name: "User without ID after saving",
-			countResult: sqlmock.NewRows([]string{"count"}).
-				AddRow(0),
 			insertResult: sqlmock.NewRows([]string{"id"}).
 				AddRow(0),
 			expected: errors.New("unable to save"),
 		},
 		{
 			name: "Success",
-			countResult: sqlmock.NewRows([]string{"count"}).
-				AddRow(0),
 			insertResult: sqlmock.NewRows([]string{"id"}).
 				AddRow(1),
 			expected: nil,
@@ -112,12 +132,13 @@ func TestUserService_Save(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			mock.ExpectQuery("^SELECT (.+) FROM users*").WillReturnRows(test.countResult)
-			if test.insertResult != nil {
+			if test.insertError != nil {
+				mock.ExpectQuery("^INSERT INTO users *").WillReturnError(test.insertError)
+			} else {
 				mock.ExpectQuery("^INSERT INTO users *").WillReturnRows(test.insertResult)
 			}
 
-			us := NewUserService(&DB{db}, "random")
+			us := NewUserService(&DB{DB: db}, testRing(t))
 
 			err = us.Save(&app.User{})
 
@@ -139,6 +160,28 @@ func TestUserService_Save(t *testing.T) {
 	}
 }
 
+func TestUserService_Save_Policy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	us := NewUserService(&DB{DB: db}, testRing(t))
+	us.Policy = password.NewPolicy(8, 64)
+
+	err = us.Save(&app.User{Email: "test@test.com", Username: "test", Password: "short"})
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	if err != app.ErrPasswordTooShort {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrPasswordTooShort, err)
+	}
+}
+
 func TestUserService_GetById(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -151,6 +194,7 @@ func TestUserService_GetById(t *testing.T) {
 		Username:  "test",
 		Email:     "test@test.com",
 		Password:  "password-hashed",
+		Bio:       "Hello",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -163,13 +207,13 @@ func TestUserService_GetById(t *testing.T) {
 	}{
 		{
 			name:      "Found by id",
-			sqlResult: sqlmock.NewRows([]string{"id", "username", "email", "password", "created_at", "updated_at"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Email, dbUser.Password, dbUser.CreatedAt, dbUser.UpdatedAt),
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "email", "password", "bio", "created_at", "updated_at", "is_admin"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Email, dbUser.Password, dbUser.Bio, dbUser.CreatedAt, dbUser.UpdatedAt, false),
 			error:     nil,
 			user:      dbUser,
 		},
 		{
 			name:      "Not found by id",
-			sqlResult: sqlmock.NewRows([]string{"id", "username", "email", "password", "created_at", "updated_at"}),
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "email", "password", "bio", "created_at", "updated_at", "is_admin"}),
 			error:     app.ErrUserNotFound,
 			user:      app.User{},
 		},
@@ -179,7 +223,7 @@ func TestUserService_GetById(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			mock.ExpectQuery("^SELECT (.+) FROM users WHERE id*").WillReturnRows(test.sqlResult)
 
-			us := NewUserService(&DB{db}, "random")
+			us := NewUserService(&DB{DB: db}, testRing(t))
 
 			user, err := us.GetById(1)
 
@@ -193,7 +237,7 @@ func TestUserService_GetById(t *testing.T) {
 			}
 
 			if err == nil {
-				if user.ID != test.user.ID || user.Username != test.user.Username || user.Email != test.user.Email || user.Password != test.user.Password || !user.CreatedAt.Equal(test.user.CreatedAt) || !user.UpdatedAt.Equal(test.user.UpdatedAt) {
+				if user.ID != test.user.ID || user.Username != test.user.Username || user.Email != test.user.Email || user.Password != test.user.Password || user.Bio != test.user.Bio || !user.CreatedAt.Equal(test.user.CreatedAt) || !user.UpdatedAt.Equal(test.user.UpdatedAt) {
 					t.Fatalf("wrong user. expected %v but got %v", test.user, user)
 				}
 			}
@@ -213,6 +257,11 @@ func TestUserService_Login(t *testing.T) {
 		t.Fatal("error while hashing password")
 	}
 
+	argon2Password, err := password.NewHasher(password.DefaultParams).Hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
 	dbUser := app.User{
 		ID:        1,
 		Username:  "test",
@@ -225,30 +274,51 @@ func TestUserService_Login(t *testing.T) {
 	tests := []struct {
 		name      string
 		sqlResult *sqlmock.Rows
+		rehash    bool
 		error     error
 	}{
 		{
 			name:      "correct login",
-			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Password, dbUser.CreatedAt, dbUser.UpdatedAt),
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}).AddRow(dbUser.ID, dbUser.Username, argon2Password, dbUser.CreatedAt, dbUser.UpdatedAt, nil, false, false),
+			error:     nil,
+		},
+		{
+			name:      "correct login with bcrypt hash",
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Password, dbUser.CreatedAt, dbUser.UpdatedAt, nil, false, false),
+			rehash:    true,
 			error:     nil,
 		},
 		{
 			name:      "wrong email",
-			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at"}),
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}),
 			error:     app.ErrWrongCredentials,
 		},
 		{
 			name:      "wrong password",
-			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at"}).AddRow(dbUser.ID, dbUser.Username, "password", dbUser.CreatedAt, dbUser.UpdatedAt),
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}).AddRow(dbUser.ID, dbUser.Username, "password", dbUser.CreatedAt, dbUser.UpdatedAt, nil, false, false),
 			error:     app.ErrWrongCredentials,
 		},
+		{
+			name:      "locked",
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Password, dbUser.CreatedAt, dbUser.UpdatedAt, time.Now().Add(time.Minute), false, false),
+			error:     app.ErrAccountLocked,
+		},
+		{
+			name:      "two-factor required",
+			sqlResult: sqlmock.NewRows([]string{"id", "username", "password", "created_at", "updated_at", "locked_until", "is_admin", "exists"}).AddRow(dbUser.ID, dbUser.Username, dbUser.Password, dbUser.CreatedAt, dbUser.UpdatedAt, nil, false, true),
+			rehash:    true,
+			error:     app.ErrTwoFactorRequired,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			mock.ExpectQuery("^SELECT (.+) FROM users WHERE email*").WillReturnRows(test.sqlResult)
+			mock.ExpectQuery("^SELECT (.+) FROM users WHERE LOWER\\(email\\)*").WillReturnRows(test.sqlResult)
+			if test.rehash {
+				mock.ExpectExec("^UPDATE users SET password = (.+) WHERE id = (.+) AND password*").WithArgs(sqlmock.AnyArg(), 1, dbUser.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
 
-			us := NewUserService(&DB{db}, "random")
+			us := NewUserService(&DB{DB: db}, testRing(t))
 
 			token, err := us.Login(&app.User{Email: "test@test.com", Password: "password"})
 
@@ -266,4 +336,308 @@ func TestUserService_Login(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("too long password", func(t *testing.T) {
+		us := NewUserService(&DB{DB: db}, testRing(t))
+		us.Policy = password.NewPolicy(8, 64)
+
+		// rejected without looking the user up or hashing
+		if _, err := us.Login(&app.User{Email: "test@test.com", Password: strings.Repeat("a", 65)}); err != app.ErrWrongCredentials {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+		}
+
+		// we make sure that all expectations were met
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+func TestUserService_Update(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name         string
+		updateResult driver.Result
+		updateError  error
+		expected     error
+	}{
+		{
+			name:        "Username already used",
+			updateError: &pq.Error{Code: "23505", Constraint: "users_username_key"},
+			expected:    app.ErrUsernameAlreadyUsed,
+		},
+		{
+			name:         "Not found",
+			updateResult: sqlmock.NewResult(0, 0),
+			expected:     app.ErrUserNotFound,
+		},
+		{
+			name:         "Success",
+			updateResult: sqlmock.NewResult(0, 1),
+			expected:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.updateError != nil {
+				mock.ExpectExec("^UPDATE users SET username*").WithArgs("new", "Hello", sqlmock.AnyArg(), 1).WillReturnError(test.updateError)
+			} else {
+				mock.ExpectExec("^UPDATE users SET username*").WithArgs("new", "Hello", sqlmock.AnyArg(), 1).WillReturnResult(test.updateResult)
+			}
+
+			us := NewUserService(&DB{DB: db}, testRing(t))
+
+			err := us.Update(&app.User{ID: 1, Username: "new", Bio: "Hello", UpdatedAt: time.Now()})
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
+	tests := []struct {
+		name     string
+		current  string
+		expect   func()
+		expected error
+	}{
+		{
+			name:    "Success",
+			current: "password",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+				expectChangePassword(mock)
+			},
+			expected: nil,
+		},
+		{
+			name:    "Wrong current password",
+			current: "wrong",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+			},
+			expected: app.ErrWrongCredentials,
+		},
+		{
+			name:    "Not found",
+			current: "password",
+			expect: func() {
+				mock.ExpectQuery("^SELECT password FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}))
+			},
+			expected: app.ErrUserNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.expect()
+
+			us := NewUserService(&DB{DB: db}, testRing(t))
+
+			token, err := us.ChangePassword(1, test.current, "new-password")
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			if err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+
+			if err == nil && token == "" {
+				t.Fatal("token was not expected to be empty")
+			}
+		})
+	}
+}
+
+// expectChangePassword expects a password change of the user 1 revoking
+// the session "abc".
+func expectChangePassword(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE users SET password = (.+), updated_at*").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("^UPDATE sessions SET revoked_at = (.+) WHERE user_id = (.+) AND id <> (.+) RETURNING id").WithArgs(sqlmock.AnyArg(), 1, "").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("abc"))
+	mock.ExpectExec("^UPDATE users SET tokens_valid_after*").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func TestUserService_ChangePasswordRevokesCachedSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
+	us := NewUserService(&DB{DB: db}, testRing(t))
+	us.Sessions = NewSessionService(&DB{DB: db}, time.Minute)
+	session := &app.Session{ID: "abc", UserId: 1, CreatedAt: time.Now()}
+
+	mock.ExpectQuery("^UPDATE sessions SET (.+) RETURNING revoked_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"valid"}).AddRow(true))
+	if err := us.Sessions.Touch(session); err != nil {
+		t.Fatal("cannot touch session", err)
+	}
+
+	mock.ExpectQuery("^SELECT password FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashedPassword)))
+	expectChangePassword(mock)
+	if _, err := us.ChangePassword(1, "password", "new-password"); err != nil {
+		t.Fatal("cannot change password", err)
+	}
+
+	// the session was cached as valid, it's checked again
+	mock.ExpectQuery("^UPDATE sessions SET (.+) RETURNING revoked_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"valid"}).AddRow(false))
+	if err := us.Sessions.Touch(session); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserService_EmailChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	hashedPassword, err := hash("password")
+	if err != nil {
+		t.Fatal("error while hashing password")
+	}
+
+	var sent []string
+	var token string
+	mailer := &appmock.Mailer{SendFn: func(to string, subject string, body string) error {
+		sent = append(sent, to)
+		if to == "new@test.com" {
+			token = strings.TrimSpace(body[strings.LastIndex(body, "\n\n"):])
+		}
+		return nil
+	}}
+
+	ring := testRing(t)
+	us := NewUserService(&DB{DB: db}, ring)
+	us.Mailer = mailer
+
+	userRows := []string{"id", "username", "email", "password", "bio", "created_at", "updated_at", "is_admin"}
+
+	t.Run("wrong password", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT (.+) FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows(userRows).AddRow(1, "test", "test@test.com", string(hashedPassword), "", time.Now(), time.Now(), false))
+
+		if err := us.RequestEmailChange(1, "new@test.com", "wrong"); err != app.ErrWrongCredentials {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+		}
+	})
+
+	t.Run("email already used", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT (.+) FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows(userRows).AddRow(1, "test", "test@test.com", string(hashedPassword), "", time.Now(), time.Now(), false))
+		mock.ExpectQuery("^SELECT COUNT(.+) FROM users WHERE LOWER\\(email\\)*").WithArgs("new@test.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		if err := us.RequestEmailChange(1, "new@test.com", "password"); err != app.ErrEmailAlreadyUsed {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrEmailAlreadyUsed, err)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT (.+) FROM users WHERE id*").WithArgs(1).WillReturnRows(sqlmock.NewRows(userRows).AddRow(1, "test", "test@test.com", string(hashedPassword), "", time.Now(), time.Now(), false))
+		mock.ExpectQuery("^SELECT COUNT(.+) FROM users WHERE LOWER\\(email\\)*").WithArgs("new@test.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		if err := us.RequestEmailChange(1, "new@test.com", "password"); err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+		if token == "" {
+			t.Fatal("expected a confirmation to the new address")
+		}
+	})
+
+	t.Run("confirm for another user", func(t *testing.T) {
+		if err := us.ConfirmEmailChange(2, token); err != app.ErrInvalidEmailChange {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrInvalidEmailChange, err)
+		}
+	})
+
+	t.Run("confirm with another token", func(t *testing.T) {
+		other, err := ring.Sign(jwt.MapClaims{"userId": 1, "purpose": challengePurpose, "exp": time.Now().Add(time.Minute).Unix()})
+		if err != nil {
+			t.Fatal("cannot sign token", err)
+		}
+		if err := us.ConfirmEmailChange(1, other); err != app.ErrInvalidEmailChange {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrInvalidEmailChange, err)
+		}
+	})
+
+	t.Run("confirm with email taken meanwhile", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT COUNT(.+) FROM users WHERE LOWER\\(email\\)*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("^UPDATE users SET email*").WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_lower_key"})
+
+		if err := us.ConfirmEmailChange(1, token); err != app.ErrEmailAlreadyUsed {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrEmailAlreadyUsed, err)
+		}
+	})
+
+	t.Run("confirm after email changed", func(t *testing.T) {
+		mock.ExpectQuery("^SELECT COUNT(.+) FROM users WHERE LOWER\\(email\\)*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("^UPDATE users SET email*").WithArgs("new@test.com", sqlmock.AnyArg(), 1, "test@test.com").WillReturnRows(sqlmock.NewRows([]string{"username"}))
+
+		if err := us.ConfirmEmailChange(1, token); err != app.ErrInvalidEmailChange {
+			t.Fatalf("wrong error. expected %s but got %s", app.ErrInvalidEmailChange, err)
+		}
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		sent = nil
+		mock.ExpectQuery("^SELECT COUNT(.+) FROM users WHERE LOWER\\(email\\)*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("^UPDATE users SET email*").WithArgs("new@test.com", sqlmock.AnyArg(), 1, "test@test.com").WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("test"))
+
+		if err := us.ConfirmEmailChange(1, token); err != nil {
+			t.Fatalf("an error '%s' was not expected", err)
+		}
+		if len(sent) != 1 || sent[0] != "test@test.com" {
+			t.Fatalf("expected a notification to the previous address but got %v", sent)
+		}
+	})
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// hash returns a bcrypt hash, the way passwords were stored before Argon2id.
+func hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
 }
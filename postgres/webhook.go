@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Ensure services implement interfaces.
+var _ app.WebhookService = &WebhookService{}
+var _ app.WebhookQueue = &WebhookQueue{}
+
+// webhookSecretPrefix makes secrets recognizable, e.g. by secret scanners.
+const webhookSecretPrefix = "whsec_"
+
+// WebhookService represents a service to manage webhook subscriptions.
+type WebhookService struct {
+	db *DB
+}
+
+// NewWebhookService returns a new instance of WebhookService.
+func NewWebhookService(db *DB) *WebhookService {
+	return &WebhookService{db: db}
+}
+
+// Create generates a secret for the webhook unless it has one.
+func (s *WebhookService) Create(w *app.Webhook) error {
+	if w.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		w.Secret = secret
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+
+	err := s.db.QueryRow("INSERT INTO webhooks (url, secret, events, workspace_id, active, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", w.URL, w.Secret, pq.Array(w.Events), nullWorkspace(w.WorkspaceId), w.Active, w.CreatedAt, w.UpdatedAt).Scan(&w.ID)
+	return translateError(err)
+}
+
+func (s *WebhookService) Get(id uint32) (*app.Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRow("SELECT id, url, secret, events, COALESCE(workspace_id, 0), active, created_at, updated_at FROM webhooks WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, app.ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *WebhookService) List() ([]*app.Webhook, error) {
+	rows, err := s.db.Query("SELECT id, url, secret, events, COALESCE(workspace_id, 0), active, created_at, updated_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*app.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *WebhookService) Update(w *app.Webhook) error {
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	w.UpdatedAt = time.Now()
+
+	err := s.db.QueryRow("UPDATE webhooks SET url = $1, secret = $2, events = $3, workspace_id = $4, active = $5, updated_at = $6 WHERE id = $7 RETURNING created_at", w.URL, w.Secret, pq.Array(w.Events), nullWorkspace(w.WorkspaceId), w.Active, w.UpdatedAt, w.ID).Scan(&w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return app.ErrWebhookNotFound
+	}
+	return translateError(err)
+}
+
+// Delete deletes the webhook with its deliveries.
+func (s *WebhookService) Delete(id uint32) error {
+	res, err := s.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *WebhookService) Deliveries(webhookId uint32, limit int) ([]*app.WebhookDelivery, error) {
+	rows, err := s.db.Query("SELECT d.id, d.status, d.attempts, d.next_attempt_at, d.last_error, d.updated_at, e.id, e.type, e.workspace_id, e.data, e.created_at FROM webhook_deliveries d JOIN outbox e ON e.id = d.event_id WHERE d.webhook_id = $1 ORDER BY d.id DESC LIMIT $2", webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*app.WebhookDelivery{}
+	byId := map[int64]*app.WebhookDelivery{}
+	ids := []int64{}
+	for rows.Next() {
+		d := &app.WebhookDelivery{Event: &app.Event{}, Log: []*app.WebhookAttempt{}}
+		if err := rows.Scan(&d.ID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.UpdatedAt, &d.Event.ID, &d.Event.Type, &d.Event.WorkspaceId, &d.Event.Data, &d.Event.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+		byId[d.ID] = d
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	rows, err = s.db.Query("SELECT id, delivery_id, status_code, error, duration_ms, created_at FROM webhook_attempts WHERE delivery_id = ANY($1) ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a app.WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryId, &a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if d, ok := byId[a.DeliveryId]; ok {
+			d.Log = append(d.Log, &a)
+		}
+	}
+	return deliveries, rows.Err()
+}
+
+// DefaultWebhookRetention is how long events are kept once delivered.
+const DefaultWebhookRetention = 7 * 24 * time.Hour
+
+// maxQueuedEvents bounds how many events of the outbox Claim queues at once.
+const maxQueuedEvents = 1000
+
+// WebhookQueue represents the queue of webhook deliveries. Instances claim
+// deliveries with SKIP LOCKED, so any number of them can work it off.
+type WebhookQueue struct {
+	db        *DB
+	retention time.Duration
+}
+
+// NewWebhookQueue returns a new instance of WebhookQueue.
+func NewWebhookQueue(db *DB, retention time.Duration) *WebhookQueue {
+	return &WebhookQueue{
+		db:        db,
+		retention: retention,
+	}
+}
+
+func (q *WebhookQueue) Claim(limit int, lease time.Duration) ([]*app.WebhookDelivery, error) {
+	now := time.Now()
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// fan the new events out to the active webhooks subscribed to them
+	_, err = tx.Exec(`WITH events AS (
+		UPDATE outbox SET queued_at = $1 WHERE id IN (SELECT id FROM outbox WHERE queued_at IS NULL ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED)
+		RETURNING id, type, workspace_id
+	)
+	INSERT INTO webhook_deliveries (webhook_id, event_id, status, next_attempt_at, updated_at)
+	SELECT w.id, e.id, $3, $1, $1 FROM events e JOIN webhooks w ON w.active
+		AND (w.workspace_id IS NULL OR w.workspace_id = e.workspace_id)
+		AND (cardinality(w.events) = 0 OR e.type = ANY(w.events))
+	ON CONFLICT (webhook_id, event_id) DO NOTHING`, now, maxQueuedEvents, app.DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+
+	// deliveries of paused webhooks wait for them
+	rows, err := tx.Query(`UPDATE webhook_deliveries d SET next_attempt_at = $1, updated_at = $2
+	FROM webhooks w, outbox e
+	WHERE d.id IN (
+		SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = $3 AND d.next_attempt_at <= $2 AND w.active
+		ORDER BY d.next_attempt_at LIMIT $4 FOR UPDATE OF d SKIP LOCKED
+	) AND w.id = d.webhook_id AND e.id = d.event_id
+	RETURNING d.id, d.status, d.attempts, d.next_attempt_at, d.last_error, d.updated_at, w.id, w.url, w.secret, e.id, e.type, e.workspace_id, e.data, e.created_at`, now.Add(lease), now, app.DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*app.WebhookDelivery{}
+	for rows.Next() {
+		d := &app.WebhookDelivery{Webhook: &app.Webhook{Active: true}, Event: &app.Event{}}
+		if err := rows.Scan(&d.ID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.UpdatedAt, &d.Webhook.ID, &d.Webhook.URL, &d.Webhook.Secret, &d.Event.ID, &d.Event.Type, &d.Event.WorkspaceId, &d.Event.Data, &d.Event.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (q *WebhookQueue) Record(d *app.WebhookDelivery, a *app.WebhookAttempt) error {
+	a.DeliveryId = d.ID
+	d.UpdatedAt = a.CreatedAt
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.QueryRow("INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id", a.DeliveryId, a.StatusCode, a.Error, a.DurationMs, a.CreatedAt).Scan(&a.ID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	_, err = tx.Exec("UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = $5 WHERE id = $6", d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.UpdatedAt, d.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (q *WebhookQueue) Purge() (int, error) {
+	cutoff := time.Now().Add(-q.retention)
+	res, err := q.db.Exec(`DELETE FROM outbox e WHERE e.queued_at < $1 AND NOT EXISTS (
+		SELECT 1 FROM webhook_deliveries d WHERE d.event_id = e.id AND (d.status = $2 OR d.updated_at >= $1)
+	)`, cutoff, app.DeliveryPending)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func scanWebhook(row scanner) (*app.Webhook, error) {
+	var w app.Webhook
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.WorkspaceId, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// nullWorkspace stores webhooks of every workspace with NULL.
+func nullWorkspace(id uint32) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
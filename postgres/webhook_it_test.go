@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"encoding/json"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestWebhookQueueIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db := Suite.GetDb(t)
+	Suite.CleanDb(t)
+	if _, err := db.Exec("DELETE FROM webhooks WHERE true"); err != nil {
+		t.Fatal("error deleting webhooks", err)
+	}
+
+	userId := createUser(db, t)
+	as := NewArticleService(db)
+	ws := NewWebhookService(db)
+	q := NewWebhookQueue(db, 0)
+
+	all := &app.Webhook{URL: "https://all.example.com", Active: true}
+	deletes := &app.Webhook{URL: "https://deletes.example.com", Events: []string{app.EventArticleDeleted}, Active: true}
+	paused := &app.Webhook{URL: "https://paused.example.com", Active: false}
+	for _, w := range []*app.Webhook{all, deletes, paused} {
+		if err := ws.Create(w); err != nil {
+			t.Fatal("cannot create webhook", err)
+		}
+	}
+
+	a := &app.Article{Title: "title", Body: "body", UserId: userId, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := as.Save(a); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	if err := as.Delete(a.Slug); err != nil {
+		t.Fatal("cannot delete article", err)
+	}
+
+	// the created event goes to one webhook, the deleted one to two
+	deliveries, err := q.Claim(10, time.Minute)
+	if err != nil || len(deliveries) != 3 {
+		t.Fatalf("wrong deliveries %v, %v", deliveries, err)
+	}
+	var article app.Article
+	if err := json.Unmarshal(deliveries[0].Event.Data, &article); err != nil || article.Slug != a.Slug {
+		t.Fatalf("wrong event data %s, %v", deliveries[0].Event.Data, err)
+	}
+
+	// claimed deliveries are leased
+	if again, err := q.Claim(10, time.Minute); err != nil || len(again) != 0 {
+		t.Fatalf("wrong deliveries %v, %v", again, err)
+	}
+
+	for _, d := range deliveries {
+		d.Status = app.DeliveryDelivered
+		d.Attempts = 1
+		if err := q.Record(d, &app.WebhookAttempt{StatusCode: 200, DurationMs: 5, CreatedAt: time.Now()}); err != nil {
+			t.Fatal("cannot record attempt", err)
+		}
+	}
+
+	log, err := ws.Deliveries(all.ID, 10)
+	if err != nil || len(log) != 2 || log[0].Status != app.DeliveryDelivered || len(log[0].Log) != 1 || log[0].Log[0].StatusCode != 200 {
+		t.Fatalf("wrong deliveries %v, %v", log, err)
+	}
+
+	// delivered events are purged after the retention period
+	if n, err := q.Purge(); err != nil || n != 2 {
+		t.Fatalf("wrong number of purged events. expected %d but got %d, %v", 2, n, err)
+	}
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookService_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewWebhookService(&DB{DB: db})
+
+	mock.ExpectQuery("^INSERT INTO webhooks*").WithArgs("https://partner.example.com", sqlmock.AnyArg(), "{}", nil, true, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	w := &app.Webhook{URL: "https://partner.example.com", Active: true}
+	if err := s.Create(w); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+
+	// a secret is generated
+	if w.ID != 1 || !strings.HasPrefix(w.Secret, webhookSecretPrefix) || len(w.Secret) != len(webhookSecretPrefix)+64 {
+		t.Fatalf("wrong webhook %+v", w)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookQueue_Claim(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	q := NewWebhookQueue(&DB{DB: db}, DefaultWebhookRetention)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^WITH events AS \\(\\s*UPDATE outbox SET queued_at(.+)INSERT INTO webhook_deliveries").WithArgs(sqlmock.AnyArg(), maxQueuedEvents, app.DeliveryPending).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("^UPDATE webhook_deliveries d SET next_attempt_at(.+)FOR UPDATE OF d SKIP LOCKED").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), app.DeliveryPending, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "attempts", "next_attempt_at", "last_error", "updated_at", "webhook_id", "url", "secret", "event_id", "type", "workspace_id", "data", "created_at"}).
+			AddRow(1, app.DeliveryPending, 0, now.Add(time.Minute), "", now, 2, "https://partner.example.com", "whsec_abc", 3, app.EventArticleCreated, 1, []byte(`{"slug":"hello"}`), now))
+	mock.ExpectCommit()
+
+	deliveries, err := q.Claim(10, time.Minute)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("wrong number of deliveries. expected %d but got %d", 1, len(deliveries))
+	}
+	d := deliveries[0]
+	if d.ID != 1 || d.Webhook.URL != "https://partner.example.com" || d.Webhook.Secret != "whsec_abc" || d.Event.ID != 3 || string(d.Event.Data) != `{"slug":"hello"}` {
+		t.Fatalf("wrong delivery %+v", d)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookQueue_Record(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	q := NewWebhookQueue(&DB{DB: db}, DefaultWebhookRetention)
+	now := time.Now()
+	d := &app.WebhookDelivery{ID: 1, Status: app.DeliveryPending, Attempts: 2, NextAttemptAt: now.Add(time.Minute), LastError: "timeout"}
+	a := &app.WebhookAttempt{Error: "timeout", DurationMs: 10000, CreatedAt: now}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO webhook_attempts*").WithArgs(1, 0, "timeout", 10000, now).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec("^UPDATE webhook_deliveries SET*").WithArgs(app.DeliveryPending, 2, d.NextAttemptAt, "timeout", now, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := q.Record(d, a); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if a.ID != 5 || a.DeliveryId != 1 {
+		t.Fatalf("wrong attempt %+v", a)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.WorkspaceService = &WorkspaceService{}
+
+// WorkspaceService represents a service to manage workspaces and their members.
+type WorkspaceService struct {
+	db *DB
+}
+
+// NewWorkspaceService returns a new instance of WorkspaceService.
+func NewWorkspaceService(db *DB) *WorkspaceService {
+	return &WorkspaceService{db: db}
+}
+
+func (s *WorkspaceService) Create(w *app.Workspace, ownerId uint32) error {
+	w.CreatedAt = time.Now()
+
+	return s.db.Transact(func(tx *DB) error {
+		err := tx.QueryRow("INSERT INTO workspaces (slug, name, created_at) VALUES ($1, $2, $3) RETURNING id", w.Slug, w.Name, w.CreatedAt).Scan(&w.ID)
+		if isConstraint(err, workspacesSlugConstraint) {
+			return app.ErrWorkspaceSlugUsed
+		} else if err != nil {
+			return translateError(err)
+		}
+
+		_, err = tx.Exec("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)", w.ID, ownerId, app.RoleOwner, w.CreatedAt)
+		return translateError(err)
+	})
+}
+
+func (s *WorkspaceService) GetBySlug(slug string) (*app.Workspace, error) {
+	var w app.Workspace
+	err := s.db.QueryRow("SELECT id, slug, name, created_at FROM workspaces WHERE slug = $1", slug).Scan(&w.ID, &w.Slug, &w.Name, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrWorkspaceNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *WorkspaceService) List(userId uint32) ([]*app.Workspace, error) {
+	workspaces := []*app.Workspace{}
+	err := queryEach(s.db, "SELECT w.id, w.slug, w.name, w.created_at FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id WHERE m.user_id = $1 ORDER BY w.id", userId, func(rows *sql.Rows) error {
+		var w app.Workspace
+		if err := rows.Scan(&w.ID, &w.Slug, &w.Name, &w.CreatedAt); err != nil {
+			return err
+		}
+		workspaces = append(workspaces, &w)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+func (s *WorkspaceService) Membership(workspaceId uint32, userId uint32) (*app.Membership, error) {
+	m := app.Membership{WorkspaceId: workspaceId, UserId: userId}
+	err := s.db.QueryRow("SELECT role, created_at FROM workspace_members WHERE workspace_id = $1 AND user_id = $2", workspaceId, userId).Scan(&m.Role, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrMembershipNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *WorkspaceService) Members(workspaceId uint32) ([]*app.Membership, error) {
+	members := []*app.Membership{}
+	rows, err := s.db.Query("SELECT user_id, role, created_at FROM workspace_members WHERE workspace_id = $1 ORDER BY created_at, user_id", workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := app.Membership{WorkspaceId: workspaceId}
+		if err := rows.Scan(&m.UserId, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, &m)
+	}
+	return members, rows.Err()
+}
+
+// SetMember keeps the date a member joined when changing their role.
+// Demoting the last owner fails with ErrLastOwner.
+func (s *WorkspaceService) SetMember(m *app.Membership) error {
+	if !validRole(m.Role) {
+		return app.ErrInvalidRole
+	}
+	m.CreatedAt = time.Now()
+
+	return s.db.Transact(func(tx *DB) error {
+		if m.Role != app.RoleOwner {
+			if err := requireOtherOwner(tx, m.WorkspaceId, m.UserId); err != nil {
+				return err
+			}
+		}
+
+		err := tx.QueryRow("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role RETURNING created_at", m.WorkspaceId, m.UserId, m.Role, m.CreatedAt).Scan(&m.CreatedAt)
+		return translateError(err)
+	})
+}
+
+func (s *WorkspaceService) RemoveMember(workspaceId uint32, userId uint32) error {
+	return s.db.Transact(func(tx *DB) error {
+		if err := requireOtherOwner(tx, workspaceId, userId); err != nil {
+			return err
+		}
+
+		res, err := tx.Exec("DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2", workspaceId, userId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return app.ErrMembershipNotFound
+		}
+		return nil
+	})
+}
+
+// requireOtherOwner fails with ErrLastOwner if the user is the only owner
+// of the workspace.
+func requireOtherOwner(tx *DB, workspaceId uint32, userId uint32) error {
+	var isOwner, otherOwners bool
+	err := tx.QueryRow("SELECT COALESCE(bool_or(user_id = $2), false), COALESCE(bool_or(user_id <> $2), false) FROM workspace_members WHERE workspace_id = $1 AND role = $3", workspaceId, userId, app.RoleOwner).Scan(&isOwner, &otherOwners)
+	if err != nil {
+		return err
+	}
+	if isOwner && !otherOwners {
+		return app.ErrLastOwner
+	}
+	return nil
+}
+
+func validRole(role string) bool {
+	for _, r := range app.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	app "github.com/leartgjoni/go-rest-template"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceService_Create(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewWorkspaceService(&DB{DB: db})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO workspaces*").WithArgs("acme", "Acme", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("^INSERT INTO workspace_members*").WithArgs(2, 1, app.RoleOwner, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := &app.Workspace{Slug: "acme", Name: "Acme"}
+	if err := s.Create(w, 1); err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if w.ID != 2 || w.CreatedAt.IsZero() {
+		t.Fatalf("wrong workspace %+v", w)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWorkspaceService_Membership(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewWorkspaceService(&DB{DB: db})
+
+	mock.ExpectQuery("^SELECT role, created_at FROM workspace_members*").WithArgs(2, 1).WillReturnRows(sqlmock.NewRows([]string{"role", "created_at"}).AddRow(app.RoleEditor, time.Now()))
+	mock.ExpectQuery("^SELECT role, created_at FROM workspace_members*").WithArgs(2, 3).WillReturnRows(sqlmock.NewRows([]string{"role", "created_at"}))
+
+	m, err := s.Membership(2, 1)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected", err)
+	}
+	if m.Role != app.RoleEditor || m.WorkspaceId != 2 || m.UserId != 1 {
+		t.Fatalf("wrong membership %+v", m)
+	}
+
+	if _, err := s.Membership(2, 3); err != app.ErrMembershipNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrMembershipNotFound, err)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWorkspaceService_SetMember(t *testing.T) {
+	var tests = []struct {
+		name          string
+		member        *app.Membership
+		isOwner       bool
+		otherOwners   bool
+		expectedError error
+	}{
+		{"promote", &app.Membership{WorkspaceId: 2, UserId: 3, Role: app.RoleOwner}, false, true, nil},
+		{"demote", &app.Membership{WorkspaceId: 2, UserId: 1, Role: app.RoleEditor}, true, true, nil},
+		{"demote last owner", &app.Membership{WorkspaceId: 2, UserId: 1, Role: app.RoleEditor}, true, false, app.ErrLastOwner},
+		{"invalid role", &app.Membership{WorkspaceId: 2, UserId: 1, Role: "admin"}, false, false, app.ErrInvalidRole},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			s := NewWorkspaceService(&DB{DB: db})
+
+			if test.expectedError != app.ErrInvalidRole {
+				mock.ExpectBegin()
+				if test.member.Role != app.RoleOwner {
+					mock.ExpectQuery("^SELECT COALESCE(.+) FROM workspace_members*").WithArgs(test.member.WorkspaceId, test.member.UserId, app.RoleOwner).WillReturnRows(sqlmock.NewRows([]string{"is_owner", "other_owners"}).AddRow(test.isOwner, test.otherOwners))
+				}
+				if test.expectedError == nil {
+					mock.ExpectQuery("^INSERT INTO workspace_members(.+) ON CONFLICT*").WithArgs(test.member.WorkspaceId, test.member.UserId, test.member.Role, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+					mock.ExpectCommit()
+				} else {
+					mock.ExpectRollback()
+				}
+			}
+
+			if err := s.SetMember(test.member); err != test.expectedError {
+				t.Fatalf("wrong error. expected %v but got %v", test.expectedError, err)
+			}
+
+			// we make sure that all expectations were met
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
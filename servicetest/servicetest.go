@@ -0,0 +1,484 @@
+// Package servicetest checks that implementations of the app services
+// behave the same, whatever they store data in. A backend's tests call Run
+// with a factory returning its services:
+//
+//	func TestServices(t *testing.T) {
+//		servicetest.Run(t, func(t *testing.T) *servicetest.Services {
+//			db := NewDB()
+//			return &servicetest.Services{Users: NewUserService(db, ring), Articles: NewArticleService(db)}
+//		})
+//	}
+package servicetest
+
+import (
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// Services are the services under test.
+type Services struct {
+	Users    app.UserService
+	Articles app.ArticleService
+	Sessions app.SessionService // optional, where the user service leaves revoking tokens to
+}
+
+// Factory returns services backed by an empty store, for a single test. The
+// article service has to know about the users of the user service.
+type Factory func(t *testing.T) *Services
+
+// slugPattern matches the slug of an article titled "title 1".
+var slugPattern = regexp.MustCompile(`^title-1-[a-zA-Z0-9]{12}$`)
+
+// Run runs the tests of every service the factory returns.
+func Run(t *testing.T, newServices Factory) {
+	t.Run("UserService", func(t *testing.T) { UserService(t, newServices) })
+	t.Run("ArticleService", func(t *testing.T) { ArticleService(t, newServices) })
+}
+
+// UserService tests the user service of the factory.
+func UserService(t *testing.T, newServices Factory) {
+	t.Run("Save", func(t *testing.T) { testUserSave(t, newServices(t).Users) })
+	t.Run("Get", func(t *testing.T) { testUserGet(t, newServices(t).Users) })
+	t.Run("Update", func(t *testing.T) { testUserUpdate(t, newServices(t).Users) })
+	t.Run("Login", func(t *testing.T) { testUserLogin(t, newServices(t).Users) })
+	t.Run("ChangePassword", func(t *testing.T) { testUserChangePassword(t, newServices(t)) })
+	t.Run("Token", func(t *testing.T) { testUserToken(t, newServices(t).Users) })
+}
+
+// ArticleService tests the article service of the factory.
+func ArticleService(t *testing.T, newServices Factory) {
+	t.Run("Save", func(t *testing.T) { testArticleSave(t, newServices(t)) })
+	t.Run("GetBySlug", func(t *testing.T) { testArticleGetBySlug(t, newServices(t)) })
+	t.Run("GetAll", func(t *testing.T) { testArticleGetAll(t, newServices(t)) })
+	t.Run("Update", func(t *testing.T) { testArticleUpdate(t, newServices(t)) })
+	t.Run("Delete", func(t *testing.T) { testArticleDelete(t, newServices(t)) })
+}
+
+// saveUser saves a user whose password is "password".
+func saveUser(t *testing.T, us app.UserService, username string, email string) *app.User {
+	t.Helper()
+
+	user := &app.User{
+		Username:  username,
+		Email:     email,
+		Password:  "password",
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+		UpdatedAt: time.Now().Truncate(time.Millisecond),
+	}
+	if err := us.Save(user); err != nil {
+		t.Fatal("cannot save user", err)
+	}
+	return user
+}
+
+// saveArticle saves an article of a new user.
+func saveArticle(t *testing.T, s *Services, title string) *app.Article {
+	t.Helper()
+
+	user, err := s.Users.GetByUsername("author")
+	if err != nil {
+		user = saveUser(t, s.Users, "author", "author@test.com")
+	}
+
+	article := &app.Article{
+		Title:     title,
+		Body:      "body of " + title,
+		UserId:    user.ID,
+		CreatedAt: time.Now().Truncate(time.Millisecond),
+		UpdatedAt: time.Now().Truncate(time.Millisecond),
+	}
+	if err := s.Articles.Save(article); err != nil {
+		t.Fatal("cannot save article", err)
+	}
+	return article
+}
+
+func testUserSave(t *testing.T, us app.UserService) {
+	user := saveUser(t, us, "test", "test@test.com")
+	if user.ID == 0 {
+		t.Fatal("user id still zero")
+	}
+	if user.Password == "password" {
+		t.Fatal("expected password to be hashed")
+	}
+
+	tests := []struct {
+		name     string
+		user     *app.User
+		expected error
+	}{
+		{
+			name:     "email already used",
+			user:     &app.User{Username: "other", Email: "test@test.com", Password: "password"},
+			expected: app.ErrEmailAlreadyUsed,
+		},
+		{
+			name:     "email already used in another case",
+			user:     &app.User{Username: "other", Email: "Test@Test.com", Password: "password"},
+			expected: app.ErrEmailAlreadyUsed,
+		},
+		{
+			name:     "username already used",
+			user:     &app.User{Username: "test", Email: "other@test.com", Password: "password"},
+			expected: app.ErrUsernameAlreadyUsed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.user.CreatedAt = time.Now()
+			test.user.UpdatedAt = time.Now()
+			if err := us.Save(test.user); err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+		})
+	}
+}
+
+func testUserGet(t *testing.T, us app.UserService) {
+	user := saveUser(t, us, "test", "test@test.com")
+
+	got, err := us.GetById(user.ID)
+	if err != nil {
+		t.Fatal("cannot get user by id", err)
+	}
+	if got.ID != user.ID || got.Username != user.Username || got.Email != user.Email || got.Password != user.Password || !got.CreatedAt.Equal(user.CreatedAt) {
+		t.Fatalf("expected %+v but got %+v", user, got)
+	}
+
+	got, err = us.GetByUsername("test")
+	if err != nil {
+		t.Fatal("cannot get user by username", err)
+	}
+	if got.ID != user.ID {
+		t.Fatalf("expected user %d but got %d", user.ID, got.ID)
+	}
+
+	if _, err := us.GetById(user.ID + 1); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+	if _, err := us.GetByUsername("other"); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+}
+
+func testUserUpdate(t *testing.T, us app.UserService) {
+	user := saveUser(t, us, "test", "test@test.com")
+	other := saveUser(t, us, "other", "other@test.com")
+
+	tests := []struct {
+		name     string
+		user     *app.User
+		expected error
+	}{
+		{
+			name:     "username already used",
+			user:     &app.User{ID: user.ID, Username: other.Username},
+			expected: app.ErrUsernameAlreadyUsed,
+		},
+		{
+			name:     "not found",
+			user:     &app.User{ID: other.ID + 1, Username: "new"},
+			expected: app.ErrUserNotFound,
+		},
+		{
+			name:     "keeping the username",
+			user:     &app.User{ID: user.ID, Username: user.Username, Bio: "Hi"},
+			expected: nil,
+		},
+		{
+			name:     "success",
+			user:     &app.User{ID: user.ID, Username: "new", Bio: "Hello"},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.user.UpdatedAt = time.Now()
+			if err := us.Update(test.user); err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+		})
+	}
+
+	got, err := us.GetById(user.ID)
+	if err != nil {
+		t.Fatal("cannot get user", err)
+	}
+	if got.Username != "new" || got.Bio != "Hello" {
+		t.Fatalf("expected updated user but got %+v", got)
+	}
+}
+
+func testUserLogin(t *testing.T, us app.UserService) {
+	user := saveUser(t, us, "test", "test@test.com")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		expected error
+	}{
+		{
+			name:     "correct login",
+			email:    "test@test.com",
+			password: "password",
+			expected: nil,
+		},
+		{
+			name:     "email in another case",
+			email:    "TEST@test.com",
+			password: "password",
+			expected: nil,
+		},
+		{
+			name:     "wrong email",
+			email:    "other@test.com",
+			password: "password",
+			expected: app.ErrWrongCredentials,
+		},
+		{
+			name:     "wrong password",
+			email:    "test@test.com",
+			password: "wrong",
+			expected: app.ErrWrongCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := &app.User{Email: test.email, Password: test.password}
+			token, err := us.Login(u)
+			if err != test.expected {
+				t.Fatalf("wrong error. expected %s but got %s", test.expected, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if token == "" || u.ID != user.ID || u.Username != user.Username {
+				t.Fatalf("expected a token and the user but got %q, %+v", token, u)
+			}
+			assertToken(t, us, token, user.ID)
+		})
+	}
+}
+
+func testUserChangePassword(t *testing.T, s *Services) {
+	us := s.Users
+	user := saveUser(t, us, "test", "test@test.com")
+	other, err := us.CreateToken(user.ID)
+	if err != nil {
+		t.Fatal("cannot create token", err)
+	}
+	// tokens carry their issue time in seconds
+	time.Sleep(time.Second)
+
+	if _, err := us.ChangePassword(user.ID, "wrong", "new-password"); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+	if _, err := us.ChangePassword(user.ID+1, "password", "new-password"); err != app.ErrUserNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrUserNotFound, err)
+	}
+
+	token, err := us.ChangePassword(user.ID, "password", "new-password")
+	if err != nil {
+		t.Fatal("cannot change password", err)
+	}
+	assertToken(t, us, token, user.ID)
+	if !authenticates(s, token) {
+		t.Fatal("expected the new token to authenticate")
+	}
+	// the other sessions are signed out
+	if authenticates(s, other) {
+		t.Fatal("expected tokens issued before the password change to be revoked")
+	}
+
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "password"}); err != app.ErrWrongCredentials {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrWrongCredentials, err)
+	}
+	if _, err := us.Login(&app.User{Email: "test@test.com", Password: "new-password"}); err != nil {
+		t.Fatal("cannot login with the new password", err)
+	}
+}
+
+func testUserToken(t *testing.T, us app.UserService) {
+	user := saveUser(t, us, "test", "test@test.com")
+
+	token, err := us.CreateToken(user.ID)
+	if err != nil {
+		t.Fatal("cannot create token", err)
+	}
+	first := assertToken(t, us, token, user.ID)
+
+	// every token is a session of its own
+	token, err = us.CreateToken(user.ID)
+	if err != nil {
+		t.Fatal("cannot create token", err)
+	}
+	if second := assertToken(t, us, token, user.ID); second.ID == first.ID {
+		t.Fatal("expected tokens to have different sessions")
+	}
+
+	for _, header := range []string{"", "Bearer", "Bearer invalid"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", header)
+		if _, err := us.ExtractAuthenticationToken(r); err == nil {
+			t.Fatalf("expected Authorization %q to be rejected", header)
+		}
+	}
+}
+
+// assertToken checks that a token authenticates the user and returns its
+// session.
+func assertToken(t *testing.T, us app.UserService, token string, userId uint32) *app.Session {
+	t.Helper()
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	session, err := us.ExtractAuthenticationToken(r)
+	if err != nil {
+		t.Fatal("cannot extract token", err)
+	}
+	if session.UserId != userId || session.ID == "" {
+		t.Fatalf("expected a session of user %d but got %+v", userId, session)
+	}
+	return session
+}
+
+// authenticates reports whether a token is accepted, by the session
+// service if there is one.
+func authenticates(s *Services, token string) bool {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	session, err := s.Users.ExtractAuthenticationToken(r)
+	if err != nil {
+		return false
+	}
+	if s.Sessions != nil {
+		return s.Sessions.Touch(session) == nil
+	}
+	return true
+}
+
+func testArticleSave(t *testing.T, s *Services) {
+	article := saveArticle(t, s, "title 1")
+	if article.ID == 0 {
+		t.Fatal("article id still zero")
+	}
+	if !slugPattern.MatchString(article.Slug) {
+		t.Fatalf("wrong slug %s", article.Slug)
+	}
+
+	// slugs are unique even for the same title
+	if other := saveArticle(t, s, "title 1"); other.Slug == article.Slug {
+		t.Fatal("expected articles with the same title to have different slugs")
+	}
+
+	err := s.Articles.Save(&app.Article{Title: "title", UserId: article.UserId + 1, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if !errors.Is(err, app.ErrForeignKeyViolation) {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrForeignKeyViolation, err)
+	}
+}
+
+func testArticleGetBySlug(t *testing.T, s *Services) {
+	article := saveArticle(t, s, "title 1")
+
+	got, err := s.Articles.GetBySlug(article.Slug)
+	if err != nil {
+		t.Fatal("cannot get article", err)
+	}
+	if got.ID != article.ID || got.Title != article.Title || got.Body != article.Body || got.UserId != article.UserId || !got.CreatedAt.Equal(article.CreatedAt) {
+		t.Fatalf("expected %+v but got %+v", article, got)
+	}
+
+	if _, err := s.Articles.GetBySlug("other"); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+}
+
+func testArticleGetAll(t *testing.T, s *Services) {
+	articles, err := s.Articles.GetAll()
+	if err != nil {
+		t.Fatal("cannot get articles", err)
+	}
+	if len(articles) != 0 {
+		t.Fatalf("expected no articles but got %d", len(articles))
+	}
+
+	var saved []*app.Article
+	for _, title := range []string{"title 1", "title 2", "title 3"} {
+		saved = append(saved, saveArticle(t, s, title))
+	}
+
+	articles, err = s.Articles.GetAll()
+	if err != nil {
+		t.Fatal("cannot get articles", err)
+	}
+	if len(articles) != len(saved) {
+		t.Fatalf("expected %d articles but got %d", len(saved), len(articles))
+	}
+
+	// oldest first
+	for i, a := range articles {
+		if a.ID != saved[i].ID || a.Slug != saved[i].Slug {
+			t.Fatalf("expected article %d at %d but got %d", saved[i].ID, i, a.ID)
+		}
+	}
+}
+
+func testArticleUpdate(t *testing.T, s *Services) {
+	article := saveArticle(t, s, "title 1")
+	oldSlug := article.Slug
+
+	article.Title = "title 1"
+	article.Body = "new body"
+	article.UpdatedAt = time.Now().Truncate(time.Millisecond)
+	if err := s.Articles.Update(article); err != nil {
+		t.Fatal("cannot update article", err)
+	}
+	if !slugPattern.MatchString(article.Slug) || article.Slug == oldSlug {
+		t.Fatalf("expected a new slug but got %s", article.Slug)
+	}
+
+	if _, err := s.Articles.GetBySlug(oldSlug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+	got, err := s.Articles.GetBySlug(article.Slug)
+	if err != nil {
+		t.Fatal("cannot get article", err)
+	}
+	if got.Body != "new body" || !got.UpdatedAt.Equal(article.UpdatedAt) {
+		t.Fatalf("expected updated article but got %+v", got)
+	}
+
+	err = s.Articles.Update(&app.Article{Slug: "other", Title: "title", UpdatedAt: time.Now()})
+	if err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+}
+
+func testArticleDelete(t *testing.T, s *Services) {
+	article := saveArticle(t, s, "title 1")
+	other := saveArticle(t, s, "title 2")
+
+	if err := s.Articles.Delete(article.Slug); err != nil {
+		t.Fatal("cannot delete article", err)
+	}
+	if _, err := s.Articles.GetBySlug(article.Slug); err != app.ErrArticleNotFound {
+		t.Fatalf("wrong error. expected %s but got %s", app.ErrArticleNotFound, err)
+	}
+	if _, err := s.Articles.GetBySlug(other.Slug); err != nil {
+		t.Fatal("expected other articles to be kept", err)
+	}
+
+	// deleting twice isn't an error
+	if err := s.Articles.Delete(article.Slug); err != nil {
+		t.Fatal("cannot delete article again", err)
+	}
+}
@@ -0,0 +1,25 @@
+package app
+
+import "time"
+
+// Session is a login on one device. Every token issued at login belongs to
+// a session, which can be revoked before the token expires.
+type Session struct {
+	ID         string    `json:"id"`
+	UserId     uint32    `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+type SessionService interface {
+	// Touch checks that the session is still valid, recording the client
+	// using it. Lookups may be cached, so a session revoked elsewhere can
+	// stay valid for a short while.
+	Touch(s *Session) error
+	List(userId uint32) ([]*Session, error)
+	Revoke(userId uint32, id string) error
+	// RevokeOthers revokes every session of the user but the current one.
+	RevokeOthers(userId uint32, currentId string) error
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"crypto"
+	"time"
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey is a key pair used to sign and verify JWTs. The active key signs
+// new tokens once ActivatesAt has passed, so verifiers see it published
+// first; rotated keys keep verifying until they are retired.
+type SigningKey struct {
+	ID          string        // kid, the RFC 7638 thumbprint of the public key
+	Algorithm   string        // RS256 or EdDSA
+	PrivateKey  crypto.Signer // public key available through PrivateKey.Public()
+	Active      bool
+	CreatedAt   time.Time
+	ActivatesAt time.Time // when it starts signing, the previous key signs until then
+	RotatedAt   *time.Time
+}
+
+type SigningKeyService interface {
+	// Keys returns every key that hasn't been retired, active key first.
+	Keys() ([]*SigningKey, error)
+	// Rotate makes a new key of the given algorithm the active one. It's
+	// published for a cache period of the key set before it signs, unless
+	// there's no key to sign with until then.
+	Rotate(algorithm string) (*SigningKey, error)
+}
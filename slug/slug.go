@@ -0,0 +1,21 @@
+// Package slug makes the slugs of articles: their title in lower case with
+// dashes for spaces, and a random suffix so titles may repeat.
+package slug
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// New returns a slug for title with a random suffix of length characters.
+func New(title string, length int) string {
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		b.WriteByte(chars[rand.Intn(len(chars))])
+	}
+
+	return fmt.Sprintf("%s-%s", strings.Replace(strings.ToLower(title), " ", "-", -1), b.String())
+}
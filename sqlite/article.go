@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/slug"
+)
+
+// Ensure service implements interface.
+var _ app.ArticleService = &ArticleService{}
+
+// ArticleService represents a service to manage articles.
+type ArticleService struct {
+	db *DB
+}
+
+// NewArticleService returns a new instance of ArticleService.
+func NewArticleService(db *DB) *ArticleService {
+	return &ArticleService{
+		db: db,
+	}
+}
+
+func (s *ArticleService) GetAll() ([]*app.Article, error) {
+	rows, err := s.db.Query("SELECT id, slug, title, body, COALESCE(user_id, 0), created_at, updated_at FROM articles ORDER BY id")
+	if err != nil {
+		return []*app.Article{}, err
+	}
+	defer func() {
+		if dErr := rows.Close(); dErr != nil && err == nil {
+			err = dErr
+		}
+	}()
+
+	var articles []*app.Article
+	for rows.Next() {
+		var article app.Article
+		err := rows.Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.CreatedAt, &article.UpdatedAt)
+		if err != nil {
+			return []*app.Article{}, err
+		}
+		articles = append(articles, &article)
+	}
+
+	return articles, nil
+}
+
+func (s *ArticleService) GetBySlug(slug string) (*app.Article, error) {
+	var article app.Article
+	err := s.db.QueryRow("SELECT id, slug, title, body, COALESCE(user_id, 0), created_at, updated_at FROM articles WHERE slug = ?", slug).Scan(&article.ID, &article.Slug, &article.Title, &article.Body, &article.UserId, &article.CreatedAt, &article.UpdatedAt)
+
+	if err != nil || article.ID == 0 {
+		return &app.Article{}, app.ErrArticleNotFound
+	}
+
+	return &article, nil
+}
+
+// maxSlugAttempts bounds how often a write is retried with a new slug when
+// the random suffix collides with an existing one.
+const maxSlugAttempts = 3
+
+func (s *ArticleService) Save(a *app.Article) error {
+	var res sql.Result
+	var err error
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		a.Slug = slug.New(a.Title, 12)
+		res, err = s.db.Exec("INSERT INTO articles (slug, title, body, user_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", a.Slug, a.Title, a.Body, a.UserId, a.CreatedAt, a.UpdatedAt)
+		if !isConstraint(err, articlesSlugConstraint) {
+			break
+		}
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return errors.New("unable to save")
+	}
+
+	a.ID = uint32(id)
+	return nil
+}
+
+func (s *ArticleService) Update(a *app.Article) error {
+	var res sql.Result
+	var newSlug string
+	var err error
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		newSlug = slug.New(a.Title, 12)
+		res, err = s.db.Exec("UPDATE articles SET slug = ?, title = ?, body = ?, updated_at = ? WHERE slug = ?", newSlug, a.Title, a.Body, a.UpdatedAt, a.Slug)
+		if !isConstraint(err, articlesSlugConstraint) {
+			break
+		}
+	}
+	if err != nil {
+		return translateError(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrArticleNotFound
+	}
+
+	a.Slug = newSlug
+	return nil
+}
+
+func (s *ArticleService) Delete(slug string) error {
+	_, err := s.db.Exec("DELETE FROM articles WHERE slug = ?", slug)
+	return err
+}
@@ -0,0 +1,107 @@
+// Package sqlite stores users and articles in a SQLite database file, for
+// deployments too small to justify a Postgres server. It needs cgo.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultBusyTimeout is how long a write waits for a concurrent one to
+// finish before failing.
+const DefaultBusyTimeout = 5 * time.Second
+
+// DB is a database handle.
+type DB struct {
+	*sql.DB
+}
+
+// Open returns a DB reference for a database file, which is created if it
+// doesn't exist. The database is in WAL mode, so reads don't block writes.
+func Open(path string, busyTimeout time.Duration) (*DB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	params.Set("_foreign_keys", "on")
+	// transactions take the write lock right away, so two of them can't
+	// both read and then deadlock upgrading to write
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// check db is available
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return &DB{DB: db}, nil
+}
+
+// Migrate applies the migrations of a directory, e.g. sqlite/migrations,
+// that haven't been applied yet. Migrations are applied in the order of
+// their names, each in a transaction.
+func (db *DB) Migrate(dir string) error {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (name VARCHAR (255) PRIMARY KEY, applied_at TIMESTAMP NOT NULL)"); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".sql") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := db.migrate(filepath.Join(dir, name), name); err != nil {
+			return fmt.Errorf("migration %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) migrate(path string, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var applied int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE name = ?", name).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	statements, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(string(statements)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (name, applied_at) VALUES (?, ?)", name, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDb returns a migrated database in a temporary directory, and a
+// function removing it.
+func openTestDb(t *testing.T) (*DB, func()) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal("cannot create temp dir", err)
+	}
+
+	db, err := Open(filepath.Join(dir, "app.db"), DefaultBusyTimeout)
+	if err != nil {
+		t.Fatal("cannot open db", err)
+	}
+	remove := func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}
+
+	if err := db.Migrate("migrations"); err != nil {
+		remove()
+		t.Fatal("cannot migrate db", err)
+	}
+	return db, remove
+}
+
+func TestDB_Open(t *testing.T) {
+	db, remove := openTestDb(t)
+	defer remove()
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal("cannot read journal mode", err)
+	}
+	if mode != "wal" {
+		t.Fatalf("expected wal journal mode but got %s", mode)
+	}
+
+	var foreignKeys int
+	if err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		t.Fatal("cannot read foreign keys", err)
+	}
+	if foreignKeys != 1 {
+		t.Fatal("expected foreign keys to be enforced")
+	}
+}
+
+func TestDB_Migrate(t *testing.T) {
+	db, remove := openTestDb(t)
+	defer remove()
+
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal("cannot count migrations", err)
+	}
+	files, _ := filepath.Glob("migrations/*.sql")
+	if applied != len(files) {
+		t.Fatalf("expected %d migrations to be applied but got %d", len(files), applied)
+	}
+
+	// applied migrations are skipped
+	if err := db.Migrate("migrations"); err != nil {
+		t.Fatal("cannot migrate db again", err)
+	}
+}
+
+func TestDB_ConcurrentWriters(t *testing.T) {
+	db, remove := openTestDb(t)
+	defer remove()
+	us := newTestUserService(t, db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- us.Save(&app.User{Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@test.com", i), Password: "password", CreatedAt: time.Now(), UpdatedAt: time.Now()})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	// writers wait for each other instead of failing with "database is locked"
+	for err := range errs {
+		if err != nil {
+			t.Fatal("cannot save user", err)
+		}
+	}
+}
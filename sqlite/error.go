@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// constraint names the services map to app errors, named as in Postgres so
+// callers see the same ones whatever the backend
+const (
+	usersEmailConstraint    = "users_email_lower_key"
+	usersUsernameConstraint = "users_username_key"
+	articlesSlugConstraint  = "articles_slug_key"
+)
+
+// constraintErrors maps SQLite extended error codes to app constraint errors.
+var constraintErrors = map[sqlite3.ErrNoExtended]error{
+	sqlite3.ErrConstraintUnique:     app.ErrUniqueViolation,
+	sqlite3.ErrConstraintPrimaryKey: app.ErrUniqueViolation,
+	sqlite3.ErrConstraintForeignKey: app.ErrForeignKeyViolation,
+	sqlite3.ErrConstraintNotNull:    app.ErrNotNullViolation,
+	sqlite3.ErrConstraintCheck:      app.ErrCheckViolation,
+}
+
+// constraintNames maps what SQLite reports as violated, the columns of a
+// constraint or an index for expression indexes, to constraint names.
+var constraintNames = map[string]string{
+	"index 'users_email_lower_key'": usersEmailConstraint,
+	"users.username":                usersUsernameConstraint,
+	"articles.slug":                 articlesSlugConstraint,
+}
+
+// translateError turns constraint violations into app.ConstraintError, other
+// errors are returned as is.
+func translateError(err error) error {
+	sqliteErr, ok := err.(sqlite3.Error)
+	if !ok {
+		return err
+	}
+
+	constraintErr, ok := constraintErrors[sqliteErr.ExtendedCode]
+	if !ok {
+		return err
+	}
+
+	// e.g. "UNIQUE constraint failed: users.username", foreign key
+	// violations don't tell which one
+	var constraint string
+	if i := strings.Index(sqliteErr.Error(), ": "); i >= 0 {
+		constraint = sqliteErr.Error()[i+2:]
+		if name, ok := constraintNames[constraint]; ok {
+			constraint = name
+		}
+	}
+	return &app.ConstraintError{Err: constraintErr, Constraint: constraint}
+}
+
+// isConstraint reports whether err violates the named constraint.
+func isConstraint(err error, constraint string) bool {
+	constraintErr, ok := translateError(err).(*app.ConstraintError)
+	return ok && constraintErr.Constraint == constraint
+}
+
+// userConstraintError maps conflicts on the users table to the app errors
+// clients understand.
+func userConstraintError(err error) error {
+	switch {
+	case isConstraint(err, usersEmailConstraint):
+		return app.ErrEmailAlreadyUsed
+	case isConstraint(err, usersUsernameConstraint):
+		return app.ErrUsernameAlreadyUsed
+	}
+	return translateError(err)
+}
@@ -0,0 +1,9 @@
+-- emails are unique regardless of case, see add_case_insensitive_email_index
+CREATE TABLE users(
+                      id INTEGER PRIMARY KEY AUTOINCREMENT,
+                      username VARCHAR (50) NOT NULL,
+                      email VARCHAR (255) NOT NULL,
+                      password VARCHAR (255) NOT NULL,
+                      created_at TIMESTAMP NOT NULL,
+                      updated_at TIMESTAMP
+);
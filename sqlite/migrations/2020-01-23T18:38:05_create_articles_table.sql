@@ -0,0 +1,11 @@
+-- anonymised articles outlive their author, as in Postgres since
+-- add_account_deletion_and_exports
+CREATE TABLE articles(
+                         id INTEGER PRIMARY KEY AUTOINCREMENT,
+                         slug VARCHAR (255) UNIQUE NOT NULL,
+                         title VARCHAR (255) NOT NULL,
+                         body TEXT,
+                         user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+                         created_at TIMESTAMP NOT NULL,
+                         updated_at TIMESTAMP
+);
@@ -0,0 +1,12 @@
+CREATE TABLE signing_keys(
+                      id VARCHAR (64) PRIMARY KEY,
+                      algorithm VARCHAR (16) NOT NULL,
+                      private_key BLOB NOT NULL,
+                      active BOOLEAN NOT NULL DEFAULT false,
+                      created_at TIMESTAMP NOT NULL,
+                      rotated_at TIMESTAMP,
+                      retired_at TIMESTAMP
+);
+
+-- at most one key signs at a time
+CREATE UNIQUE INDEX signing_keys_active_idx ON signing_keys (active) WHERE active;
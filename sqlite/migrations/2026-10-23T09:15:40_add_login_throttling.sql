@@ -0,0 +1,2 @@
+-- login throttling needs Postgres, only the admin flag applies here
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
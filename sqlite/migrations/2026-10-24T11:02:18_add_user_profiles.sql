@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+
+-- profiles are looked up by username, so it has to be unique
+CREATE UNIQUE INDEX users_username_key ON users (username);
@@ -0,0 +1,2 @@
+-- tokens issued earlier, e.g. before a password change, no longer authenticate
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMP;
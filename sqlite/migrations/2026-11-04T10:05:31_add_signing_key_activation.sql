@@ -0,0 +1,3 @@
+-- rotated keys are published before they sign
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMP;
+UPDATE signing_keys SET activates_at = created_at;
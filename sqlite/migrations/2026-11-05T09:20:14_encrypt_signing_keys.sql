@@ -0,0 +1,21 @@
+-- private keys are stored encrypted; the ones stored in clear before are
+-- encrypted by the server on start. SQLite can't drop NOT NULL, so the
+-- table is rebuilt.
+CREATE TABLE signing_keys_new(
+                      id VARCHAR (64) PRIMARY KEY,
+                      algorithm VARCHAR (16) NOT NULL,
+                      private_key BLOB,
+                      encrypted_private_key TEXT,
+                      active BOOLEAN NOT NULL DEFAULT false,
+                      created_at TIMESTAMP NOT NULL,
+                      activates_at TIMESTAMP,
+                      rotated_at TIMESTAMP,
+                      retired_at TIMESTAMP
+);
+INSERT INTO signing_keys_new (id, algorithm, private_key, active, created_at, activates_at, rotated_at, retired_at)
+SELECT id, algorithm, private_key, active, created_at, activates_at, rotated_at, retired_at FROM signing_keys;
+DROP TABLE signing_keys;
+ALTER TABLE signing_keys_new RENAME TO signing_keys;
+
+-- at most one key signs at a time
+CREATE UNIQUE INDEX signing_keys_active_idx ON signing_keys (active) WHERE active;
@@ -0,0 +1,25 @@
+package sqlite
+
+import (
+	"github.com/leartgjoni/go-rest-template/servicetest"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	var removes []func()
+	defer func() {
+		for _, remove := range removes {
+			remove()
+		}
+	}()
+
+	servicetest.Run(t, func(t *testing.T) *servicetest.Services {
+		db, remove := openTestDb(t)
+		removes = append(removes, remove)
+
+		return &servicetest.Services{
+			Users:    newTestUserService(t, db),
+			Articles: NewArticleService(db),
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"database/sql"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.SigningKeyService = &SigningKeyService{}
+
+// SigningKeyService represents a service to manage JWT signing keys.
+type SigningKeyService struct {
+	db            *DB
+	encryptionKey []byte
+}
+
+// NewSigningKeyService returns a new instance of SigningKeyService. Private
+// keys are stored encrypted with encryptionKey (AES-128, 192 or 256).
+func NewSigningKeyService(db *DB, encryptionKey []byte) *SigningKeyService {
+	return &SigningKeyService{
+		db:            db,
+		encryptionKey: encryptionKey,
+	}
+}
+
+// Keys returns the keys tokens may still be signed with: the active key and
+// keys rotated out less than a token lifetime ago.
+func (s *SigningKeyService) Keys() ([]*app.SigningKey, error) {
+	rows, err := s.db.Query("SELECT id, algorithm, private_key, encrypted_private_key, active, created_at, activates_at, rotated_at FROM signing_keys WHERE retired_at IS NULL AND (rotated_at IS NULL OR rotated_at > ?) ORDER BY active DESC, created_at DESC", time.Now().UTC().Add(-keyring.TokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if dErr := rows.Close(); dErr != nil && err == nil {
+			err = dErr
+		}
+	}()
+
+	keys := []*app.SigningKey{}
+	for rows.Next() {
+		var k app.SigningKey
+		var der []byte
+		var encrypted sql.NullString
+		if err := rows.Scan(&k.ID, &k.Algorithm, &der, &encrypted, &k.Active, &k.CreatedAt, &k.ActivatesAt, &k.RotatedAt); err != nil {
+			return nil, err
+		}
+
+		// keys stored before encryption are read as they are until EncryptKeys
+		if encrypted.Valid {
+			k.PrivateKey, err = keyring.OpenPrivateKey(s.encryptionKey, k.Algorithm, encrypted.String)
+		} else {
+			k.PrivateKey, err = keyring.ParsePrivateKey(k.Algorithm, der)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Rotate generates a new active key. It signs once published for
+// keyring.PublishDelay, the previous active key signing until then and
+// verifying until every token it signed has expired; keys rotated out
+// before that are retired.
+func (s *SigningKeyService) Rotate(algorithm string) (*app.SigningKey, error) {
+	k, err := keyring.Generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k.Active = true
+
+	encrypted, err := keyring.SealPrivateKey(s.encryptionKey, k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE signing_keys SET retired_at = ? WHERE retired_at IS NULL AND NOT active AND rotated_at < ?", now, now.Add(-keyring.TokenTTL)); err != nil {
+		return nil, err
+	}
+	k.ActivatesAt = now.Add(keyring.PublishDelay)
+	res, err := tx.Exec("UPDATE signing_keys SET active = false, rotated_at = ? WHERE active", k.ActivatesAt)
+	if err != nil {
+		return nil, err
+	}
+	// without a key to sign with in the meantime, the new one signs right away
+	if rotated, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if rotated == 0 {
+		k.ActivatesAt = now
+	}
+	if _, err := tx.Exec("INSERT INTO signing_keys (id, algorithm, encrypted_private_key, active, created_at, activates_at) VALUES (?, ?, ?, ?, ?, ?)", k.ID, k.Algorithm, encrypted, k.Active, k.CreatedAt, k.ActivatesAt); err != nil {
+		return nil, err
+	}
+
+	return k, tx.Commit()
+}
+
+// EncryptKeys encrypts the private keys stored in clear, before they were
+// stored encrypted.
+func (s *SigningKeyService) EncryptKeys() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.Query("SELECT id, private_key FROM signing_keys WHERE private_key IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	encrypted := map[string]string{}
+	for rows.Next() {
+		var id string
+		var der []byte
+		if err := rows.Scan(&id, &der); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if encrypted[id], err = keyring.SealDER(s.encryptionKey, der); err != nil {
+			_ = rows.Close()
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, e := range encrypted {
+		if _, err := tx.Exec("UPDATE signing_keys SET encrypted_private_key = ?, private_key = NULL WHERE id = ?", e, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
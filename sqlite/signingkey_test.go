@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"crypto/ed25519"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"testing"
+	"time"
+)
+
+// testEncryptionKey encrypts the signing keys of tests.
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSigningKeyService_Encryption(t *testing.T) {
+	db, remove := openTestDb(t)
+	defer remove()
+
+	ks := NewSigningKeyService(db, testEncryptionKey)
+
+	// a key stored in clear before keys were encrypted
+	legacy, err := keyring.Generate(app.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal("cannot generate key", err)
+	}
+	der, err := keyring.MarshalPrivateKey(legacy.PrivateKey)
+	if err != nil {
+		t.Fatal("cannot marshal key", err)
+	}
+	if _, err := db.Exec("INSERT INTO signing_keys (id, algorithm, private_key, active, created_at, activates_at) VALUES (?, ?, ?, ?, ?, ?)", legacy.ID, legacy.Algorithm, der, true, time.Now().UTC(), time.Now().UTC()); err != nil {
+		t.Fatal("cannot insert key", err)
+	}
+
+	if _, err := ks.Rotate(app.AlgorithmEdDSA); err != nil {
+		t.Fatal("cannot rotate keys", err)
+	}
+	if err := ks.EncryptKeys(); err != nil {
+		t.Fatal("cannot encrypt keys", err)
+	}
+
+	var plaintext int
+	if err := db.QueryRow("SELECT COUNT(*) FROM signing_keys WHERE private_key IS NOT NULL OR encrypted_private_key IS NULL").Scan(&plaintext); err != nil {
+		t.Fatal("cannot count keys", err)
+	}
+	if plaintext != 0 {
+		t.Fatalf("expected every key to be encrypted but %d aren't", plaintext)
+	}
+
+	keys, err := ks.Keys()
+	if err != nil {
+		t.Fatal("cannot get keys", err)
+	}
+	var found bool
+	for _, k := range keys {
+		if k.ID == legacy.ID {
+			found = k.PrivateKey.(ed25519.PrivateKey).Equal(legacy.PrivateKey)
+		}
+	}
+	if len(keys) != 2 || !found {
+		t.Fatalf("expected both keys to be decrypted but got %v", keys)
+	}
+
+	// the keys can't be read with another encryption key
+	if _, err := NewSigningKeyService(db, []byte("fedcba9876543210fedcba9876543210")).Keys(); err == nil {
+		t.Fatal("expected keys to be unreadable with a wrong encryption key")
+	}
+}
@@ -0,0 +1,290 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/mail"
+	"github.com/leartgjoni/go-rest-template/password"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Ensure service implements interface.
+var _ app.UserService = &UserService{}
+
+// UserService represents a service to manage users. Sessions aren't
+// tracked without Postgres, so tokens stay valid until they expire or the
+// password is changed.
+type UserService struct {
+	db     *DB
+	tokens *keyring.Ring
+
+	Passwords       app.PasswordHasher
+	Policy          app.PasswordPolicy // optional, checked for new passwords
+	Mailer          app.Mailer         // sends email change confirmations
+	ConfirmEmailURL string             // optional, the confirmation token is appended as ?token=
+
+	dummy password.Dummy
+}
+
+// NewUserService returns a new instance of UserService hashing passwords
+// with Argon2id and the default parameters.
+func NewUserService(db *DB, tokens *keyring.Ring) *UserService {
+	return &UserService{
+		db:        db,
+		tokens:    tokens,
+		Passwords: password.NewHasher(password.DefaultParams),
+	}
+}
+
+// CreateToken starts a new session of the user.
+func (s *UserService) CreateToken(userId uint32) (string, error) {
+	return s.tokens.SignSession(userId)
+}
+
+// ExtractAuthenticationToken returns the session of a valid token, unless
+// the user revoked the tokens issued before it by changing their password.
+func (s *UserService) ExtractAuthenticationToken(r *http.Request) (*app.Session, error) {
+	session, err := s.tokens.ParseSession(keyring.BearerToken(r))
+	if err != nil {
+		return nil, err
+	}
+
+	var validAfter *time.Time
+	err = s.db.QueryRow("SELECT tokens_valid_after FROM users WHERE id = ?", session.UserId).Scan(&validAfter)
+	if err == sql.ErrNoRows {
+		return nil, app.ErrWrongCredentials
+	} else if err != nil {
+		return nil, err
+	}
+	if validAfter != nil && validAfter.After(session.CreatedAt) {
+		return nil, app.ErrWrongCredentials
+	}
+
+	return session, nil
+}
+
+func (s *UserService) Save(user *app.User) error {
+	if s.Policy != nil {
+		if err := s.Policy.Validate(user.Password); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := s.Passwords.Hash(user.Password)
+	if err != nil {
+		return app.ErrWrongPasswordFormat
+	}
+
+	// the unique indexes decide who gets the email or username
+	res, err := s.db.Exec("INSERT INTO users (username, email, password, bio, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", user.Username, user.Email, hashedPassword, user.Bio, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return userConstraintError(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return errors.New("unable to save")
+	}
+
+	user.ID = uint32(id)
+	user.Password = hashedPassword
+	return nil
+}
+
+func (s *UserService) GetById(userId uint32) (*app.User, error) {
+	var user app.User
+	err := s.db.QueryRow("SELECT id, username, email, password, bio, created_at, updated_at, is_admin FROM users WHERE id = ?", userId).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Bio, &user.CreatedAt, &user.UpdatedAt, &user.IsAdmin)
+
+	if err != nil || user.ID == 0 {
+		return &app.User{}, app.ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (s *UserService) GetByUsername(username string) (*app.User, error) {
+	var user app.User
+	err := s.db.QueryRow("SELECT id, username, email, password, bio, created_at, updated_at, is_admin FROM users WHERE username = ?", username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Bio, &user.CreatedAt, &user.UpdatedAt, &user.IsAdmin)
+
+	if err != nil || user.ID == 0 {
+		return &app.User{}, app.ErrUserNotFound
+	}
+
+	return &user, nil
+}
+
+func (s *UserService) Update(user *app.User) error {
+	res, err := s.db.Exec("UPDATE users SET username = ?, bio = ?, updated_at = ? WHERE id = ?", user.Username, user.Bio, user.UpdatedAt, user.ID)
+	if err != nil {
+		return userConstraintError(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *UserService) ChangePassword(userId uint32, currentPassword string, newPassword string) (string, error) {
+	var hashedPassword string
+	err := s.db.QueryRow("SELECT password FROM users WHERE id = ?", userId).Scan(&hashedPassword)
+	if err == sql.ErrNoRows {
+		return "", app.ErrUserNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := password.Verify(hashedPassword, currentPassword); err != nil {
+		return "", app.ErrWrongCredentials
+	}
+
+	if s.Policy != nil {
+		if err := s.Policy.Validate(newPassword); err != nil {
+			return "", err
+		}
+	}
+
+	newHash, err := s.Passwords.Hash(newPassword)
+	if err != nil {
+		return "", app.ErrWrongPasswordFormat
+	}
+
+	// tokens carry their issue time in seconds, so the new one mustn't be
+	// older than the cutoff
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := s.db.Exec("UPDATE users SET password = ?, tokens_valid_after = ?, updated_at = ? WHERE id = ?", newHash, now, now, userId); err != nil {
+		return "", err
+	}
+
+	return s.CreateToken(userId)
+}
+
+func (s *UserService) RequestEmailChange(userId uint32, email string, plain string) error {
+	if s.Mailer == nil {
+		return errors.New("email changes need a mailer")
+	}
+
+	user, err := s.GetById(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := password.Verify(user.Password, plain); err != nil {
+		return app.ErrWrongCredentials
+	}
+
+	if err := s.checkEmailAvailable(email); err != nil {
+		return err
+	}
+
+	token, err := s.tokens.SignEmailChange(userId, email, user.Email)
+	if err != nil {
+		return err
+	}
+	return mail.SendEmailChange(s.Mailer, email, user.Username, token, s.ConfirmEmailURL)
+}
+
+// ConfirmEmailChange applies a change requested with RequestEmailChange. A
+// token only works once, as long as the email hasn't changed meanwhile.
+func (s *UserService) ConfirmEmailChange(userId uint32, tokenString string) error {
+	email, from, err := s.tokens.ParseEmailChange(tokenString, userId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkEmailAvailable(email); err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec("UPDATE users SET email = ?, updated_at = ? WHERE id = ? AND email = ?", email, time.Now(), userId, from)
+	if err != nil {
+		// taken since the check above
+		return userConstraintError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return app.ErrInvalidEmailChange
+	}
+
+	var username string
+	if err := s.db.QueryRow("SELECT username FROM users WHERE id = ?", userId).Scan(&username); err != nil {
+		return err
+	}
+
+	// let the previous address know, in case the account was taken over
+	if s.Mailer != nil {
+		if err := mail.SendEmailChanged(s.Mailer, from, username, email); err != nil {
+			log.Printf("cannot send email change notification to user %d: %s", userId, err)
+		}
+	}
+	return nil
+}
+
+func (s *UserService) checkEmailAvailable(email string) error {
+	count := 0
+	if err := s.db.QueryRow("SELECT COUNT(id) FROM users WHERE LOWER(email) = LOWER(?)", email).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return app.ErrEmailAlreadyUsed
+	}
+	return nil
+}
+
+func (s *UserService) Login(u *app.User) (string, error) {
+	// long passwords would take long to hash, whether the email is known or not
+	if s.Policy != nil && s.Policy.TooLong(u.Password) {
+		return "", app.ErrWrongCredentials
+	}
+
+	var user app.User
+	err := s.db.QueryRow("SELECT id, username, password, created_at, updated_at, is_admin FROM users WHERE LOWER(email) = LOWER(?) LIMIT 1", u.Email).Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.IsAdmin)
+
+	if err != nil || user.ID == 0 {
+		// hash anyway, so unknown emails take as long as wrong passwords
+		_ = s.Passwords.Verify(s.dummy.Hash(s.Passwords), u.Password)
+		return "", app.ErrWrongCredentials
+	}
+	if err := s.Passwords.Verify(user.Password, u.Password); err != nil {
+		return "", app.ErrWrongCredentials
+	}
+
+	if s.Passwords.NeedsRehash(user.Password) {
+		user.Password = s.rehash(user.ID, user.Password, u.Password)
+	}
+
+	u.ID = user.ID
+	u.Username = user.Username
+	u.Password = user.Password
+	u.CreatedAt = user.CreatedAt
+	u.UpdatedAt = user.UpdatedAt
+	u.IsAdmin = user.IsAdmin
+
+	return s.CreateToken(u.ID)
+}
+
+// rehash upgrades the hash of a password that was just verified, returning
+// the new hash. Failing to do so doesn't fail the login.
+func (s *UserService) rehash(userId uint32, oldHash string, plain string) string {
+	return password.Rehash(s.Passwords, userId, oldHash, plain, func(newHash string) (bool, error) {
+		// unless the password was changed meanwhile
+		res, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", newHash, userId, oldHash)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		return n == 1, err
+	})
+}
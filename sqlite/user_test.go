@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/keyring"
+	"github.com/leartgjoni/go-rest-template/password"
+	"testing"
+)
+
+// newTestUserService returns a service with cheap password hashes and its
+// own signing key.
+func newTestUserService(t *testing.T, db *DB) *UserService {
+	ks := NewSigningKeyService(db, testEncryptionKey)
+	if _, err := ks.Rotate(app.AlgorithmEdDSA); err != nil {
+		t.Fatal("cannot create signing key", err)
+	}
+
+	us := NewUserService(db, keyring.New(ks))
+	us.Passwords = password.NewHasher(password.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	return us
+}
@@ -0,0 +1,161 @@
+// Package stream fans the events of the outbox out to the clients streaming
+// them, e.g. over server-sent events.
+//
+// Every instance runs a Broker, fed by a listener on the database, so events
+// reach clients connected to any instance. Clients resume after the last
+// event they received, as long as the broker still buffers it.
+package stream
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"sync"
+)
+
+// Defaults of NewBroker.
+const (
+	DefaultBufferSize     = 1024
+	DefaultSubscriberSize = 64
+)
+
+// Broker keeps the latest events in a bounded buffer and sends new ones to
+// its subscribers. Subscribers that don't keep up are dropped rather than
+// slowing down the others; they resume from the buffer.
+type Broker struct {
+	SubscriberSize int // events a subscriber may fall behind by
+
+	mu     sync.Mutex
+	buf    []*app.Event // ring of the latest events, in publish order
+	start  int          // index of the oldest event in buf
+	n      int          // number of events in buf
+	ids    map[int64]bool
+	subs   map[*subscription]bool
+	closed bool
+}
+
+// NewBroker returns a broker buffering the latest size events.
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	return &Broker{
+		SubscriberSize: DefaultSubscriberSize,
+		buf:            make([]*app.Event, size),
+		ids:            map[int64]bool{},
+		subs:           map[*subscription]bool{},
+	}
+}
+
+var _ app.EventBroker = &Broker{}
+
+// Publish buffers e and sends it to the subscribers. Events already buffered
+// are ignored, so they may be published again, e.g. when catching up.
+func (b *Broker) Publish(e *app.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.ids[e.ID] {
+		return
+	}
+
+	if b.n == len(b.buf) {
+		delete(b.ids, b.buf[b.start].ID)
+		b.buf[b.start] = e
+		b.start = (b.start + 1) % len(b.buf)
+	} else {
+		b.buf[(b.start+b.n)%len(b.buf)] = e
+		b.n++
+	}
+	b.ids[e.ID] = true
+
+	for sub := range b.subs {
+		select {
+		case sub.events <- e:
+		default:
+			// it fell behind, and resumes when it reconnects
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe replays the events published after the one with lastId, then
+// sends new ones. Ids are only unique, events are published in the order
+// their transactions committed, so the events replayed are the ones after
+// lastId in the buffer rather than those with larger ids.
+func (b *Broker) Subscribe(lastId int64) (app.EventSubscription, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []*app.Event
+	missed := false
+	if lastId != 0 {
+		i := b.index(lastId)
+		if i < 0 {
+			// replay everything we have, the client missed events anyway
+			i, missed = -1, true
+		}
+		for j := i + 1; j < b.n; j++ {
+			replay = append(replay, b.buf[(b.start+j)%len(b.buf)])
+		}
+	}
+
+	sub := &subscription{broker: b, events: make(chan *app.Event, len(replay)+b.SubscriberSize)}
+	for _, e := range replay {
+		sub.events <- e
+	}
+	if b.closed {
+		close(sub.events)
+		return sub, missed
+	}
+	b.subs[sub] = true
+	return sub, missed
+}
+
+// Close closes the subscriptions, ending their streams.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// index returns the position of the event with id from the oldest one, or
+// -1 if it isn't buffered.
+func (b *Broker) index(id int64) int {
+	if !b.ids[id] {
+		return -1
+	}
+	for i := 0; i < b.n; i++ {
+		if b.buf[(b.start+i)%len(b.buf)].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove closes sub unless it's been removed already. b.mu must be held.
+func (b *Broker) remove(sub *subscription) {
+	if !b.subs[sub] {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.events)
+}
+
+type subscription struct {
+	broker *Broker
+	events chan *app.Event
+}
+
+func (s *subscription) Events() <-chan *app.Event {
+	return s.events
+}
+
+func (s *subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	app "github.com/leartgjoni/go-rest-template"
+	"reflect"
+	"testing"
+)
+
+// received returns the ids of the events buffered for sub.
+func received(sub app.EventSubscription) []int64 {
+	ids := []int64{}
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return ids
+			}
+			ids = append(ids, e.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestBroker_Subscribe(t *testing.T) {
+	b := NewBroker(3)
+	// ids aren't in commit order
+	for _, id := range []int64{1, 3, 2, 4} {
+		b.Publish(&app.Event{ID: id})
+	}
+
+	var tests = []struct {
+		name     string
+		lastId   int64
+		expected []int64
+		missed   bool
+	}{
+		{name: "new events only", lastId: 0, expected: []int64{}},
+		{name: "resume", lastId: 3, expected: []int64{2, 4}},
+		{name: "up to date", lastId: 4, expected: []int64{}},
+		{name: "no longer buffered", lastId: 1, expected: []int64{3, 2, 4}, missed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, missed := b.Subscribe(test.lastId)
+			defer sub.Close()
+
+			if missed != test.missed {
+				t.Fatalf("expected missed to be %v", test.missed)
+			}
+			if ids := received(sub); !reflect.DeepEqual(ids, test.expected) {
+				t.Fatalf("wrong events. expected %v but got %v", test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	b := NewBroker(10)
+	b.SubscriberSize = 2
+
+	fast, _ := b.Subscribe(0)
+	slow, _ := b.Subscribe(0)
+
+	b.Publish(&app.Event{ID: 1})
+	b.Publish(&app.Event{ID: 1}) // published again, e.g. when catching up
+	b.Publish(&app.Event{ID: 2})
+	if ids := received(fast); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Fatalf("wrong events. expected %v but got %v", []int64{1, 2}, ids)
+	}
+
+	// the slow subscriber is dropped once it falls behind
+	b.Publish(&app.Event{ID: 3})
+	if ids := received(fast); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Fatalf("wrong events. expected %v but got %v", []int64{3}, ids)
+	}
+	if ids := received(slow); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Fatalf("wrong events. expected %v but got %v", []int64{1, 2}, ids)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("expected the slow subscription to be closed")
+	}
+
+	// and resumes where it stopped
+	resumed, missed := b.Subscribe(2)
+	if ids := received(resumed); missed || !reflect.DeepEqual(ids, []int64{3}) {
+		t.Fatalf("wrong events. expected %v but got %v", []int64{3}, ids)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker(10)
+	sub, _ := b.Subscribe(0)
+	sub.Close()
+	sub.Close() // closing twice is fine
+
+	other, _ := b.Subscribe(0)
+	b.Close()
+	if _, ok := <-other.Events(); ok {
+		t.Fatal("expected the subscription to be closed")
+	}
+	other.Close()
+
+	// nothing is published after closing
+	b.Publish(&app.Event{ID: 1})
+	late, _ := b.Subscribe(0)
+	if _, ok := <-late.Events(); ok {
+		t.Fatal("expected the subscription to be closed")
+	}
+}
@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	var tests = []struct {
+		time     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := Code(secret, Step(time.Unix(test.time, 0)))
+		if err != nil {
+			t.Fatal("cannot generate code", err)
+		}
+		if code != test.expected {
+			t.Errorf("wrong code at %v. expected %s but got %s", test.time, test.expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal("cannot generate secret", err)
+	}
+
+	now := time.Unix(1600000000, 0)
+
+	var tests = []struct {
+		name  string
+		at    time.Time
+		valid bool
+	}{
+		{"current step", now, true},
+		{"previous step", now.Add(-Period), true},
+		{"next step", now.Add(Period), true},
+		{"too old", now.Add(-2 * Period), false},
+		{"too new", now.Add(2 * Period), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := Code(secret, Step(test.at))
+			if err != nil {
+				t.Fatal("cannot generate code", err)
+			}
+
+			step, ok := Validate(secret, code, now)
+			if ok != test.valid {
+				t.Fatalf("expected valid to be %v", test.valid)
+			}
+			if ok && step != Step(test.at) {
+				t.Fatalf("wrong step. expected %v but got %v", Step(test.at), step)
+			}
+		})
+	}
+
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Fatal("short code should not validate")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("go-rest-template", "test@test.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/go-rest-template:test@test.com?") ||
+		!strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") ||
+		!strings.Contains(uri, "issuer=go-rest-template") {
+		t.Fatalf("wrong uri %s", uri)
+	}
+}
@@ -0,0 +1,19 @@
+package app
+
+// TOTPEnrollment holds what a user needs to register an authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorService interface {
+	Enroll(userId uint32) (*TOTPEnrollment, error)
+	Confirm(userId uint32, code string) ([]string, error)
+	Disable(userId uint32, password string, code string) error
+	CreateChallenge(userId uint32) (string, error)
+	// ChallengeUser returns the user a challenge was issued for.
+	ChallengeUser(challenge string) (uint32, error)
+	// VerifyChallenge uses up a challenge, returning its user, if code is
+	// correct. A challenge allows a few attempts.
+	VerifyChallenge(challenge string, code string) (uint32, error)
+}
@@ -0,0 +1,17 @@
+package app
+
+// Services are the services taking part in a unit of work.
+type Services struct {
+	Users    UserService
+	Articles ArticleService
+	APIKeys  APIKeyService
+	Audit    AuditLog
+}
+
+// UnitOfWork makes writes through several services atomic.
+type UnitOfWork interface {
+	// Do runs fn with services whose writes are committed together if fn
+	// returns nil, and discarded otherwise. fn may run more than once when
+	// it conflicts with concurrent writes.
+	Do(fn func(s *Services) error) error
+}
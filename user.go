@@ -10,14 +10,38 @@ type User struct {
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
 	Password  string    `json:"password"`
+	Bio       string    `json:"bio"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	IsAdmin   bool      `json:"is_admin,omitempty"`
 }
 
 type UserService interface {
 	CreateToken(userId uint32) (string, error)
-	ExtractAuthenticationToken(r *http.Request) (uint32, error)
+	// ExtractAuthenticationToken returns the session the request's token
+	// belongs to. Whether the session has been revoked is up to the
+	// SessionService, where there is one.
+	ExtractAuthenticationToken(r *http.Request) (*Session, error)
 	Save(user *User) error
 	GetById(userId uint32) (*User, error)
+	GetByUsername(username string) (*User, error)
 	Login(u *User) (string, error)
+
+	// Update saves the user's username and bio.
+	Update(user *User) error
+	// ChangePassword signs out every other session of the user and returns
+	// a new token for the current one.
+	ChangePassword(userId uint32, currentPassword string, newPassword string) (string, error)
+	// RequestEmailChange mails a confirmation token to the new address. The
+	// email only changes once it is confirmed with ConfirmEmailChange.
+	RequestEmailChange(userId uint32, email string, password string) error
+	ConfirmEmailChange(userId uint32, token string) error
+}
+
+// PrimaryUsers is implemented by user services that may read from replicas
+// lagging behind the primary.
+type PrimaryUsers interface {
+	// FromPrimary returns the service reading from the primary, e.g. for a
+	// user who just wrote and has to read their writes.
+	FromPrimary() UserService
 }
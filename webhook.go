@@ -0,0 +1,73 @@
+package app
+
+import "time"
+
+// Webhook subscribes an endpoint to events. Deliveries are signed with
+// Secret, see the webhook package.
+type Webhook struct {
+	ID          uint32    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`                 // subscribes to all events if empty
+	WorkspaceId uint32    `json:"workspace_id,omitempty"` // 0 subscribes to the events of every workspace
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // attempts ran out
+)
+
+// WebhookDelivery is an event on its way to a webhook.
+type WebhookDelivery struct {
+	ID            int64     `json:"id"`
+	Webhook       *Webhook  `json:"-"`
+	Event         *Event    `json:"event"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	Log []*WebhookAttempt `json:"log,omitempty"` // set by WebhookService.Deliveries
+}
+
+// WebhookAttempt logs an attempt to deliver an event.
+type WebhookAttempt struct {
+	ID         int64     `json:"id"`
+	DeliveryId int64     `json:"delivery_id"`
+	StatusCode int       `json:"status_code,omitempty"` // 0 if no response came
+	Error      string    `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookService manages webhook subscriptions.
+type WebhookService interface {
+	Create(w *Webhook) error
+	Get(id uint32) (*Webhook, error)
+	List() ([]*Webhook, error)
+	Update(w *Webhook) error
+	Delete(id uint32) error
+	// Deliveries returns the latest deliveries of a webhook, with the log of
+	// their attempts.
+	Deliveries(webhookId uint32, limit int) ([]*WebhookDelivery, error)
+}
+
+// WebhookQueue is the queue deliveries are worked off from.
+type WebhookQueue interface {
+	// Claim queues the new events of the outbox for their webhooks, and
+	// returns up to limit deliveries that are due. They aren't claimed
+	// again for lease, so other instances don't deliver them too.
+	Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	// Record logs an attempt, and saves the status, attempts, next attempt
+	// and last error of its delivery.
+	Record(d *WebhookDelivery, a *WebhookAttempt) error
+	// Purge deletes events whose deliveries all finished before the
+	// retention period, with the deliveries, returning how many were deleted.
+	Purge() (int, error)
+}
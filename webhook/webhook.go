@@ -0,0 +1,226 @@
+// Package webhook delivers the events of the outbox to webhooks.
+//
+// Each delivery is a POST of the event as JSON. Receivers verify it came
+// from us with the X-Webhook-Signature header: "sha256=" and the hex encoded
+// HMAC-SHA256, keyed with the webhook secret, of the X-Webhook-Timestamp
+// header, a dot and the body. Deliveries are at least once, receivers can
+// tell retries apart with X-Webhook-Id, the id of the event.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	app "github.com/leartgjoni/go-rest-template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of deliveries.
+const (
+	IdHeader        = "X-Webhook-Id"
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Defaults of NewDispatcher.
+const (
+	DefaultMaxAttempts = 10
+	DefaultMinBackoff  = 10 * time.Second
+	DefaultMaxBackoff  = 6 * time.Hour
+)
+
+// maxErrorLength bounds the response bodies kept in delivery logs.
+const maxErrorLength = 1024
+
+// Sign returns the signature of a delivery.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher polls the queue for deliveries that are due and delivers them.
+// Failed deliveries are retried with exponential backoff, until they run out
+// of attempts and are dead-lettered.
+type Dispatcher struct {
+	Queue  app.WebhookQueue
+	Client *http.Client
+
+	Interval    time.Duration // between polls of an empty queue
+	BatchSize   int           // deliveries claimed at once
+	Concurrency int           // deliveries in flight at once
+	MaxAttempts int
+	MinBackoff  time.Duration // before the first retry, doubling for every next one
+	MaxBackoff  time.Duration
+
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewDispatcher returns a new instance of Dispatcher.
+func NewDispatcher(q app.WebhookQueue) *Dispatcher {
+	return &Dispatcher{
+		Queue:       q,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Interval:    time.Second,
+		BatchSize:   50,
+		Concurrency: 8,
+		MaxAttempts: DefaultMaxAttempts,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+}
+
+// Start polls the queue until Close is called.
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.stopped = make(chan struct{})
+
+	go func() {
+		defer close(d.stopped)
+		for {
+			n, err := d.Dispatch(ctx)
+			if err != nil {
+				log.Printf("cannot dispatch webhooks: %s", err)
+			}
+			// a full batch means more are likely due
+			if err == nil && n == d.BatchSize {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.Interval):
+			}
+		}
+	}()
+}
+
+// Close stops polling and cancels deliveries in flight. Their lease runs out
+// and they are delivered again, by this or another instance.
+func (d *Dispatcher) Close() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.stopped
+}
+
+// Dispatch claims the deliveries that are due and delivers them, returning
+// how many were claimed.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	// the lease outlasts every attempt of the batch
+	lease := d.Client.Timeout*time.Duration(d.BatchSize/d.Concurrency+1) + time.Minute
+	deliveries, err := d.Queue.Claim(d.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	sem := make(chan struct{}, d.Concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(delivery *app.WebhookDelivery) {
+			defer func() { <-sem; wg.Done() }()
+			d.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *app.WebhookDelivery) {
+	start := time.Now()
+	statusCode, err := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		return
+	}
+
+	attempt := &app.WebhookAttempt{
+		StatusCode: statusCode,
+		DurationMs: int(time.Since(start) / time.Millisecond),
+		CreatedAt:  time.Now(),
+	}
+	delivery.Attempts++
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = app.DeliveryDelivered
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = app.DeliveryDead
+	default:
+		delivery.NextAttemptAt = attempt.CreatedAt.Add(d.backoff(delivery.Attempts))
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		delivery.LastError = attempt.Error
+	}
+
+	if err := d.Queue.Record(delivery, attempt); err != nil {
+		log.Printf("cannot record delivery %d of webhook %d: %s", delivery.ID, delivery.Webhook.ID, err)
+	}
+}
+
+// post returns the status code of the response, and an error unless it's
+// a 2xx.
+func (d *Dispatcher) post(ctx context.Context, delivery *app.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdHeader, strconv.FormatInt(delivery.Event.ID, 10))
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Webhook.Secret, timestamp, body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d: %s", res.StatusCode, bytes.TrimSpace(b))
+	}
+	return res.StatusCode, nil
+}
+
+// backoff returns how long to wait before the next attempt, after attempts
+// failed ones.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.MinBackoff
+	for i := 1; i < attempts && backoff < d.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.MaxBackoff {
+		backoff = d.MaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"context"
+	app "github.com/leartgjoni/go-rest-template"
+	"github.com/leartgjoni/go-rest-template/mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"id":1}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+	if received := Sign("secret", 1700000000, []byte(`{"id":1}`)); received != expected {
+		t.Fatalf("wrong signature. expected %s but got %s", expected, received)
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	var tests = []struct {
+		name             string
+		status           int
+		attempts         int
+		expectedStatus   string
+		expectedAttempts int
+		expectedBackoff  time.Duration
+		expectedError    string
+	}{
+		{name: "delivered", status: http.StatusNoContent, expectedStatus: app.DeliveryDelivered, expectedAttempts: 1},
+		{name: "retried", status: http.StatusInternalServerError, attempts: 2, expectedStatus: app.DeliveryPending, expectedAttempts: 3, expectedBackoff: 4 * time.Second, expectedError: "unexpected status 500: down"},
+		{name: "dead", status: http.StatusInternalServerError, attempts: 4, expectedStatus: app.DeliveryDead, expectedAttempts: 5, expectedError: "unexpected status 500: down"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received *http.Request
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte("down\n"))
+			}))
+			defer srv.Close()
+
+			delivery := &app.WebhookDelivery{
+				ID:       1,
+				Webhook:  &app.Webhook{ID: 2, URL: srv.URL, Secret: "secret", Active: true},
+				Event:    &app.Event{ID: 3, Type: app.EventArticleCreated, WorkspaceId: 1, Data: []byte(`{"slug":"hello"}`), CreatedAt: time.Unix(0, 0).UTC()},
+				Status:   app.DeliveryPending,
+				Attempts: test.attempts,
+			}
+
+			var q mock.WebhookQueue
+			q.ClaimFn = func(limit int, lease time.Duration) ([]*app.WebhookDelivery, error) {
+				return []*app.WebhookDelivery{delivery}, nil
+			}
+			var recorded *app.WebhookAttempt
+			q.RecordFn = func(d *app.WebhookDelivery, a *app.WebhookAttempt) error {
+				recorded = a
+				return nil
+			}
+
+			d := NewDispatcher(&q)
+			d.MaxAttempts = 5
+			d.MinBackoff = time.Second
+
+			n, err := d.Dispatch(context.Background())
+			if err != nil || n != 1 {
+				t.Fatalf("wrong result. expected 1 delivery but got %d, %v", n, err)
+			}
+
+			// the delivery is signed
+			expectedBody := `{"id":3,"type":"article.created","workspace_id":1,"data":{"slug":"hello"},"created_at":"1970-01-01T00:00:00Z"}`
+			if string(body) != expectedBody {
+				t.Fatalf("expected %s but received %s", expectedBody, body)
+			}
+			timestamp, _ := strconv.ParseInt(received.Header.Get(TimestampHeader), 10, 64)
+			if received.Header.Get(SignatureHeader) != Sign("secret", timestamp, body) {
+				t.Fatalf("wrong signature %s", received.Header.Get(SignatureHeader))
+			}
+			if received.Header.Get(IdHeader) != "3" || received.Header.Get(EventHeader) != app.EventArticleCreated {
+				t.Fatalf("wrong headers %v", received.Header)
+			}
+
+			if !q.RecordInvoked || recorded.StatusCode != test.status || recorded.Error != test.expectedError {
+				t.Fatalf("wrong attempt %+v", recorded)
+			}
+			if delivery.Status != test.expectedStatus || delivery.Attempts != test.expectedAttempts || delivery.LastError != test.expectedError {
+				t.Fatalf("wrong delivery %+v", delivery)
+			}
+			if test.expectedBackoff != 0 && !delivery.NextAttemptAt.Equal(recorded.CreatedAt.Add(test.expectedBackoff)) {
+				t.Fatalf("wrong next attempt. expected %s but got %s", recorded.CreatedAt.Add(test.expectedBackoff), delivery.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	// the receiver hangs until the dispatcher is closed
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	claimed := make(chan struct{}, 1)
+	var q mock.WebhookQueue
+	q.ClaimFn = func(limit int, lease time.Duration) ([]*app.WebhookDelivery, error) {
+		select {
+		case claimed <- struct{}{}:
+			return []*app.WebhookDelivery{{ID: 1, Webhook: &app.Webhook{URL: srv.URL}, Event: &app.Event{}}}, nil
+		default:
+			return nil, nil
+		}
+	}
+	q.RecordFn = func(d *app.WebhookDelivery, a *app.WebhookAttempt) error {
+		t.Fatal("expected the cancelled delivery not to be recorded")
+		return nil
+	}
+
+	d := NewDispatcher(&q)
+	d.Start()
+	<-claimed
+	d.Close()
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{MinBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+
+	for attempts, expected := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 20: time.Minute} {
+		if received := d.backoff(attempts); received != expected {
+			t.Fatalf("wrong backoff after %d attempts. expected %s but got %s", attempts, expected, received)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import "time"
+
+// Workspace isolates the articles of a team. Articles created before
+// workspaces existed belong to the default one.
+type Workspace struct {
+	ID        uint32    `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultWorkspaceId is the workspace of requests not naming one.
+const DefaultWorkspaceId = 1
+
+// Membership gives a user a role in a workspace.
+type Membership struct {
+	WorkspaceId uint32    `json:"workspace_id"`
+	UserId      uint32    `json:"user_id"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Workspace roles, each allowed what the ones after it are.
+const (
+	RoleOwner  = "owner"  // manages members
+	RoleEditor = "editor" // writes articles
+	RoleViewer = "viewer"
+)
+
+// Roles lists the roles, most privileged first.
+var Roles = []string{RoleOwner, RoleEditor, RoleViewer}
+
+// HasRole reports whether the membership's role allows what role does.
+func (m *Membership) HasRole(role string) bool {
+	for _, r := range Roles {
+		if r == m.Role {
+			return true
+		}
+		if r == role {
+			return false
+		}
+	}
+	return false
+}
+
+type WorkspaceService interface {
+	// Create saves a workspace with the user as its owner.
+	Create(w *Workspace, ownerId uint32) error
+	GetBySlug(slug string) (*Workspace, error)
+	// List returns the workspaces the user is a member of.
+	List(userId uint32) ([]*Workspace, error)
+
+	Membership(workspaceId uint32, userId uint32) (*Membership, error)
+	Members(workspaceId uint32) ([]*Membership, error)
+	// SetMember adds a member, or changes their role.
+	SetMember(m *Membership) error
+	// RemoveMember removes a member, but not the last owner.
+	RemoveMember(workspaceId uint32, userId uint32) error
+}
+
+// WorkspaceArticles scopes an article service to a workspace, so it neither
+// finds nor changes articles of others.
+type WorkspaceArticles interface {
+	InWorkspace(workspaceId uint32) ArticleService
+}
+
+// WorkspaceTrash scopes a trash service to a workspace, like
+// WorkspaceArticles.
+type WorkspaceTrash interface {
+	InWorkspace(workspaceId uint32) ArticleTrashService
+}